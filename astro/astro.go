@@ -0,0 +1,139 @@
+// Package astro computes where the sun and the moon are in the sky of an observer, offline.
+//
+// The sun follows the low precision formulas of the Astronomical Almanac, good to about 0.01°,
+// and the moon the main periodic terms of Meeus' "Astronomical Algorithms", good to about an
+// arcminute. The earth is a sphere and refraction is ignored: near the horizon it lifts an
+// aircraft about as much as the body behind it.
+package astro
+
+import (
+	"math"
+	"time"
+
+	"github.com/carlo-colombo/sopra/haversine"
+)
+
+const (
+	earthRadiusKm = 6371.0
+	auKm          = 149597870.7
+	sunRadiusKm   = 696000.0
+	moonRadiusKm  = 1737.4
+)
+
+// Position is the direction of a body in the sky of an observer and the size of its disk.
+type Position struct {
+	Azimuth   float64 // degrees clockwise from north
+	Elevation float64 // degrees above the horizon
+	Radius    float64 // apparent radius of the disk, arcminutes
+}
+
+// Sun returns the position of the sun at t for an observer at lat, lon (degrees) and alt (meters above sea level).
+func Sun(t time.Time, lat, lon, alt float64) Position {
+	d := daysSinceJ2000(t)
+	g := haversine.DegToRad(357.529 + 0.98560028*d)  // mean anomaly
+	q := 280.459 + 0.98564736*d                      // mean longitude
+	l := q + 1.915*math.Sin(g) + 0.020*math.Sin(2*g) // ecliptic longitude
+	r := (1.00014 - 0.01671*math.Cos(g) - 0.00014*math.Cos(2*g)) * auKm
+	return horizontal(t, lat, lon, alt, l, 0, r, sunRadiusKm)
+}
+
+// Moon returns the position of the moon at t for an observer at lat, lon (degrees) and alt (meters above sea level).
+// The parallax, up to a degree, is taken into account.
+func Moon(t time.Time, lat, lon, alt float64) Position {
+	T := daysSinceJ2000(t) / 36525
+	lm := 218.3164477 + 481267.88123421*T                    // mean longitude
+	D := haversine.DegToRad(297.8501921 + 445267.1114034*T)  // mean elongation
+	M := haversine.DegToRad(357.5291092 + 35999.0502909*T)   // sun mean anomaly
+	Mm := haversine.DegToRad(134.9633964 + 477198.8675055*T) // moon mean anomaly
+	F := haversine.DegToRad(93.2720950 + 483202.0175233*T)   // argument of latitude
+	E := 1 - 0.002516*T                                      // eccentricity of the earth orbit, scaling the terms in M
+
+	l := lm +
+		6.288774*math.Sin(Mm) +
+		1.274027*math.Sin(2*D-Mm) +
+		0.658314*math.Sin(2*D) +
+		0.213618*math.Sin(2*Mm) -
+		0.185116*E*math.Sin(M) -
+		0.114332*math.Sin(2*F) +
+		0.058793*math.Sin(2*D-2*Mm) +
+		0.057066*E*math.Sin(2*D-M-Mm) +
+		0.053322*math.Sin(2*D+Mm) +
+		0.045758*E*math.Sin(2*D-M) -
+		0.040923*E*math.Sin(M-Mm) -
+		0.034720*math.Sin(D) -
+		0.030383*E*math.Sin(M+Mm) +
+		0.015327*math.Sin(2*D-2*F) -
+		0.012528*math.Sin(Mm+2*F) +
+		0.010980*math.Sin(Mm-2*F)
+	b := 5.128122*math.Sin(F) +
+		0.280602*math.Sin(Mm+F) +
+		0.277693*math.Sin(Mm-F) +
+		0.173237*math.Sin(2*D-F) +
+		0.055413*math.Sin(2*D-Mm+F) +
+		0.046271*math.Sin(2*D-Mm-F) +
+		0.032573*math.Sin(2*D+F) +
+		0.017198*math.Sin(2*Mm+F) +
+		0.009266*math.Sin(2*D+Mm-F) +
+		0.008822*math.Sin(2*Mm-F)
+	r := 385000.56 -
+		20905.355*math.Cos(Mm) -
+		3699.111*math.Cos(2*D-Mm) -
+		2955.968*math.Cos(2*D) -
+		569.925*math.Cos(2*Mm) +
+		48.888*E*math.Cos(M) -
+		3.149*math.Cos(2*F) +
+		246.158*math.Cos(2*D-2*Mm) -
+		152.138*E*math.Cos(2*D-M-Mm) -
+		170.733*math.Cos(2*D+Mm) -
+		204.586*E*math.Cos(2*D-M) -
+		129.620*E*math.Cos(M-Mm) +
+		108.743*math.Cos(D) +
+		104.755*E*math.Cos(M+Mm)
+	return horizontal(t, lat, lon, alt, l, b, r, moonRadiusKm)
+}
+
+// Separation returns the angle in degrees between two directions of the sky.
+func Separation(az1, el1, az2, el2 float64) float64 {
+	el1, el2 = haversine.DegToRad(el1), haversine.DegToRad(el2)
+	dAz := haversine.DegToRad(az2 - az1)
+	// Haversine formula, accurate for the small angles of a transit
+	h := math.Pow(math.Sin((el2-el1)/2), 2) + math.Cos(el1)*math.Cos(el2)*math.Pow(math.Sin(dAz/2), 2)
+	return haversine.RadToDeg(2 * math.Asin(math.Min(1, math.Sqrt(h))))
+}
+
+// horizontal converts the ecliptic longitude and latitude (degrees) and the distance (km) of a body
+// to its topocentric position for the observer.
+func horizontal(t time.Time, lat, lon, alt, eclLon, eclLat, distance, radius float64) Position {
+	d := daysSinceJ2000(t)
+	eps := haversine.DegToRad(23.439291 - 0.0130042*d/36525) // obliquity of the ecliptic
+	l, b := haversine.DegToRad(eclLon), haversine.DegToRad(eclLat)
+
+	// Geocentric equatorial coordinates of the body
+	x := distance * math.Cos(b) * math.Cos(l)
+	y := distance * (math.Cos(b)*math.Sin(l)*math.Cos(eps) - math.Sin(b)*math.Sin(eps))
+	z := distance * (math.Cos(b)*math.Sin(l)*math.Sin(eps) + math.Sin(b)*math.Cos(eps))
+
+	// Seen from the observer, at its local sidereal time
+	phi := haversine.DegToRad(lat)
+	theta := haversine.DegToRad(280.46061837 + 360.98564736629*d + lon)
+	r := earthRadiusKm + alt/1000
+	x -= r * math.Cos(phi) * math.Cos(theta)
+	y -= r * math.Cos(phi) * math.Sin(theta)
+	z -= r * math.Sin(phi)
+
+	east := -math.Sin(theta)*x + math.Cos(theta)*y
+	north := -math.Sin(phi)*math.Cos(theta)*x - math.Sin(phi)*math.Sin(theta)*y + math.Cos(phi)*z
+	up := math.Cos(phi)*math.Cos(theta)*x + math.Cos(phi)*math.Sin(theta)*y + math.Sin(phi)*z
+	rng := math.Sqrt(x*x + y*y + z*z)
+
+	return Position{
+		Azimuth:   math.Mod(haversine.RadToDeg(math.Atan2(east, north))+360, 360),
+		Elevation: haversine.RadToDeg(math.Asin(up / rng)),
+		Radius:    haversine.RadToDeg(math.Asin(radius/rng)) * 60,
+	}
+}
+
+// daysSinceJ2000 returns the days elapsed from 2000-01-01 12:00 UTC to t.
+func daysSinceJ2000(t time.Time) float64 {
+	return float64(t.UnixNano())/float64(24*time.Hour) - 10957.5
+}
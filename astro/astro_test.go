@@ -0,0 +1,55 @@
+package astro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSun(t *testing.T) {
+	// Solar noon of the June solstice in Zurich: 90° - latitude + obliquity
+	pos := Sun(time.Date(2024, 6, 20, 11, 27, 0, 0, time.UTC), 47.3769, 8.5417, 400)
+	assert.InDelta(t, 180, pos.Azimuth, 0.5)
+	assert.InDelta(t, 90-47.3769+23.44, pos.Elevation, 0.05)
+	assert.InDelta(t, 15.74, pos.Radius, 0.01, "the sun is the smallest in July")
+
+	// Sunrise at the equator on the March equinox, due east
+	pos = Sun(time.Date(2024, 3, 20, 6, 7, 0, 0, time.UTC), 0, 0, 0)
+	assert.InDelta(t, 90, pos.Azimuth, 0.5)
+	assert.InDelta(t, 0, pos.Elevation, 0.5)
+}
+
+func TestMoon(t *testing.T) {
+	// The sun and the moon overlap at the point of greatest eclipse of total solar eclipses
+	tests := []struct {
+		name     string
+		time     time.Time
+		lat, lon float64
+	}{
+		{"2017-08-21", time.Date(2017, 8, 21, 18, 25, 32, 0, time.UTC), 36.97, -87.67},
+		{"2024-04-08", time.Date(2024, 4, 8, 18, 17, 20, 0, time.UTC), 25.29, -104.14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sun := Sun(tt.time, tt.lat, tt.lon, 0)
+			moon := Moon(tt.time, tt.lat, tt.lon, 0)
+			assert.Less(t, Separation(sun.Azimuth, sun.Elevation, moon.Azimuth, moon.Elevation)*60, 2.0, "arcminutes")
+			assert.Greater(t, moon.Radius, sun.Radius, "the eclipse is total")
+		})
+	}
+
+	// The parallax lowers the moon, by a third of a degree at 70° of elevation
+	at := time.Date(2024, 4, 8, 18, 17, 20, 0, time.UTC)
+	fromSurface := Moon(at, 25.29, -104.14, 0)
+	fromCenter := Moon(at, 25.29, -104.14, -earthRadiusKm*1000)
+	assert.InDelta(t, 0.33, fromCenter.Elevation-fromSurface.Elevation, 0.03)
+	assert.InDelta(t, 15.5, fromSurface.Radius, 1.5)
+}
+
+func TestSeparation(t *testing.T) {
+	assert.InDelta(t, 0, Separation(120, 30, 120, 30), 1e-9)
+	assert.InDelta(t, 1, Separation(120, 30, 120, 31), 1e-9)
+	assert.InDelta(t, 0.5, Separation(359.5, 60, 0.5, 60), 1e-3, "one degree of azimuth at 60° of elevation, across north")
+	assert.InDelta(t, 90, Separation(0, 0, 270, 90), 1e-9)
+}
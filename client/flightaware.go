@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/carlo-colombo/sopra/database"
 	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
 )
 
 // FlightAwareClient is a client for the FlightAware AeroAPI.
@@ -16,11 +16,11 @@ type FlightAwareClient struct {
 	httpClient *http.Client
 	apiKey     string
 	baseURL    string
-	db         *database.DB
+	db         storage.Flights
 }
 
 // NewFlightAwareClient creates a new FlightAwareClient.
-func NewFlightAwareClient(apiKey string, db *database.DB) *FlightAwareClient {
+func NewFlightAwareClient(apiKey string, db storage.Flights) *FlightAwareClient {
 	return &FlightAwareClient{
 		httpClient: &http.Client{Timeout: 10 * time.Second}, // Add a timeout for HTTP requests
 		apiKey:     apiKey,
@@ -116,3 +116,37 @@ func (c *FlightAwareClient) GetOperator(icao string) (string, error) {
 
 	return string(raw), nil
 }
+
+// GetAirport retrieves the location of an airport from FlightAware AeroAPI by its code.
+func (c *FlightAwareClient) GetAirport(code string) (*model.AirportInfo, error) {
+	url := fmt.Sprintf("%s/airports/%s", c.baseURL, code)
+	log.Printf("Requesting airport info from FlightAware API: %s\n", url)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("x-apikey", c.apiKey)
+	req.Header.Add("Accept", "application/json; charset=UTF-8")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to FlightAware API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil // No airport found for the given code, not an error
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FlightAware API returned non-OK status: %s", resp.Status)
+	}
+
+	var airport model.AirportInfo
+	if err := json.NewDecoder(resp.Body).Decode(&airport); err != nil {
+		return nil, fmt.Errorf("failed to decode FlightAware API response: %w", err)
+	}
+	return &airport, nil
+}
@@ -5,28 +5,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
-	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/memory"
 	"github.com/carlo-colombo/sopra/model"
 )
 
 // newTestDB creates a new in-memory database for testing.
-func newTestDB(t *testing.T) *database.DB {
+func newTestDB(t *testing.T) *memory.Store {
 	t.Helper()
-	dbName := fmt.Sprintf("%s.db", t.Name())
-	os.Remove(dbName) // Clean up before test
-	db, err := database.NewDB(dbName)
-	if err != nil {
-		t.Fatalf("failed to create test db: %v", err)
-	}
-	t.Cleanup(func() {
-		db.Close()
-		os.Remove(dbName)
-	})
-	return db
+	return memory.New()
 }
 
 func TestNewFlightAwareClient(t *testing.T) {
@@ -276,3 +265,39 @@ func TestGetFlightInfo_NoFlightsInResponse(t *testing.T) {
 		t.Fatalf("Expected no flight info, but got: %+v", flightInfo)
 	}
 }
+
+func TestGetAirport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/aeroapi/airports/LSZH" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"airport_code": "LSZH", "code_iata": "ZRH", "name": "Zurich", "latitude": 47.458056, "longitude": 8.548056}`)
+	}))
+	defer server.Close()
+
+	client := &FlightAwareClient{
+		httpClient: server.Client(),
+		apiKey:     "test_api_key",
+		baseURL:    server.URL + "/aeroapi",
+		db:         newTestDB(t),
+	}
+
+	airport, err := client.GetAirport("LSZH")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	expected := model.AirportInfo{Code: "LSZH", Latitude: 47.458056, Longitude: 8.548056}
+	if airport == nil || *airport != expected {
+		t.Fatalf("Expected airport %+v, but got: %+v", expected, airport)
+	}
+
+	airport, err = client.GetAirport("XXXX")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if airport != nil {
+		t.Fatalf("Expected no airport, but got: %+v", airport)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
-	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/geofence"
 	"github.com/carlo-colombo/sopra/model"
 	"golang.org/x/oauth2/clientcredentials"
 )
@@ -57,7 +59,7 @@ func (c *OpenSkyClient) GetStates() (*model.States, error) {
 
 // GetStatesWithBoundingBox retrieves flight states within a specified bounding box from the OpenSky Network API.
 func (c *OpenSkyClient) GetStatesWithBoundingBox(lamin, lomin, lamax, lomax float64) (*model.States, error) {
-	url := fmt.Sprintf("%s/states/all?lamin=%f&lomin=%f&lamax=%f&lomax=%f", c.baseURL, lamin, lomin, lamax, lomax)
+	url := fmt.Sprintf("%s/states/all?lamin=%f&lomin=%f&lamax=%f&lomax=%f&extended=1", c.baseURL, lamin, lomin, lamax, lomax)
 	log.Printf("Requesting states from OpenSky API: %s\n", url)
 	resp, err := c.httpClient.Get(url)
 	if err != nil {
@@ -65,6 +67,9 @@ func (c *OpenSkyClient) GetStatesWithBoundingBox(lamin, lomin, lamax, lomax floa
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, newRateLimitError(resp)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get states: %s", resp.Status)
 	}
@@ -77,19 +82,56 @@ func (c *OpenSkyClient) GetStatesWithBoundingBox(lamin, lomin, lamax, lomax floa
 	return &states, nil
 }
 
+// RateLimitError is returned when OpenSky rejects a request because the credits are exhausted.
+type RateLimitError struct {
+	Status string
+	Wait   time.Duration
+}
+
+func newRateLimitError(resp *http.Response) *RateLimitError {
+	err := &RateLimitError{Status: resp.Status}
+	for _, header := range []string{"X-Rate-Limit-Retry-After-Seconds", "Retry-After"} {
+		if seconds, convErr := strconv.Atoi(resp.Header.Get(header)); convErr == nil {
+			err.Wait = time.Duration(seconds) * time.Second
+			break
+		}
+	}
+	return err
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("failed to get states: %s, retry after %s", e.Status, e.Wait)
+}
+
+// RetryAfter returns how long OpenSky asks to wait before the next request.
+func (e *RateLimitError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
 // GetStatesInRadius retrieves flight states within a specified radius from a given central point.
 func (c *OpenSkyClient) GetStatesInRadius(lat, lon, radiusKm float64) ([]model.Flight, error) {
-	bbox := haversine.GetBoundingBox(lat, lon, radiusKm)
-	states, err := c.GetStatesWithBoundingBox(bbox.MinLat, bbox.MinLon, bbox.MaxLat, bbox.MaxLon)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetStatesInArea(geofence.Circle{Latitude: lat, Longitude: lon, RadiusKm: radiusKm})
+}
 
+// GetStatesInArea retrieves flight states inside an area, querying the bounding boxes covering it.
+func (c *OpenSkyClient) GetStatesInArea(area geofence.Area) ([]model.Flight, error) {
 	var filteredFlights []model.Flight
-	for _, flight := range states.ToFlights() {
-		if flight.Latitude != 0 && flight.Longitude != 0 &&
-			haversine.Distance(lat, lon, flight.Latitude, flight.Longitude) <= radiusKm {
-			filteredFlights = append(filteredFlights, flight)
+	seen := make(map[string]bool)
+	for _, bbox := range area.BoundingBoxes() {
+		states, err := c.GetStatesWithBoundingBox(bbox.MinLat, bbox.MinLon, bbox.MaxLat, bbox.MaxLon)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, flight := range states.ToFlights() {
+			if seen[flight.Icao24] {
+				continue
+			}
+			if flight.Latitude != 0 && flight.Longitude != 0 &&
+				area.Contains(flight.Latitude, flight.Longitude) {
+				seen[flight.Icao24] = true
+				filteredFlights = append(filteredFlights, flight)
+			}
 		}
 	}
 	return filteredFlights, nil
@@ -2,10 +2,13 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/carlo-colombo/sopra/geofence"
 	"github.com/carlo-colombo/sopra/model"
 )
 
@@ -82,6 +85,29 @@ func TestGetStatesWithBoundingBox(t *testing.T) {
 	}
 }
 
+func TestGetStatesWithBoundingBox_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rate-Limit-Retry-After-Seconds", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := &OpenSkyClient{
+		httpClient: server.Client(),
+		baseURL:    server.URL,
+	}
+
+	_, err := client.GetStatesWithBoundingBox(1, 1, 1, 1)
+
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("Expected a RateLimitError, but got %v", err)
+	}
+	if rateLimitErr.RetryAfter() != 2*time.Minute {
+		t.Errorf("Expected to retry after 2m, but got %s", rateLimitErr.RetryAfter())
+	}
+}
+
 func TestGetStatesInRadius(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		states := model.States{
@@ -121,6 +147,47 @@ func TestGetStatesInRadius(t *testing.T) {
 	}
 }
 
+func TestGetStatesInArea_Antimeridian(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// Both boxes return the same aircraft, which must only be reported once
+		states := model.States{
+			Time: 1,
+			States: [][]interface{}{
+				{"icao24_1", "CALL1", "country1", 1.0, 1.0, 179.5, -16.5, 1.0, false, 1.0, 1.0, 1.0, nil, 1.0, nil, false, 0},
+				{"icao24_2", "CALL2", "country2", 1.0, 1.0, 170.0, -16.5, 1.0, false, 1.0, 1.0, 1.0, nil, 1.0, nil, false, 0},
+			},
+		}
+		if err := json.NewEncoder(w).Encode(states); err != nil {
+			t.Fatalf("failed to encode mock response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client := &OpenSkyClient{
+		httpClient: server.Client(),
+		baseURL:    server.URL,
+	}
+
+	fence, err := geofence.Parse([]byte(`{"type":"Polygon","coordinates":[[[179,-17],[-179,-17],[-179,-16],[179,-16],[179,-17]]]}`))
+	if err != nil {
+		t.Fatalf("failed to parse geofence: %v", err)
+	}
+
+	flights, err := client.GetStatesInArea(fence)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected one request per side of the antimeridian, but got %d", requests)
+	}
+	if len(flights) != 1 || flights[0].Callsign != "CALL1" {
+		t.Errorf("Expected only CALL1 inside the geofence, but got %+v", flights)
+	}
+}
+
 func TestCallsignTrimming(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		states := model.States{
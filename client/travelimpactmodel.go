@@ -11,8 +11,8 @@ import (
 	"time"
 
 	"github.com/carlo-colombo/sopra/config"
-	"github.com/carlo-colombo/sopra/database"
 	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
 )
 
 const googleTravelImpactModelAPIURL = "https://travelimpactmodel.googleapis.com/v1/flights:computeFlightEmissions"
@@ -27,11 +27,11 @@ type TravelImpactModelAPIClient interface {
 type TravelImpactModelClient struct {
 	apiKey string
 	client *http.Client
-	db     *database.DB // For caching
+	db     storage.KeyValueCache
 }
 
 // NewTravelImpactModelClient creates a new TravelImpactModelClient.
-func NewTravelImpactModelClient(cfg *config.Config, db *database.DB) *TravelImpactModelClient {
+func NewTravelImpactModelClient(cfg *config.Config, db storage.KeyValueCache) *TravelImpactModelClient {
 	return &TravelImpactModelClient{
 		apiKey: cfg.TravelImpactModel.APIKey,
 		client: &http.Client{Timeout: 30 * time.Second}, // Increased timeout for external API
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"reflect"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -10,12 +11,17 @@ import (
 
 // Config holds the application's configuration.
 type Config struct {
-	Print    bool   `mapstructure:"print"`
-	Watch    bool   `mapstructure:"watch"`
-	Interval int    `mapstructure:"interval"`
-	Port     int    `mapstructure:"port"`
-	DBPath   string `mapstructure:"db_path"`
-	Timezone string `mapstructure:"timezone"`
+	Print           bool   `mapstructure:"print"`
+	Watch           bool   `mapstructure:"watch"`
+	Interval        int    `mapstructure:"interval"`
+	SightingGap     int    `mapstructure:"sighting_gap"`
+	Port            int    `mapstructure:"port"`
+	Storage         string `mapstructure:"storage"` // "sqlite", "postgres" or "memory"
+	PostgresURL     string `mapstructure:"postgres_url"`
+	DBPath          string `mapstructure:"db_path"`
+	Timezone        string `mapstructure:"timezone"`
+	ShutdownTimeout int    `mapstructure:"shutdown_timeout"` // seconds
+	AdminToken      string `mapstructure:"admin_token"`
 
 	OpenSkyClient struct {
 		ID     string `mapstructure:"id"`
@@ -24,14 +30,176 @@ type Config struct {
 	FlightAware struct {
 		APIKey string `mapstructure:"api_key"`
 	} `mapstructure:"flightaware"`
-	Service struct {
-		Latitude  float64 `mapstructure:"latitude"`
-		Longitude float64 `mapstructure:"longitude"`
-		Radius    float64 `mapstructure:"radius"`
-	} `mapstructure:"service"`
+	Service           ServiceConfig `mapstructure:"service"`
 	TravelImpactModel struct {
 		APIKey string `mapstructure:"api_key"`
 	} `mapstructure:"travel_impact_model"`
+	Filters  FilterConfig    `mapstructure:"filters"`
+	Sites    []SiteConfig    `mapstructure:"sites"`
+	Schedule ScheduleConfig  `mapstructure:"schedule"`
+	Webhooks []WebhookConfig `mapstructure:"webhooks"`
+	MQTT     MQTTConfig      `mapstructure:"mqtt"`
+	Rules    []RuleConfig    `mapstructure:"rules"`
+	// SquawkRanges flag special purpose codes, on top of the 7500, 7600 and 7700 emergencies
+	SquawkRanges []SquawkRangeConfig `mapstructure:"squawk_ranges"`
+	Transits     TransitConfig       `mapstructure:"transits"`
+	Lookahead    LookaheadConfig     `mapstructure:"lookahead"`
+	Recurring    RecurringConfig     `mapstructure:"recurring"`
+	Positions    PositionsConfig     `mapstructure:"positions"`
+	Maintenance  MaintenanceConfig   `mapstructure:"maintenance"`
+}
+
+// MaintenanceConfig tunes the background maintenance of the database.
+type MaintenanceConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	HistoryDays int  `mapstructure:"history_days"` // days the runs of the maintenance jobs are kept, defaults to 30
+}
+
+// PositionsConfig tunes the storage of the positions reported at every poll in watch mode, the tracks of the aircraft.
+type PositionsConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	FullDays   int  `mapstructure:"full_days"`  // days the positions are kept as reported, defaults to 7
+	Downsample int  `mapstructure:"downsample"` // seconds between the positions of an aircraft kept afterwards, defaults to 60
+	Months     int  `mapstructure:"months"`     // months after which the positions are deleted, defaults to 6
+}
+
+// RecurringConfig tunes the learning of the flights passing at about the same time on the same weekdays.
+type RecurringConfig struct {
+	Days           int `mapstructure:"days"`            // of sightings learned from, defaults to 28
+	MinOccurrences int `mapstructure:"min_occurrences"` // passes needed on the weekdays of a flight, defaults to 4
+}
+
+// LookaheadConfig enables, in watch mode, the predictions of the aircraft about to fly over the sites.
+type LookaheadConfig struct {
+	Enabled bool    `mapstructure:"enabled"`
+	Margin  float64 `mapstructure:"margin"`  // km the fetched boxes are widened by, defaults to 50
+	Horizon int     `mapstructure:"horizon"` // seconds the aircraft paths are extrapolated, defaults to 600
+}
+
+// TransitConfig enables, in watch mode, the predictions of aircraft crossing the sun or the moon.
+type TransitConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	Horizon       int     `mapstructure:"horizon"`        // seconds the aircraft paths are extrapolated, defaults to 300
+	MaxSeparation float64 `mapstructure:"max_separation"` // arcminutes from the center of the disk, defaults to 30
+}
+
+// SquawkRangeConfig is a block of special purpose squawk codes, e.g. the military or police block of a country.
+type SquawkRangeConfig struct {
+	Name     string `mapstructure:"name"`
+	From     string `mapstructure:"from"`     // four octal digits, inclusive
+	To       string `mapstructure:"to"`       // inclusive, defaults to from
+	Severity string `mapstructure:"severity"` // info, warning or critical, defaults to warning
+}
+
+// RuleConfig is an alert rule, see the rules package for the expression language.
+type RuleConfig struct {
+	Name       string   `mapstructure:"name"`
+	Expression string   `mapstructure:"expression"`
+	Severity   string   `mapstructure:"severity"` // info, warning or critical, defaults to info
+	Cooldown   int      `mapstructure:"cooldown"` // seconds, defaults to 900
+	Actions    []string `mapstructure:"actions"`  // log, webhook or mqtt, defaults to log
+}
+
+// MQTTConfig is the broker the aircraft overhead and the latest sightings are published to.
+type MQTTConfig struct {
+	Broker          string `mapstructure:"broker"` // e.g. tcp://localhost:1883, disabled when empty
+	ClientID        string `mapstructure:"client_id"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password"`
+	TopicPrefix     string `mapstructure:"topic_prefix"`
+	DiscoveryPrefix string `mapstructure:"discovery_prefix"` // Home Assistant discovery prefix
+}
+
+// WebhookConfig is an HTTP endpoint receiving a POST for sighting events.
+type WebhookConfig struct {
+	Name        string            `mapstructure:"name"`
+	URL         string            `mapstructure:"url"`
+	Headers     map[string]string `mapstructure:"headers"`
+	Events      []string          `mapstructure:"events"`       // event types, all when empty
+	Template    string            `mapstructure:"template"`     // text/template body, the event as JSON when empty
+	Secret      string            `mapstructure:"secret"`       // key of the HMAC-SHA256 signature, unsigned when empty
+	MaxAttempts int               `mapstructure:"max_attempts"` // attempts before a delivery is dead, defaults to 8
+}
+
+// ScheduleConfig tunes how watch mode adapts the polling interval of each site.
+// A zero min_interval never polls sooner than the site interval, and a zero max_interval never backs off from it.
+type ScheduleConfig struct {
+	MinInterval   int      `mapstructure:"min_interval"`   // seconds, shortest interval while aircraft are crossing the area
+	MaxInterval   int      `mapstructure:"max_interval"`   // seconds, longest back off when the sky is empty, off by default
+	QuietHours    []string `mapstructure:"quiet_hours"`    // cron expressions of the minutes polled at quiet_interval
+	QuietInterval int      `mapstructure:"quiet_interval"` // seconds, defaults to max_interval
+}
+
+// DefaultSite is the name of the site built from the top level configuration when no sites are listed.
+const DefaultSite = "default"
+
+// SiteConfig holds a named location watched for overflights.
+type SiteConfig struct {
+	Name          string `mapstructure:"name"`
+	ServiceConfig `mapstructure:",squash"`
+	Interval      int          `mapstructure:"interval"` // seconds, defaults to the top level interval
+	Filters       FilterConfig `mapstructure:"filters"`  // defaults to the top level filters
+}
+
+// WatchSites returns the configured sites, or a single default site built from
+// the service, interval and filters settings when none is listed.
+func (c *Config) WatchSites() []SiteConfig {
+	if len(c.Sites) == 0 {
+		return []SiteConfig{{
+			Name:          DefaultSite,
+			ServiceConfig: c.Service,
+			Interval:      c.Interval,
+			Filters:       c.Filters,
+		}}
+	}
+
+	sites := make([]SiteConfig, len(c.Sites))
+	for i, site := range c.Sites {
+		if site.Interval <= 0 {
+			site.Interval = c.Interval
+		}
+		if reflect.ValueOf(site.Filters).IsZero() {
+			site.Filters = c.Filters
+		}
+		sites[i] = site
+	}
+	return sites
+}
+
+// ServiceConfig holds the observer location and the area watched around it.
+type ServiceConfig struct {
+	Latitude  float64 `mapstructure:"latitude"`
+	Longitude float64 `mapstructure:"longitude"`
+	Altitude  float64 `mapstructure:"altitude"` // meters above sea level of the observer
+	Radius    float64 `mapstructure:"radius"`
+	// Geofence is a GeoJSON Polygon/MultiPolygon, inline or as a file path.
+	// When set it replaces the circle of Radius around the location.
+	Geofence string `mapstructure:"geofence"`
+}
+
+// FilterConfig holds the traffic filters deciding what counts as an overflight.
+// Zero values disable the corresponding filter.
+type FilterConfig struct {
+	MinAltitude          float64            `mapstructure:"min_altitude"` // meters
+	MaxAltitude          float64            `mapstructure:"max_altitude"` // meters
+	ExcludeOnGround      bool               `mapstructure:"exclude_on_ground"`
+	MinSpeed             float64            `mapstructure:"min_speed"` // m/s
+	IncludeOperators     []string           `mapstructure:"include_operators"`
+	ExcludeOperators     []string           `mapstructure:"exclude_operators"`
+	IncludeAircraftTypes []string           `mapstructure:"include_aircraft_types"`
+	ExcludeAircraftTypes []string           `mapstructure:"exclude_aircraft_types"`
+	IncludeCategories    []int              `mapstructure:"include_categories"`
+	ExcludeCategories    []int              `mapstructure:"exclude_categories"`
+	IncludeCallsigns     []string           `mapstructure:"include_callsigns"` // regular expressions
+	ExcludeCallsigns     []string           `mapstructure:"exclude_callsigns"` // regular expressions
+	VerticalRateBands    []VerticalRateBand `mapstructure:"vertical_rate_bands"`
+}
+
+// VerticalRateBand is a named vertical rate range in m/s, e.g. arriving or departing traffic.
+type VerticalRateBand struct {
+	Name string  `mapstructure:"name"`
+	Min  float64 `mapstructure:"min"`
+	Max  float64 `mapstructure:"max"`
 }
 
 // LoadConfig loads configuration from file and environment variables.
@@ -69,29 +237,78 @@ func LoadConfig(path string) (*Config, error) {
 	if err := viper.BindEnv("service.longitude", "DEFAULT_LONGITUDE"); err != nil {
 		log.Fatalf("failed to bind 'service.longitude' env: %v", err)
 	}
+	if err := viper.BindEnv("service.altitude", "DEFAULT_ALTITUDE"); err != nil {
+		log.Fatalf("failed to bind 'service.altitude' env: %v", err)
+	}
 	if err := viper.BindEnv("service.radius", "DEFAULT_RADIUS"); err != nil {
 		log.Fatalf("failed to bind 'service.radius' env: %v", err)
 	}
+	if err := viper.BindEnv("service.geofence", "GEOFENCE"); err != nil {
+		log.Fatalf("failed to bind 'service.geofence' env: %v", err)
+	}
 	if err := viper.BindEnv("watch", "WATCH"); err != nil {
 		log.Fatalf("failed to bind 'watch' env: %v", err)
 	}
 	if err := viper.BindEnv("interval", "WATCH_INTERVAL"); err != nil {
 		log.Fatalf("failed to bind 'interval' env: %v", err)
 	}
+	if err := viper.BindEnv("sighting_gap", "SIGHTING_GAP"); err != nil {
+		log.Fatalf("failed to bind 'sighting_gap' env: %v", err)
+	}
+	if err := viper.BindEnv("storage", "STORAGE"); err != nil {
+		log.Fatalf("failed to bind 'storage' env: %v", err)
+	}
+	if err := viper.BindEnv("postgres_url", "POSTGRES_URL"); err != nil {
+		log.Fatalf("failed to bind 'postgres_url' env: %v", err)
+	}
 	if err := viper.BindEnv("db_path", "DB_PATH"); err != nil {
 		log.Fatalf("failed to bind 'db_path' env: %v", err)
 	}
 	if err := viper.BindEnv("timezone", "TIMEZONE"); err != nil {
 		log.Fatalf("failed to bind 'timezone' env: %v", err)
 	}
+	if err := viper.BindEnv("shutdown_timeout", "SHUTDOWN_TIMEOUT"); err != nil {
+		log.Fatalf("failed to bind 'shutdown_timeout' env: %v", err)
+	}
+	if err := viper.BindEnv("admin_token", "ADMIN_TOKEN"); err != nil {
+		log.Fatalf("failed to bind 'admin_token' env: %v", err)
+	}
+	if err := viper.BindEnv("mqtt.broker", "MQTT_BROKER"); err != nil {
+		log.Fatalf("failed to bind 'mqtt.broker' env: %v", err)
+	}
+	if err := viper.BindEnv("mqtt.username", "MQTT_USERNAME"); err != nil {
+		log.Fatalf("failed to bind 'mqtt.username' env: %v", err)
+	}
+	if err := viper.BindEnv("mqtt.password", "MQTT_PASSWORD"); err != nil {
+		log.Fatalf("failed to bind 'mqtt.password' env: %v", err)
+	}
 
 	// Set default values
 
 	viper.SetDefault("port", 8080)
 	viper.SetDefault("watch", false)
 	viper.SetDefault("interval", 300)
+	viper.SetDefault("sighting_gap", 900)
+	viper.SetDefault("schedule.min_interval", 15)
+	viper.SetDefault("storage", "sqlite")
 	viper.SetDefault("db_path", "sopra.db")
 	viper.SetDefault("timezone", "Local")
+	viper.SetDefault("shutdown_timeout", 30)
+	viper.SetDefault("mqtt.client_id", "sopra")
+	viper.SetDefault("mqtt.topic_prefix", "sopra")
+	viper.SetDefault("mqtt.discovery_prefix", "homeassistant")
+	viper.SetDefault("transits.horizon", 300)
+	viper.SetDefault("transits.max_separation", 30.0)
+	viper.SetDefault("lookahead.margin", 50.0)
+	viper.SetDefault("lookahead.horizon", 600)
+	viper.SetDefault("recurring.days", 28)
+	viper.SetDefault("recurring.min_occurrences", 4)
+	viper.SetDefault("positions.enabled", true)
+	viper.SetDefault("positions.full_days", 7)
+	viper.SetDefault("positions.downsample", 60)
+	viper.SetDefault("positions.months", 6)
+	viper.SetDefault("maintenance.enabled", true)
+	viper.SetDefault("maintenance.history_days", 30)
 
 	viper.SetDefault("opensky_client.id", "")
 
@@ -112,7 +329,7 @@ func LoadConfig(path string) (*Config, error) {
 
 			// Config file not found; ignore error if not critical
 
-			fmt.Println("No config file found, using environment variables and defaults")
+			log.Println("No config file found, using environment variables and defaults")
 
 		} else {
 
@@ -130,6 +347,17 @@ func LoadConfig(path string) (*Config, error) {
 
 	}
 
+	names := make(map[string]bool)
+	for _, site := range cfg.Sites {
+		if site.Name == "" {
+			return nil, fmt.Errorf("every site needs a name")
+		}
+		if names[site.Name] {
+			return nil, fmt.Errorf("duplicate site name %q", site.Name)
+		}
+		names[site.Name] = true
+	}
+
 	return &cfg, nil
 
 }
@@ -144,9 +372,13 @@ func (c *Config) String() string {
 	  Print: %t
 	  Watch: %t
 	  Interval: %ds
+	  Sighting Gap: %ds
 	  Port: %d
+	  Storage: %s
 	  DB Path: %s
 	  Timezone: %s
+	  Shutdown Timeout: %ds
+	  Admin Token Set: %t
 
 	  OpenSky Client:
 
@@ -166,15 +398,27 @@ func (c *Config) String() string {
 
 	    Longitude: %.4f
 
+	    Altitude: %.0f m
+
 	    Radius: %.2f km
 
+	    Geofence: %t
+
+	  Sites: %d
+
+	  MQTT Broker: %s
+
 	`,
 		c.Print,
 		c.Watch,
 		c.Interval,
+		c.SightingGap,
 		c.Port,
+		c.Storage,
 		c.DBPath,
 		c.Timezone,
+		c.ShutdownTimeout,
+		c.AdminToken != "",
 
 		c.OpenSkyClient.ID, c.OpenSkyClient.Secret,
 
@@ -182,6 +426,10 @@ func (c *Config) String() string {
 
 		c.TravelImpactModel.APIKey,
 
-		c.Service.Latitude, c.Service.Longitude, c.Service.Radius)
+		c.Service.Latitude, c.Service.Longitude, c.Service.Altitude, c.Service.Radius, c.Service.Geofence != "",
+
+		len(c.WatchSites()),
+
+		c.MQTT.Broker)
 
 }
@@ -28,6 +28,7 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, cfg)
 	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, 900, cfg.SightingGap)
 	assert.Equal(t, "", cfg.OpenSkyClient.ID)
 	assert.Equal(t, "", cfg.OpenSkyClient.Secret)
 	assert.Equal(t, 47.3769, cfg.Service.Latitude)
@@ -73,6 +74,15 @@ service:
   latitude: 10.0
   longitude: 20.0
   radius: 30.0
+filters:
+  max_altitude: 6000
+  exclude_on_ground: true
+  exclude_operators: ["EXS"]
+  exclude_callsigns: ["^N[0-9]"]
+  vertical_rate_bands:
+    - name: arriving
+      min: -20
+      max: -1
 `
 	tmpdir, err := os.MkdirTemp("", "config-test")
 	assert.NoError(t, err)
@@ -92,4 +102,81 @@ service:
 	assert.Equal(t, 10.0, cfg.Service.Latitude)
 	assert.Equal(t, 20.0, cfg.Service.Longitude)
 	assert.Equal(t, 30.0, cfg.Service.Radius)
+	assert.Equal(t, 6000.0, cfg.Filters.MaxAltitude)
+	assert.True(t, cfg.Filters.ExcludeOnGround)
+	assert.Equal(t, []string{"EXS"}, cfg.Filters.ExcludeOperators)
+	assert.Equal(t, []string{"^N[0-9]"}, cfg.Filters.ExcludeCallsigns)
+	assert.Equal(t, []VerticalRateBand{{Name: "arriving", Min: -20, Max: -1}}, cfg.Filters.VerticalRateBands)
+}
+
+func TestLoadConfig_Sites(t *testing.T) {
+	viper.Reset()
+	configContent := `
+interval: 120
+filters:
+  exclude_on_ground: true
+sites:
+  - name: zurich
+    latitude: 47.3769
+    longitude: 8.5417
+    radius: 20
+  - name: geneva
+    latitude: 46.2044
+    longitude: 6.1432
+    geofence: "geneva.geojson"
+    interval: 30
+    filters:
+      max_altitude: 3000
+`
+	tmpdir, err := os.MkdirTemp("", "config-test-sites")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	err = os.WriteFile(filepath.Join(tmpdir, "config.yml"), []byte(configContent), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := LoadConfig(tmpdir)
+	assert.NoError(t, err)
+
+	sites := cfg.WatchSites()
+	assert.Len(t, sites, 2)
+	assert.Equal(t, "zurich", sites[0].Name)
+	assert.Equal(t, 47.3769, sites[0].Latitude)
+	assert.Equal(t, 20.0, sites[0].Radius)
+	assert.Equal(t, 120, sites[0].Interval)
+	assert.True(t, sites[0].Filters.ExcludeOnGround, "sites without filters inherit the top level ones")
+
+	assert.Equal(t, "geneva", sites[1].Name)
+	assert.Equal(t, "geneva.geojson", sites[1].Geofence)
+	assert.Equal(t, 30, sites[1].Interval)
+	assert.False(t, sites[1].Filters.ExcludeOnGround)
+	assert.Equal(t, 3000.0, sites[1].Filters.MaxAltitude)
+}
+
+func TestLoadConfig_DuplicateSite(t *testing.T) {
+	viper.Reset()
+	tmpdir, err := os.MkdirTemp("", "config-test-duplicate-sites")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	err = os.WriteFile(filepath.Join(tmpdir, "config.yml"), []byte("sites:\n  - name: a\n  - name: a\n"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(tmpdir)
+	assert.Error(t, err)
+}
+
+func TestWatchSites_Default(t *testing.T) {
+	cfg := &Config{Interval: 60}
+	cfg.Service.Latitude = 1
+	cfg.Service.Radius = 5
+	cfg.Filters.MinSpeed = 10
+
+	sites := cfg.WatchSites()
+	assert.Len(t, sites, 1)
+	assert.Equal(t, DefaultSite, sites[0].Name)
+	assert.Equal(t, 1.0, sites[0].Latitude)
+	assert.Equal(t, 5.0, sites[0].Radius)
+	assert.Equal(t, 60, sites[0].Interval)
+	assert.Equal(t, 10.0, sites[0].Filters.MinSpeed)
 }
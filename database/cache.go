@@ -4,34 +4,48 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"strings"
 	"time"
 
 	"github.com/carlo-colombo/sopra/migrations"
 	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// busyTimeout is how long a connection waits for the lock of the database held by another, e.g. a write
+// while the write-ahead log is checkpointed.
+const busyTimeout = 5 * time.Second
+
+// withQuery appends the parameters of query to the data source name of a database file.
+func withQuery(name, query string) string {
+	if strings.Contains(name, "?") {
+		return name + "&" + query
+	}
+	return name + "?" + query
+}
+
 // DB handles the database operations for caching.
 type DB struct {
 	db *sql.DB
 }
 
+var _ storage.Store = (*DB)(nil)
+
 // runMigrations applies the database migrations.
 func runMigrations(dataSourceName string) error {
 	d, err := iofs.New(migrations.Migrations, ".")
 	if err != nil {
 		return err
 	}
-	m, err := migrate.NewWithSourceInstance("iofs", d, "sqlite3://"+dataSourceName)
+	m, err := migrate.NewWithSourceInstance("iofs", d, migrateScheme+"://"+dataSource(dataSourceName))
 	if err != nil {
 		return err
 	}
+	// Closed, so that the last connection to the database closed removes its write-ahead log
+	defer m.Close()
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return err
 	}
@@ -44,7 +58,7 @@ func NewDB(dataSourceName string) (*DB, error) {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", dataSourceName)
+	db, err := sql.Open(driverName, dataSource(dataSourceName))
 	if err != nil {
 		return nil, err
 	}
@@ -52,198 +66,18 @@ func NewDB(dataSourceName string) (*DB, error) {
 	return &DB{db: db}, nil
 }
 
-// Close closes the underlying database connection.
-func (c *DB) Close() error {
-	return c.db.Close()
-}
-
-// GetFlightCount returns the total number of flights in the cache.
-func (c *DB) GetFlightCount() (int, error) {
-	var count int
-	err := c.db.QueryRow("SELECT COUNT(*) FROM flight_log").Scan(&count)
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-// GetFlight retrieves a cached FlightInfo by key.
-func (c *DB) GetFlight(key string) (*model.FlightInfo, time.Time, error) {
-	var jsonValue string
-	var lastSeen time.Time
-	var identificationCount int
-	err := c.db.QueryRow("SELECT value, last_seen, identification_count FROM flight_log WHERE key = ?", key).Scan(&jsonValue, &lastSeen, &identificationCount)
-	if err == sql.ErrNoRows {
-		return nil, time.Time{}, nil // Cache miss
-	}
-	if err != nil {
-		return nil, time.Time{}, err
-	}
-
-	var flightInfo model.FlightInfo
-	if err := json.Unmarshal([]byte(jsonValue), &flightInfo); err != nil {
-		return nil, time.Time{}, err
-	}
-	flightInfo.IdentificationCount = identificationCount
-
-	log.Printf("Cache hit for key: %s, last seen: %s\n", key, lastSeen)
-	return &flightInfo, lastSeen, nil
-}
-
-// GetLast10Flights retrieves the last 10 logged FlightInfo.
-func (c *DB) GetLast10Flights() ([]*model.FlightInfo, []time.Time, error) {
-	rows, err := c.db.Query(`
-		SELECT value, last_seen, identification_count 
-		FROM flight_log
-		GROUP BY value ->> 'ident'
-		ORDER BY last_seen 
-		DESC LIMIT 10
-	`)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer rows.Close()
-
-	var flights []*model.FlightInfo
-	var lastSeens []time.Time
-
-	for rows.Next() {
-		var jsonValue string
-		var lastSeen time.Time
-		var identificationCount int
-		if err := rows.Scan(&jsonValue, &lastSeen, &identificationCount); err != nil {
-			return nil, nil, err
-		}
-
-		var flightInfo model.FlightInfo
-		if err := json.Unmarshal([]byte(jsonValue), &flightInfo); err != nil {
-			return nil, nil, err
-		}
-		flightInfo.IdentificationCount = identificationCount
-		flights = append(flights, &flightInfo)
-		lastSeens = append(lastSeens, lastSeen)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, nil, err
-	}
-
-	return flights, lastSeens, nil
-}
-
-// GetMostCommonFlights retrieves the 5 most common FlightInfo.
-func (c *DB) GetMostCommonFlights() ([]*model.FlightInfo, error) {
-	rows, err := c.db.Query("SELECT value, identification_count FROM flight_log ORDER BY identification_count DESC LIMIT 5")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var flights []*model.FlightInfo
-
-	for rows.Next() {
-		var jsonValue string
-		var identificationCount int
-		if err := rows.Scan(&jsonValue, &identificationCount); err != nil {
-			return nil, err
-		}
-
-		var flightInfo model.FlightInfo
-		if err := json.Unmarshal([]byte(jsonValue), &flightInfo); err != nil {
-			return nil, err
-		}
-		flightInfo.IdentificationCount = identificationCount
-		flights = append(flights, &flightInfo)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return flights, nil
-}
-
-// GetAllFlights retrieves the logged FlightInfo, optionally limited by the limit parameter.
-func (c *DB) GetAllFlights(limit int) ([]*model.FlightInfo, []time.Time, error) {
-	query := "SELECT value, last_seen, identification_count FROM flight_log ORDER BY last_seen DESC"
-	var rows *sql.Rows
-	var err error
-	if limit > 0 {
-		query += " LIMIT ?"
-		rows, err = c.db.Query(query, limit)
-	} else {
-		rows, err = c.db.Query(query)
-	}
-	if err != nil {
-		return nil, nil, err
-	}
-	defer rows.Close()
-
-	var flights []*model.FlightInfo
-	var lastSeens []time.Time
-
-	for rows.Next() {
-		var jsonValue string
-		var lastSeen time.Time
-		var identificationCount int
-		if err := rows.Scan(&jsonValue, &lastSeen, &identificationCount); err != nil {
-			return nil, nil, err
-		}
-
-		var flightInfo model.FlightInfo
-		if err := json.Unmarshal([]byte(jsonValue), &flightInfo); err != nil {
-			return nil, nil, err
-		}
-		flightInfo.IdentificationCount = identificationCount
-		flights = append(flights, &flightInfo)
-		lastSeens = append(lastSeens, lastSeen)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, nil, err
-	}
-
-	return flights, lastSeens, nil
+// SQL returns the underlying database, to read its tables as they are, as sopra db copy does.
+func (c *DB) SQL() *sql.DB {
+	return c.db
 }
 
-// LogFlight stores a FlightInfo in the cache.
-func (c *DB) LogFlight(key string, flightInfo *model.FlightInfo) error {
-	jsonValue, err := json.Marshal(flightInfo)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.db.Exec("INSERT INTO flight_log (key, value, last_seen, identification_count) VALUES (?, ?, ?, 1) ON CONFLICT(key) DO UPDATE SET value = excluded.value, last_seen = excluded.last_seen, identification_count = identification_count + 1", key, string(jsonValue), time.Now())
-	log.Printf("Logged flight for key: %s\n", key)
-	return err
-}
-
-// GetLatestFlight retrieves the most recently logged FlightInfo.
-func (c *DB) GetLatestFlight() (*model.FlightInfo, time.Time, error) {
-	var jsonValue string
-	var lastSeen time.Time
-	var identificationCount int
-	err := c.db.QueryRow("SELECT value, last_seen, identification_count FROM flight_log ORDER BY last_seen DESC LIMIT 1").Scan(&jsonValue, &lastSeen, &identificationCount)
-	if err == sql.ErrNoRows {
-		return nil, time.Time{}, nil // No flights in cache
-	}
-	if err != nil {
-		return nil, time.Time{}, err
-	}
-
-	var flightInfo model.FlightInfo
-	if err := json.Unmarshal([]byte(jsonValue), &flightInfo); err != nil {
-		return nil, time.Time{}, err
+// Close waits for the queries in progress, checkpoints the write-ahead log, if any,
+// so that all writes are in the database file, and closes the underlying database connection.
+func (c *DB) Close() error {
+	if _, err := c.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Printf("failed to checkpoint database: %v", err)
 	}
-	flightInfo.IdentificationCount = identificationCount
-
-	return &flightInfo, lastSeen, nil
-}
-
-// ClearFlightLog deletes all records from the flight_log table.
-func (c *DB) ClearFlightLog() error {
-	_, err := c.db.Exec("DELETE FROM flight_log")
-	return err
+	return c.db.Close()
 }
 
 // Set stores a key-value pair in the cache with an expiration time.
@@ -343,42 +177,18 @@ func (c *DB) GetOperators(icaos []string) (map[string]string, error) {
 	return operators, nil
 }
 
-func (c *DB) getTopAirports(path string) ([]model.AirportStat, error) {
-	query := fmt.Sprintf(`
-		SELECT
-			value ->> '$.%s.code_iata' as iata,
-			value ->> '$.%s.city' as city,
-			SUM(identification_count) as total_count
-		FROM flight_log
-		WHERE value ->> '$.%s.code_iata' IS NOT NULL AND value ->> '$.%s.code_iata' != ''
-		GROUP BY iata, city
-		ORDER BY total_count DESC
-		LIMIT 10
-	`, path, path, path, path)
-
-	rows, err := c.db.Query(query)
+// GetOperatorInfo retrieves the logged details of an operator, with "N/A" as short name for unknown operators.
+func (c *DB) GetOperatorInfo(icao string) (*model.OperatorInfo, error) {
+	operatorJSON, err := c.GetOperator(icao)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var stats []model.AirportStat
-	for rows.Next() {
-		var s model.AirportStat
-		if err := rows.Scan(&s.Iata, &s.City, &s.Count); err != nil {
-			return nil, err
-		}
-		stats = append(stats, s)
+	if operatorJSON == "" {
+		return &model.OperatorInfo{Shortname: "N/A"}, nil
 	}
-	return stats, nil
-}
-
-// GetTopDestinations retrieves the top 10 destination airports.
-func (c *DB) GetTopDestinations() ([]model.AirportStat, error) {
-	return c.getTopAirports("destination")
-}
-
-// GetTopSources retrieves the top 10 source airports.
-func (c *DB) GetTopSources() ([]model.AirportStat, error) {
-	return c.getTopAirports("origin")
+	var operatorInfo model.OperatorInfo
+	if err := json.Unmarshal([]byte(operatorJSON), &operatorInfo); err != nil {
+		return nil, err
+	}
+	return &operatorInfo, nil
 }
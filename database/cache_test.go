@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/carlo-colombo/sopra/model"
 	"github.com/stretchr/testify/assert"
@@ -42,16 +43,19 @@ func TestAirportStats(t *testing.T) {
 		},
 	}
 
+	now := time.Now()
 	for _, f := range flights {
 		err = db.LogFlight(f.Ident, f)
 		assert.NoError(t, err)
+		_, err = db.RecordSighting(model.Observation{Callsign: f.Ident, Time: now}, time.Minute)
+		assert.NoError(t, err)
 	}
 
-	// Log F1 again to increment identification_count
-	err = db.LogFlight("F1", flights[0])
+	// A second pass of F1 after the gap counts as another sighting
+	_, err = db.RecordSighting(model.Observation{Callsign: "F1", Time: now.Add(time.Hour)}, time.Minute)
 	assert.NoError(t, err)
 
-	topDest, err := db.GetTopDestinations()
+	topDest, err := db.GetTopDestinations("")
 	assert.NoError(t, err)
 	assert.Len(t, topDest, 2)
 	// JFK should have count 3 (2 from F1, 1 from F3)
@@ -61,7 +65,7 @@ func TestAirportStats(t *testing.T) {
 	assert.Equal(t, "LAX", topDest[1].Iata)
 	assert.Equal(t, 1, topDest[1].Count)
 
-	topSrc, err := db.GetTopSources()
+	topSrc, err := db.GetTopSources("")
 	assert.NoError(t, err)
 	assert.Len(t, topSrc, 2)
 	// ZRH should have count 3 (2 from F1, 1 from F2)
@@ -0,0 +1,24 @@
+//go:build cgo && !purego
+
+package database
+
+import (
+	"fmt"
+
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// driverName is the database/sql driver of SQLite, github.com/mattn/go-sqlite3, which requires CGO,
+// and migrateScheme the scheme of its migrate database URLs.
+const (
+	driverName    = "sqlite3"
+	migrateScheme = "sqlite3"
+)
+
+// dataSource returns the data source name of a database file for the driver, in write-ahead log mode
+// and waiting busyTimeout for the lock held by another connection. A new database is created
+// in incremental auto vacuum mode, which is set before its first table.
+func dataSource(name string) string {
+	return withQuery(name, fmt.Sprintf("_auto_vacuum=incremental&_journal_mode=WAL&_busy_timeout=%d", busyTimeout.Milliseconds()))
+}
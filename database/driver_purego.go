@@ -0,0 +1,129 @@
+//go:build !cgo || purego
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"modernc.org/sqlite"
+)
+
+// driverName is the database/sql driver of SQLite, modernc.org/sqlite written in Go, used when building without CGO
+// or with the purego tag, and migrateScheme the scheme of its migrate database URLs.
+const (
+	driverName    = "sqlite_sopra"
+	migrateScheme = "sqlite"
+)
+
+func init() {
+	sql.Register(driverName, timesDriver{&sqlite.Driver{}})
+}
+
+// dataSource returns the data source name of a database file for the driver, in write-ahead log mode
+// and waiting busyTimeout for the lock held by another connection. A new database is created
+// in incremental auto vacuum mode, set first, before its first table. The times are written
+// as github.com/mattn/go-sqlite3 writes them, rather than as time.Time.String, so that they compare
+// in time order, work with the date functions of SQLite and a database is shared by both builds.
+func dataSource(name string) string {
+	return withQuery(name, fmt.Sprintf("_time_format=sqlite&_pragma=auto_vacuum(INCREMENTAL)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)", busyTimeout.Milliseconds()))
+}
+
+// timesDriver reads the DATETIME columns in the locations github.com/mattn/go-sqlite3 reads them: modernc.org/sqlite
+// parses the times in the local time zone, so that a time written in UTC is read back in time.Local.
+type timesDriver struct {
+	driver.Driver
+}
+
+// timesStoredConn are the interfaces of a connection of modernc.org/sqlite used by database/sql.
+type timesStoredConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+func (d timesDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return timesConn{c.(timesStoredConn)}, nil
+}
+
+type timesConn struct {
+	timesStoredConn
+}
+
+func (c timesConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c timesConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.timesStoredConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return timesStmt{s.(timesStoredStmt)}, nil
+}
+
+func (c timesConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.timesStoredConn.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return timesRows{r}, nil
+}
+
+// timesStoredStmt are the interfaces of a statement of modernc.org/sqlite used by database/sql.
+type timesStoredStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+type timesStmt struct {
+	timesStoredStmt
+}
+
+func (s timesStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := s.timesStoredStmt.QueryContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return timesRows{r}, nil
+}
+
+type timesRows struct {
+	driver.Rows
+}
+
+func (r timesRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		if t, ok := v.(time.Time); ok {
+			dest[i] = storedLocation(t)
+		}
+	}
+	return nil
+}
+
+// storedLocation returns a time in UTC when it was written in UTC, and otherwise in a zone
+// with the offset it was written with, as github.com/mattn/go-sqlite3 reads it.
+func storedLocation(t time.Time) time.Time {
+	_, offset := t.Zone()
+	if offset == 0 {
+		return t.UTC()
+	}
+	return t.In(time.FixedZone("", offset))
+}
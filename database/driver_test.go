@@ -0,0 +1,90 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDriver_Times checks that both SQLite drivers, selected by the purego build tag, write and read the times alike.
+func TestDriver_Times(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+	require.NoError(t, db.ClearFlightLog())
+
+	inUTC := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	inZurich := time.Date(2025, 1, 1, 11, 30, 0, 500, time.FixedZone("CET", 3600))
+	var ids []int64
+	for _, at := range []time.Time{inUTC, inZurich} {
+		sighting, err := db.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR123", Time: at}, time.Minute)
+		require.NoError(t, err)
+		ids = append(ids, sighting.ID)
+	}
+
+	var stored []string
+	rows, err := db.db.Query("SELECT CAST(first_seen AS TEXT) FROM sighting ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		require.NoError(t, rows.Scan(&s))
+		stored = append(stored, s)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"2025-01-01 10:00:00+00:00", "2025-01-01 11:30:00.0000005+01:00"}, stored)
+
+	got, err := db.GetSighting(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, inUTC, got.FirstSeen)
+
+	got, err = db.GetSighting(ids[1])
+	require.NoError(t, err)
+	assert.True(t, inZurich.Equal(got.FirstSeen))
+	_, offset := got.FirstSeen.Zone()
+	assert.Equal(t, 3600, offset)
+
+	// The times compare in time order in SQL
+	count, err := db.GetSightingCountSince(inUTC.Add(time.Hour), "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// TestDriver_WAL checks that both SQLite drivers open the database in write-ahead log mode, so that a write goes
+// through while an export is reading.
+func TestDriver_WAL(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+		os.Remove(dbName + "-wal")
+		os.Remove(dbName + "-shm")
+	})
+
+	var mode string
+	require.NoError(t, db.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	at := time.Now()
+	err = db.ExportSightings(time.Time{}, at, "", func(row *model.ExportRow) error {
+		_, err := db.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR123", Time: at}, time.Minute)
+		return err
+	})
+	require.NoError(t, err)
+	count, err := db.GetSightingCountSince(at, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// exportQuery selects the sightings flattened with their flights, as the fields of exportFields: the flight of
+// a sighting is the leg of its callsign logged last by the end of the sighting.
+const exportQuery = `
+	SELECT s.id, s.site, s.icao24, s.callsign, s.first_seen, s.last_seen, COALESCE(s.min_distance, 0), COALESCE(s.min_altitude, 0),
+		COALESCE(s.entry_bearing, 0), COALESCE(s.exit_bearing, 0), s.sample_count, COALESCE(s.peak_noise, 0),
+		COALESCE(l.ident, ''), COALESCE(o.code, ''), COALESCE(o.icao, ''), COALESCE(o.iata, ''),
+		COALESCE(origin.code, ''), COALESCE(origin.code_iata, ''), COALESCE(origin.city, ''),
+		COALESCE(destination.code, ''), COALESCE(destination.code_iata, ''), COALESCE(destination.city, ''),
+		COALESCE(l.route, ''), COALESCE(l.route_distance, 0), COALESCE(a.registration, ''), COALESCE(a.aircraft_type, ''), COALESCE(l.co2_kg, 0),
+		COALESCE(l.baro_altitude, 0), COALESCE(l.geo_altitude, 0), COALESCE(l.velocity, 0), COALESCE(l.true_track, 0),
+		COALESCE(l.vertical_rate, 0), COALESCE(l.squawk, ''), COALESCE(l.on_ground, FALSE)
+	FROM sighting s
+	LEFT JOIN flight_leg l ON l.id = (
+		SELECT id FROM flight_leg
+		WHERE flight_ident = s.callsign AND logged_at <= s.last_seen
+		ORDER BY logged_at DESC, id DESC
+		LIMIT 1)
+	LEFT JOIN operator o ON o.id = l.operator_id
+	LEFT JOIN aircraft a ON a.id = l.aircraft_id
+	LEFT JOIN airport origin ON origin.id = l.origin_id
+	LEFT JOIN airport destination ON destination.id = l.destination_id
+	WHERE s.first_seen >= ? AND s.first_seen < ? AND (? = '' OR s.site = ?)
+	ORDER BY s.first_seen, s.id`
+
+// exportFields returns pointers to the fields of r selected by exportQuery, to scan them.
+func exportFields(r *model.ExportRow) []any {
+	return []any{
+		&r.SightingID, &r.Site, &r.Icao24, &r.Callsign, &r.FirstSeen, &r.LastSeen, &r.MinDistance, &r.MinAltitude,
+		&r.EntryBearing, &r.ExitBearing, &r.SampleCount, &r.PeakNoise,
+		&r.Ident, &r.Operator, &r.OperatorIcao, &r.OperatorIata,
+		&r.Origin, &r.OriginIata, &r.OriginCity,
+		&r.Destination, &r.DestinationIata, &r.DestinationCity,
+		&r.Route, &r.RouteDistance, &r.Registration, &r.AircraftType, &r.CO2KG,
+		&r.BaroAltitude, &r.GeoAltitude, &r.Velocity, &r.TrueTrack,
+		&r.VerticalRate, &r.Squawk, &r.OnGround,
+	}
+}
+
+// ExportSightings calls fn with the sightings started from the given time and before the other, optionally
+// restricted to a site, in the order they started, flattened with their flights. The rows are scanned one
+// at a time while fn writes them out, and the first error returned by fn stops the export.
+func (c *DB) ExportSightings(from, to time.Time, site string, fn func(*model.ExportRow) error) error {
+	rows, err := c.db.Query(exportQuery, from, to, site, site)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row model.ExportRow
+		if err := rows.Scan(exportFields(&row)...); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterStats(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	today := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	yesterday := today.AddDate(0, 0, -1)
+
+	assert.NoError(t, db.RecordFilterRejection("", "on_ground", "a1", today))
+	assert.NoError(t, db.RecordFilterRejection("", "on_ground", "a1", today)) // same aircraft, counted once
+	assert.NoError(t, db.RecordFilterRejection("", "on_ground", "a2", today))
+	assert.NoError(t, db.RecordFilterRejection("", "on_ground", "a1", yesterday))
+	assert.NoError(t, db.RecordFilterRejection("", "max_altitude", "b1", yesterday))
+
+	stats, err := db.GetFilterStats(today, "")
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "on_ground", stats[0].Name)
+	assert.Equal(t, 2, stats[0].Today)
+	assert.Equal(t, 3, stats[0].Total)
+	assert.Equal(t, "max_altitude", stats[1].Name)
+	assert.Equal(t, 0, stats[1].Today)
+	assert.Equal(t, 1, stats[1].Total)
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstSeen(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+	assert.NoError(t, db.ClearFlightLog())
+
+	lastWeek := time.Now().AddDate(0, 0, -8)
+	firsts, err := db.RecordFirstSeen(map[string]string{model.KindOperator: "SWR", model.KindAircraftType: "A333"}, "SWR1", "", lastWeek)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.KindOperator, model.KindAircraftType}, firsts)
+
+	now := time.Now()
+	firsts, err = db.RecordFirstSeen(map[string]string{model.KindOperator: "SWR", model.KindAircraftType: "A388", model.KindCountry: "CH"}, "SWR2", "office", now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.KindAircraftType, model.KindCountry}, firsts)
+
+	seen, err := db.GetFirstSeen()
+	assert.NoError(t, err)
+	assert.Len(t, seen, 4)
+	for _, s := range seen {
+		if s.Kind == model.KindOperator {
+			assert.Equal(t, 2, s.Count)
+			assert.Equal(t, "SWR1", s.Callsign, "the first sighting is kept")
+			assert.Equal(t, "default", s.Site)
+		}
+	}
+
+	recent, err := db.GetFirstSeenSince(now.AddDate(0, 0, -7), "")
+	assert.NoError(t, err)
+	assert.Len(t, recent, 2)
+	assert.Equal(t, "A388", recent[0].Value)
+	assert.Equal(t, "CH", recent[1].Value)
+	assert.Equal(t, "office", recent[0].Site)
+
+	recent, err = db.GetFirstSeenSince(now.AddDate(0, 0, -7), "default")
+	assert.NoError(t, err)
+	assert.Empty(t, recent)
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/migrations"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlightLog_Migrated(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	// The flights seeded in the JSON flight_log keep their details, last seen time and count
+	flight, lastSeen, err := db.GetFlight("SWR123")
+	assert.NoError(t, err)
+	require.NotNil(t, flight)
+	assert.Equal(t, "SWR123", flight.Ident)
+	assert.Equal(t, "SWR", flight.OperatorIcao)
+	assert.Equal(t, "A333", flight.AircraftType)
+	assert.Equal(t, model.AirportDetail{CodeIata: "ZRH", Name: "Zurich Airport", City: "Zurich"}, flight.Origin)
+	assert.Equal(t, "JFK", flight.Destination.CodeIata)
+	require.NotNil(t, flight.FiledAirspeed)
+	assert.Equal(t, 450, *flight.FiledAirspeed)
+	assert.Nil(t, flight.Route)
+	assert.Equal(t, 47.4583, flight.Latitude)
+	assert.Equal(t, 1, flight.IdentificationCount)
+	assert.Equal(t, "2024-01-01 12:00:00", lastSeen.Format(time.DateTime))
+
+	count, err := db.GetFlightCount()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, count)
+}
+
+// TestSighting_Backfill checks that each flight identified before the sightings existed counts in the stats as one
+// pass, however many polls identified it.
+func TestSighting_Backfill(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	t.Cleanup(func() { os.Remove(dbName) })
+
+	// The database as it was before the sighting table
+	d, err := iofs.New(migrations.Migrations, ".")
+	require.NoError(t, err)
+	m, err := migrate.NewWithSourceInstance("iofs", d, migrateScheme+"://"+dataSource(dbName))
+	require.NoError(t, err)
+	require.NoError(t, m.Migrate(5))
+	srcErr, dbErr := m.Close()
+	require.NoError(t, srcErr)
+	require.NoError(t, dbErr)
+
+	old, err := sql.Open(driverName, dataSource(dbName))
+	require.NoError(t, err)
+	_, err = old.Exec("UPDATE flight_log SET identification_count = 3 WHERE key = 'DLH456'")
+	require.NoError(t, err)
+	_, err = old.Exec("UPDATE flight_log SET identification_count = 2 WHERE key = 'AFR789'")
+	require.NoError(t, err)
+	require.NoError(t, old.Close())
+
+	db, err := NewDB(dbName)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// A single pass of a single sample per flight, whatever polls identified it
+	count, err := db.GetSightingCount()
+	require.NoError(t, err)
+	assert.Equal(t, 10, count)
+	var samples int
+	require.NoError(t, db.db.QueryRow("SELECT SUM(sample_count) FROM sighting").Scan(&samples))
+	assert.Equal(t, 10, samples)
+
+	flights, err := db.GetMostCommonFlights("")
+	require.NoError(t, err)
+	require.NotEmpty(t, flights)
+	for _, flight := range flights {
+		assert.Equal(t, 1, flight.IdentificationCount, flight.Ident)
+	}
+
+	sources, err := db.GetTopSources("")
+	require.NoError(t, err)
+	require.NotEmpty(t, sources)
+	assert.Equal(t, 1, sources[0].Count)
+
+	// The flight keeps its identification count
+	flight, _, err := db.GetFlight("DLH456")
+	require.NoError(t, err)
+	assert.Equal(t, 3, flight.IdentificationCount)
+}
+
+func TestLogFlight_RoundTrip(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+	assert.NoError(t, db.ClearFlightLog())
+
+	route, altitude := "GERSA UN871 BADEP", 370
+	scheduledOut := time.Date(2024, 6, 21, 7, 5, 0, 0, time.UTC)
+	flight := &model.FlightInfo{
+		Ident:          "SWR12",
+		FaFlightID:     "SWR12-1718900000-schedule-0001",
+		Operator:       "SWR",
+		OperatorIcao:   "SWR",
+		OperatorIata:   "LX",
+		Registration:   "HB-JNA",
+		AircraftType:   "B77W",
+		Icao24:         "4b1805",
+		Codeshares:     []string{"UAL9730", "ACA6725"},
+		CodesharesIata: []string{"UA9730"},
+		Origin:         model.AirportDetail{Code: "LSZH", CodeIcao: "LSZH", CodeIata: "ZRH", Timezone: "Europe/Zurich", Name: "Zurich", City: "Zurich"},
+		Destination:    model.AirportDetail{Code: "KJFK", CodeIcao: "KJFK", CodeIata: "JFK", Name: "John F Kennedy Intl", City: "New York"},
+		ScheduledOut:   &scheduledOut,
+		ScheduledOff:   scheduledOut.Add(15 * time.Minute),
+		Route:          &route,
+		FiledAltitude:  &altitude,
+		Diverted:       true,
+		RouteDistance:  3930,
+		Status:         "En Route",
+		Distance:       1234.5,
+		CO2KG:          98000,
+	}
+	assert.NoError(t, db.LogFlight("SWR12", flight))
+	assert.NoError(t, db.LogFlight("SWR12", flight))
+
+	got, _, err := db.GetFlight("SWR12")
+	assert.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, 2, got.IdentificationCount)
+	assert.True(t, scheduledOut.Equal(*got.ScheduledOut))
+	assert.True(t, flight.ScheduledOff.Equal(got.ScheduledOff))
+	assert.True(t, got.ActualOff.IsZero())
+	got.IdentificationCount, got.ScheduledOut, got.ScheduledOff = 0, flight.ScheduledOut, flight.ScheduledOff
+	got.ScheduledOn, got.EstimatedOff, got.EstimatedOn, got.ActualOff, got.ActualOn = time.Time{}, time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	assert.Equal(t, flight, got)
+
+	// A new leg of the same flight becomes the current one
+	next := *flight
+	next.FaFlightID = "SWR12-1718990000-schedule-0001"
+	next.Codeshares, next.CodesharesIata = nil, nil
+	next.Destination = model.AirportDetail{Code: "KEWR", CodeIata: "EWR", City: "Newark"}
+	assert.NoError(t, db.LogFlight("SWR12", &next))
+	got, _, err = db.GetFlight("SWR12")
+	assert.NoError(t, err)
+	assert.Equal(t, "EWR", got.Destination.CodeIata)
+	assert.Nil(t, got.Codeshares)
+	count, err := db.GetFlightCount()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// The compatibility view renders the current leg as the JSON flight_log did
+	var destination, aircraftType string
+	var diverted bool
+	var identificationCount int
+	err = db.db.QueryRow(`SELECT value ->> '$.destination.code_iata', value ->> '$.aircraft_type', value ->> '$.diverted', identification_count
+		FROM flight_log WHERE key = ?`, "SWR12").Scan(&destination, &aircraftType, &diverted, &identificationCount)
+	assert.NoError(t, err)
+	assert.Equal(t, "EWR", destination)
+	assert.Equal(t, "B77W", aircraftType)
+	assert.True(t, diverted)
+	assert.Equal(t, 3, identificationCount)
+
+	var value string
+	assert.NoError(t, db.db.QueryRow("SELECT value FROM flight_log WHERE key = ?", "SWR12").Scan(&value))
+	var logged model.FlightInfo
+	assert.NoError(t, json.Unmarshal([]byte(value), &logged))
+	assert.Equal(t, "HB-JNA", logged.Registration)
+	assert.Equal(t, route, *logged.Route)
+	assert.True(t, scheduledOut.Equal(*logged.ScheduledOut))
+	assert.Equal(t, 1234.5, logged.Distance)
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// autoVacuumIncremental is the value of PRAGMA auto_vacuum for incremental vacuum.
+const autoVacuumIncremental = 2
+
+// errNotIncremental is returned by IncrementalVacuum for a database not in incremental auto vacuum mode.
+var errNotIncremental = errors.New("the database is not in incremental auto vacuum mode, run sopra db maintain to switch it")
+
+// DeleteExpiredCache deletes the cache entries expired at the given time and returns how many were deleted.
+func (c *DB) DeleteExpiredCache(now time.Time) (int64, error) {
+	res, err := c.db.Exec("DELETE FROM key_value_cache WHERE expires_at < ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Optimize lets SQLite update the statistics used by the query planner, where they are likely stale.
+func (c *DB) Optimize() error {
+	_, err := c.db.Exec("PRAGMA optimize")
+	return err
+}
+
+// EnableIncrementalVacuum switches the database to incremental auto vacuum mode, if not in it yet, with a full VACUUM
+// rewriting the whole database file, and returns whether it was switched.
+func (c *DB) EnableIncrementalVacuum() (bool, error) {
+	// The mode is switched on a single connection, as VACUUM applies the auto_vacuum set on its own connection.
+	ctx := context.Background()
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var mode int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return false, err
+	}
+	if mode == autoVacuumIncremental {
+		return false, nil
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// IncrementalVacuum returns the free pages of the database file to the file system and returns how many were freed.
+// A database created before incremental auto vacuum mode, see EnableIncrementalVacuum, is left as it is
+// and fails with errNotIncremental, so that every run of the vacuum job records it.
+func (c *DB) IncrementalVacuum() (int64, error) {
+	ctx := context.Background()
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var mode, before, after int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return 0, err
+	}
+	if mode != autoVacuumIncremental {
+		return 0, errNotIncremental
+	}
+	if err := conn.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&before); err != nil {
+		return 0, err
+	}
+	if err := incrementalVacuum(ctx, conn); err != nil {
+		return 0, err
+	}
+	if err := conn.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&after); err != nil {
+		return 0, err
+	}
+	return before - after, nil
+}
+
+// incrementalVacuum runs PRAGMA incremental_vacuum to the end: it frees a page at every step,
+// so it is run as a query whose rows are all read, rather than executed with a single step.
+func incrementalVacuum(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, "PRAGMA incremental_vacuum")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// Checkpoint copies the write-ahead log, if any, into the database file and truncates it,
+// and returns how many pages were copied.
+func (c *DB) Checkpoint() (int64, error) {
+	var busy, logPages, checkpointed int64
+	if err := c.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logPages, &checkpointed); err != nil {
+		return 0, err
+	}
+	// Not in WAL mode there is no log, and -1 pages
+	return max(checkpointed, 0), nil
+}
+
+// RecordMaintenanceRun stores a run of a maintenance job.
+func (c *DB) RecordMaintenanceRun(run *model.MaintenanceRun) error {
+	return c.db.QueryRow(
+		"INSERT INTO maintenance_run (job, started_at, duration_ms, affected, error) VALUES (?, ?, ?, ?, ?) RETURNING id",
+		run.Job, run.StartedAt, run.DurationMs, run.Affected, run.Error,
+	).Scan(&run.ID)
+}
+
+// GetMaintenanceRuns retrieves the latest runs of the maintenance jobs, newest first, up to limit.
+func (c *DB) GetMaintenanceRuns(limit int) ([]*model.MaintenanceRun, error) {
+	rows, err := c.db.Query(`
+		SELECT id, job, started_at, duration_ms, affected, error
+		FROM maintenance_run
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*model.MaintenanceRun
+	for rows.Next() {
+		run, err := scanMaintenanceRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetLastMaintenanceRuns returns when each maintenance job last ran, by job.
+func (c *DB) GetLastMaintenanceRuns() (map[string]time.Time, error) {
+	rows, err := c.db.Query("SELECT job, started_at FROM maintenance_run WHERE id IN (SELECT MAX(id) FROM maintenance_run GROUP BY job)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	last := make(map[string]time.Time)
+	for rows.Next() {
+		var job string
+		var startedAt time.Time
+		if err := rows.Scan(&job, &startedAt); err != nil {
+			return nil, err
+		}
+		last[job] = startedAt
+	}
+	return last, rows.Err()
+}
+
+// DeleteMaintenanceRunsBefore deletes the runs of the maintenance jobs started before the given time
+// and returns how many were deleted.
+func (c *DB) DeleteMaintenanceRunsBefore(before time.Time) (int64, error) {
+	res, err := c.db.Exec("DELETE FROM maintenance_run WHERE started_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanMaintenanceRun(row rowScanner) (*model.MaintenanceRun, error) {
+	var run model.MaintenanceRun
+	if err := row.Scan(&run.ID, &run.Job, &run.StartedAt, &run.DurationMs, &run.Affected, &run.Error); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
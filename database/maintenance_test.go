@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteExpiredCache(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	require.NoError(t, db.Set("expired", "a", -time.Minute))
+	require.NoError(t, db.Set("fresh", "b", time.Hour))
+
+	deleted, err := db.DeleteExpiredCache(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var keys []string
+	rows, err := db.db.Query("SELECT key FROM key_value_cache")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		require.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"fresh"}, keys)
+}
+
+func TestIncrementalVacuum_NewDatabase(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	var mode int
+	require.NoError(t, db.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode))
+	assert.Equal(t, autoVacuumIncremental, mode)
+	switched, err := db.EnableIncrementalVacuum()
+	require.NoError(t, err)
+	assert.False(t, switched)
+	_, err = db.IncrementalVacuum()
+	require.NoError(t, err)
+}
+
+func TestIncrementalVacuum(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	// A database created before incremental auto vacuum mode
+	legacy, err := sql.Open(driverName, dbName)
+	require.NoError(t, err)
+	_, err = legacy.Exec("CREATE TABLE legacy (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	// The vacuum leaves a database not in incremental auto vacuum mode as it is, failing until switched
+	_, err = db.IncrementalVacuum()
+	require.ErrorIs(t, err, errNotIncremental)
+	var mode int
+	require.NoError(t, db.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode))
+	assert.Zero(t, mode)
+	switched, err := db.EnableIncrementalVacuum()
+	require.NoError(t, err)
+	assert.True(t, switched)
+	require.NoError(t, db.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode))
+	assert.Equal(t, autoVacuumIncremental, mode)
+	switched, err = db.EnableIncrementalVacuum()
+	require.NoError(t, err)
+	assert.False(t, switched)
+
+	// Pages freed by deleting rows are returned by the next ones
+	value := strings.Repeat("x", 4096)
+	for i := range 50 {
+		require.NoError(t, db.Set(fmt.Sprintf("key%d", i), value, -time.Minute))
+	}
+	_, err = db.DeleteExpiredCache(time.Now())
+	require.NoError(t, err)
+	freed, err := db.IncrementalVacuum()
+	require.NoError(t, err)
+	assert.Positive(t, freed)
+	var free int
+	require.NoError(t, db.db.QueryRow("PRAGMA freelist_count").Scan(&free))
+	assert.Zero(t, free)
+
+	checkpointed, err := db.Checkpoint()
+	require.NoError(t, err)
+	assert.Zero(t, checkpointed)
+	require.NoError(t, db.Optimize())
+}
+
+func TestMaintenanceRuns(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	now := time.Now().Truncate(time.Second)
+	runs := []*model.MaintenanceRun{
+		{Job: "cache", StartedAt: now.AddDate(0, 0, -40), DurationMs: 3, Affected: 5},
+		{Job: "cache", StartedAt: now.Add(-time.Hour), DurationMs: 2, Affected: 1},
+		{Job: "vacuum", StartedAt: now, DurationMs: 10, Error: "database is locked"},
+	}
+	for _, run := range runs {
+		require.NoError(t, db.RecordMaintenanceRun(run))
+		assert.NotZero(t, run.ID)
+	}
+
+	latest, err := db.GetMaintenanceRuns(2)
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	assert.Equal(t, "vacuum", latest[0].Job)
+	assert.Equal(t, "database is locked", latest[0].Error)
+	assert.Equal(t, runs[1].ID, latest[1].ID)
+	assert.Equal(t, int64(1), latest[1].Affected)
+	assert.True(t, now.Add(-time.Hour).Equal(latest[1].StartedAt))
+
+	last, err := db.GetLastMaintenanceRuns()
+	require.NoError(t, err)
+	require.Len(t, last, 2)
+	assert.True(t, now.Add(-time.Hour).Equal(last["cache"]))
+	assert.True(t, now.Equal(last["vacuum"]))
+
+	deleted, err := db.DeleteMaintenanceRunsBefore(now.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// trackMargin is how long before the first and after the last observation of a sighting the positions are part
+// of its track: the positions reported by OpenSky are up to several seconds older than the polls observing them.
+const trackMargin = time.Minute
+
+const positionColumns = "time, icao24, callsign, latitude, longitude, baro_altitude, geo_altitude, velocity, true_track, vertical_rate, on_ground"
+
+// RecordPositions stores the positions of the states polled at, reported at their time position or, when unknown,
+// at the poll. A position already stored, reported again by a later poll, is skipped, and so are states without one.
+func (c *DB) RecordPositions(states []model.Flight, at time.Time) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO position (" + positionColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, state := range states {
+		if state.Latitude == 0 && state.Longitude == 0 {
+			continue
+		}
+		reported := at
+		if state.TimePosition > 0 {
+			reported = time.Unix(int64(state.TimePosition), 0)
+		}
+		_, err := stmt.Exec(reported, state.Icao24, state.Callsign, state.Latitude, state.Longitude, state.BaroAltitude,
+			state.GeoAltitude, state.Velocity, state.TrueTrack, state.VerticalRate, state.OnGround)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTrack returns the positions of the aircraft of a sighting during the pass, in time order.
+func (c *DB) GetTrack(sighting *model.Sighting) ([]model.Position, error) {
+	rows, err := c.db.Query("SELECT "+positionColumns+" FROM position WHERE icao24 = ? AND time >= ? AND time <= ? ORDER BY time",
+		sighting.Icao24, sighting.FirstSeen.Add(-trackMargin), sighting.LastSeen.Add(trackMargin))
+	if err != nil {
+		return nil, err
+	}
+	return scanPositions(rows)
+}
+
+// GetPositionsWithin returns the positions reported in [from, to) within radiusKm of a point, in time order.
+// The positions in the bounding box of the circle are read, and the ones outside the circle skipped.
+func (c *DB) GetPositionsWithin(lat, lon, radiusKm float64, from, to time.Time) ([]model.Position, error) {
+	box := haversine.GetBoundingBox(lat, lon, radiusKm)
+	rows, err := c.db.Query("SELECT "+positionColumns+` FROM position
+		WHERE time >= ? AND time < ? AND latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
+		ORDER BY time, id`,
+		from, to, box.MinLat, box.MaxLat, box.MinLon, box.MaxLon)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := scanPositions(rows)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(positions, func(p model.Position) bool {
+		return haversine.Distance(lat, lon, p.Latitude, p.Longitude) > radiusKm
+	}), nil
+}
+
+// scanPositions reads the positions selected with positionColumns and closes the rows.
+func scanPositions(rows *sql.Rows) ([]model.Position, error) {
+	defer rows.Close()
+	var positions []model.Position
+	for rows.Next() {
+		var p model.Position
+		if err := rows.Scan(&p.Time, &p.Icao24, &p.Callsign, &p.Latitude, &p.Longitude, &p.BaroAltitude, &p.GeoAltitude,
+			&p.Velocity, &p.TrueTrack, &p.VerticalRate, &p.OnGround); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// DownsamplePositions keeps, of the positions reported before the given time, the first of each aircraft
+// in every interval, and returns how many positions were deleted.
+func (c *DB) DownsamplePositions(before time.Time, interval time.Duration) (int64, error) {
+	res, err := c.db.Exec(`
+		DELETE FROM position
+		WHERE time < ? AND id NOT IN (
+			SELECT MIN(id) FROM position WHERE time < ?
+			GROUP BY icao24, CAST(strftime('%s', time) AS INTEGER) / ?
+		)`, before, before, int64(interval.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeletePositionsBefore deletes the positions reported before the given time and returns how many were deleted.
+func (c *DB) DeletePositionsBefore(before time.Time) (int64, error) {
+	res, err := c.db.Exec("DELETE FROM position WHERE time < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
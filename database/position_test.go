@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordPositions(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	now := time.Now().Truncate(time.Second)
+	states := []model.Flight{
+		{Icao24: "4b1805", Callsign: "SWR12", TimePosition: int(now.Unix()) - 5, Latitude: 47.4, Longitude: 8.5, BaroAltitude: 3000, Velocity: 120},
+		{Icao24: "4b1806", Callsign: "SWR13"}, // no position
+		{Icao24: "4b1807", Callsign: "EZY45", Latitude: 47.5, Longitude: 8.6, OnGround: true},
+	}
+	require.NoError(t, db.RecordPositions(states, now))
+	// The next poll reports the same position of 4b1805 again, and a newer one of 4b1807
+	states[2].Longitude = 8.7
+	require.NoError(t, db.RecordPositions(states, now.Add(10*time.Second)))
+
+	track, err := db.GetTrack(&model.Sighting{Icao24: "4b1805", FirstSeen: now, LastSeen: now})
+	require.NoError(t, err)
+	require.Len(t, track, 1)
+	assert.Equal(t, now.Add(-5*time.Second).Unix(), track[0].Time.Unix())
+	assert.Equal(t, 3000.0, track[0].BaroAltitude)
+
+	track, err = db.GetTrack(&model.Sighting{Icao24: "4b1807", FirstSeen: now, LastSeen: now.Add(10 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, track, 2)
+	assert.True(t, track[1].OnGround)
+	assert.Equal(t, 8.7, track[1].Longitude)
+
+	track, err = db.GetTrack(&model.Sighting{Icao24: "4b1806", FirstSeen: now, LastSeen: now})
+	require.NoError(t, err)
+	assert.Empty(t, track)
+
+	// Outside of the margin around the pass
+	track, err = db.GetTrack(&model.Sighting{Icao24: "4b1805", FirstSeen: now.Add(time.Hour), LastSeen: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, track)
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredictionOutcomes(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	start := time.Now().Add(-time.Hour)
+	predicted := func(icao24 string) model.Prediction {
+		return model.Prediction{Site: "home", Icao24: icao24, PredictedAt: start, EntryTime: start.Add(3 * time.Minute), ClosestDistance: 2000}
+	}
+	outcomes := []*model.PredictionOutcome{
+		// 20 seconds late and 500 m farther, 20 seconds early and 300 m closer
+		{Prediction: predicted("abc123"), Outcome: model.PredictionEntered, ActualEntry: start.Add(200 * time.Second), ActualDistance: 2500, ResolvedAt: start.Add(5 * time.Minute)},
+		{Prediction: predicted("def456"), Outcome: model.PredictionEntered, ActualEntry: start.Add(160 * time.Second), ActualDistance: 1700, ResolvedAt: start.Add(5 * time.Minute)},
+		{Prediction: predicted("ghi789"), Outcome: model.PredictionMissed, ResolvedAt: start.Add(5 * time.Minute)},
+		{Prediction: model.Prediction{Site: "home", Icao24: "jkl012"}, Outcome: model.PredictionUnpredicted, ActualEntry: start, ActualDistance: 800, ResolvedAt: start.Add(5 * time.Minute)},
+		{Prediction: predicted("mno345"), Outcome: model.PredictionMissed, ResolvedAt: start.Add(-time.Hour)},
+		{Prediction: model.Prediction{Site: "office", Icao24: "abc123"}, Outcome: model.PredictionUnpredicted, ActualEntry: start, ResolvedAt: start.Add(5 * time.Minute)},
+	}
+	for _, o := range outcomes {
+		assert.NoError(t, db.RecordPredictionOutcome(o))
+	}
+
+	accuracy, err := db.GetPredictionAccuracy(start, "home")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.PredictionAccuracy{Entered: 2, Missed: 1, Unpredicted: 1, MeanEntryError: 20, MeanDistanceError: 400, MeanLead: 180}, accuracy)
+
+	accuracy, err = db.GetPredictionAccuracy(start, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, accuracy.Unpredicted)
+
+	accuracy, err = db.GetPredictionAccuracy(time.Now(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.PredictionAccuracy{}, accuracy)
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// ReplaceRecurringFlights replaces the stored recurring flights with newly learned ones.
+func (c *DB) ReplaceRecurringFlights(flights []model.RecurringFlight) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recurring_flight"); err != nil {
+		return err
+	}
+	for _, f := range flights {
+		weekdays, err := json.Marshal(f.Weekdays)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO recurring_flight (site, callsign, minute, tolerance, weekdays, occurrences, regularity) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			siteOrDefault(f.Site), f.Callsign, f.Minute, f.Tolerance, string(weekdays), f.Occurrences, f.Regularity)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRecurringFlights returns the recurring flights in time of day order, optionally restricted to a site.
+func (c *DB) GetRecurringFlights(site string) ([]model.RecurringFlight, error) {
+	rows, err := c.db.Query("SELECT site, callsign, minute, tolerance, weekdays, occurrences, regularity FROM recurring_flight WHERE ? = '' OR site = ? ORDER BY minute, site, callsign",
+		site, site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flights []model.RecurringFlight
+	for rows.Next() {
+		var f model.RecurringFlight
+		var weekdays string
+		if err := rows.Scan(&f.Site, &f.Callsign, &f.Minute, &f.Tolerance, &weekdays, &f.Occurrences, &f.Regularity); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(weekdays), &f.Weekdays); err != nil {
+			return nil, err
+		}
+		flights = append(flights, f)
+	}
+	return flights, rows.Err()
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecurringFlights(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	assert.NoError(t, db.ReplaceRecurringFlights([]model.RecurringFlight{
+		{Site: "home", Callsign: "SWR12", Minute: 1080, Tolerance: 15, Weekdays: weekdays, Occurrences: 16, Regularity: 0.8},
+		{Callsign: "EZY34", Minute: 462, Tolerance: 10, Weekdays: []time.Weekday{time.Saturday}, Occurrences: 4, Regularity: 1},
+	}))
+
+	flights, err := db.GetRecurringFlights("")
+	assert.NoError(t, err)
+	require.Len(t, flights, 2)
+	assert.Equal(t, model.RecurringFlight{Site: "default", Callsign: "EZY34", Minute: 462, Tolerance: 10,
+		Weekdays: []time.Weekday{time.Saturday}, Occurrences: 4, Regularity: 1}, flights[0])
+	assert.Equal(t, weekdays, flights[1].Weekdays)
+
+	flights, err = db.GetRecurringFlights("home")
+	assert.NoError(t, err)
+	require.Len(t, flights, 1)
+	assert.Equal(t, "SWR12", flights[0].Callsign)
+
+	// Learning again replaces all the flights
+	assert.NoError(t, db.ReplaceRecurringFlights(nil))
+	flights, err = db.GetRecurringFlights("")
+	assert.NoError(t, err)
+	assert.Empty(t, flights)
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const ruleColumns = "id, name, expression, severity, cooldown, actions, enabled"
+
+func scanRule(row rowScanner) (*model.Rule, error) {
+	var r model.Rule
+	var actions string
+	if err := row.Scan(&r.ID, &r.Name, &r.Expression, &r.Severity, &r.Cooldown, &actions, &r.Enabled); err != nil {
+		return nil, err
+	}
+	if actions != "" {
+		r.Actions = strings.Split(actions, ",")
+	}
+	return &r, nil
+}
+
+// GetRules retrieves the stored rules, ordered by ID.
+func (c *DB) GetRules() ([]*model.Rule, error) {
+	rows, err := c.db.Query("SELECT " + ruleColumns + " FROM rule ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*model.Rule
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// GetRule retrieves a stored rule, or nil if there is none with that ID.
+func (c *DB) GetRule(id int64) (*model.Rule, error) {
+	r, err := scanRule(c.db.QueryRow("SELECT "+ruleColumns+" FROM rule WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// CreateRule stores a new rule and sets its ID.
+func (c *DB) CreateRule(r *model.Rule) error {
+	now := time.Now().UTC()
+	res, err := c.db.Exec("INSERT INTO rule (name, expression, severity, cooldown, actions, enabled, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Name, r.Expression, r.Severity, r.Cooldown, strings.Join(r.Actions, ","), r.Enabled, now, now)
+	if err != nil {
+		return err
+	}
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// UpdateRule replaces a stored rule. It returns false when there is no rule with its ID.
+func (c *DB) UpdateRule(r *model.Rule) (bool, error) {
+	res, err := c.db.Exec("UPDATE rule SET name = ?, expression = ?, severity = ?, cooldown = ?, actions = ?, enabled = ?, updated_at = ? WHERE id = ?",
+		r.Name, r.Expression, r.Severity, r.Cooldown, strings.Join(r.Actions, ","), r.Enabled, time.Now().UTC(), r.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteRule deletes a stored rule. It returns false when there is no rule with that ID.
+func (c *DB) DeleteRule(id int64) (bool, error) {
+	res, err := c.db.Exec("DELETE FROM rule WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
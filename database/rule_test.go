@@ -0,0 +1,51 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	rule := &model.Rule{Name: "heavy", Expression: `aircraft_type == "A388"`, Severity: "warning", Cooldown: 600, Actions: []string{"log", "webhook"}, Enabled: true}
+	assert.NoError(t, db.CreateRule(rule))
+	assert.NotZero(t, rule.ID)
+	assert.Error(t, db.CreateRule(&model.Rule{Name: "heavy", Expression: "true"}), "names are unique")
+
+	stored, err := db.GetRule(rule.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, rule, stored)
+
+	rule.Enabled = false
+	rule.Actions = []string{"mqtt"}
+	found, err := db.UpdateRule(rule)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	rules, err := db.GetRules()
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Rule{rule}, rules)
+
+	found, err = db.DeleteRule(rule.ID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	found, err = db.DeleteRule(rule.ID)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	stored, err = db.GetRule(rule.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+}
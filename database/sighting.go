@@ -0,0 +1,205 @@
+package database
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const sightingColumns = "id, site, icao24, callsign, first_seen, last_seen, min_distance, min_altitude, entry_bearing, exit_bearing, sample_count, peak_noise, noise_exposure"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// siteOrDefault returns the site, falling back to the default site when empty.
+func siteOrDefault(site string) string {
+	if site == "" {
+		return config.DefaultSite
+	}
+	return site
+}
+
+func scanSighting(row rowScanner) (*model.Sighting, error) {
+	var s model.Sighting
+	var minDistance, minAltitude, entryBearing, exitBearing, peakNoise, noiseExposure sql.NullFloat64
+	if err := row.Scan(&s.ID, &s.Site, &s.Icao24, &s.Callsign, &s.FirstSeen, &s.LastSeen,
+		&minDistance, &minAltitude, &entryBearing, &exitBearing, &s.SampleCount, &peakNoise, &noiseExposure); err != nil {
+		return nil, err
+	}
+	s.MinDistance = minDistance.Float64
+	s.MinAltitude = minAltitude.Float64
+	s.EntryBearing = entryBearing.Float64
+	s.ExitBearing = exitBearing.Float64
+	s.PeakNoise = peakNoise.Float64
+	s.NoiseExposure = noiseExposure.Float64
+	return &s, nil
+}
+
+// RecordSighting adds an observation to the open sighting of the same aircraft at the same site,
+// or starts a new sighting when the last one was seen more than gap ago. The noise estimate of the
+// loudest observation is kept.
+func (c *DB) RecordSighting(obs model.Observation, gap time.Duration) (*model.Sighting, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT "+sightingColumns+" FROM sighting WHERE site = ? AND icao24 = ? AND callsign = ? AND last_seen >= ? ORDER BY last_seen DESC LIMIT 1",
+		siteOrDefault(obs.Site), obs.Icao24, obs.Callsign, obs.Time.Add(-gap))
+	sighting, err := scanSighting(row)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if sighting == nil {
+		sighting = &model.Sighting{
+			Site:          siteOrDefault(obs.Site),
+			Icao24:        obs.Icao24,
+			Callsign:      obs.Callsign,
+			FirstSeen:     obs.Time,
+			LastSeen:      obs.Time,
+			MinDistance:   obs.Distance,
+			MinAltitude:   model.LowerAltitude(0, obs.Altitude),
+			EntryBearing:  obs.Bearing,
+			ExitBearing:   obs.Bearing,
+			SampleCount:   1,
+			PeakNoise:     obs.NoiseLevel,
+			NoiseExposure: obs.NoiseExposure,
+		}
+		res, err := tx.Exec("INSERT INTO sighting (site, icao24, callsign, first_seen, last_seen, min_distance, min_altitude, entry_bearing, exit_bearing, sample_count, peak_noise, noise_exposure) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			sighting.Site, sighting.Icao24, sighting.Callsign, sighting.FirstSeen, sighting.LastSeen, sighting.MinDistance, nullIfZero(sighting.MinAltitude), sighting.EntryBearing, sighting.ExitBearing, sighting.SampleCount,
+			nullIfZero(sighting.PeakNoise), nullIfZero(sighting.NoiseExposure))
+		if err != nil {
+			return nil, err
+		}
+		if sighting.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+	} else {
+		sighting.LastSeen = obs.Time
+		sighting.MinDistance = math.Min(sighting.MinDistance, obs.Distance)
+		sighting.MinAltitude = model.LowerAltitude(sighting.MinAltitude, obs.Altitude)
+		sighting.ExitBearing = obs.Bearing
+		sighting.SampleCount++
+		if obs.NoiseLevel != 0 && (sighting.PeakNoise == 0 || obs.NoiseLevel > sighting.PeakNoise) {
+			sighting.PeakNoise = obs.NoiseLevel
+			sighting.NoiseExposure = obs.NoiseExposure
+		}
+		_, err := tx.Exec("UPDATE sighting SET last_seen = ?, min_distance = ?, min_altitude = ?, exit_bearing = ?, sample_count = ?, peak_noise = ?, noise_exposure = ? WHERE id = ?",
+			sighting.LastSeen, sighting.MinDistance, nullIfZero(sighting.MinAltitude), sighting.ExitBearing, sighting.SampleCount,
+			nullIfZero(sighting.PeakNoise), nullIfZero(sighting.NoiseExposure), sighting.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sighting, nil
+}
+
+// GetSighting retrieves a sighting by id, nil when there is none.
+func (c *DB) GetSighting(id int64) (*model.Sighting, error) {
+	sighting, err := scanSighting(c.db.QueryRow("SELECT "+sightingColumns+" FROM sighting WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sighting, err
+}
+
+// GetRecentSightings retrieves the most recent sightings, newest first, optionally restricted to a site.
+func (c *DB) GetRecentSightings(limit int, site string) ([]*model.Sighting, error) {
+	rows, err := c.db.Query("SELECT "+sightingColumns+" FROM sighting WHERE ? = '' OR site = ? ORDER BY last_seen DESC LIMIT ?", site, site, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sightings []*model.Sighting
+	for rows.Next() {
+		s, err := scanSighting(rows)
+		if err != nil {
+			return nil, err
+		}
+		sightings = append(sightings, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sightings, nil
+}
+
+// GetNoisySightingsSince retrieves the sightings with a noise estimate started since the given time,
+// optionally restricted to a site, the loudest first.
+func (c *DB) GetNoisySightingsSince(since time.Time, site string) ([]*model.Sighting, error) {
+	rows, err := c.db.Query("SELECT "+sightingColumns+" FROM sighting WHERE peak_noise IS NOT NULL AND first_seen >= ? AND (? = '' OR site = ?) ORDER BY peak_noise DESC",
+		since, site, site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sightings []*model.Sighting
+	for rows.Next() {
+		s, err := scanSighting(rows)
+		if err != nil {
+			return nil, err
+		}
+		sightings = append(sightings, s)
+	}
+	return sightings, rows.Err()
+}
+
+// GetSightingsBetween retrieves the sightings started from the given time and before the other,
+// optionally restricted to a site, in the order they started.
+func (c *DB) GetSightingsBetween(from, to time.Time, site string) ([]*model.Sighting, error) {
+	rows, err := c.db.Query("SELECT "+sightingColumns+" FROM sighting WHERE first_seen >= ? AND first_seen < ? AND (? = '' OR site = ?) ORDER BY first_seen",
+		from, to, site, site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sightings []*model.Sighting
+	for rows.Next() {
+		s, err := scanSighting(rows)
+		if err != nil {
+			return nil, err
+		}
+		sightings = append(sightings, s)
+	}
+	return sightings, rows.Err()
+}
+
+// nullIfZero stores unknown values, zero, as NULL.
+func nullIfZero(v float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: v, Valid: v != 0}
+}
+
+// GetSightingCount returns the total number of sightings.
+func (c *DB) GetSightingCount() (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM sighting").Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetSightingCountSince returns the number of sightings started since the given time, optionally restricted to a site.
+func (c *DB) GetSightingCountSince(since time.Time, site string) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM sighting WHERE first_seen >= ? AND (? = '' OR site = ?)", since, site, site).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
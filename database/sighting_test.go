@@ -0,0 +1,178 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordSighting(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	err = db.ClearFlightLog()
+	assert.NoError(t, err)
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	gap := 10 * time.Minute
+
+	observations := []model.Observation{
+		{Icao24: "4b1805", Callsign: "SWR123", Time: start, Distance: 9000, Altitude: 5000, Bearing: 270},
+		{Icao24: "4b1805", Callsign: "SWR123", Time: start.Add(time.Minute), Distance: 2000, Altitude: 4000, Bearing: 200},
+		{Icao24: "4b1805", Callsign: "SWR123", Time: start.Add(2 * time.Minute), Distance: 6000, Altitude: 4500, Bearing: 90},
+	}
+	var sighting *model.Sighting
+	for _, obs := range observations {
+		sighting, err = db.RecordSighting(obs, gap)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, start, sighting.FirstSeen)
+	assert.Equal(t, start.Add(2*time.Minute), sighting.LastSeen)
+	assert.Equal(t, 2000.0, sighting.MinDistance)
+	assert.Equal(t, 4000.0, sighting.MinAltitude)
+	assert.Equal(t, 270.0, sighting.EntryBearing)
+	assert.Equal(t, 90.0, sighting.ExitBearing)
+	assert.Equal(t, 3, sighting.SampleCount)
+
+	// Seen again after the gap: a new pass starts
+	next, err := db.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR123", Time: start.Add(time.Hour), Distance: 3000, Bearing: 10}, gap)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sighting.ID, next.ID)
+	assert.Equal(t, 1, next.SampleCount)
+
+	sightings, err := db.GetRecentSightings(10, "")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 2)
+	assert.Equal(t, next.ID, sightings[0].ID)
+	assert.Equal(t, 3, sightings[1].SampleCount)
+	assert.Equal(t, 2000.0, sightings[1].MinDistance)
+}
+
+func TestRecordSighting_Sites(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	err = db.ClearFlightLog()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.NoError(t, db.LogFlight("SWR123", &model.FlightInfo{Ident: "SWR123"}))
+	assert.NoError(t, db.LogFlight("EZY45", &model.FlightInfo{Ident: "EZY45"}))
+
+	// The same aircraft over two overlapping sites gets a pass at each
+	zurich, err := db.RecordSighting(model.Observation{Site: "zurich", Icao24: "4b1805", Callsign: "SWR123", Time: now}, time.Minute)
+	assert.NoError(t, err)
+	geneva, err := db.RecordSighting(model.Observation{Site: "geneva", Icao24: "4b1805", Callsign: "SWR123", Time: now}, time.Minute)
+	assert.NoError(t, err)
+	assert.NotEqual(t, zurich.ID, geneva.ID)
+	_, err = db.RecordSighting(model.Observation{Site: "geneva", Icao24: "440123", Callsign: "EZY45", Time: now.Add(time.Second)}, time.Minute)
+	assert.NoError(t, err)
+
+	sightings, err := db.GetRecentSightings(10, "zurich")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 1)
+	assert.Equal(t, "zurich", sightings[0].Site)
+
+	sightings, err = db.GetRecentSightings(10, "")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 3)
+
+	flights, _, err := db.GetAllFlights(0, "zurich")
+	assert.NoError(t, err)
+	assert.Len(t, flights, 1)
+	assert.Equal(t, "SWR123", flights[0].Ident)
+
+	latest, _, err := db.GetLatestFlight("geneva")
+	assert.NoError(t, err)
+	assert.Equal(t, "EZY45", latest.Ident)
+
+	latest, _, err = db.GetLatestFlight("basel")
+	assert.NoError(t, err)
+	assert.Nil(t, latest)
+
+	common, err := db.GetMostCommonFlights("geneva")
+	assert.NoError(t, err)
+	assert.Len(t, common, 2)
+
+	count, err := db.GetSightingCountSince(now, "geneva")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = db.GetSightingCountSince(now.Add(time.Second), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	between, err := db.GetSightingsBetween(now, now.Add(time.Second), "geneva")
+	assert.NoError(t, err)
+	assert.Len(t, between, 1)
+	assert.Equal(t, "SWR123", between[0].Callsign)
+	between, err = db.GetSightingsBetween(now, now.Add(time.Minute), "")
+	assert.NoError(t, err)
+	assert.Len(t, between, 3)
+}
+
+func TestRecordSighting_Noise(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+	assert.NoError(t, db.ClearFlightLog())
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	gap := 10 * time.Minute
+	for i, level := range []float64{0, 62.5, 71.2, 0, 65} {
+		_, err := db.RecordSighting(model.Observation{Site: "home", Icao24: "4b1805", Callsign: "SWR123", Time: start.Add(time.Duration(i) * time.Minute),
+			NoiseLevel: level, NoiseExposure: level + 10}, gap)
+		assert.NoError(t, err)
+	}
+	_, err = db.RecordSighting(model.Observation{Site: "home", Icao24: "3c6444", Callsign: "DLH4", Time: start, NoiseLevel: 75.5, NoiseExposure: 88}, gap)
+	assert.NoError(t, err)
+	_, err = db.RecordSighting(model.Observation{Site: "home", Icao24: "440123", Callsign: "EZY1", Time: start}, gap)
+	assert.NoError(t, err)
+	_, err = db.RecordSighting(model.Observation{Site: "office", Icao24: "4b1805", Callsign: "SWR123", Time: start, NoiseLevel: 80, NoiseExposure: 90}, gap)
+	assert.NoError(t, err)
+
+	// The loudest observation of each pass, loudest pass first, passes without estimate left out
+	sightings, err := db.GetNoisySightingsSince(start, "home")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 2)
+	assert.Equal(t, "DLH4", sightings[0].Callsign)
+	assert.Equal(t, 75.5, sightings[0].PeakNoise)
+	assert.Equal(t, 88.0, sightings[0].NoiseExposure)
+	assert.Equal(t, "SWR123", sightings[1].Callsign)
+	assert.Equal(t, 71.2, sightings[1].PeakNoise)
+	assert.Equal(t, 81.2, sightings[1].NoiseExposure)
+
+	sightings, err = db.GetNoisySightingsSince(start, "")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 3)
+	sightings, err = db.GetNoisySightingsSince(start.Add(time.Minute), "")
+	assert.NoError(t, err)
+	assert.Empty(t, sightings)
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const squawkAlertColumns = "id, site, icao24, callsign, kind, severity, squawk, state, last_state, first_seen, last_seen"
+
+func scanSquawkAlert(row rowScanner) (*model.SquawkAlert, error) {
+	var a model.SquawkAlert
+	var state, lastState string
+	if err := row.Scan(&a.ID, &a.Site, &a.Icao24, &a.Callsign, &a.Kind, &a.Severity, &a.Squawk, &state, &lastState, &a.FirstSeen, &a.LastSeen); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(state), &a.State); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(lastState), &a.LastState); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// RecordSquawkAlert stores a flagged state vector as the last one of the open alert of the same kind for the same
+// aircraft at the same site, or opens a new alert raised by it when the last one was seen more than gap ago.
+// It reports whether a new alert was opened.
+func (c *DB) RecordSquawkAlert(site, kind, severity string, state *model.Flight, at time.Time, gap time.Duration) (*model.SquawkAlert, bool, error) {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT "+squawkAlertColumns+" FROM squawk_alert WHERE site = ? AND icao24 = ? AND kind = ? AND last_seen >= ? ORDER BY last_seen DESC LIMIT 1",
+		siteOrDefault(site), state.Icao24, kind, at.Add(-gap))
+	alert, err := scanSquawkAlert(row)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	opened := alert == nil
+	if opened {
+		alert = &model.SquawkAlert{Site: siteOrDefault(site), Icao24: state.Icao24, Callsign: state.Callsign, Kind: kind,
+			Severity: severity, Squawk: state.Squawk, State: *state, FirstSeen: at}
+	}
+	if alert.Callsign == "" {
+		alert.Callsign = state.Callsign // may appear after the squawk
+	}
+	alert.LastState = *state
+	alert.LastSeen = at
+
+	if opened {
+		res, err := tx.Exec("INSERT INTO squawk_alert (site, icao24, callsign, kind, severity, squawk, state, last_state, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			alert.Site, alert.Icao24, alert.Callsign, alert.Kind, alert.Severity, alert.Squawk, string(stateJSON), string(stateJSON), alert.FirstSeen, alert.LastSeen)
+		if err != nil {
+			return nil, false, err
+		}
+		if alert.ID, err = res.LastInsertId(); err != nil {
+			return nil, false, err
+		}
+	} else {
+		_, err := tx.Exec("UPDATE squawk_alert SET callsign = ?, last_state = ?, last_seen = ? WHERE id = ?",
+			alert.Callsign, string(stateJSON), alert.LastSeen, alert.ID)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return alert, opened, nil
+}
+
+// GetSquawkAlertsSince returns the alerts seen since the given time, most recently seen first, optionally restricted to a site.
+func (c *DB) GetSquawkAlertsSince(since time.Time, site string) ([]*model.SquawkAlert, error) {
+	rows, err := c.db.Query("SELECT "+squawkAlertColumns+" FROM squawk_alert WHERE last_seen >= ? AND (? = '' OR site = ?) ORDER BY last_seen DESC",
+		since, site, site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*model.SquawkAlert
+	for rows.Next() {
+		a, err := scanSquawkAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
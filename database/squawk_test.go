@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSquawkAlerts(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	start := time.Now().Add(-time.Hour)
+	state := &model.Flight{Icao24: "4b1805", Squawk: "7700", BaroAltitude: 3000, Latitude: 47.4, Longitude: 8.5}
+	alert, opened, err := db.RecordSquawkAlert("", "emergency", "critical", state, start, 15*time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+	assert.Equal(t, "default", alert.Site)
+
+	// The callsign may appear later, the alert stays open while the aircraft is seen
+	descending := *state
+	descending.Callsign = "SWR12"
+	descending.BaroAltitude = 1500
+	extended, opened, err := db.RecordSquawkAlert("", "emergency", "critical", &descending, start.Add(5*time.Minute), 15*time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, opened)
+	assert.Equal(t, alert.ID, extended.ID)
+
+	// Another kind opens its own alert
+	_, opened, err = db.RecordSquawkAlert("office", "spi", "warning", state, start.Add(5*time.Minute), 15*time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+
+	alerts, err := db.GetSquawkAlertsSince(start, "default")
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "SWR12", alerts[0].Callsign)
+	assert.Equal(t, 3000.0, alerts[0].State.BaroAltitude)
+	assert.Equal(t, 1500.0, alerts[0].LastState.BaroAltitude)
+	assert.WithinDuration(t, start, alerts[0].FirstSeen, 0)
+	assert.WithinDuration(t, start.Add(5*time.Minute), alerts[0].LastSeen, 0)
+
+	// After the gap a new alert is opened
+	_, opened, err = db.RecordSquawkAlert("", "emergency", "critical", state, start.Add(time.Hour), 15*time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+	alerts, err = db.GetSquawkAlertsSince(start, "")
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 3)
+	assert.Equal(t, "emergency", alerts[0].Kind)
+	assert.Equal(t, "spi", alerts[1].Kind)
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/carlo-colombo/sopra/storage"
+	"github.com/carlo-colombo/sopra/storage/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		dbName := fmt.Sprintf("%s.db", strings.ReplaceAll(t.Name(), "/", "_"))
+		os.Remove(dbName)
+		db, err := NewDB(dbName)
+		if err != nil {
+			t.Fatalf("failed to create test db: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+			os.Remove(dbName)
+		})
+		return db
+	})
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDeliveryQueue(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	first := &model.WebhookDelivery{Webhook: "a", EventType: "aircraft_entered", Body: `{"n":1}`, NextAttempt: now, CreatedAt: now}
+	later := &model.WebhookDelivery{Webhook: "a", EventType: "aircraft_left", Body: `{"n":2}`, NextAttempt: now.Add(time.Minute), CreatedAt: now}
+	assert.NoError(t, db.EnqueueWebhookDelivery(first))
+	assert.NoError(t, db.EnqueueWebhookDelivery(later))
+	assert.NotZero(t, first.ID)
+
+	due, err := db.GetDueWebhookDeliveries(now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, first.ID, due[0].ID)
+	assert.Equal(t, `{"n":1}`, due[0].Body)
+	assert.Equal(t, model.DeliveryPending, due[0].Status)
+
+	// A failed attempt is retried at the next attempt time
+	assert.NoError(t, db.MarkWebhookFailed(first.ID, 1, now.Add(2*time.Minute), "timeout", false))
+	due, err = db.GetDueWebhookDeliveries(now.Add(time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, later.ID, due[0].ID)
+
+	assert.NoError(t, db.MarkWebhookDelivered(later.ID, 1, now.Add(time.Minute)))
+	assert.NoError(t, db.MarkWebhookFailed(first.ID, 2, now.Add(4*time.Minute), "timeout", true))
+	due, err = db.GetDueWebhookDeliveries(now.Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+
+	dead, err := db.GetDeadWebhookDeliveries(10)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, "timeout", dead[0].LastError)
+
+	requeued, err := db.RequeueWebhookDelivery(later.ID, now)
+	assert.NoError(t, err)
+	assert.False(t, requeued, "delivered deliveries cannot be requeued")
+	requeued, err = db.RequeueWebhookDelivery(first.ID, now)
+	assert.NoError(t, err)
+	assert.True(t, requeued)
+	due, err = db.GetDueWebhookDeliveries(now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, 0, due[0].Attempts)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/maintenance"
+	"github.com/carlo-colombo/sopra/memory"
+	"github.com/carlo-colombo/sopra/postgres"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+// dbUsage lists the database commands.
+const dbUsage = `Usage: sopra db <command>
+
+Commands:
+  maintain  Run all the database maintenance jobs now
+  copy      Copy the SQLite database at db_path into the Postgres database at postgres_url
+`
+
+// runDBCommand runs a database command, the arguments following "db", and exits.
+func runDBCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, dbUsage)
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "maintain":
+		err = maintain(cfg)
+	case "copy":
+		err = copyToPostgres(cfg)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown db command %q\n\n%s", args[0], dbUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Error running db %s: %v", args[0], err)
+	}
+	os.Exit(0)
+}
+
+// openStore opens the storage selected by the configuration.
+func openStore(cfg *config.Config) (storage.Store, error) {
+	switch cfg.Storage {
+	case "sqlite":
+		return database.NewDB(cfg.DBPath)
+	case "postgres":
+		if cfg.PostgresURL == "" {
+			return nil, fmt.Errorf("postgres_url is required by the postgres storage")
+		}
+		return postgres.NewDB(cfg.PostgresURL)
+	case "memory":
+		log.Printf("Using in-memory storage, nothing is kept after exit")
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q, must be sqlite, postgres or memory", cfg.Storage)
+	}
+}
+
+// maintain runs all the maintenance jobs on the database and prints their runs, failing if any job failed.
+func maintain(cfg *config.Config) error {
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	scheduler, err := maintenance.New(cfg, db)
+	if err != nil {
+		return err
+	}
+	// Switching a SQLite database created before incremental auto vacuum to it rewrites the database,
+	// so it is done on demand only, not by the scheduler
+	if sqlite, ok := db.(interface{ EnableIncrementalVacuum() (bool, error) }); ok {
+		switched, err := sqlite.EnableIncrementalVacuum()
+		if err != nil {
+			return err
+		}
+		if switched {
+			fmt.Println("Switched the database to incremental auto vacuum")
+		}
+	}
+	failed := 0
+	for _, run := range scheduler.RunAll(time.Now()) {
+		status := "ok"
+		if run.Error != "" {
+			status = "error: " + run.Error
+			failed++
+		}
+		fmt.Printf("%-10s %6d affected %6d ms  %s\n", run.Job, run.Affected, run.DurationMs, status)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d maintenance jobs failed", failed)
+	}
+	return nil
+}
+
+// copyToPostgres copies the SQLite database at db_path, migrated first to the latest schema, into the empty
+// Postgres database at postgres_url and prints how many rows of each table were copied.
+func copyToPostgres(cfg *config.Config) error {
+	if cfg.PostgresURL == "" {
+		return fmt.Errorf("postgres_url is required to copy into Postgres")
+	}
+	if _, err := os.Stat(cfg.DBPath); err != nil {
+		return err
+	}
+	src, err := database.NewDB(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := postgres.NewDB(cfg.PostgresURL)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	copied, err := dst.Copy(src.SQL())
+	if err != nil {
+		return err
+	}
+	for _, table := range copied {
+		fmt.Printf("%-18s %8d rows\n", table.Table, table.Rows)
+	}
+	return nil
+}
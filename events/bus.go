@@ -0,0 +1,153 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// Type identifies what happened to an aircraft.
+type Type string
+
+const (
+	// AircraftEntered is published when an aircraft starts a pass over a site.
+	AircraftEntered Type = "aircraft_entered"
+	// AircraftLeft is published when an aircraft of an open pass is no longer seen over a site.
+	AircraftLeft Type = "aircraft_left"
+	// ClosestApproach is published once per pass, when the aircraft starts moving away from the site.
+	ClosestApproach Type = "closest_approach"
+	// OperatorFirstSeen is published the first time a flight of an operator is seen.
+	OperatorFirstSeen Type = "operator_first_seen"
+	// EnrichmentCompleted is published when an aircraft has been enriched with FlightAware data.
+	EnrichmentCompleted Type = "enrichment_completed"
+	// SquawkAlert is published when an aircraft over a site starts squawking an emergency or special
+	// purpose code, or activates SPI, whether or not it has a callsign.
+	SquawkAlert Type = "squawk_alert"
+	// TransitPredicted is published when an aircraft over a site is predicted to cross, or pass next to,
+	// the disk of the sun or the moon within the transit horizon.
+	TransitPredicted Type = "transit_predicted"
+	// OverflightPredicted is published when an aircraft outside a site is first predicted to enter it
+	// within the look-ahead horizon.
+	OverflightPredicted Type = "overflight_predicted"
+	// RuleMatched is sent to the actions of an alert rule when it matches an aircraft.
+	// It is not published on the bus.
+	RuleMatched Type = "rule_matched"
+)
+
+// Event is something that happened to an aircraft over a site.
+type Event struct {
+	ID         uint64             `json:"id"`
+	Type       Type               `json:"type"`
+	Time       time.Time          `json:"time"`
+	Site       string             `json:"site"`
+	Flight     *model.FlightInfo  `json:"flight,omitempty"`
+	Sighting   *model.Sighting    `json:"sighting,omitempty"`
+	Operator   string             `json:"operator,omitempty"`   // ICAO code, for OperatorFirstSeen
+	Rule       string             `json:"rule,omitempty"`       // for RuleMatched
+	Severity   string             `json:"severity,omitempty"`   // for RuleMatched and SquawkAlert
+	Alert      *model.SquawkAlert `json:"alert,omitempty"`      // for SquawkAlert
+	Transit    *model.Transit     `json:"transit,omitempty"`    // for TransitPredicted
+	Prediction *model.Prediction  `json:"prediction,omitempty"` // for OverflightPredicted
+}
+
+// Bus delivers published events to its subscribers.
+// Publishing never blocks: events are dropped for subscribers whose buffer is full.
+type Bus struct {
+	mu      sync.Mutex
+	nextID  uint64
+	replay  int
+	history []Event
+	subs    map[*Subscription]struct{}
+}
+
+// NewBus creates a Bus remembering the last replay events for late subscribers.
+func NewBus(replay int) *Bus {
+	return &Bus{replay: replay, subs: make(map[*Subscription]struct{})}
+}
+
+// Publish assigns an ID to the event, and its time when unset, and delivers it to the subscribers.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e.ID = b.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if b.replay > 0 {
+		if len(b.history) == b.replay {
+			b.history = slices.Delete(b.history, 0, 1)
+		}
+		b.history = append(b.history, e)
+	}
+	for sub := range b.subs {
+		sub.deliver(e)
+	}
+	return e
+}
+
+// Subscribe returns a subscription receiving the events of the given types, or of all types when none is given.
+// The remembered events are replayed first, as far as buffer allows.
+func (b *Bus) Subscribe(buffer int, types ...Type) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, types: types, bus: b}
+	for _, e := range b.history {
+		sub.deliver(e)
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// History returns the remembered events, oldest first.
+func (b *Bus) History() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.history)
+}
+
+// Subscription is a buffered stream of events.
+type Subscription struct {
+	// C receives the events. It is closed by Close.
+	C <-chan Event
+
+	ch      chan Event
+	types   []Type
+	bus     *Bus
+	dropped uint64
+}
+
+// Close stops the delivery of events and closes C.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// deliver sends the event without blocking. It must be called with the bus lock held.
+func (s *Subscription) deliver(e Event) {
+	if len(s.types) > 0 && !slices.Contains(s.types, e.Type) {
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+		s.dropped++
+	}
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	bus := NewBus(0)
+	all := bus.Subscribe(10)
+	left := bus.Subscribe(10, AircraftLeft)
+
+	first := bus.Publish(Event{Type: AircraftEntered, Site: "zurich"})
+	second := bus.Publish(Event{Type: AircraftLeft, Site: "zurich"})
+
+	assert.Equal(t, uint64(1), first.ID)
+	assert.False(t, first.Time.IsZero())
+	assert.Equal(t, first, <-all.C)
+	assert.Equal(t, second, <-all.C)
+	assert.Equal(t, second, <-left.C)
+	assert.Len(t, left.C, 0)
+}
+
+func TestBus_NonBlocking(t *testing.T) {
+	bus := NewBus(0)
+	sub := bus.Subscribe(1)
+
+	bus.Publish(Event{Type: AircraftEntered})
+	bus.Publish(Event{Type: ClosestApproach}) // buffer full, dropped
+
+	assert.Equal(t, uint64(1), sub.Dropped())
+	assert.Equal(t, AircraftEntered, (<-sub.C).Type)
+
+	sub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	bus.Publish(Event{Type: AircraftLeft}) // closed subscriptions are skipped
+	sub.Close()
+}
+
+func TestBus_Replay(t *testing.T) {
+	bus := NewBus(2)
+	bus.Publish(Event{Type: AircraftEntered})
+	bus.Publish(Event{Type: ClosestApproach})
+	bus.Publish(Event{Type: AircraftLeft})
+
+	history := bus.History()
+	assert.Len(t, history, 2)
+	assert.Equal(t, uint64(2), history[0].ID)
+
+	late := bus.Subscribe(10)
+	assert.Equal(t, ClosestApproach, (<-late.C).Type)
+	assert.Equal(t, AircraftLeft, (<-late.C).Type)
+
+	// Replay is limited by the buffer and filtered by type
+	small := bus.Subscribe(1, AircraftLeft)
+	assert.Equal(t, AircraftLeft, (<-small.C).Type)
+	assert.Equal(t, uint64(0), small.Dropped())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/export"
+	"github.com/spf13/pflag"
+)
+
+// runExport runs the export command, the arguments following "export", and exits.
+func runExport(cfg *config.Config, args []string) {
+	flags := pflag.NewFlagSet("export", pflag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sopra export [flags]\n\nExport the sightings flattened with their flights.\n\nFlags:\n%s", flags.FlagUsages())
+	}
+	format := flags.String("format", "csv", "The format of the export: "+strings.Join(export.Formats, ", "))
+	since := flags.String("since", "", "Export the sightings started from this date (2006-01-02) or RFC 3339 time")
+	until := flags.String("until", "", "Export the sightings started before this date or RFC 3339 time, now by default")
+	site := flags.String("site", "", "Export only the sightings of this site")
+	output := flags.StringP("output", "o", "", "The file to write the export to, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+
+	if err := exportSightings(cfg, *format, *since, *until, *site, *output); err != nil {
+		log.Fatalf("Error exporting: %v", err)
+	}
+	os.Exit(0)
+}
+
+// exportSightings writes the sightings started in the range at site, all when empty, in a format to the output file,
+// or to stdout when empty.
+func exportSightings(cfg *config.Config, format, since, until, site, output string) error {
+	if !slices.Contains(export.Formats, format) {
+		return fmt.Errorf("unknown format %q, must be one of %s", format, strings.Join(export.Formats, ", "))
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	from, to, err := export.Range(since, until, loc)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+	writer, err := export.NewWriter(format, buffered)
+	if err != nil {
+		return err
+	}
+	written, err := export.Sightings(db, writer, from, to, site)
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	log.Printf("Exported %d sightings", written)
+	return nil
+}
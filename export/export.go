@@ -0,0 +1,183 @@
+// Package export writes the sighting history, flattened with the flights, as CSV, NDJSON or Parquet,
+// streaming the rows from the storage to the output one at a time.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Formats are the names of the export formats.
+var Formats = []string{"csv", "ndjson", "parquet"}
+
+// rowGroupSize is how many rows Parquet keeps in memory before writing them out as a row group.
+const rowGroupSize = 10000
+
+// Writer writes the rows of an export in a format.
+type Writer interface {
+	Write(row *model.ExportRow) error
+	// Close writes what the format needs after the rows, it does not close the output.
+	Close() error
+}
+
+// NewWriter returns the Writer of a format, one of Formats, to w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(w)
+	case "ndjson":
+		return ndjsonWriter{json.NewEncoder(w)}, nil
+	case "parquet":
+		return parquetWriter{parquet.NewGenericWriter[model.ExportRow](w, parquet.MaxRowsPerRowGroup(rowGroupSize))}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case "csv":
+		return "text/csv; charset=utf-8"
+	case "ndjson":
+		return "application/x-ndjson"
+	case "parquet":
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// Sightings writes the sightings started in [from, to), optionally restricted to a site, and returns how many rows
+// were written. The writer is closed at the end, also when the export fails.
+func Sightings(db storage.Sightings, w Writer, from, to time.Time, site string) (int64, error) {
+	var written int64
+	err := db.ExportSightings(from, to, site, func(row *model.ExportRow) error {
+		written++
+		return w.Write(row)
+	})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// Range parses the bounds of an export, since and until, each a time in RFC 3339 or a date, meaning the start of
+// the day in loc. An empty since means from the first sighting and an empty until means until now.
+func Range(since, until string, loc *time.Location) (from, to time.Time, err error) {
+	if since != "" {
+		if from, err = parseTime(since, loc); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	to = time.Now()
+	if until != "" {
+		if to, err = parseTime(until, loc); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("since must be before until")
+	}
+	return from, to, nil
+}
+
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, must be a date (2006-01-02) or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// columns are the names of the columns of the CSV exports, the JSON names of the fields of model.ExportRow.
+var columns = func() []string {
+	t := reflect.TypeOf(model.ExportRow{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i], _, _ = strings.Cut(t.Field(i).Tag.Get("json"), ",")
+	}
+	return names
+}()
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+// newCSVWriter returns a Writer of CSV with a header row.
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	if err := c.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(row *model.ExportRow) error {
+	v := reflect.ValueOf(row).Elem()
+	for i := range c.record {
+		c.record[i] = formatValue(v.Field(i))
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatValue formats a field of model.ExportRow as a CSV value, the times in RFC 3339.
+func formatValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n ndjsonWriter) Write(row *model.ExportRow) error {
+	return n.enc.Encode(row)
+}
+
+func (n ndjsonWriter) Close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	w *parquet.GenericWriter[model.ExportRow]
+}
+
+func (p parquetWriter) Write(row *model.ExportRow) error {
+	_, err := p.w.Write([]model.ExportRow{*row})
+	return err
+}
+
+func (p parquetWriter) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,123 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/memory"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB returns a store with a sighting of an identified flight at the returned time, after the flight was logged,
+// and one of an unknown callsign an hour later.
+func newTestDB(t *testing.T) (*memory.Store, time.Time) {
+	t.Helper()
+	db := memory.New()
+	route := "GERSA UN871 BADEP"
+	flight := &model.FlightInfo{
+		Ident: "SWR12", Operator: "SWR", OperatorIata: "LX", Registration: "HB-JNA", AircraftType: "B77W", Route: &route, CO2KG: 98000,
+		Origin:      model.AirportDetail{Code: "LSZH", CodeIata: "ZRH", City: "Zurich"},
+		Destination: model.AirportDetail{Code: "KJFK", CodeIata: "JFK", City: "New York, NY"},
+	}
+	flight.SetState(&model.Flight{Icao24: "4b1805", BaroAltitude: 3000, Velocity: 180.5})
+	require.NoError(t, db.LogFlight("SWR12", flight))
+	at := time.Now().Add(time.Second).Truncate(time.Second).UTC()
+	for _, obs := range []model.Observation{
+		{Icao24: "4b1805", Callsign: "SWR12", Time: at, Distance: 1500.5, Altitude: 3000},
+		{Site: "office", Icao24: "400001", Callsign: "EZY45", Time: at.Add(time.Hour)},
+	} {
+		_, err := db.RecordSighting(obs, 10*time.Minute)
+		require.NoError(t, err)
+	}
+	return db, at
+}
+
+// export exports the test sightings in a format and returns the output and when the first sighting started.
+func export(t *testing.T, format string, site string) ([]byte, time.Time) {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := NewWriter(format, &out)
+	require.NoError(t, err)
+	db, at := newTestDB(t)
+	n, err := Sightings(db, w, at, at.Add(2*time.Hour), site)
+	require.NoError(t, err)
+	assert.Positive(t, n)
+	return out.Bytes(), at
+}
+
+func TestSightings_CSV(t *testing.T) {
+	out, at := export(t, "csv", "")
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, columns, records[0])
+	assert.Equal(t, []string{"sighting_id", "site", "icao24", "callsign", "first_seen"}, records[0][:5])
+
+	row := make(map[string]string)
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+	assert.Equal(t, "SWR12", row["ident"])
+	assert.Equal(t, at.Format(time.RFC3339), row["first_seen"])
+	assert.Equal(t, "1500.5", row["min_distance_m"])
+	assert.Equal(t, "New York, NY", row["destination_city"])
+	assert.Equal(t, "98000", row["co2_kg"])
+	assert.Equal(t, "180.5", row["velocity"])
+	assert.Equal(t, "false", row["on_ground"])
+	assert.Equal(t, "EZY45", records[2][3])
+}
+
+func TestSightings_NDJSON(t *testing.T) {
+	out, _ := export(t, "ndjson", "office")
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 1)
+	var row model.ExportRow
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+	assert.Equal(t, "EZY45", row.Callsign)
+	assert.Equal(t, "office", row.Site)
+	assert.Empty(t, row.Ident)
+}
+
+func TestSightings_Parquet(t *testing.T) {
+	out, at := export(t, "parquet", "")
+	rows, err := parquet.Read[model.ExportRow](bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "SWR12", rows[0].Ident)
+	assert.Equal(t, "ZRH", rows[0].OriginIata)
+	assert.True(t, at.Equal(rows[0].FirstSeen))
+	assert.Equal(t, 1500.5, rows[0].MinDistance)
+	assert.Equal(t, "EZY45", rows[1].Callsign)
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter("xlsx", &bytes.Buffer{})
+	assert.ErrorContains(t, err, "csv, ndjson, parquet")
+}
+
+func TestRange(t *testing.T) {
+	zurich := time.FixedZone("CEST", 2*3600)
+
+	from, to, err := Range("2025-06-21", "2025-06-21T08:00:00Z", zurich)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 6, 21, 0, 0, 0, 0, zurich), from)
+	assert.True(t, time.Date(2025, 6, 21, 8, 0, 0, 0, time.UTC).Equal(to))
+
+	// Everything until now by default
+	from, to, err = Range("", "", zurich)
+	require.NoError(t, err)
+	assert.True(t, from.IsZero())
+	assert.WithinDuration(t, time.Now(), to, time.Second)
+
+	_, _, err = Range("yesterday", "", zurich)
+	assert.ErrorContains(t, err, "invalid time")
+	_, _, err = Range("2025-06-21", "2025-06-20", zurich)
+	assert.ErrorContains(t, err, "before")
+}
@@ -0,0 +1,203 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// Filter decides whether an aircraft counts as an overflight.
+type Filter struct {
+	Name string
+	// Enriched filters need FlightAware data and can only run after enrichment.
+	Enriched bool
+	accept   func(state *model.Flight, info *model.FlightInfo) bool
+}
+
+// Set is an ordered list of filters built from the configuration.
+type Set struct {
+	filters []Filter
+}
+
+// New builds the filters enabled in cfg.
+func New(cfg config.FilterConfig) (*Set, error) {
+	var filters []Filter
+
+	if cfg.ExcludeOnGround {
+		filters = append(filters, Filter{Name: "on_ground", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return !state.OnGround
+		}})
+	}
+	// The aircraft without an altitude, zero, are not known to be out of the band and are accepted
+	if cfg.MinAltitude > 0 {
+		filters = append(filters, Filter{Name: "min_altitude", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			alt := altitude(state)
+			return alt == 0 || alt >= cfg.MinAltitude
+		}})
+	}
+	if cfg.MaxAltitude > 0 {
+		filters = append(filters, Filter{Name: "max_altitude", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return altitude(state) <= cfg.MaxAltitude
+		}})
+	}
+	if cfg.MinSpeed > 0 {
+		filters = append(filters, Filter{Name: "min_speed", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return state.Velocity >= cfg.MinSpeed
+		}})
+	}
+	if len(cfg.VerticalRateBands) > 0 {
+		bands := cfg.VerticalRateBands
+		filters = append(filters, Filter{Name: "vertical_rate", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			for _, band := range bands {
+				if state.VerticalRate >= band.Min && state.VerticalRate <= band.Max {
+					return true
+				}
+			}
+			return false
+		}})
+	}
+	if len(cfg.IncludeCategories) > 0 {
+		categories := cfg.IncludeCategories
+		filters = append(filters, Filter{Name: "include_categories", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return slices.Contains(categories, state.Category)
+		}})
+	}
+	if len(cfg.ExcludeCategories) > 0 {
+		categories := cfg.ExcludeCategories
+		filters = append(filters, Filter{Name: "exclude_categories", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return !slices.Contains(categories, state.Category)
+		}})
+	}
+
+	includeCallsigns, err := compileAll(cfg.IncludeCallsigns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include_callsigns: %w", err)
+	}
+	if len(includeCallsigns) > 0 {
+		filters = append(filters, Filter{Name: "include_callsigns", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return matchAny(includeCallsigns, state.Callsign)
+		}})
+	}
+	excludeCallsigns, err := compileAll(cfg.ExcludeCallsigns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude_callsigns: %w", err)
+	}
+	if len(excludeCallsigns) > 0 {
+		filters = append(filters, Filter{Name: "exclude_callsigns", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return !matchAny(excludeCallsigns, state.Callsign)
+		}})
+	}
+
+	// Operators are checked against the ICAO prefix of the callsign before
+	// enrichment, so that excluded airlines never cost a FlightAware call.
+	if len(cfg.IncludeOperators) > 0 {
+		operators := upperAll(cfg.IncludeOperators)
+		filters = append(filters, Filter{Name: "include_operators", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return slices.Contains(operators, callsignOperator(state.Callsign))
+		}})
+	}
+	if len(cfg.ExcludeOperators) > 0 {
+		operators := upperAll(cfg.ExcludeOperators)
+		filters = append(filters, Filter{Name: "exclude_operators", accept: func(state *model.Flight, _ *model.FlightInfo) bool {
+			return !slices.Contains(operators, callsignOperator(state.Callsign))
+		}})
+	}
+
+	// The aircraft type is only known once FlightAware has been queried.
+	if len(cfg.IncludeAircraftTypes) > 0 {
+		types := upperAll(cfg.IncludeAircraftTypes)
+		filters = append(filters, Filter{Name: "include_aircraft_types", Enriched: true, accept: func(_ *model.Flight, info *model.FlightInfo) bool {
+			return slices.Contains(types, strings.ToUpper(info.AircraftType))
+		}})
+	}
+	if len(cfg.ExcludeAircraftTypes) > 0 {
+		types := upperAll(cfg.ExcludeAircraftTypes)
+		filters = append(filters, Filter{Name: "exclude_aircraft_types", Enriched: true, accept: func(_ *model.Flight, info *model.FlightInfo) bool {
+			return !slices.Contains(types, strings.ToUpper(info.AircraftType))
+		}})
+	}
+
+	return &Set{filters: filters}, nil
+}
+
+// CheckState runs the filters that only need the OpenSky state vector.
+// It returns the name of the first filter rejecting the aircraft, or an empty string if none did.
+func (s *Set) CheckState(state *model.Flight) string {
+	return s.check(false, state, nil)
+}
+
+// CheckEnriched runs the filters that need FlightAware data.
+// It returns the name of the first filter rejecting the aircraft, or an empty string if none did.
+func (s *Set) CheckEnriched(state *model.Flight, info *model.FlightInfo) string {
+	return s.check(true, state, info)
+}
+
+// Names returns the names of the configured filters.
+func (s *Set) Names() []string {
+	var names []string
+	for _, f := range s.filters {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func (s *Set) check(enriched bool, state *model.Flight, info *model.FlightInfo) string {
+	if s == nil {
+		return ""
+	}
+	for _, f := range s.filters {
+		if f.Enriched == enriched && !f.accept(state, info) {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// altitude returns the barometric altitude, falling back to the geometric one when missing.
+func altitude(state *model.Flight) float64 {
+	if state.BaroAltitude != 0 {
+		return state.BaroAltitude
+	}
+	return state.GeoAltitude
+}
+
+// callsignOperator returns the ICAO airline designator at the start of an ICAO callsign.
+func callsignOperator(callsign string) string {
+	if len(callsign) < 3 {
+		return ""
+	}
+	return strings.ToUpper(callsign[:3])
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func upperAll(values []string) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = strings.ToUpper(v)
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckState(t *testing.T) {
+	set, err := New(config.FilterConfig{
+		MinAltitude:       300,
+		MaxAltitude:       6000,
+		ExcludeOnGround:   true,
+		MinSpeed:          30,
+		ExcludeOperators:  []string{"exs"},
+		ExcludeCallsigns:  []string{"^HB[A-Z]"},
+		ExcludeCategories: []int{14},
+		VerticalRateBands: []config.VerticalRateBand{
+			{Name: "arriving", Min: -20, Max: -1},
+			{Name: "level", Min: -1, Max: 1},
+		},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		state    model.Flight
+		expected string
+	}{
+		{"accepted", model.Flight{Callsign: "SWR123", BaroAltitude: 3000, Velocity: 150}, ""},
+		{"geo altitude fallback", model.Flight{Callsign: "SWR123", GeoAltitude: 3000, Velocity: 150}, ""},
+		{"unknown altitude", model.Flight{Callsign: "SWR123", Velocity: 150}, ""},
+		{"on ground", model.Flight{Callsign: "SWR123", OnGround: true, Velocity: 10}, "on_ground"},
+		{"too low", model.Flight{Callsign: "SWR123", BaroAltitude: 100, Velocity: 150}, "min_altitude"},
+		{"too high", model.Flight{Callsign: "SWR123", BaroAltitude: 11000, Velocity: 250}, "max_altitude"},
+		{"too slow", model.Flight{Callsign: "SWR123", BaroAltitude: 3000, Velocity: 10}, "min_speed"},
+		{"departing", model.Flight{Callsign: "SWR123", BaroAltitude: 3000, Velocity: 150, VerticalRate: 10}, "vertical_rate"},
+		{"drone category", model.Flight{Callsign: "SWR123", BaroAltitude: 3000, Velocity: 150, Category: 14}, "exclude_categories"},
+		{"private callsign", model.Flight{Callsign: "HBZAB", BaroAltitude: 3000, Velocity: 150}, "exclude_callsigns"},
+		{"excluded operator", model.Flight{Callsign: "EXS12A", BaroAltitude: 3000, Velocity: 150}, "exclude_operators"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, set.CheckState(&tt.state))
+		})
+	}
+}
+
+func TestCheckEnriched(t *testing.T) {
+	set, err := New(config.FilterConfig{
+		IncludeOperators:     []string{"SWR", "EZS"},
+		ExcludeAircraftTypes: []string{"c172"},
+	})
+	assert.NoError(t, err)
+
+	state := &model.Flight{Callsign: "SWR123"}
+	assert.Equal(t, "", set.CheckState(state))
+	assert.Equal(t, "include_operators", set.CheckState(&model.Flight{Callsign: "DLH4"}))
+
+	assert.Equal(t, "", set.CheckEnriched(state, &model.FlightInfo{AircraftType: "A320"}))
+	assert.Equal(t, "exclude_aircraft_types", set.CheckEnriched(state, &model.FlightInfo{AircraftType: "C172"}))
+}
+
+func TestNew_InvalidRegex(t *testing.T) {
+	_, err := New(config.FilterConfig{IncludeCallsigns: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestNilSetAcceptsEverything(t *testing.T) {
+	var set *Set
+	assert.Equal(t, "", set.CheckState(&model.Flight{OnGround: true}))
+}
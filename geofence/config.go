@@ -0,0 +1,13 @@
+package geofence
+
+import (
+	"github.com/carlo-colombo/sopra/config"
+)
+
+// FromConfig returns the configured geofence, or the circle around the location when none is set.
+func FromConfig(svc config.ServiceConfig) (Area, error) {
+	if svc.Geofence != "" {
+		return Load(svc.Geofence)
+	}
+	return Circle{Latitude: svc.Latitude, Longitude: svc.Longitude, RadiusKm: svc.Radius}, nil
+}
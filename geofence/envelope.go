@@ -0,0 +1,62 @@
+package geofence
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/carlo-colombo/sopra/haversine"
+)
+
+// Envelope is the area covered by the bounding boxes of another area, widened by MarginKm on every side.
+// Fetching the envelope of an area also returns the aircraft around it, e.g. to see them approaching.
+type Envelope struct {
+	Area     Area
+	MarginKm float64
+}
+
+// Contains reports whether the point is inside any of the bounding boxes.
+func (e Envelope) Contains(lat, lon float64) bool {
+	for _, bbox := range e.BoundingBoxes() {
+		if lat >= bbox.MinLat && lat <= bbox.MaxLat && lon >= bbox.MinLon && lon <= bbox.MaxLon {
+			return true
+		}
+	}
+	return false
+}
+
+// kmPerDegree is the length of a degree of latitude.
+const kmPerDegree = 111.32
+
+// BoundingBoxes returns the bounding boxes of the area, widened by the margin and merged where they overlap.
+func (e Envelope) BoundingBoxes() []haversine.BoundingBox {
+	if e.MarginKm <= 0 {
+		return e.Area.BoundingBoxes()
+	}
+	var boxes []haversine.BoundingBox
+	for _, bbox := range e.Area.BoundingBoxes() {
+		dLat := e.MarginKm / kmPerDegree
+		bbox.MinLat = math.Max(bbox.MinLat-dLat, -90)
+		bbox.MaxLat = math.Min(bbox.MaxLat+dLat, 90)
+		// The degrees of longitude of the margin at the latitude farthest from the equator, the shortest ones
+		dLon := 360.0
+		if cos := math.Cos(math.Max(math.Abs(bbox.MinLat), math.Abs(bbox.MaxLat)) * math.Pi / 180); cos > e.MarginKm/(180*kmPerDegree) {
+			dLon = e.MarginKm / (kmPerDegree * cos)
+		}
+		bbox.MinLon -= dLon
+		bbox.MaxLon += dLon
+		boxes = append(boxes, splitAntimeridian(bbox)...)
+	}
+	return mergeBoxes(boxes)
+}
+
+// GeoJSON returns the bounding boxes as a MultiPolygon.
+func (e Envelope) GeoJSON() Geometry {
+	var polygons [][][][2]float64
+	for _, b := range e.BoundingBoxes() {
+		polygons = append(polygons, [][][2]float64{{
+			{b.MinLon, b.MinLat}, {b.MaxLon, b.MinLat}, {b.MaxLon, b.MaxLat}, {b.MinLon, b.MaxLat}, {b.MinLon, b.MinLat},
+		}})
+	}
+	coordinates, _ := json.Marshal(polygons)
+	return Geometry{Type: "MultiPolygon", Coordinates: coordinates}
+}
@@ -0,0 +1,44 @@
+package geofence
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	circle := Circle{Latitude: 47.3769, Longitude: 8.5417, RadiusKm: 20}
+	box := circle.BoundingBoxes()[0]
+	envelope := Envelope{Area: circle}
+
+	// The corner of the bounding box is outside the circle but inside the envelope
+	corner := [2]float64{box.MaxLat - 0.001, box.MaxLon - 0.001}
+	assert.False(t, circle.Contains(corner[0], corner[1]))
+	assert.True(t, envelope.Contains(corner[0], corner[1]))
+	assert.False(t, envelope.Contains(box.MaxLat+0.1, box.MaxLon))
+	assert.Equal(t, circle.BoundingBoxes(), envelope.BoundingBoxes())
+	assert.Equal(t, "MultiPolygon", envelope.GeoJSON().Type)
+}
+
+func TestEnvelope_Margin(t *testing.T) {
+	circle := Circle{Latitude: 60, Longitude: 8.5, RadiusKm: 20}
+	box := circle.BoundingBoxes()[0]
+	envelope := Envelope{Area: circle, MarginKm: 50}
+
+	boxes := envelope.BoundingBoxes()
+	assert.Len(t, boxes, 1)
+	assert.InDelta(t, box.MaxLat+50/111.32, boxes[0].MaxLat, 1e-9)
+	assert.InDelta(t, box.MinLat-50/111.32, boxes[0].MinLat, 1e-9)
+	// At least 50 km east and west at the northern edge
+	assert.InDelta(t, 50, (boxes[0].MaxLon-box.MaxLon)*111.32*math.Cos(boxes[0].MaxLat*math.Pi/180), 1e-9)
+	assert.InDelta(t, 50, (box.MinLon-boxes[0].MinLon)*111.32*math.Cos(boxes[0].MaxLat*math.Pi/180), 1e-9)
+	assert.True(t, envelope.Contains(box.MaxLat+0.4, 8.5))
+	assert.False(t, envelope.Contains(box.MaxLat+0.5, 8.5))
+
+	// Widened boxes of nearby areas are merged, and split at the antimeridian
+	union := Union{circle, Circle{Latitude: 60, Longitude: 10.5, RadiusKm: 20}}
+	assert.Len(t, union.BoundingBoxes(), 2)
+	assert.Len(t, Envelope{Area: union, MarginKm: 50}.BoundingBoxes(), 1)
+	assert.Len(t, Envelope{Area: Circle{Latitude: 0, Longitude: 179.9, RadiusKm: 5}, MarginKm: 50}.BoundingBoxes(), 2)
+}
@@ -0,0 +1,243 @@
+package geofence
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/carlo-colombo/sopra/haversine"
+)
+
+// Area is a region of interest aircraft are watched in.
+type Area interface {
+	// Contains reports whether the point is inside the area.
+	Contains(lat, lon float64) bool
+	// BoundingBoxes returns the boxes covering the area, split at the antimeridian.
+	BoundingBoxes() []haversine.BoundingBox
+	// GeoJSON returns the area as a GeoJSON geometry.
+	GeoJSON() Geometry
+}
+
+// Geometry is a GeoJSON Polygon or MultiPolygon geometry.
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Circle is the area within a radius from a center point.
+type Circle struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+}
+
+// Contains reports whether the point is within the radius.
+func (c Circle) Contains(lat, lon float64) bool {
+	return haversine.Distance(c.Latitude, c.Longitude, lat, lon) <= c.RadiusKm
+}
+
+// BoundingBoxes returns the box around the circle.
+func (c Circle) BoundingBoxes() []haversine.BoundingBox {
+	return splitAntimeridian(haversine.GetBoundingBox(c.Latitude, c.Longitude, c.RadiusKm))
+}
+
+// GeoJSON approximates the circle with a 64 sided polygon.
+func (c Circle) GeoJSON() Geometry {
+	const segments = 64
+	ring := make([][2]float64, 0, segments+1)
+	for i := 0; i <= segments; i++ {
+		lat, lon := haversine.Destination(c.Latitude, c.Longitude, float64(i%segments)*360/segments, c.RadiusKm)
+		ring = append(ring, [2]float64{lon, lat})
+	}
+	coordinates, _ := json.Marshal([][][2]float64{ring})
+	return Geometry{Type: "Polygon", Coordinates: coordinates}
+}
+
+// point is a longitude/latitude pair, in GeoJSON order.
+type point [2]float64
+
+// polygon is a list of linear rings, the first being the outer boundary and the others holes.
+// Longitudes are unwrapped so that rings crossing the antimeridian are continuous.
+type polygon [][]point
+
+// Geofence is an area bounded by one or more polygons.
+type Geofence struct {
+	geometry Geometry
+	polygons []polygon
+}
+
+// Load parses a geofence given either as inline GeoJSON or as the path to a GeoJSON file.
+func Load(value string) (*Geofence, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		return Parse([]byte(value))
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geofence file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a GeoJSON Polygon or MultiPolygon, either as a bare geometry or wrapped in a Feature.
+func Parse(data []byte) (*Geofence, error) {
+	var raw struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	var polygons [][][]point
+	switch raw.Type {
+	case "Feature":
+		if raw.Geometry == nil {
+			return nil, fmt.Errorf("GeoJSON feature has no geometry")
+		}
+		return Parse(raw.Geometry)
+	case "Polygon":
+		var coordinates [][]point
+		if err := json.Unmarshal(raw.Coordinates, &coordinates); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		polygons = [][][]point{coordinates}
+	case "MultiPolygon":
+		if err := json.Unmarshal(raw.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q, expected Polygon or MultiPolygon", raw.Type)
+	}
+
+	g := &Geofence{geometry: Geometry{Type: raw.Type, Coordinates: raw.Coordinates}}
+	for _, rings := range polygons {
+		if len(rings) == 0 {
+			return nil, fmt.Errorf("polygon without rings")
+		}
+		var p polygon
+		for _, ring := range rings {
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("polygon ring needs at least 4 positions, got %d", len(ring))
+			}
+			p = append(p, unwrap(ring))
+		}
+		g.polygons = append(g.polygons, p)
+	}
+	return g, nil
+}
+
+// Contains reports whether the point is inside any of the polygons and outside their holes.
+func (g *Geofence) Contains(lat, lon float64) bool {
+	for _, p := range g.polygons {
+		minLon, maxLon := p.lonRange()
+		for _, shift := range []float64{0, 360, -360} {
+			l := lon + shift
+			if l < minLon || l > maxLon {
+				continue
+			}
+			if p.contains(lat, l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BoundingBoxes returns the boxes covering all polygons.
+func (g *Geofence) BoundingBoxes() []haversine.BoundingBox {
+	var boxes []haversine.BoundingBox
+	for _, p := range g.polygons {
+		bbox := haversine.BoundingBox{MinLat: 90, MaxLat: -90, MinLon: math.Inf(1), MaxLon: math.Inf(-1)}
+		for _, pt := range p[0] {
+			bbox.MinLon = math.Min(bbox.MinLon, pt[0])
+			bbox.MaxLon = math.Max(bbox.MaxLon, pt[0])
+			bbox.MinLat = math.Min(bbox.MinLat, pt[1])
+			bbox.MaxLat = math.Max(bbox.MaxLat, pt[1])
+		}
+		boxes = append(boxes, splitAntimeridian(bbox)...)
+	}
+	return boxes
+}
+
+// GeoJSON returns the geometry the geofence was parsed from.
+func (g *Geofence) GeoJSON() Geometry {
+	return g.geometry
+}
+
+func (p polygon) lonRange() (float64, float64) {
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+	for _, pt := range p[0] {
+		minLon = math.Min(minLon, pt[0])
+		maxLon = math.Max(maxLon, pt[0])
+	}
+	return minLon, maxLon
+}
+
+func (p polygon) contains(lat, lon float64) bool {
+	if !ringContains(p[0], lat, lon) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContains(hole, lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains tests the point against a ring using ray casting.
+func ringContains(ring []point, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// unwrap shifts longitudes so that no edge spans more than 180 degrees,
+// which keeps rings crossing the antimeridian continuous.
+func unwrap(ring []point) []point {
+	res := make([]point, len(ring))
+	res[0] = ring[0]
+	for i := 1; i < len(ring); i++ {
+		lon := ring[i][0]
+		prev := res[i-1][0]
+		for lon-prev > 180 {
+			lon -= 360
+		}
+		for lon-prev < -180 {
+			lon += 360
+		}
+		res[i] = point{lon, ring[i][1]}
+	}
+	return res
+}
+
+// splitAntimeridian splits a box extending past ±180 degrees of longitude into boxes within range.
+func splitAntimeridian(bbox haversine.BoundingBox) []haversine.BoundingBox {
+	switch {
+	case bbox.MaxLon-bbox.MinLon >= 360:
+		bbox.MinLon, bbox.MaxLon = -180, 180
+	case bbox.MaxLon > 180:
+		east := bbox
+		east.MaxLon = 180
+		west := bbox
+		west.MinLon, west.MaxLon = -180, bbox.MaxLon-360
+		return []haversine.BoundingBox{east, west}
+	case bbox.MinLon < -180:
+		west := bbox
+		west.MinLon = -180
+		east := bbox
+		east.MinLon, east.MaxLon = bbox.MinLon+360, 180
+		return []haversine.BoundingBox{east, west}
+	}
+	return []haversine.BoundingBox{bbox}
+}
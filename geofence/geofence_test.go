@@ -0,0 +1,100 @@
+package geofence
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const valley = `{"type":"Polygon","coordinates":[
+	[[8.40,47.30],[8.70,47.30],[8.70,47.50],[8.40,47.50],[8.40,47.30]],
+	[[8.50,47.38],[8.60,47.38],[8.60,47.42],[8.50,47.42],[8.50,47.38]]
+]}`
+
+func TestParsePolygon(t *testing.T) {
+	fence, err := Parse([]byte(valley))
+	assert.NoError(t, err)
+
+	assert.True(t, fence.Contains(47.35, 8.45))
+	assert.False(t, fence.Contains(47.40, 8.55), "point in the hole")
+	assert.False(t, fence.Contains(47.60, 8.45))
+	assert.False(t, fence.Contains(47.35, 8.80))
+
+	boxes := fence.BoundingBoxes()
+	assert.Len(t, boxes, 1)
+	assert.Equal(t, 47.30, boxes[0].MinLat)
+	assert.Equal(t, 47.50, boxes[0].MaxLat)
+	assert.Equal(t, 8.40, boxes[0].MinLon)
+	assert.Equal(t, 8.70, boxes[0].MaxLon)
+
+	assert.Equal(t, "Polygon", fence.GeoJSON().Type)
+}
+
+func TestParseMultiPolygonFeature(t *testing.T) {
+	fence, err := Parse([]byte(`{"type":"Feature","properties":{},"geometry":{"type":"MultiPolygon","coordinates":[
+		[[[0,0],[1,0],[1,1],[0,1],[0,0]]],
+		[[[10,10],[11,10],[11,11],[10,11],[10,10]]]
+	]}}`))
+	assert.NoError(t, err)
+
+	assert.True(t, fence.Contains(0.5, 0.5))
+	assert.True(t, fence.Contains(10.5, 10.5))
+	assert.False(t, fence.Contains(5, 5))
+	assert.Len(t, fence.BoundingBoxes(), 2)
+}
+
+func TestAntimeridian(t *testing.T) {
+	fence, err := Parse([]byte(`{"type":"Polygon","coordinates":[[[179,-17],[-179,-17],[-179,-16],[179,-16],[179,-17]]]}`))
+	assert.NoError(t, err)
+
+	assert.True(t, fence.Contains(-16.5, 179.5))
+	assert.True(t, fence.Contains(-16.5, -179.5))
+	assert.True(t, fence.Contains(-16.5, 180))
+	assert.False(t, fence.Contains(-16.5, 0))
+	assert.False(t, fence.Contains(-16.5, 178))
+
+	boxes := fence.BoundingBoxes()
+	assert.Len(t, boxes, 2)
+	for _, bbox := range boxes {
+		assert.GreaterOrEqual(t, bbox.MinLon, -180.0)
+		assert.LessOrEqual(t, bbox.MaxLon, 180.0)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"Point","coordinates":[0,0]}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"type":"Polygon","coordinates":[[[0,0],[1,1]]]}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valley.geojson")
+	assert.NoError(t, os.WriteFile(path, []byte(valley), 0644))
+
+	fence, err := Load(path)
+	assert.NoError(t, err)
+	assert.True(t, fence.Contains(47.35, 8.45))
+
+	fence, err = Load("  " + valley)
+	assert.NoError(t, err)
+	assert.True(t, fence.Contains(47.35, 8.45))
+}
+
+func TestCircle(t *testing.T) {
+	circle := Circle{Latitude: 47.3769, Longitude: 8.5417, RadiusKm: 10}
+
+	assert.True(t, circle.Contains(47.38, 8.55))
+	assert.False(t, circle.Contains(47.6, 8.55))
+	assert.Len(t, circle.BoundingBoxes(), 1)
+
+	// The polygon drawn for the circle contains the center but not far away points
+	fence, err := Parse([]byte(`{"type":"Polygon","coordinates":` + string(circle.GeoJSON().Coordinates) + `}`))
+	assert.NoError(t, err)
+	assert.True(t, fence.Contains(47.3769, 8.5417))
+	assert.False(t, fence.Contains(47.6, 8.55))
+}
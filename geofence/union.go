@@ -0,0 +1,78 @@
+package geofence
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/carlo-colombo/sopra/haversine"
+)
+
+// Union is the area covered by any of its areas.
+type Union []Area
+
+// Contains reports whether the point is inside any of the areas.
+func (u Union) Contains(lat, lon float64) bool {
+	for _, area := range u {
+		if area.Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// BoundingBoxes returns the boxes of all areas, merging overlapping ones so that
+// overlapping areas are covered by a single box.
+func (u Union) BoundingBoxes() []haversine.BoundingBox {
+	var boxes []haversine.BoundingBox
+	for _, area := range u {
+		boxes = append(boxes, area.BoundingBoxes()...)
+	}
+	return mergeBoxes(boxes)
+}
+
+// mergeBoxes merges the overlapping boxes, until none overlaps.
+func mergeBoxes(boxes []haversine.BoundingBox) []haversine.BoundingBox {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(boxes) && !merged; i++ {
+			for j := i + 1; j < len(boxes); j++ {
+				if overlaps(boxes[i], boxes[j]) {
+					boxes[i] = haversine.BoundingBox{
+						MinLat: math.Min(boxes[i].MinLat, boxes[j].MinLat),
+						MinLon: math.Min(boxes[i].MinLon, boxes[j].MinLon),
+						MaxLat: math.Max(boxes[i].MaxLat, boxes[j].MaxLat),
+						MaxLon: math.Max(boxes[i].MaxLon, boxes[j].MaxLon),
+					}
+					boxes = append(boxes[:j], boxes[j+1:]...)
+					merged = true
+					break
+				}
+			}
+		}
+	}
+	return boxes
+}
+
+// GeoJSON returns the areas as a single MultiPolygon.
+func (u Union) GeoJSON() Geometry {
+	var polygons []json.RawMessage
+	for _, area := range u {
+		geometry := area.GeoJSON()
+		switch geometry.Type {
+		case "Polygon":
+			polygons = append(polygons, geometry.Coordinates)
+		case "MultiPolygon":
+			var parts []json.RawMessage
+			if err := json.Unmarshal(geometry.Coordinates, &parts); err == nil {
+				polygons = append(polygons, parts...)
+			}
+		}
+	}
+	coordinates, _ := json.Marshal(polygons)
+	return Geometry{Type: "MultiPolygon", Coordinates: coordinates}
+}
+
+func overlaps(a, b haversine.BoundingBox) bool {
+	return a.MinLat <= b.MaxLat && b.MinLat <= a.MaxLat &&
+		a.MinLon <= b.MaxLon && b.MinLon <= a.MaxLon
+}
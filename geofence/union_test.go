@@ -0,0 +1,31 @@
+package geofence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnion(t *testing.T) {
+	zurich := Circle{Latitude: 47.3769, Longitude: 8.5417, RadiusKm: 20}
+	winterthur := Circle{Latitude: 47.4988, Longitude: 8.7237, RadiusKm: 20}
+	geneva := Circle{Latitude: 46.2044, Longitude: 6.1432, RadiusKm: 20}
+
+	union := Union{zurich, winterthur, geneva}
+
+	assert.True(t, union.Contains(47.3769, 8.5417))
+	assert.True(t, union.Contains(46.2044, 6.1432))
+	assert.False(t, union.Contains(46.9, 7.4))
+
+	// Zurich and Winterthur overlap and are fetched with a single box
+	boxes := union.BoundingBoxes()
+	assert.Len(t, boxes, 2)
+	merged := boxes[0]
+	assert.Equal(t, zurich.BoundingBoxes()[0].MinLat, merged.MinLat)
+	assert.Equal(t, winterthur.BoundingBoxes()[0].MaxLat, merged.MaxLat)
+
+	fence, err := Parse([]byte(`{"type":"MultiPolygon","coordinates":` + string(union.GeoJSON().Coordinates) + `}`))
+	assert.NoError(t, err)
+	assert.True(t, fence.Contains(46.2044, 6.1432))
+	assert.True(t, fence.Contains(47.3769, 8.5417))
+}
@@ -18,13 +18,13 @@ type BoundingBox struct {
 func GetBoundingBox(lat, lon, radiusKm float64) BoundingBox {
 	rad := radiusKm / earthRadiusKm
 
-	minLat := lat - radToDeg(rad)
-	maxLat := lat + radToDeg(rad)
+	minLat := lat - RadToDeg(rad)
+	maxLat := lat + RadToDeg(rad)
 
-	deltaLon := math.Asin(math.Sin(rad) / math.Cos(degToRad(lat)))
+	deltaLon := math.Asin(math.Sin(rad) / math.Cos(DegToRad(lat)))
 
-	minLon := lon - radToDeg(deltaLon)
-	maxLon := lon + radToDeg(deltaLon)
+	minLon := lon - RadToDeg(deltaLon)
+	maxLon := lon + RadToDeg(deltaLon)
 
 	return BoundingBox{
 		MinLat: minLat,
@@ -34,21 +34,23 @@ func GetBoundingBox(lat, lon, radiusKm float64) BoundingBox {
 	}
 }
 
-func radToDeg(rad float64) float64 {
+// RadToDeg converts an angle from radians to degrees.
+func RadToDeg(rad float64) float64 {
 	return rad * 180 / math.Pi
 }
 
-func degToRad(deg float64) float64 {
+// DegToRad converts an angle from degrees to radians.
+func DegToRad(deg float64) float64 {
 	return deg * math.Pi / 180
 }
 
 // Distance calculates the shortest path between two coordinates on the surface of a sphere.
 func Distance(lat1, lon1, lat2, lon2 float64) float64 {
-	dLat := degToRad(lat2 - lat1)
-	dLon := degToRad(lon2 - lon1)
+	dLat := DegToRad(lat2 - lat1)
+	dLon := DegToRad(lon2 - lon1)
 
-	lat1 = degToRad(lat1)
-	lat2 = degToRad(lat2)
+	lat1 = DegToRad(lat1)
+	lat2 = DegToRad(lat2)
 
 	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
 		math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(lat1)*math.Cos(lat2)
@@ -56,3 +58,48 @@ func Distance(lat1, lon1, lat2, lon2 float64) float64 {
 
 	return earthRadiusKm * c
 }
+
+// Bearing calculates the initial bearing in degrees (0-360, clockwise from north)
+// from the first coordinate towards the second.
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	dLon := DegToRad(lon2 - lon1)
+
+	lat1 = DegToRad(lat1)
+	lat2 = DegToRad(lat2)
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+
+	return math.Mod(RadToDeg(math.Atan2(y, x))+360, 360)
+}
+
+// Destination calculates the point reached travelling the given distance in kilometers
+// from a starting point along a bearing in degrees.
+func Destination(lat, lon, bearing, distanceKm float64) (float64, float64) {
+	d := distanceKm / earthRadiusKm
+	b := DegToRad(bearing)
+	lat1 := DegToRad(lat)
+	lon1 := DegToRad(lon)
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lon2 := lon1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	return RadToDeg(lat2), math.Mod(RadToDeg(lon2)+540, 360) - 180
+}
+
+// LookAngles calculates where an observer sees a target: the azimuth in degrees (0-360, clockwise from north),
+// the elevation in degrees above the observer's horizon and the straight-line slant range in meters.
+// Altitudes are in meters above sea level. The curvature of the earth lowers distant targets: the
+// elevation is negative for targets below the horizon.
+func LookAngles(obsLat, obsLon, obsAlt, lat, lon, alt float64) (azimuth, elevation, slantRange float64) {
+	theta := Distance(obsLat, obsLon, lat, lon) / earthRadiusKm // central angle
+	r1 := earthRadiusKm*1000 + obsAlt
+	r2 := earthRadiusKm*1000 + alt
+
+	slantRange = math.Sqrt(r1*r1 + r2*r2 - 2*r1*r2*math.Cos(theta))
+	if slantRange == 0 {
+		return 0, 90, 0
+	}
+	elevation = RadToDeg(math.Asin(math.Max(-1, math.Min(1, (r2*math.Cos(theta)-r1)/slantRange))))
+	return Bearing(obsLat, obsLon, lat, lon), elevation, slantRange
+}
@@ -39,7 +39,7 @@ func TestGetBoundingBox(t *testing.T) {
 func TestRadToDeg(t *testing.T) {
 	rad := math.Pi
 	expectedDeg := 180.0
-	if deg := radToDeg(rad); !almostEqual(deg, expectedDeg) {
+	if deg := RadToDeg(rad); !almostEqual(deg, expectedDeg) {
 		t.Errorf("Expected %f, but got %f", expectedDeg, deg)
 	}
 }
@@ -47,7 +47,71 @@ func TestRadToDeg(t *testing.T) {
 func TestDegToRad(t *testing.T) {
 	deg := 180.0
 	expectedRad := math.Pi
-	if rad := degToRad(deg); !almostEqual(rad, expectedRad) {
+	if rad := DegToRad(deg); !almostEqual(rad, expectedRad) {
 		t.Errorf("Expected %f, but got %f", expectedRad, rad)
 	}
 }
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		expected               float64
+	}{
+		{"north", 47.0, 8.0, 48.0, 8.0, 0},
+		{"south", 47.0, 8.0, 46.0, 8.0, 180},
+		{"east on equator", 0, 0, 0, 1, 90},
+		{"west on equator", 0, 0, 0, -1, 270},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b := Bearing(tt.lat1, tt.lon1, tt.lat2, tt.lon2); !almostEqual(b, tt.expected) {
+				t.Errorf("Expected bearing %f, but got %f", tt.expected, b)
+			}
+		})
+	}
+}
+
+func TestDestination(t *testing.T) {
+	lat, lon := 47.3769, 8.5417
+	for _, bearing := range []float64{0, 45, 135, 270} {
+		dLat, dLon := Destination(lat, lon, bearing, 25)
+		if d := Distance(lat, lon, dLat, dLon); !almostEqual(d, 25) {
+			t.Errorf("Expected destination 25 km away at bearing %f, but got %f", bearing, d)
+		}
+		if b := Bearing(lat, lon, dLat, dLon); math.Abs(math.Remainder(b-bearing, 360)) > 1e-3 {
+			t.Errorf("Expected bearing %f, but got %f", bearing, b)
+		}
+	}
+}
+
+func TestLookAngles(t *testing.T) {
+	kmPerDegree := earthRadiusKm * math.Pi / 180
+	tests := []struct {
+		name                                   string
+		lat, lon, alt                          float64
+		azimuth, elevation, slantRange, margin float64
+	}{
+		{"10 km north, 10 km up", 47.0 + 10/kmPerDegree, 8.0, 10400, 0, 44.93, 14148, 0.01},
+		{"overhead", 47.0, 8.0, 1400, 0, 90, 1000, 0.01},
+		// 10 km up is still above the horizon at 300 km, but not at 400 km
+		{"300 km east", 47.0, 8.0 + 300/(kmPerDegree*math.Cos(DegToRad(47))), 10400, 88.55, 0.56, 300361, 0.01},
+		{"400 km east", 47.0, 8.0 + 400/(kmPerDegree*math.Cos(DegToRad(47))), 10400, 88.07, -0.37, 400322, 0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			azimuth, elevation, slantRange := LookAngles(47.0, 8.0, 400, tt.lat, tt.lon, tt.alt)
+			if math.Abs(azimuth-tt.azimuth) > tt.margin {
+				t.Errorf("Expected azimuth %f, but got %f", tt.azimuth, azimuth)
+			}
+			if math.Abs(elevation-tt.elevation) > tt.margin {
+				t.Errorf("Expected elevation %f, but got %f", tt.elevation, elevation)
+			}
+			if math.Abs(slantRange-tt.slantRange) > 1 {
+				t.Errorf("Expected slant range %f, but got %f", tt.slantRange, slantRange)
+			}
+		})
+	}
+}
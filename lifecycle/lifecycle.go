@@ -0,0 +1,104 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Component is a part of the application started and stopped by the Manager.
+type Component struct {
+	Name string
+	// Run blocks until the component stops, either on its own or once its context is canceled.
+	// It may be nil for components that only need to be stopped, like the database.
+	Run func(ctx context.Context) error
+	// Stop asks the component to stop gracefully before its context is canceled. It may be nil.
+	Stop func(ctx context.Context) error
+}
+
+// Manager runs components and, on shutdown, stops them in the reverse order they were added,
+// so that a component is stopped before the ones it depends on.
+type Manager struct {
+	timeout    time.Duration
+	components []*running
+}
+
+type running struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// New creates a Manager allowing timeout for the whole shutdown.
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// Add registers a component. Components must be added before Run.
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, &running{Component: c})
+}
+
+// Run starts the components and blocks until ctx is done or a component stops on its own,
+// then shuts all components down. It returns the error of the component that stopped,
+// joined with any error met during shutdown.
+func (m *Manager) Run(ctx context.Context) error {
+	stopped := make(chan *running, len(m.components))
+	for _, c := range m.components {
+		c.done = make(chan struct{})
+		if c.Run == nil {
+			close(c.done)
+			continue
+		}
+		var runCtx context.Context
+		runCtx, c.cancel = context.WithCancel(context.Background())
+		go func(c *running) {
+			defer close(c.done)
+			c.err = c.Run(runCtx)
+			stopped <- c
+		}(c)
+	}
+
+	var cause error
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down: %v", context.Cause(ctx))
+	case c := <-stopped:
+		if c.err != nil {
+			cause = fmt.Errorf("%s: %w", c.Name, c.err)
+		}
+		log.Printf("Shutting down: %s stopped: %v", c.Name, c.err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	errs := []error{cause}
+	for i := len(m.components) - 1; i >= 0; i-- {
+		if err := m.stop(shutdownCtx, m.components[i]); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", m.components[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stop stops a component and waits for its Run to return.
+func (m *Manager) stop(ctx context.Context, c *running) error {
+	start := time.Now()
+	var err error
+	if c.Stop != nil {
+		err = c.Stop(ctx)
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return errors.Join(err, fmt.Errorf("did not stop in time: %w", ctx.Err()))
+	}
+	log.Printf("Stopped %s in %s", c.Name, time.Since(start))
+	return err
+}
@@ -0,0 +1,76 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_StopsInReverseOrder(t *testing.T) {
+	var stopped []string
+	m := New(time.Second)
+	m.Add(Component{
+		Name: "database",
+		Stop: func(ctx context.Context) error {
+			stopped = append(stopped, "database")
+			return nil
+		},
+	})
+	m.Add(Component{
+		Name: "watcher",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped = append(stopped, "watcher")
+			return nil
+		},
+	})
+	release := make(chan struct{})
+	m.Add(Component{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopped = append(stopped, "server")
+			close(release)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, m.Run(ctx))
+	assert.Equal(t, []string{"server", "watcher", "database"}, stopped)
+}
+
+func TestRun_ComponentFailure(t *testing.T) {
+	var dbClosed bool
+	m := New(time.Second)
+	m.Add(Component{Name: "database", Stop: func(ctx context.Context) error {
+		dbClosed = true
+		return nil
+	}})
+	m.Add(Component{Name: "server", Run: func(ctx context.Context) error {
+		return errors.New("address already in use")
+	}})
+
+	err := m.Run(context.Background())
+	assert.ErrorContains(t, err, "server: address already in use")
+	assert.True(t, dbClosed)
+}
+
+func TestRun_Timeout(t *testing.T) {
+	m := New(50 * time.Millisecond)
+	m.Add(Component{Name: "stuck", Run: func(ctx context.Context) error {
+		select {}
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := m.Run(ctx)
+	assert.ErrorContains(t, err, "stopping stuck: did not stop in time")
+}
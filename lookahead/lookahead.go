@@ -0,0 +1,134 @@
+// Package lookahead predicts the aircraft about to fly over a site, dead reckoning the aircraft around its area.
+package lookahead
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// step is the resolution of the first scan of a path, refined afterwards.
+const step = 5 * time.Second
+
+// Site is an area watched for the aircraft about to enter it.
+type Site struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+	Area      geofence.Area
+}
+
+// Predictor extrapolates the paths of the aircraft outside a site to find when they enter its area.
+type Predictor struct {
+	horizon time.Duration
+}
+
+// New creates a Predictor from the look-ahead configuration.
+func New(cfg config.LookaheadConfig) (*Predictor, error) {
+	if cfg.Horizon <= 0 || cfg.Horizon > 3600 {
+		return nil, fmt.Errorf("the look-ahead horizon must be between 1 and 3600 seconds")
+	}
+	if cfg.Margin <= 0 || cfg.Margin > 500 {
+		return nil, fmt.Errorf("the look-ahead margin must be positive and at most 500 km")
+	}
+	return &Predictor{horizon: time.Duration(cfg.Horizon) * time.Second}, nil
+}
+
+// Predict returns the aircraft outside the area of the site predicted to enter it within the horizon after at,
+// soonest first. Aircraft keep their last track, speed and vertical rate. The closest approach is the closest
+// to the site within the horizon.
+func (p *Predictor) Predict(site Site, states []model.Flight, at time.Time) []model.Prediction {
+	var predictions []model.Prediction
+	for i := range states {
+		state := &states[i]
+		if state.OnGround || state.Velocity <= 0 || site.Area.Contains(state.Latitude, state.Longitude) {
+			continue
+		}
+		if prediction, ok := p.predict(site, state, at); ok {
+			predictions = append(predictions, prediction)
+		}
+	}
+	slices.SortFunc(predictions, func(a, b model.Prediction) int {
+		return cmp.Or(a.EntryTime.Compare(b.EntryTime), cmp.Compare(a.Icao24, b.Icao24))
+	})
+	return predictions
+}
+
+// predict finds when an aircraft enters the area of the site and its closest approach, if it enters within the horizon.
+func (p *Predictor) predict(site Site, state *model.Flight, at time.Time) (model.Prediction, bool) {
+	seen := at
+	if state.TimePosition > 0 {
+		seen = time.Unix(int64(state.TimePosition), 0)
+	}
+	position := func(t time.Time) (lat, lon float64) {
+		return haversine.Destination(state.Latitude, state.Longitude, state.TrueTrack, state.Velocity*t.Sub(seen).Seconds()/1000)
+	}
+	inside := func(t time.Time) bool {
+		return site.Area.Contains(position(t))
+	}
+	distance := func(t time.Time) float64 {
+		lat, lon := position(t)
+		return haversine.Distance(site.Latitude, site.Longitude, lat, lon) * 1000
+	}
+
+	steps := int(p.horizon / step)
+	entry, closest, best := -1, 0, math.Inf(1)
+	for i := 0; i <= steps; i++ {
+		t := at.Add(time.Duration(i) * step)
+		if entry < 0 && inside(t) {
+			entry = i
+		}
+		if d := distance(t); d < best {
+			closest, best = i, d
+		}
+	}
+	if entry < 0 {
+		return model.Prediction{}, false
+	}
+
+	// Bisect the boundary crossing, and golden section search the closest approach, between the neighbouring steps
+	entryTime := at
+	if entry > 0 {
+		lo, hi := at.Add(time.Duration(entry-1)*step), at.Add(time.Duration(entry)*step)
+		for hi.Sub(lo) > 100*time.Millisecond {
+			if mid := lo.Add(hi.Sub(lo) / 2); inside(mid) {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		entryTime = hi
+	}
+	lo, hi := at.Add(time.Duration(max(closest-1, 0))*step), at.Add(time.Duration(min(closest+1, steps))*step)
+	const ratio = 0.6180339887498949
+	for hi.Sub(lo) > 100*time.Millisecond {
+		m1 := hi.Add(-time.Duration(float64(hi.Sub(lo)) * ratio))
+		m2 := lo.Add(time.Duration(float64(hi.Sub(lo)) * ratio))
+		if distance(m1) < distance(m2) {
+			hi = m2
+		} else {
+			lo = m1
+		}
+	}
+	closestTime := lo.Add(hi.Sub(lo) / 2)
+
+	entryLat, entryLon := position(entryTime)
+	return model.Prediction{
+		Site:            site.Name,
+		Icao24:          state.Icao24,
+		Callsign:        state.Callsign,
+		PredictedAt:     at,
+		EntryTime:       entryTime.Truncate(time.Second),
+		EntryBearing:    math.Round(haversine.Bearing(site.Latitude, site.Longitude, entryLat, entryLon)),
+		ClosestTime:     closestTime.Truncate(time.Second),
+		ClosestDistance: math.Round(distance(closestTime)),
+		ClosestAltitude: math.Round(math.Max(state.GeometricAltitude()+state.VerticalRate*closestTime.Sub(seen).Seconds(), 0)),
+	}, true
+}
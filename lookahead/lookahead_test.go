@@ -0,0 +1,81 @@
+package lookahead
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredict(t *testing.T) {
+	predictor, err := New(config.LookaheadConfig{Margin: 50, Horizon: 600})
+	require.NoError(t, err)
+	site := Site{Name: "home", Latitude: 47.0, Longitude: 8.0, Area: geofence.Circle{Latitude: 47.0, Longitude: 8.0, RadiusKm: 10}}
+	at := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+
+	// 42 km west flying east at 200 m/s, passing 2 km north of the site, reported 10 seconds ago
+	northLat, northLon := haversine.Destination(47.0, 8.0, 0, 2)
+	lat, lon := haversine.Destination(northLat, northLon, 270, 42)
+	states := []model.Flight{
+		{Icao24: "abc123", Callsign: "XYZ12", TimePosition: int(at.Add(-10 * time.Second).Unix()), Latitude: lat, Longitude: lon,
+			GeoAltitude: 5000, VerticalRate: -5, Velocity: 200, TrueTrack: haversine.Bearing(lat, lon, northLat, northLon)},
+		{Icao24: "away01", Latitude: lat, Longitude: lon, Velocity: 200, TrueTrack: 270},               // flying away
+		{Icao24: "ground", Latitude: lat, Longitude: lon, Velocity: 20, TrueTrack: 90, OnGround: true}, // taxiing
+		{Icao24: "inside", Latitude: 47.0, Longitude: 8.0, Velocity: 200, TrueTrack: 90},               // already overhead
+	}
+	farLat, farLon := haversine.Destination(47.0, 8.0, 180, 150)
+	states = append(states, model.Flight{Icao24: "far001", Latitude: farLat, Longitude: farLon, Velocity: 200}) // beyond the horizon
+
+	predictions := predictor.Predict(site, states, at)
+	require.Len(t, predictions, 1)
+	p := predictions[0]
+	assert.Equal(t, "home", p.Site)
+	assert.Equal(t, "abc123", p.Icao24)
+	assert.Equal(t, "XYZ12", p.Callsign)
+	assert.Equal(t, at, p.PredictedAt)
+	// 42 km, less the 9.8 km of the chord 2 km off the center, at 200 m/s from 10 seconds ago
+	assert.WithinDuration(t, at.Add(151*time.Second), p.EntryTime, 2*time.Second)
+	assert.InDelta(t, 281.5, p.EntryBearing, 1)
+	assert.WithinDuration(t, at.Add(200*time.Second), p.ClosestTime, 2*time.Second)
+	assert.InDelta(t, 2000, p.ClosestDistance, 20)
+	assert.InDelta(t, 3950, p.ClosestAltitude, 10, "descending for 210 seconds")
+}
+
+func TestPredict_AboutToEnter(t *testing.T) {
+	predictor, err := New(config.LookaheadConfig{Margin: 50, Horizon: 60})
+	require.NoError(t, err)
+	site := Site{Name: "home", Latitude: 47.0, Longitude: 8.0, Area: geofence.Circle{Latitude: 47.0, Longitude: 8.0, RadiusKm: 10}}
+	at := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+
+	// Reported just outside a minute ago, already inside by now
+	lat, lon := haversine.Destination(47.0, 8.0, 270, 10.5)
+	track := haversine.Bearing(lat, lon, 47.0, 8.0)
+	predictions := predictor.Predict(site, []model.Flight{{Icao24: "abc123", TimePosition: int(at.Add(-time.Minute).Unix()),
+		Latitude: lat, Longitude: lon, Velocity: 100, TrueTrack: track}}, at)
+	require.Len(t, predictions, 1)
+	assert.Equal(t, at, predictions[0].EntryTime)
+	assert.WithinDuration(t, at.Add(45*time.Second), predictions[0].ClosestTime, time.Second)
+	assert.InDelta(t, 0, predictions[0].ClosestDistance, 10)
+
+	// Without a position time the state is taken as current
+	predictions = predictor.Predict(site, []model.Flight{{Icao24: "abc123", Latitude: lat, Longitude: lon, Velocity: 100, TrueTrack: track}}, at)
+	require.Len(t, predictions, 1)
+	assert.WithinDuration(t, at.Add(5*time.Second), predictions[0].EntryTime, time.Second)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	for _, cfg := range []config.LookaheadConfig{
+		{Margin: 50},
+		{Margin: 50, Horizon: 7200},
+		{Horizon: 600},
+		{Margin: 1000, Horizon: 600},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
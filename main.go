@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/carlo-colombo/sopra/client"
 	"github.com/carlo-colombo/sopra/config"
-	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/lifecycle"
+	"github.com/carlo-colombo/sopra/maintenance"
+	"github.com/carlo-colombo/sopra/mqtt"
+	"github.com/carlo-colombo/sopra/recurring"
+	"github.com/carlo-colombo/sopra/retention"
+	"github.com/carlo-colombo/sopra/rules"
 	"github.com/carlo-colombo/sopra/server"
 	"github.com/carlo-colombo/sopra/service"
+	"github.com/carlo-colombo/sopra/webhook"
 	"github.com/spf13/pflag"
 )
 
@@ -19,6 +29,8 @@ func main() {
 	pflag.Bool("print", false, "Print the result and logs to stdout")
 	pflag.Bool("watch", false, "Watch for flights and log them")
 	pflag.Int("interval", 300, "The interval to watch for flights in seconds")
+	// The flags following a command, such as export, are the command's own
+	pflag.CommandLine.SetInterspersed(false)
 	pflag.Parse()
 
 	cfg, err := config.LoadConfig(".")
@@ -29,6 +41,13 @@ func main() {
 
 	log.Printf("%s", cfg.String()) // Print the loaded configuration
 
+	if pflag.Arg(0) == "db" {
+		runDBCommand(cfg, pflag.Args()[1:])
+	}
+	if pflag.Arg(0) == "export" {
+		runExport(cfg, pflag.Args()[1:])
+	}
+
 	if cfg.OpenSkyClient.ID == "" || cfg.OpenSkyClient.Secret == "" {
 		log.Fatal("OPENSKY_CLIENT_ID and OPENSKY_CLIENT_SECRET environment variables are required")
 	}
@@ -38,7 +57,7 @@ func main() {
 	}
 
 	// Initialize the db
-	db, err := database.NewDB(cfg.DBPath)
+	db, err := openStore(cfg)
 	if err != nil {
 		log.Fatalf("Error initializing db: %v", err)
 	}
@@ -51,7 +70,7 @@ func main() {
 		log.Printf("Database initialized. Total flights in DB: %d", flightCount)
 	}
 
-	latestFlight, lastSeen, err := db.GetLatestFlight()
+	latestFlight, lastSeen, err := db.GetLatestFlight("")
 	if err != nil {
 		log.Printf("Error getting latest flight from DB: %v", err)
 	} else if latestFlight != nil {
@@ -64,10 +83,13 @@ func main() {
 	openskyClient := client.NewOpenSkyClient(cfg.OpenSkyClient.ID, cfg.OpenSkyClient.Secret)
 	flightawareClient := client.NewFlightAwareClient(cfg.FlightAware.APIKey, db)
 	travelImpactModelClient := client.NewTravelImpactModelClient(cfg, db)
-	appService := service.NewService(openskyClient, flightawareClient, travelImpactModelClient, db, cfg) // Pass cfg here
+	appService, err := service.NewService(openskyClient, flightawareClient, travelImpactModelClient, db, cfg) // Pass cfg here
+	if err != nil {
+		log.Fatalf("Error configuring the service: %v", err)
+	}
 
 	if cfg.Print {
-		flights, err := appService.GetFlightsInRadius(cfg.Service.Latitude, cfg.Service.Longitude, cfg.Service.Radius)
+		flights, err := appService.GetFlights("")
 		if err != nil {
 			log.Printf("Error getting flights: %v", err)
 			// Print an empty JSON array of FlightInfo or a JSON error object
@@ -89,13 +111,95 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Components are stopped in reverse order: the server first, then the watcher, the event consumers, then the db.
+	manager := lifecycle.New(time.Duration(cfg.ShutdownTimeout) * time.Second)
+	manager.Add(lifecycle.Component{
+		Name: "database",
+		Stop: func(ctx context.Context) error { return db.Close() },
+	})
+	// Event consumers are added before the watcher, so they are stopped after it and handle its last events
+	dispatcher, err := webhook.New(cfg.Webhooks, db)
+	if err != nil {
+		log.Fatalf("Error configuring webhooks: %v", err)
+	}
+	if dispatcher.Enabled() {
+		addConsumer(manager, appService.Events(), "webhooks", dispatcher.Run)
+	}
+	var publisher *mqtt.Publisher
+	if cfg.MQTT.Broker != "" {
+		publisher = mqtt.New(cfg, db)
+		addConsumer(manager, appService.Events(), "mqtt", publisher.Run)
+	}
+	ruleEngine, err := rules.New(cfg.Rules, db)
+	if err != nil {
+		log.Fatalf("Error loading alert rules: %v", err)
+	}
+	if dispatcher.Enabled() {
+		ruleEngine.SetAction(rules.ActionWebhook, dispatcher.Enqueue)
+	}
+	if publisher != nil {
+		ruleEngine.SetAction(rules.ActionMQTT, publisher.Alert)
+	}
+	addConsumer(manager, appService.Events(), "rules", ruleEngine.Run)
+	learner, err := recurring.New(cfg, db)
+	if err != nil {
+		log.Fatalf("Error configuring the recurring flights: %v", err)
+	}
+	manager.Add(lifecycle.Component{Name: "recurring flights", Run: learner.Run})
+	if cfg.Maintenance.Enabled {
+		scheduler, err := maintenance.New(cfg, db)
+		if err != nil {
+			log.Fatalf("Error configuring the maintenance: %v", err)
+		}
+		manager.Add(lifecycle.Component{Name: "maintenance", Run: scheduler.Run})
+	} else if cfg.Positions.Enabled {
+		// Without the maintenance scheduler the retention of the positions runs on its own
+		retentionJob, err := retention.New(cfg.Positions, db)
+		if err != nil {
+			log.Fatalf("Error configuring the retention of the positions: %v", err)
+		}
+		manager.Add(lifecycle.Component{Name: "positions retention", Run: retentionJob.Run})
+	}
 	if cfg.Watch {
-		go appService.RunWatchMode(cfg.Interval)
+		manager.Add(lifecycle.Component{
+			Name: "watcher",
+			Run: func(ctx context.Context) error {
+				appService.RunWatchMode(ctx)
+				return nil
+			},
+		})
 	}
 
-	log.Printf("Server starting on port :%d", cfg.Port)
 	httpServer := server.NewServer(appService, cfg, db)
-	if err := httpServer.Start(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	httpServer.SetRules(ruleEngine)
+	manager.Add(lifecycle.Component{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			log.Printf("Server starting on port :%d", cfg.Port)
+			return httpServer.Start()
+		},
+		Stop: httpServer.Shutdown,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := manager.Run(ctx); err != nil {
+		log.Fatalf("Shutdown with error: %v", err)
 	}
+	log.Println("Shutdown complete")
+}
+
+// addConsumer adds a component running consume on the events of the bus.
+func addConsumer(manager *lifecycle.Manager, bus *events.Bus, name string, consume func(context.Context, <-chan events.Event) error) {
+	subscription := bus.Subscribe(1000)
+	manager.Add(lifecycle.Component{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			return consume(ctx, subscription.C)
+		},
+		Stop: func(ctx context.Context) error {
+			subscription.Close()
+			return nil
+		},
+	})
 }
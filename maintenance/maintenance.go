@@ -0,0 +1,137 @@
+// Package maintenance keeps the database tidy in the background: it sweeps the expired cache entries,
+// applies the retention policies, optimizes, vacuums and checkpoints the database, and records every run.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/retention"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+// checkInterval is how often the scheduler looks for the jobs due.
+const checkInterval = time.Minute
+
+// The names of the jobs, as recorded in their runs.
+const (
+	JobCache      = "cache"
+	JobPositions  = "positions"
+	JobHistory    = "history"
+	JobCheckpoint = "checkpoint"
+	JobOptimize   = "optimize"
+	JobVacuum     = "vacuum"
+)
+
+// job is a maintenance task run every so often, returning how many rows or pages it affected.
+type job struct {
+	name  string
+	every time.Duration
+	run   func(now time.Time) (int64, error)
+}
+
+// Store is the storage the jobs maintain: the cache, the positions and the database itself, with the runs.
+type Store interface {
+	storage.KeyValueCache
+	storage.Positions
+	storage.Maintenance
+}
+
+// Scheduler runs the maintenance jobs when they are due.
+type Scheduler struct {
+	db   Store
+	jobs []job
+	next map[string]time.Time
+}
+
+// New creates a Scheduler with the jobs enabled by the configuration. The jobs deleting rows come first,
+// so that the vacuum returns their pages to the file system.
+func New(cfg *config.Config, db Store) (*Scheduler, error) {
+	if cfg.Maintenance.HistoryDays < 1 {
+		return nil, fmt.Errorf("the runs of the maintenance jobs must be kept for at least 1 day")
+	}
+	s := &Scheduler{db: db, next: make(map[string]time.Time)}
+	s.jobs = append(s.jobs, job{JobCache, time.Hour, db.DeleteExpiredCache})
+	if cfg.Positions.Enabled {
+		positions, err := retention.New(cfg.Positions, db)
+		if err != nil {
+			return nil, err
+		}
+		s.jobs = append(s.jobs, job{JobPositions, time.Hour, positions.Apply})
+	}
+	historyDays := cfg.Maintenance.HistoryDays
+	s.jobs = append(s.jobs,
+		job{JobHistory, 24 * time.Hour, func(now time.Time) (int64, error) {
+			return db.DeleteMaintenanceRunsBefore(now.AddDate(0, 0, -historyDays))
+		}},
+		job{JobCheckpoint, time.Hour, func(time.Time) (int64, error) { return db.Checkpoint() }},
+		job{JobOptimize, 24 * time.Hour, func(time.Time) (int64, error) { return 0, db.Optimize() }},
+		job{JobVacuum, 24 * time.Hour, func(time.Time) (int64, error) { return db.IncrementalVacuum() }},
+	)
+	return s, nil
+}
+
+// Run runs the jobs as they are due, until ctx is canceled. Jobs that never ran, or not for longer
+// than their interval, e.g. while sopra was stopped, are due right away.
+func (s *Scheduler) Run(ctx context.Context) error {
+	last, err := s.db.GetLastMaintenanceRuns()
+	if err != nil {
+		log.Printf("Error getting the last maintenance runs: %v", err)
+	}
+	for _, j := range s.jobs {
+		s.next[j.name] = last[j.name].Add(j.every)
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		s.RunDue(time.Now())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs the jobs due at the given time and returns their runs.
+func (s *Scheduler) RunDue(now time.Time) []*model.MaintenanceRun {
+	var runs []*model.MaintenanceRun
+	for _, j := range s.jobs {
+		if now.Before(s.next[j.name]) {
+			continue
+		}
+		runs = append(runs, s.run(j, now))
+		s.next[j.name] = now.Add(j.every)
+	}
+	return runs
+}
+
+// RunAll runs all the jobs right away, whether due or not, and returns their runs.
+func (s *Scheduler) RunAll(now time.Time) []*model.MaintenanceRun {
+	runs := make([]*model.MaintenanceRun, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		runs = append(runs, s.run(j, now))
+		s.next[j.name] = now.Add(j.every)
+	}
+	return runs
+}
+
+// run runs a job and records its run; errors are logged and recorded rather than returned, the other jobs still run.
+func (s *Scheduler) run(j job, now time.Time) *model.MaintenanceRun {
+	start := time.Now()
+	affected, err := j.run(now)
+	run := &model.MaintenanceRun{Job: j.name, StartedAt: now, DurationMs: time.Since(start).Milliseconds(), Affected: affected}
+	if err != nil {
+		log.Printf("Error running the maintenance job %s: %v", j.name, err)
+		run.Error = err.Error()
+	}
+	if err := s.db.RecordMaintenanceRun(run); err != nil {
+		log.Printf("Error recording the run of the maintenance job %s: %v", j.name, err)
+	}
+	return run
+}
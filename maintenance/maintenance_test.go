@@ -0,0 +1,90 @@
+package maintenance
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/memory"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) *database.DB {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := database.NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+	return db
+}
+
+func jobs(runs []*model.MaintenanceRun) []string {
+	names := make([]string, len(runs))
+	for i, run := range runs {
+		names[i] = run.Job
+	}
+	return names
+}
+
+func TestScheduler(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{
+		Positions:   config.PositionsConfig{Enabled: true, FullDays: 7, Downsample: 60, Months: 6},
+		Maintenance: config.MaintenanceConfig{Enabled: true, HistoryDays: 30},
+	}
+	scheduler, err := New(cfg, db)
+	require.NoError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, db.Set("expired", "a", -time.Minute))
+	require.NoError(t, db.RecordPositions([]model.Flight{{Icao24: "4b1805", Latitude: 47.4, Longitude: 8.5}}, now.AddDate(-1, 0, 0)))
+	require.NoError(t, db.RecordMaintenanceRun(&model.MaintenanceRun{Job: JobOptimize, StartedAt: now.AddDate(0, 0, -31)}))
+
+	runs := scheduler.RunAll(now)
+	assert.Equal(t, []string{JobCache, JobPositions, JobHistory, JobCheckpoint, JobOptimize, JobVacuum}, jobs(runs))
+	for _, run := range runs {
+		assert.Empty(t, run.Error, run.Job)
+	}
+	assert.Equal(t, int64(1), runs[0].Affected)
+	assert.Equal(t, int64(1), runs[1].Affected)
+	assert.Equal(t, int64(1), runs[2].Affected)
+
+	// The runs are recorded
+	recorded, err := db.GetMaintenanceRuns(10)
+	require.NoError(t, err)
+	assert.Len(t, recorded, len(runs))
+
+	// The hourly jobs are due an hour later, the daily ones a day later
+	assert.Empty(t, scheduler.RunDue(now.Add(30*time.Minute)))
+	assert.Equal(t, []string{JobCache, JobPositions, JobCheckpoint}, jobs(scheduler.RunDue(now.Add(time.Hour))))
+	assert.Equal(t, []string{JobCache, JobPositions, JobHistory, JobCheckpoint, JobOptimize, JobVacuum}, jobs(scheduler.RunDue(now.Add(24*time.Hour))))
+}
+
+func TestScheduler_PositionsDisabled(t *testing.T) {
+	db := newTestDB(t)
+	scheduler, err := New(&config.Config{Maintenance: config.MaintenanceConfig{HistoryDays: 30}}, db)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{JobCache, JobHistory, JobCheckpoint, JobOptimize, JobVacuum}, jobs(scheduler.RunAll(time.Now())))
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(&config.Config{}, memory.New())
+	assert.Error(t, err)
+
+	_, err = New(&config.Config{
+		Positions:   config.PositionsConfig{Enabled: true},
+		Maintenance: config.MaintenanceConfig{HistoryDays: 30},
+	}, memory.New())
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// ExportSightings calls fn with the sightings started from the given time and before the other, optionally
+// restricted to a site, in the order they started, flattened with their flights. The rows are flattened
+// first, so that fn runs without holding the store, and the first error returned by fn stops the export.
+func (s *Store) ExportSightings(from, to time.Time, site string, fn func(*model.ExportRow) error) error {
+	s.mu.Lock()
+	sightings := s.selectSightings(site, func(sighting *model.Sighting) bool {
+		return !sighting.FirstSeen.Before(from) && sighting.FirstSeen.Before(to)
+	})
+	slices.SortStableFunc(sightings, func(a, b *model.Sighting) int { return a.FirstSeen.Compare(b.FirstSeen) })
+	rows := make([]model.ExportRow, len(sightings))
+	for i, sighting := range sightings {
+		var flight *model.FlightInfo
+		if r, ok := s.flights[sighting.Callsign]; ok {
+			flight = r.legAt(sighting.LastSeen)
+		}
+		rows[i] = model.NewExportRow(sighting, flight)
+	}
+	s.mu.Unlock()
+
+	for i := range rows {
+		if err := fn(&rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
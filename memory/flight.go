@@ -0,0 +1,233 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// flightRecord is a flight of the enrichment cache, by the key it was logged with.
+type flightRecord struct {
+	info     model.FlightInfo
+	lastSeen time.Time
+	count    int
+	legs     []flightLeg // in the order they were first logged
+}
+
+// flightLeg is a leg of a flight, one per FlightAware flight id, as last logged.
+type flightLeg struct {
+	info     model.FlightInfo
+	loggedAt time.Time // when the leg was first logged
+}
+
+// legAt returns a copy of the leg logged last by the given time, nil if none was.
+func (r *flightRecord) legAt(at time.Time) *model.FlightInfo {
+	for i := len(r.legs) - 1; i >= 0; i-- {
+		if !r.legs[i].loggedAt.After(at) {
+			f := copyFlight(&r.legs[i].info)
+			return &f
+		}
+	}
+	return nil
+}
+
+// copyFlight returns a copy of a FlightInfo as stored: without what is only displayed, and without
+// the airports lacking a code, the empty codeshares and the identification count, set on reading.
+func copyFlight(f *model.FlightInfo) model.FlightInfo {
+	c := *f
+	c.DistanceDisplay = ""
+	c.CO2KGDisplay = ""
+	c.IdentificationCount = 0
+	c.Codeshares = cloneOrNil(f.Codeshares)
+	c.CodesharesIata = cloneOrNil(f.CodesharesIata)
+	for _, a := range []*model.AirportDetail{&c.Origin, &c.Destination} {
+		if a.Code+a.CodeIcao+a.CodeIata == "" {
+			*a = model.AirportDetail{}
+		}
+	}
+	return c
+}
+
+func cloneOrNil(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return slices.Clone(s)
+}
+
+// read returns a copy of the flight, with its identification count.
+func (r *flightRecord) read() *model.FlightInfo {
+	f := copyFlight(&r.info)
+	f.IdentificationCount = r.count
+	return &f
+}
+
+// GetFlightCount returns the total number of flights in the cache.
+func (s *Store) GetFlightCount() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.flights), nil
+}
+
+// GetFlight retrieves a cached FlightInfo by key.
+func (s *Store) GetFlight(key string) (*model.FlightInfo, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.flights[key]
+	if !ok {
+		return nil, time.Time{}, nil
+	}
+	return r.read(), r.lastSeen, nil
+}
+
+// LogFlight stores a FlightInfo in the cache, seen now, and counts its identification.
+func (s *Store) LogFlight(key string, flightInfo *model.FlightInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.flights[key]
+	if !ok {
+		r = &flightRecord{}
+		s.flights[key] = r
+	}
+	r.info = copyFlight(flightInfo)
+	r.lastSeen = time.Now()
+	r.count++
+	i := slices.IndexFunc(r.legs, func(l flightLeg) bool { return l.info.FaFlightID == flightInfo.FaFlightID })
+	if i < 0 {
+		r.legs = append(r.legs, flightLeg{loggedAt: r.lastSeen})
+		i = len(r.legs) - 1
+	}
+	r.legs[i].info = r.info
+	return nil
+}
+
+// GetLatestFlight retrieves the most recently logged FlightInfo, optionally restricted to a site.
+func (s *Store) GetLatestFlight(site string) (*model.FlightInfo, time.Time, error) {
+	flights, lastSeens, err := s.GetAllFlights(1, site)
+	if err != nil || len(flights) == 0 {
+		return nil, time.Time{}, err
+	}
+	return flights[0], lastSeens[0], nil
+}
+
+// flightSeen is a flight with the time it was seen, by the query it is listed by.
+type flightSeen struct {
+	record   *flightRecord
+	lastSeen time.Time
+}
+
+// flightLog returns the logged flights newest first. When site is not empty only the flights sighted
+// there are listed, with their last sighting time at the site.
+func (s *Store) flightLog(site string) []flightSeen {
+	var log []flightSeen
+	if site == "" {
+		for _, r := range s.flights {
+			log = append(log, flightSeen{r, r.lastSeen})
+		}
+	} else {
+		last := make(map[string]*model.Sighting) // the latest sighting of each callsign at the site
+		for _, sighting := range s.sightings {
+			if sighting.Site == site {
+				last[sighting.Callsign] = sighting
+			}
+		}
+		for callsign, sighting := range last {
+			if r, ok := s.flights[callsign]; ok {
+				log = append(log, flightSeen{r, sighting.LastSeen})
+			}
+		}
+	}
+	slices.SortFunc(log, func(a, b flightSeen) int {
+		return cmp.Or(b.lastSeen.Compare(a.lastSeen), cmp.Compare(a.record.info.Ident, b.record.info.Ident))
+	})
+	return log
+}
+
+// split returns the flights and the times they were seen.
+func split(log []flightSeen) ([]*model.FlightInfo, []time.Time) {
+	var flights []*model.FlightInfo
+	var lastSeens []time.Time
+	for _, f := range log {
+		flights = append(flights, f.record.read())
+		lastSeens = append(lastSeens, f.lastSeen)
+	}
+	return flights, lastSeens
+}
+
+// GetLast10Flights retrieves the last 10 logged FlightInfo, one per ident, optionally restricted to a site.
+func (s *Store) GetLast10Flights(site string) ([]*model.FlightInfo, []time.Time, error) {
+	if site != "" {
+		return s.GetAllFlights(10, site)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := make(map[string]time.Time) // the last time each ident was seen
+	for _, r := range s.flights {
+		if r.lastSeen.After(latest[r.info.Ident]) {
+			latest[r.info.Ident] = r.lastSeen
+		}
+	}
+	log := slices.DeleteFunc(s.flightLog(""), func(f flightSeen) bool {
+		return f.lastSeen.Before(latest[f.record.info.Ident])
+	})
+	flights, lastSeens := split(limited(log, 10))
+	return flights, lastSeens, nil
+}
+
+// GetAllFlights retrieves the logged FlightInfo, optionally limited by the limit parameter
+// and restricted to the flights sighted at site.
+func (s *Store) GetAllFlights(limit int, site string) ([]*model.FlightInfo, []time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.flightLog(site)
+	if limit > 0 {
+		log = limited(log, limit)
+	}
+	flights, lastSeens := split(log)
+	return flights, lastSeens, nil
+}
+
+// ClearFlightLog deletes all the logged flights, the sightings and the first seen values.
+func (s *Store) ClearFlightLog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flights = make(map[string]*flightRecord)
+	s.airports = make(map[string]airportLocation)
+	s.sightings = nil
+	s.lastSightings = make(map[sightingKey]*model.Sighting)
+	s.firstSeen = nil
+	return nil
+}
+
+// airportLocation is where the airports of a code are.
+type airportLocation struct {
+	latitude, longitude float64
+}
+
+// AirportLocated reports whether the airports of a code all have a location: an airport no logged flight refers to
+// has none to find.
+func (s *Store) AirportLocated(code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.airports[code]; ok {
+		return true, nil
+	}
+	for _, r := range s.flights {
+		for _, leg := range r.legs {
+			if leg.info.Origin.Code == code || leg.info.Destination.Code == code {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// SetAirportLocation stores the latitude and the longitude of the airports of a code.
+func (s *Store) SetAirportLocation(code string, latitude, longitude float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.airports[code] = airportLocation{latitude, longitude}
+	return nil
+}
@@ -0,0 +1,247 @@
+// Package memory implements the storage repositories in memory, for the tests and the ephemeral demo runs:
+// nothing survives the process.
+package memory
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+// Store keeps everything in memory, behind a single lock.
+type Store struct {
+	mu sync.Mutex
+
+	cache     map[string]cacheEntry
+	operators map[string]string
+	flights   map[string]*flightRecord
+	airports  map[string]airportLocation
+
+	sightings        []*model.Sighting
+	lastSightings    map[sightingKey]*model.Sighting
+	filterRejections map[filterRejection]bool
+	predictions      []model.PredictionOutcome
+	firstSeen        []*model.FirstSeen
+	squawkAlerts     []*model.SquawkAlert
+	positions        []position
+	positionKeys     map[positionKey]bool
+	recurringFlights []model.RecurringFlight
+	rules            []*model.Rule
+	deliveries       []*model.WebhookDelivery
+	maintenanceRuns  []*model.MaintenanceRun
+
+	// lastID is the last id given to a record of each kind, ids are never reused
+	lastID map[string]int64
+}
+
+var _ storage.Store = (*Store)(nil)
+
+type cacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{
+		cache:            make(map[string]cacheEntry),
+		operators:        make(map[string]string),
+		flights:          make(map[string]*flightRecord),
+		airports:         make(map[string]airportLocation),
+		lastSightings:    make(map[sightingKey]*model.Sighting),
+		filterRejections: make(map[filterRejection]bool),
+		positionKeys:     make(map[positionKey]bool),
+		lastID:           make(map[string]int64),
+	}
+}
+
+// nextID returns a new id for a record of the kind.
+func (s *Store) nextID(kind string) int64 {
+	s.lastID[kind]++
+	return s.lastID[kind]
+}
+
+// siteOrDefault returns the site, falling back to the default site when empty.
+func siteOrDefault(site string) string {
+	if site == "" {
+		return config.DefaultSite
+	}
+	return site
+}
+
+// matchesSite reports whether a record of a site is selected by a query restricted to site, empty for all.
+func matchesSite(recordSite, site string) bool {
+	return site == "" || recordSite == site
+}
+
+// Close does nothing, there is nothing to release.
+func (s *Store) Close() error {
+	return nil
+}
+
+// Set stores a key-value pair in the cache with an expiration time.
+func (s *Store) Set(key string, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache[key] = cacheEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Get retrieves a value from the cache by key, deleting it when expired.
+func (s *Store) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.cache[key]
+	if !ok {
+		return "", nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.cache, key)
+		return "", nil
+	}
+	return entry.value, nil
+}
+
+// DeleteExpiredCache deletes the cache entries expired at the given time and returns how many were deleted.
+func (s *Store) DeleteExpiredCache(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for key, entry := range s.cache {
+		if entry.expiresAt.Before(now) {
+			delete(s.cache, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// LogOperator stores an operator's JSON data, unless already stored.
+func (s *Store) LogOperator(icao string, jsonValue string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.operators[icao]; !ok {
+		s.operators[icao] = jsonValue
+	}
+	return nil
+}
+
+// GetOperator retrieves an operator's JSON data by ICAO, empty when unknown.
+func (s *Store) GetOperator(icao string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.operators[icao], nil
+}
+
+// GetOperators retrieves the JSON data of the known operators among icaos.
+func (s *Store) GetOperators(icaos []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operators := make(map[string]string)
+	for _, icao := range icaos {
+		if jsonValue, ok := s.operators[icao]; ok {
+			operators[icao] = jsonValue
+		}
+	}
+	return operators, nil
+}
+
+// GetOperatorInfo retrieves the details of an operator, with "N/A" as short name for unknown operators.
+func (s *Store) GetOperatorInfo(icao string) (*model.OperatorInfo, error) {
+	operatorJSON, err := s.GetOperator(icao)
+	if err != nil {
+		return nil, err
+	}
+	if operatorJSON == "" {
+		return &model.OperatorInfo{Shortname: "N/A"}, nil
+	}
+	var operatorInfo model.OperatorInfo
+	if err := json.Unmarshal([]byte(operatorJSON), &operatorInfo); err != nil {
+		return nil, err
+	}
+	return &operatorInfo, nil
+}
+
+// Optimize does nothing, there is no query planner.
+func (s *Store) Optimize() error {
+	return nil
+}
+
+// IncrementalVacuum frees nothing, the memory of deleted records is reclaimed by the garbage collector.
+func (s *Store) IncrementalVacuum() (int64, error) {
+	return 0, nil
+}
+
+// Checkpoint copies nothing, there is no write-ahead log.
+func (s *Store) Checkpoint() (int64, error) {
+	return 0, nil
+}
+
+// RecordMaintenanceRun stores a run of a maintenance job and sets its ID.
+func (s *Store) RecordMaintenanceRun(run *model.MaintenanceRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.ID = s.nextID("maintenance_run")
+	stored := *run
+	s.maintenanceRuns = append(s.maintenanceRuns, &stored)
+	return nil
+}
+
+// GetMaintenanceRuns retrieves the latest runs of the maintenance jobs, newest first, up to limit.
+func (s *Store) GetMaintenanceRuns(limit int) ([]*model.MaintenanceRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*model.MaintenanceRun, 0, len(s.maintenanceRuns))
+	for _, run := range s.maintenanceRuns {
+		copied := *run
+		runs = append(runs, &copied)
+	}
+	slices.SortStableFunc(runs, func(a, b *model.MaintenanceRun) int {
+		return cmp.Or(b.StartedAt.Compare(a.StartedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return limited(runs, limit), nil
+}
+
+// GetLastMaintenanceRuns returns when each maintenance job last ran, by job.
+func (s *Store) GetLastMaintenanceRuns() (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := make(map[string]time.Time)
+	for _, run := range s.maintenanceRuns { // in id order, the last run of a job wins
+		last[run.Job] = run.StartedAt
+	}
+	return last, nil
+}
+
+// DeleteMaintenanceRunsBefore deletes the runs of the maintenance jobs started before the given time
+// and returns how many were deleted.
+func (s *Store) DeleteMaintenanceRunsBefore(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	s.maintenanceRuns, deleted = deleteFunc(s.maintenanceRuns, func(run *model.MaintenanceRun) bool {
+		return run.StartedAt.Before(before)
+	})
+	return deleted, nil
+}
+
+// limited returns the first limit records, all when limit is negative, like LIMIT in SQL.
+func limited[T any](records []T, limit int) []T {
+	if limit >= 0 && len(records) > limit {
+		return records[:limit]
+	}
+	return records
+}
+
+// deleteFunc deletes the records matching del and returns the remaining ones, with how many were deleted.
+func deleteFunc[T any](records []T, del func(T) bool) ([]T, int64) {
+	n := len(records)
+	records = slices.DeleteFunc(records, del)
+	return records, int64(n - len(records))
+}
@@ -0,0 +1,12 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/carlo-colombo/sopra/storage"
+	"github.com/carlo-colombo/sopra/storage/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store { return New() })
+}
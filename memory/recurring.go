@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// ReplaceRecurringFlights replaces the stored recurring flights with newly learned ones.
+func (s *Store) ReplaceRecurringFlights(flights []model.RecurringFlight) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recurringFlights = make([]model.RecurringFlight, len(flights))
+	for i, f := range flights {
+		f.Site = siteOrDefault(f.Site)
+		f.Weekdays = slices.Clone(f.Weekdays)
+		s.recurringFlights[i] = f
+	}
+	return nil
+}
+
+// GetRecurringFlights returns the recurring flights in time of day order, optionally restricted to a site.
+func (s *Store) GetRecurringFlights(site string) ([]model.RecurringFlight, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var flights []model.RecurringFlight
+	for _, f := range s.recurringFlights {
+		if matchesSite(f.Site, site) {
+			f.Weekdays = slices.Clone(f.Weekdays)
+			flights = append(flights, f)
+		}
+	}
+	slices.SortFunc(flights, func(a, b model.RecurringFlight) int {
+		return cmp.Or(cmp.Compare(a.Minute, b.Minute), cmp.Compare(a.Site, b.Site), cmp.Compare(a.Callsign, b.Callsign))
+	})
+	return flights, nil
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"slices"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// copyRule returns a copy of a rule as stored, without the empty actions.
+func copyRule(r *model.Rule) *model.Rule {
+	c := *r
+	c.Actions = cloneOrNil(r.Actions)
+	c.ReadOnly = false
+	return &c
+}
+
+// GetRules retrieves the stored rules, ordered by ID.
+func (s *Store) GetRules() ([]*model.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rules []*model.Rule
+	for _, r := range s.rules {
+		rules = append(rules, copyRule(r))
+	}
+	return rules, nil
+}
+
+// GetRule retrieves a stored rule, or nil if there is none with that ID.
+func (s *Store) GetRule(id int64) (*model.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.ruleIndex(id); i >= 0 {
+		return copyRule(s.rules[i]), nil
+	}
+	return nil, nil
+}
+
+// CreateRule stores a new rule and sets its ID.
+func (s *Store) CreateRule(r *model.Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = s.nextID("rule")
+	s.rules = append(s.rules, copyRule(r))
+	return nil
+}
+
+// UpdateRule replaces a stored rule. It returns false when there is no rule with its ID.
+func (s *Store) UpdateRule(r *model.Rule) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.ruleIndex(r.ID)
+	if i < 0 {
+		return false, nil
+	}
+	s.rules[i] = copyRule(r)
+	return true, nil
+}
+
+// DeleteRule deletes a stored rule. It returns false when there is no rule with that ID.
+func (s *Store) DeleteRule(id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.ruleIndex(id)
+	if i < 0 {
+		return false, nil
+	}
+	s.rules = slices.Delete(s.rules, i, i+1)
+	return true, nil
+}
+
+// ruleIndex returns the index of the rule with the ID, -1 when there is none.
+func (s *Store) ruleIndex(id int64) int {
+	return slices.IndexFunc(s.rules, func(r *model.Rule) bool { return r.ID == id })
+}
@@ -0,0 +1,346 @@
+package memory
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// trackMargin is how long before the first and after the last observation of a sighting the positions are part of its track.
+const trackMargin = time.Minute
+
+// sightingKey identifies the sightings of an aircraft with a callsign at a site.
+type sightingKey struct {
+	site, icao24, callsign string
+}
+
+// RecordSighting adds an observation to the open sighting of the same aircraft at the same site,
+// or starts a new sighting when the last one was seen more than gap ago. The noise estimate of the
+// loudest observation is kept.
+func (s *Store) RecordSighting(obs model.Observation, gap time.Duration) (*model.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sightingKey{siteOrDefault(obs.Site), obs.Icao24, obs.Callsign}
+	sighting := s.lastSightings[key]
+	if sighting != nil && sighting.LastSeen.Before(obs.Time.Add(-gap)) {
+		sighting = nil
+	}
+
+	if sighting == nil {
+		sighting = &model.Sighting{
+			ID:            s.nextID("sighting"),
+			Site:          key.site,
+			Icao24:        obs.Icao24,
+			Callsign:      obs.Callsign,
+			FirstSeen:     obs.Time,
+			LastSeen:      obs.Time,
+			MinDistance:   obs.Distance,
+			MinAltitude:   model.LowerAltitude(0, obs.Altitude),
+			EntryBearing:  obs.Bearing,
+			ExitBearing:   obs.Bearing,
+			SampleCount:   1,
+			PeakNoise:     obs.NoiseLevel,
+			NoiseExposure: obs.NoiseExposure,
+		}
+		s.sightings = append(s.sightings, sighting)
+		s.lastSightings[key] = sighting
+	} else {
+		sighting.LastSeen = obs.Time
+		sighting.MinDistance = math.Min(sighting.MinDistance, obs.Distance)
+		sighting.MinAltitude = model.LowerAltitude(sighting.MinAltitude, obs.Altitude)
+		sighting.ExitBearing = obs.Bearing
+		sighting.SampleCount++
+		if obs.NoiseLevel != 0 && (sighting.PeakNoise == 0 || obs.NoiseLevel > sighting.PeakNoise) {
+			sighting.PeakNoise = obs.NoiseLevel
+			sighting.NoiseExposure = obs.NoiseExposure
+		}
+	}
+	copied := *sighting
+	return &copied, nil
+}
+
+// GetSighting retrieves a sighting by id, nil when there is none.
+func (s *Store) GetSighting(id int64) (*model.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The sightings are stored in id order
+	i, found := slices.BinarySearchFunc(s.sightings, id, func(sighting *model.Sighting, id int64) int { return cmp.Compare(sighting.ID, id) })
+	if !found {
+		return nil, nil
+	}
+	copied := *s.sightings[i]
+	return &copied, nil
+}
+
+// selectSightings returns copies of the sightings at site, all when empty, matching keep.
+func (s *Store) selectSightings(site string, keep func(*model.Sighting) bool) []*model.Sighting {
+	var sightings []*model.Sighting
+	for _, sighting := range s.sightings {
+		if matchesSite(sighting.Site, site) && keep(sighting) {
+			copied := *sighting
+			sightings = append(sightings, &copied)
+		}
+	}
+	return sightings
+}
+
+// GetRecentSightings retrieves the most recent sightings, newest first, optionally restricted to a site.
+func (s *Store) GetRecentSightings(limit int, site string) ([]*model.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sightings := s.selectSightings(site, func(*model.Sighting) bool { return true })
+	slices.SortStableFunc(sightings, func(a, b *model.Sighting) int { return b.LastSeen.Compare(a.LastSeen) })
+	return limited(sightings, limit), nil
+}
+
+// GetNoisySightingsSince retrieves the sightings with a noise estimate started since the given time,
+// optionally restricted to a site, the loudest first.
+func (s *Store) GetNoisySightingsSince(since time.Time, site string) ([]*model.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sightings := s.selectSightings(site, func(sighting *model.Sighting) bool {
+		return sighting.PeakNoise != 0 && !sighting.FirstSeen.Before(since)
+	})
+	slices.SortStableFunc(sightings, func(a, b *model.Sighting) int { return cmp.Compare(b.PeakNoise, a.PeakNoise) })
+	return sightings, nil
+}
+
+// GetSightingsBetween retrieves the sightings started from the given time and before the other,
+// optionally restricted to a site, in the order they started.
+func (s *Store) GetSightingsBetween(from, to time.Time, site string) ([]*model.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sightings := s.selectSightings(site, func(sighting *model.Sighting) bool {
+		return !sighting.FirstSeen.Before(from) && sighting.FirstSeen.Before(to)
+	})
+	slices.SortStableFunc(sightings, func(a, b *model.Sighting) int { return a.FirstSeen.Compare(b.FirstSeen) })
+	return sightings, nil
+}
+
+// GetSightingCount returns the total number of sightings.
+func (s *Store) GetSightingCount() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sightings), nil
+}
+
+// GetSightingCountSince returns the number of sightings started since the given time, optionally restricted to a site.
+func (s *Store) GetSightingCountSince(since time.Time, site string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.selectSightings(site, func(sighting *model.Sighting) bool { return !sighting.FirstSeen.Before(since) })), nil
+}
+
+// RecordFirstSeen counts a pass of callsign over site showing the attribute values, by kind, and returns
+// the kinds, in the order of model.Kinds, whose value was seen for the first time.
+func (s *Store) RecordFirstSeen(attrs map[string]string, callsign, site string, at time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firsts []string
+	for _, kind := range model.Kinds {
+		value, ok := attrs[kind]
+		if !ok {
+			continue
+		}
+		i := slices.IndexFunc(s.firstSeen, func(f *model.FirstSeen) bool { return f.Kind == kind && f.Value == value })
+		if i >= 0 {
+			s.firstSeen[i].Count++
+			continue
+		}
+		s.firstSeen = append(s.firstSeen, &model.FirstSeen{Kind: kind, Value: value, Time: at, Callsign: callsign, Site: siteOrDefault(site), Count: 1})
+		firsts = append(firsts, kind)
+	}
+	return firsts, nil
+}
+
+// GetFirstSeen returns the first sighting of every attribute value.
+func (s *Store) GetFirstSeen() ([]*model.FirstSeen, error) {
+	return s.selectFirstSeen(func(*model.FirstSeen) bool { return true }), nil
+}
+
+// GetFirstSeenSince returns the attribute values seen for the first time since the given time, newest first,
+// optionally restricted to the ones first seen at a site.
+func (s *Store) GetFirstSeenSince(since time.Time, site string) ([]*model.FirstSeen, error) {
+	seen := s.selectFirstSeen(func(f *model.FirstSeen) bool { return !f.Time.Before(since) && matchesSite(f.Site, site) })
+	slices.SortStableFunc(seen, func(a, b *model.FirstSeen) int { return cmp.Or(b.Time.Compare(a.Time), cmp.Compare(a.Kind, b.Kind)) })
+	return seen, nil
+}
+
+func (s *Store) selectFirstSeen(keep func(*model.FirstSeen) bool) []*model.FirstSeen {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var seen []*model.FirstSeen
+	for _, f := range s.firstSeen {
+		if keep(f) {
+			copied := *f
+			seen = append(seen, &copied)
+		}
+	}
+	return seen
+}
+
+// RecordSquawkAlert stores a flagged state vector in the open alert of the same kind for the same aircraft
+// at the same site, or opens a new alert when the last one was seen more than gap ago.
+// It reports whether a new alert was opened.
+func (s *Store) RecordSquawkAlert(site, kind, severity string, state *model.Flight, at time.Time, gap time.Duration) (*model.SquawkAlert, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	site = siteOrDefault(site)
+	var alert *model.SquawkAlert
+	for _, candidate := range s.squawkAlerts {
+		if candidate.Site == site && candidate.Icao24 == state.Icao24 && candidate.Kind == kind &&
+			!candidate.LastSeen.Before(at.Add(-gap)) && (alert == nil || !candidate.LastSeen.Before(alert.LastSeen)) {
+			alert = candidate
+		}
+	}
+	opened := alert == nil
+	if opened {
+		alert = &model.SquawkAlert{ID: s.nextID("squawk_alert"), Site: site, Icao24: state.Icao24, Callsign: state.Callsign, Kind: kind,
+			Severity: severity, Squawk: state.Squawk, State: *state, FirstSeen: at}
+		s.squawkAlerts = append(s.squawkAlerts, alert)
+	}
+	if alert.Callsign == "" {
+		alert.Callsign = state.Callsign // may appear after the squawk
+	}
+	alert.LastState = *state
+	alert.LastSeen = at
+
+	copied := *alert
+	return &copied, opened, nil
+}
+
+// GetSquawkAlertsSince returns the alerts seen since the given time, most recently seen first, optionally restricted to a site.
+func (s *Store) GetSquawkAlertsSince(since time.Time, site string) ([]*model.SquawkAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var alerts []*model.SquawkAlert
+	for _, alert := range s.squawkAlerts {
+		if !alert.LastSeen.Before(since) && matchesSite(alert.Site, site) {
+			copied := *alert
+			alerts = append(alerts, &copied)
+		}
+	}
+	slices.SortStableFunc(alerts, func(a, b *model.SquawkAlert) int { return b.LastSeen.Compare(a.LastSeen) })
+	return alerts, nil
+}
+
+// position is a stored position, with the id telling the order it was stored in.
+type position struct {
+	id int64
+	model.Position
+}
+
+// positionKey identifies a position: an aircraft is at a single position at a time.
+type positionKey struct {
+	icao24 string
+	time   int64 // Unix nanoseconds
+}
+
+func (p position) key() positionKey {
+	return positionKey{p.Icao24, p.Time.UnixNano()}
+}
+
+// RecordPositions stores the positions of the states polled at, reported at their time position or, when unknown,
+// at the poll. A position already stored, reported again by a later poll, is skipped, and so are states without one.
+func (s *Store) RecordPositions(states []model.Flight, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, state := range states {
+		if state.Latitude == 0 && state.Longitude == 0 {
+			continue
+		}
+		reported := at
+		if state.TimePosition > 0 {
+			reported = time.Unix(int64(state.TimePosition), 0)
+		}
+		p := position{Position: model.Position{
+			Time: reported, Icao24: state.Icao24, Callsign: state.Callsign, Latitude: state.Latitude, Longitude: state.Longitude,
+			BaroAltitude: state.BaroAltitude, GeoAltitude: state.GeoAltitude, Velocity: state.Velocity, TrueTrack: state.TrueTrack,
+			VerticalRate: state.VerticalRate, OnGround: state.OnGround,
+		}}
+		if s.positionKeys[p.key()] {
+			continue
+		}
+		p.id = s.nextID("position")
+		s.positionKeys[p.key()] = true
+		s.positions = append(s.positions, p)
+	}
+	return nil
+}
+
+// GetTrack returns the positions of the aircraft of a sighting during the pass, in time order.
+func (s *Store) GetTrack(sighting *model.Sighting) ([]model.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from, to := sighting.FirstSeen.Add(-trackMargin), sighting.LastSeen.Add(trackMargin)
+	var track []model.Position
+	for _, p := range s.positions {
+		if p.Icao24 == sighting.Icao24 && !p.Time.Before(from) && !p.Time.After(to) {
+			track = append(track, p.Position)
+		}
+	}
+	slices.SortStableFunc(track, func(a, b model.Position) int { return a.Time.Compare(b.Time) })
+	return track, nil
+}
+
+// GetPositionsWithin returns the positions reported in [from, to) within radiusKm of a point, in time order.
+func (s *Store) GetPositionsWithin(lat, lon, radiusKm float64, from, to time.Time) ([]model.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var positions []model.Position
+	for _, p := range s.positions {
+		if !p.Time.Before(from) && p.Time.Before(to) && haversine.Distance(lat, lon, p.Latitude, p.Longitude) <= radiusKm {
+			positions = append(positions, p.Position)
+		}
+	}
+	slices.SortStableFunc(positions, func(a, b model.Position) int { return a.Time.Compare(b.Time) })
+	return positions, nil
+}
+
+// DownsamplePositions keeps, of the positions reported before the given time, the first stored of each aircraft
+// in every interval, and returns how many positions were deleted.
+func (s *Store) DownsamplePositions(before time.Time, interval time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seconds := int64(interval.Seconds())
+	type bucket struct {
+		icao24 string
+		n      int64
+	}
+	kept := make(map[bucket]bool)
+	var deleted int64
+	s.positions, deleted = deleteFunc(s.positions, func(p position) bool { // in id order, the first stored is kept
+		if !p.Time.Before(before) {
+			return false
+		}
+		b := bucket{p.Icao24, p.Time.Unix() / seconds}
+		if kept[b] {
+			delete(s.positionKeys, p.key())
+			return true
+		}
+		kept[b] = true
+		return false
+	})
+	return deleted, nil
+}
+
+// DeletePositionsBefore deletes the positions reported before the given time and returns how many were deleted.
+func (s *Store) DeletePositionsBefore(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	s.positions, deleted = deleteFunc(s.positions, func(p position) bool {
+		if p.Time.Before(before) {
+			delete(s.positionKeys, p.key())
+			return true
+		}
+		return false
+	})
+	return deleted, nil
+}
@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// GetMostCommonFlights retrieves the 5 FlightInfo with the most sightings, optionally restricted to a site.
+// IdentificationCount is set to the number of sightings.
+func (s *Store) GetMostCommonFlights(site string) ([]*model.FlightInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type common struct {
+		record    *flightRecord
+		sightings int
+		lastSeen  time.Time
+	}
+	byCallsign := make(map[string]*common)
+	for _, sighting := range s.sightings {
+		r, ok := s.flights[sighting.Callsign]
+		if !ok || !matchesSite(sighting.Site, site) {
+			continue
+		}
+		c := byCallsign[sighting.Callsign]
+		if c == nil {
+			c = &common{record: r}
+			byCallsign[sighting.Callsign] = c
+		}
+		c.sightings++
+		if sighting.LastSeen.After(c.lastSeen) {
+			c.lastSeen = sighting.LastSeen
+		}
+	}
+	commons := make([]*common, 0, len(byCallsign))
+	for _, c := range byCallsign {
+		commons = append(commons, c)
+	}
+	slices.SortFunc(commons, func(a, b *common) int {
+		return cmp.Or(cmp.Compare(b.sightings, a.sightings), b.lastSeen.Compare(a.lastSeen))
+	})
+
+	var flights []*model.FlightInfo
+	for _, c := range limited(commons, 5) {
+		f := c.record.read()
+		f.IdentificationCount = c.sightings
+		flights = append(flights, f)
+	}
+	return flights, nil
+}
+
+// getTopAirports retrieves the top 10 origin, or destination, airports by number of sightings, optionally restricted to a site.
+func (s *Store) getTopAirports(destination bool, site string) ([]model.AirportStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type airport struct{ iata, city string }
+	counts := make(map[airport]int)
+	for _, sighting := range s.sightings {
+		r, ok := s.flights[sighting.Callsign]
+		if !ok || !matchesSite(sighting.Site, site) {
+			continue
+		}
+		a := r.info.Origin
+		if destination {
+			a = r.info.Destination
+		}
+		if a.CodeIata != "" {
+			counts[airport{a.CodeIata, a.City}]++
+		}
+	}
+	var stats []model.AirportStat
+	for a, count := range counts {
+		stats = append(stats, model.AirportStat{Iata: a.iata, City: a.city, Count: count})
+	}
+	slices.SortFunc(stats, func(a, b model.AirportStat) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Iata, b.Iata), cmp.Compare(a.City, b.City))
+	})
+	return limited(stats, 10), nil
+}
+
+// GetTopDestinations retrieves the top 10 destination airports by number of sightings, optionally restricted to a site.
+func (s *Store) GetTopDestinations(site string) ([]model.AirportStat, error) {
+	return s.getTopAirports(true, site)
+}
+
+// GetTopSources retrieves the top 10 source airports by number of sightings, optionally restricted to a site.
+func (s *Store) GetTopSources(site string) ([]model.AirportStat, error) {
+	return s.getTopAirports(false, site)
+}
+
+// filterRejection is an aircraft rejected by a traffic filter of a site on a day.
+type filterRejection struct {
+	site, name, day, icao24 string
+}
+
+// RecordFilterRejection records that a traffic filter of a site rejected an aircraft.
+// Each aircraft is counted at most once per site, filter and day.
+func (s *Store) RecordFilterRejection(site, name, icao24 string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filterRejections[filterRejection{siteOrDefault(site), name, at.Format("2006-01-02"), icao24}] = true
+	return nil
+}
+
+// GetFilterStats retrieves the number of distinct aircraft rejected by each filter, today and overall,
+// optionally restricted to a site.
+func (s *Store) GetFilterStats(today time.Time, site string) ([]model.FilterStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := today.Format("2006-01-02")
+	type aircraftDay struct{ day, icao24 string }
+	todays := make(map[string]map[string]bool)
+	totals := make(map[string]map[aircraftDay]bool)
+	for r := range s.filterRejections {
+		if !matchesSite(r.site, site) {
+			continue
+		}
+		if totals[r.name] == nil {
+			todays[r.name] = make(map[string]bool)
+			totals[r.name] = make(map[aircraftDay]bool)
+		}
+		if r.day == day {
+			todays[r.name][r.icao24] = true
+		}
+		totals[r.name][aircraftDay{r.day, r.icao24}] = true
+	}
+	var stats []model.FilterStat
+	for name, total := range totals {
+		stats = append(stats, model.FilterStat{Name: name, Today: len(todays[name]), Total: len(total)})
+	}
+	slices.SortFunc(stats, func(a, b model.FilterStat) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Name, b.Name))
+	})
+	return stats, nil
+}
+
+// RecordPredictionOutcome stores how a look-ahead prediction turned out.
+func (s *Store) RecordPredictionOutcome(o *model.PredictionOutcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *o
+	stored.Site = siteOrDefault(o.Site)
+	s.predictions = append(s.predictions, stored)
+	return nil
+}
+
+// GetPredictionAccuracy summarizes the outcomes of the predictions resolved since the given time, optionally restricted to a site.
+// The errors and the lead are averaged over the aircraft that entered as predicted.
+func (s *Store) GetPredictionAccuracy(since time.Time, site string) (*model.PredictionAccuracy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var a model.PredictionAccuracy
+	for _, o := range s.predictions {
+		if o.ResolvedAt.Before(since) || !matchesSite(o.Site, site) {
+			continue
+		}
+		switch o.Outcome {
+		case model.PredictionEntered:
+			a.Entered++
+			a.MeanEntryError += math.Abs(o.EntryError())
+			a.MeanDistanceError += math.Abs(o.DistanceError())
+			a.MeanLead += o.Lead()
+		case model.PredictionMissed:
+			a.Missed++
+		case model.PredictionUnpredicted:
+			a.Unpredicted++
+		}
+	}
+	if a.Entered > 0 {
+		a.MeanEntryError = math.Round(a.MeanEntryError/float64(a.Entered)*10) / 10
+		a.MeanDistanceError = math.Round(a.MeanDistanceError / float64(a.Entered))
+		a.MeanLead = math.Round(a.MeanLead / float64(a.Entered))
+	}
+	return &a, nil
+}
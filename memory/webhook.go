@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+func copyDelivery(d *model.WebhookDelivery) *model.WebhookDelivery {
+	c := *d
+	if d.DeliveredAt != nil {
+		deliveredAt := *d.DeliveredAt
+		c.DeliveredAt = &deliveredAt
+	}
+	return &c
+}
+
+// EnqueueWebhookDelivery stores a pending delivery, due at its NextAttempt, and sets its ID.
+func (s *Store) EnqueueWebhookDelivery(d *model.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.Status = model.DeliveryPending
+	d.ID = s.nextID("webhook_delivery")
+	stored := copyDelivery(d)
+	stored.Attempts = 0
+	stored.LastError = ""
+	stored.DeliveredAt = nil
+	s.deliveries = append(s.deliveries, stored)
+	return nil
+}
+
+// selectDeliveries returns copies of up to limit deliveries matching keep, in the order of compare.
+func (s *Store) selectDeliveries(keep func(*model.WebhookDelivery) bool, compare func(a, b *model.WebhookDelivery) int, limit int) []*model.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []*model.WebhookDelivery
+	for _, d := range s.deliveries {
+		if keep(d) {
+			deliveries = append(deliveries, copyDelivery(d))
+		}
+	}
+	slices.SortFunc(deliveries, compare)
+	return limited(deliveries, limit)
+}
+
+// GetDueWebhookDeliveries retrieves up to limit pending deliveries due at now, oldest first.
+func (s *Store) GetDueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	return s.selectDeliveries(
+		func(d *model.WebhookDelivery) bool {
+			return d.Status == model.DeliveryPending && !d.NextAttempt.After(now)
+		},
+		func(a, b *model.WebhookDelivery) int {
+			return cmp.Or(a.NextAttempt.Compare(b.NextAttempt), cmp.Compare(a.ID, b.ID))
+		},
+		limit), nil
+}
+
+// GetDeadWebhookDeliveries retrieves up to limit deliveries that ran out of attempts, newest first.
+func (s *Store) GetDeadWebhookDeliveries(limit int) ([]*model.WebhookDelivery, error) {
+	return s.selectDeliveries(
+		func(d *model.WebhookDelivery) bool { return d.Status == model.DeliveryDead },
+		func(a, b *model.WebhookDelivery) int { return cmp.Compare(b.ID, a.ID) },
+		limit), nil
+}
+
+// delivery returns the stored delivery with the ID, nil when there is none.
+func (s *Store) delivery(id int64) *model.WebhookDelivery {
+	i := slices.IndexFunc(s.deliveries, func(d *model.WebhookDelivery) bool { return d.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return s.deliveries[i]
+}
+
+// MarkWebhookDelivered records a successful delivery.
+func (s *Store) MarkWebhookDelivered(id int64, attempts int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.delivery(id); d != nil {
+		d.Status = model.DeliveryDelivered
+		d.Attempts = attempts
+		d.DeliveredAt = &at
+		d.LastError = ""
+	}
+	return nil
+}
+
+// MarkWebhookFailed records a failed attempt, scheduling the next one at next,
+// or moving the delivery to the dead letters when dead is true.
+func (s *Store) MarkWebhookFailed(id int64, attempts int, next time.Time, lastError string, dead bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.delivery(id); d != nil {
+		d.Status = model.DeliveryPending
+		if dead {
+			d.Status = model.DeliveryDead
+		}
+		d.Attempts = attempts
+		d.NextAttempt = next
+		d.LastError = lastError
+	}
+	return nil
+}
+
+// RequeueWebhookDelivery moves a dead delivery back to the queue, due at now with its attempts reset.
+// It returns false when there is no dead delivery with that ID.
+func (s *Store) RequeueWebhookDelivery(id int64, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.delivery(id)
+	if d == nil || d.Status != model.DeliveryDead {
+		return false, nil
+	}
+	d.Status = model.DeliveryPending
+	d.Attempts = 0
+	d.NextAttempt = now
+	return true, nil
+}
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS sighting (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    icao24 TEXT NOT NULL DEFAULT '',
+    callsign TEXT NOT NULL,
+    first_seen DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    min_distance REAL,
+    min_altitude REAL,
+    entry_bearing REAL,
+    exit_bearing REAL,
+    sample_count INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_sighting_callsign_last_seen ON sighting (callsign, last_seen);
+CREATE INDEX IF NOT EXISTS idx_sighting_last_seen ON sighting (last_seen);
+
+-- Backfill one sighting per existing flight_log row so stats keep their history. Its identification_count counted
+-- polls rather than passes, so the backfilled sighting is a single pass of a single sample.
+INSERT INTO sighting (callsign, first_seen, last_seen, min_distance)
+SELECT key, last_seen, last_seen, value ->> '$.distance_m'
+FROM flight_log
+WHERE last_seen IS NOT NULL;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS filter_rejection (
+    name TEXT NOT NULL,
+    day TEXT NOT NULL,
+    icao24 TEXT NOT NULL,
+    PRIMARY KEY (name, day, icao24)
+);
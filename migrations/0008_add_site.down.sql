@@ -0,0 +1,18 @@
+CREATE TABLE filter_rejection_old (
+    name TEXT NOT NULL,
+    day TEXT NOT NULL,
+    icao24 TEXT NOT NULL,
+    PRIMARY KEY (name, day, icao24)
+);
+
+INSERT OR IGNORE INTO filter_rejection_old (name, day, icao24)
+SELECT name, day, icao24 FROM filter_rejection;
+
+DROP TABLE filter_rejection;
+
+ALTER TABLE filter_rejection_old RENAME TO filter_rejection;
+
+DROP INDEX IF EXISTS idx_sighting_site_last_seen;
+DROP INDEX IF EXISTS idx_sighting_callsign_last_seen;
+ALTER TABLE sighting DROP COLUMN site;
+CREATE INDEX IF NOT EXISTS idx_sighting_callsign_last_seen ON sighting (callsign, last_seen);
@@ -0,0 +1,20 @@
+ALTER TABLE sighting ADD COLUMN site TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS idx_sighting_callsign_last_seen;
+CREATE INDEX IF NOT EXISTS idx_sighting_callsign_last_seen ON sighting (callsign, site, last_seen);
+CREATE INDEX IF NOT EXISTS idx_sighting_site_last_seen ON sighting (site, last_seen);
+
+CREATE TABLE filter_rejection_new (
+    site TEXT NOT NULL DEFAULT 'default',
+    name TEXT NOT NULL,
+    day TEXT NOT NULL,
+    icao24 TEXT NOT NULL,
+    PRIMARY KEY (site, name, day, icao24)
+);
+
+INSERT INTO filter_rejection_new (site, name, day, icao24)
+SELECT 'default', name, day, icao24 FROM filter_rejection;
+
+DROP TABLE filter_rejection;
+
+ALTER TABLE filter_rejection_new RENAME TO filter_rejection;
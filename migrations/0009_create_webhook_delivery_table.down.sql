@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhook_delivery_status_next_attempt;
+DROP TABLE IF EXISTS webhook_delivery;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS rule (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    expression TEXT NOT NULL,
+    severity TEXT NOT NULL DEFAULT 'info',
+    cooldown INTEGER NOT NULL DEFAULT 0,
+    actions TEXT NOT NULL DEFAULT 'log',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
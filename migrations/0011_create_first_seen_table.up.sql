@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS first_seen (
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    first_seen DATETIME NOT NULL,
+    callsign TEXT NOT NULL,
+    site TEXT NOT NULL DEFAULT 'default',
+    count INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (kind, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_first_seen_first_seen ON first_seen (first_seen);
+
+-- Backfill from the recorded passes: callsign and site are taken from the earliest pass
+INSERT INTO first_seen (kind, value, first_seen, callsign, site, count)
+SELECT 'operator', f.value ->> '$.operator_icao', MIN(s.first_seen), s.callsign, s.site, COUNT(*)
+FROM sighting s JOIN flight_log f ON f.key = s.callsign
+WHERE COALESCE(f.value ->> '$.operator_icao', '') != ''
+GROUP BY f.value ->> '$.operator_icao';
+
+INSERT INTO first_seen (kind, value, first_seen, callsign, site, count)
+SELECT 'aircraft_type', f.value ->> '$.aircraft_type', MIN(s.first_seen), s.callsign, s.site, COUNT(*)
+FROM sighting s JOIN flight_log f ON f.key = s.callsign
+WHERE COALESCE(f.value ->> '$.aircraft_type', '') != ''
+GROUP BY f.value ->> '$.aircraft_type';
+
+INSERT INTO first_seen (kind, value, first_seen, callsign, site, count)
+SELECT 'registration', f.value ->> '$.registration', MIN(s.first_seen), s.callsign, s.site, COUNT(*)
+FROM sighting s JOIN flight_log f ON f.key = s.callsign
+WHERE COALESCE(f.value ->> '$.registration', '') != ''
+GROUP BY f.value ->> '$.registration';
+
+INSERT INTO first_seen (kind, value, first_seen, callsign, site, count)
+SELECT 'route', (f.value ->> '$.origin.code') || '-' || (f.value ->> '$.destination.code'), MIN(s.first_seen), s.callsign, s.site, COUNT(*)
+FROM sighting s JOIN flight_log f ON f.key = s.callsign
+WHERE COALESCE(f.value ->> '$.origin.code', '') != '' AND COALESCE(f.value ->> '$.destination.code', '') != ''
+GROUP BY (f.value ->> '$.origin.code') || '-' || (f.value ->> '$.destination.code');
+
+INSERT INTO first_seen (kind, value, first_seen, callsign, site, count)
+SELECT 'country', o.value ->> '$.country', MIN(s.first_seen), s.callsign, s.site, COUNT(*)
+FROM sighting s JOIN flight_log f ON f.key = s.callsign
+JOIN operator_log o ON o.icao = f.value ->> '$.operator_icao'
+WHERE COALESCE(o.value ->> '$.country', '') != ''
+GROUP BY o.value ->> '$.country';
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS squawk_alert (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site TEXT NOT NULL DEFAULT 'default',
+    icao24 TEXT NOT NULL,
+    callsign TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    squawk TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL, -- raising the alert
+    last_state TEXT NOT NULL,
+    first_seen DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_squawk_alert_icao24_last_seen ON squawk_alert (site, icao24, kind, last_seen);
+CREATE INDEX IF NOT EXISTS idx_squawk_alert_last_seen ON squawk_alert (last_seen);
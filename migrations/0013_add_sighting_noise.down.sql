@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_sighting_peak_noise;
+ALTER TABLE sighting DROP COLUMN noise_exposure;
+ALTER TABLE sighting DROP COLUMN peak_noise;
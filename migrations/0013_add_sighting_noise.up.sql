@@ -0,0 +1,4 @@
+ALTER TABLE sighting ADD COLUMN peak_noise REAL;
+ALTER TABLE sighting ADD COLUMN noise_exposure REAL;
+
+CREATE INDEX IF NOT EXISTS idx_sighting_peak_noise ON sighting (peak_noise);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS prediction (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site TEXT NOT NULL DEFAULT 'default',
+    icao24 TEXT NOT NULL,
+    callsign TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    -- the last prediction, NULL for the unpredicted aircraft
+    predicted_at DATETIME,
+    entry_time DATETIME,
+    closest_distance REAL,
+    -- what happened, NULL for the missed predictions
+    actual_entry DATETIME,
+    actual_distance REAL,
+    entry_error REAL,
+    distance_error REAL,
+    lead REAL,
+    resolved_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_prediction_resolved_at ON prediction (resolved_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recurring_flight (
+    site TEXT NOT NULL DEFAULT 'default',
+    callsign TEXT NOT NULL,
+    minute INTEGER NOT NULL,
+    tolerance INTEGER NOT NULL,
+    weekdays TEXT NOT NULL,
+    occurrences INTEGER NOT NULL,
+    regularity REAL NOT NULL,
+    PRIMARY KEY (site, callsign, minute)
+);
@@ -0,0 +1,20 @@
+CREATE TABLE flight_log_old (
+    key TEXT PRIMARY KEY,
+    value TEXT,
+    last_seen DATETIME,
+    identification_count INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO flight_log_old (key, value, last_seen, identification_count)
+SELECT key, value, last_seen, identification_count FROM flight_log;
+
+DROP VIEW flight_log;
+
+ALTER TABLE flight_log_old RENAME TO flight_log;
+
+DROP TABLE IF EXISTS codeshare;
+DROP TABLE IF EXISTS flight_leg;
+DROP TABLE IF EXISTS flight;
+DROP TABLE IF EXISTS aircraft;
+DROP TABLE IF EXISTS operator;
+DROP TABLE IF EXISTS airport;
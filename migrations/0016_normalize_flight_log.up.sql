@@ -0,0 +1,271 @@
+-- The airports, operators and aircraft flights refer to, identified by all their codes
+CREATE TABLE IF NOT EXISTS airport (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL DEFAULT '',
+    code_icao TEXT NOT NULL DEFAULT '',
+    code_iata TEXT NOT NULL DEFAULT '',
+    code_lid TEXT,
+    timezone TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    city TEXT NOT NULL DEFAULT '',
+    airport_info_url TEXT NOT NULL DEFAULT '',
+    -- not known from the flights, filled from the airports of FlightAware
+    latitude REAL,
+    longitude REAL,
+    UNIQUE (code, code_icao, code_iata)
+);
+
+CREATE INDEX IF NOT EXISTS idx_airport_code_iata ON airport (code_iata);
+
+CREATE TABLE IF NOT EXISTS operator (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL DEFAULT '',
+    icao TEXT NOT NULL DEFAULT '',
+    iata TEXT NOT NULL DEFAULT '',
+    UNIQUE (code, icao, iata)
+);
+
+CREATE INDEX IF NOT EXISTS idx_operator_icao ON operator (icao);
+
+CREATE TABLE IF NOT EXISTS aircraft (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    icao24 TEXT NOT NULL DEFAULT '',
+    registration TEXT NOT NULL DEFAULT '',
+    aircraft_type TEXT NOT NULL DEFAULT '',
+    UNIQUE (icao24, registration, aircraft_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_aircraft_type ON aircraft (aircraft_type);
+
+-- A flight is the ident flights are logged by, the callsign, pointing to its latest leg
+CREATE TABLE IF NOT EXISTS flight (
+    ident TEXT PRIMARY KEY,
+    leg_id INTEGER REFERENCES flight_leg (id),
+    last_seen DATETIME NOT NULL,
+    identification_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_flight_last_seen ON flight (last_seen);
+
+-- A leg is a flight from an origin to a destination, one per FlightAware flight id
+CREATE TABLE IF NOT EXISTS flight_leg (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    flight_ident TEXT NOT NULL REFERENCES flight (ident),
+    fa_flight_id TEXT NOT NULL DEFAULT '',
+    operator_id INTEGER REFERENCES operator (id),
+    aircraft_id INTEGER REFERENCES aircraft (id),
+    origin_id INTEGER REFERENCES airport (id),
+    destination_id INTEGER REFERENCES airport (id),
+    logged_at DATETIME NOT NULL,
+    ident TEXT NOT NULL DEFAULT '',
+    ident_icao TEXT NOT NULL DEFAULT '',
+    ident_iata TEXT NOT NULL DEFAULT '',
+    actual_runway_off TEXT NOT NULL DEFAULT '',
+    actual_runway_on TEXT NOT NULL DEFAULT '',
+    flight_number TEXT NOT NULL DEFAULT '',
+    atc_ident TEXT,
+    inbound_fa_flight_id TEXT NOT NULL DEFAULT '',
+    blocked BOOLEAN NOT NULL DEFAULT 0,
+    diverted BOOLEAN NOT NULL DEFAULT 0,
+    cancelled BOOLEAN NOT NULL DEFAULT 0,
+    position_only BOOLEAN NOT NULL DEFAULT 0,
+    departure_delay INTEGER NOT NULL DEFAULT 0,
+    arrival_delay INTEGER NOT NULL DEFAULT 0,
+    filed_ete INTEGER NOT NULL DEFAULT 0,
+    foresight_predictions_available BOOLEAN NOT NULL DEFAULT 0,
+    scheduled_out DATETIME,
+    estimated_out DATETIME,
+    actual_out DATETIME,
+    scheduled_off DATETIME NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    estimated_off DATETIME NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    actual_off DATETIME NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    scheduled_on DATETIME NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    estimated_on DATETIME NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    actual_on DATETIME NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    scheduled_in DATETIME,
+    estimated_in DATETIME,
+    actual_in DATETIME,
+    progress_percent INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT '',
+    route_distance INTEGER NOT NULL DEFAULT 0,
+    filed_airspeed INTEGER,
+    filed_altitude INTEGER,
+    route TEXT,
+    baggage_claim TEXT,
+    seats_cabin_business INTEGER,
+    seats_cabin_coach INTEGER,
+    seats_cabin_first INTEGER,
+    gate_origin TEXT,
+    gate_destination TEXT,
+    terminal_origin TEXT,
+    terminal_destination TEXT,
+    type TEXT NOT NULL DEFAULT '',
+    site TEXT NOT NULL DEFAULT '',
+    -- the state of the aircraft when the flight was logged
+    baro_altitude REAL NOT NULL DEFAULT 0,
+    geo_altitude REAL NOT NULL DEFAULT 0,
+    velocity REAL NOT NULL DEFAULT 0,
+    true_track REAL NOT NULL DEFAULT 0,
+    vertical_rate REAL NOT NULL DEFAULT 0,
+    squawk TEXT NOT NULL DEFAULT '',
+    on_ground BOOLEAN NOT NULL DEFAULT 0,
+    latitude REAL NOT NULL DEFAULT 0,
+    longitude REAL NOT NULL DEFAULT 0,
+    distance REAL NOT NULL DEFAULT 0,
+    azimuth REAL NOT NULL DEFAULT 0,
+    elevation REAL NOT NULL DEFAULT 0,
+    slant_range REAL NOT NULL DEFAULT 0,
+    co2_kg REAL NOT NULL DEFAULT 0,
+    UNIQUE (flight_ident, fa_flight_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_flight_leg_origin ON flight_leg (origin_id);
+CREATE INDEX IF NOT EXISTS idx_flight_leg_destination ON flight_leg (destination_id);
+CREATE INDEX IF NOT EXISTS idx_flight_leg_operator ON flight_leg (operator_id);
+CREATE INDEX IF NOT EXISTS idx_flight_leg_aircraft ON flight_leg (aircraft_id);
+
+-- The codeshares of a leg, in order, by ICAO ("icao") and IATA ("iata") ident
+CREATE TABLE IF NOT EXISTS codeshare (
+    leg_id INTEGER NOT NULL REFERENCES flight_leg (id),
+    kind TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    ident TEXT NOT NULL,
+    PRIMARY KEY (leg_id, kind, position)
+);
+
+-- Convert the logged flights, one leg each
+INSERT OR IGNORE INTO airport (code, code_icao, code_iata, code_lid, timezone, name, city, airport_info_url)
+SELECT COALESCE(value ->> '$.origin.code', ''), COALESCE(value ->> '$.origin.code_icao', ''), COALESCE(value ->> '$.origin.code_iata', ''),
+    value ->> '$.origin.code_lid', COALESCE(value ->> '$.origin.timezone', ''), COALESCE(value ->> '$.origin.name', ''),
+    COALESCE(value ->> '$.origin.city', ''), COALESCE(value ->> '$.origin.airport_info_url', '')
+FROM flight_log
+WHERE COALESCE(value ->> '$.origin.code', '') || COALESCE(value ->> '$.origin.code_icao', '') || COALESCE(value ->> '$.origin.code_iata', '') != ''
+ORDER BY last_seen DESC;
+
+INSERT OR IGNORE INTO airport (code, code_icao, code_iata, code_lid, timezone, name, city, airport_info_url)
+SELECT COALESCE(value ->> '$.destination.code', ''), COALESCE(value ->> '$.destination.code_icao', ''), COALESCE(value ->> '$.destination.code_iata', ''),
+    value ->> '$.destination.code_lid', COALESCE(value ->> '$.destination.timezone', ''), COALESCE(value ->> '$.destination.name', ''),
+    COALESCE(value ->> '$.destination.city', ''), COALESCE(value ->> '$.destination.airport_info_url', '')
+FROM flight_log
+WHERE COALESCE(value ->> '$.destination.code', '') || COALESCE(value ->> '$.destination.code_icao', '') || COALESCE(value ->> '$.destination.code_iata', '') != ''
+ORDER BY last_seen DESC;
+
+INSERT OR IGNORE INTO operator (code, icao, iata)
+SELECT COALESCE(value ->> '$.operator', ''), COALESCE(value ->> '$.operator_icao', ''), COALESCE(value ->> '$.operator_iata', '')
+FROM flight_log
+WHERE COALESCE(value ->> '$.operator', '') || COALESCE(value ->> '$.operator_icao', '') || COALESCE(value ->> '$.operator_iata', '') != '';
+
+INSERT OR IGNORE INTO aircraft (icao24, registration, aircraft_type)
+SELECT COALESCE(value ->> '$.icao24', ''), COALESCE(value ->> '$.registration', ''), COALESCE(value ->> '$.aircraft_type', '')
+FROM flight_log
+WHERE COALESCE(value ->> '$.icao24', '') || COALESCE(value ->> '$.registration', '') || COALESCE(value ->> '$.aircraft_type', '') != '';
+
+INSERT INTO flight (ident, last_seen, identification_count)
+SELECT key, COALESCE(last_seen, CURRENT_TIMESTAMP), identification_count FROM flight_log;
+
+INSERT INTO flight_leg (flight_ident, fa_flight_id, operator_id, aircraft_id, origin_id, destination_id, logged_at,
+    ident, ident_icao, ident_iata, actual_runway_off, actual_runway_on, flight_number, atc_ident, inbound_fa_flight_id,
+    blocked, diverted, cancelled, position_only, departure_delay, arrival_delay, filed_ete, foresight_predictions_available,
+    scheduled_out, estimated_out, actual_out, scheduled_off, estimated_off, actual_off, scheduled_on, estimated_on, actual_on,
+    scheduled_in, estimated_in, actual_in, progress_percent, status, route_distance, filed_airspeed, filed_altitude, route,
+    baggage_claim, seats_cabin_business, seats_cabin_coach, seats_cabin_first, gate_origin, gate_destination, terminal_origin,
+    terminal_destination, type, site, baro_altitude, geo_altitude, velocity, true_track, vertical_rate, squawk, on_ground,
+    latitude, longitude, distance, azimuth, elevation, slant_range, co2_kg)
+SELECT f.key, COALESCE(f.value ->> '$.fa_flight_id', ''),
+    (SELECT id FROM operator WHERE code = COALESCE(f.value ->> '$.operator', '') AND icao = COALESCE(f.value ->> '$.operator_icao', '')
+        AND iata = COALESCE(f.value ->> '$.operator_iata', '')),
+    (SELECT id FROM aircraft WHERE icao24 = COALESCE(f.value ->> '$.icao24', '') AND registration = COALESCE(f.value ->> '$.registration', '')
+        AND aircraft_type = COALESCE(f.value ->> '$.aircraft_type', '')),
+    (SELECT id FROM airport WHERE code = COALESCE(f.value ->> '$.origin.code', '') AND code_icao = COALESCE(f.value ->> '$.origin.code_icao', '')
+        AND code_iata = COALESCE(f.value ->> '$.origin.code_iata', '')),
+    (SELECT id FROM airport WHERE code = COALESCE(f.value ->> '$.destination.code', '') AND code_icao = COALESCE(f.value ->> '$.destination.code_icao', '')
+        AND code_iata = COALESCE(f.value ->> '$.destination.code_iata', '')),
+    COALESCE(f.last_seen, CURRENT_TIMESTAMP),
+    COALESCE(f.value ->> '$.ident', ''), COALESCE(f.value ->> '$.ident_icao', ''), COALESCE(f.value ->> '$.ident_iata', ''),
+    COALESCE(f.value ->> '$.actual_runway_off', ''), COALESCE(f.value ->> '$.actual_runway_on', ''),
+    COALESCE(f.value ->> '$.flight_number', ''), f.value ->> '$.atc_ident', COALESCE(f.value ->> '$.inbound_fa_flight_id', ''),
+    COALESCE(f.value ->> '$.blocked', 0), COALESCE(f.value ->> '$.diverted', 0), COALESCE(f.value ->> '$.cancelled', 0),
+    COALESCE(f.value ->> '$.position_only', 0), COALESCE(f.value ->> '$.departure_delay', 0), COALESCE(f.value ->> '$.arrival_delay', 0),
+    COALESCE(f.value ->> '$.filed_ete', 0), COALESCE(f.value ->> '$.foresight_predictions_available', 0),
+    f.value ->> '$.scheduled_out', f.value ->> '$.estimated_out', f.value ->> '$.actual_out',
+    COALESCE(f.value ->> '$.scheduled_off', '0001-01-01T00:00:00Z'), COALESCE(f.value ->> '$.estimated_off', '0001-01-01T00:00:00Z'),
+    COALESCE(f.value ->> '$.actual_off', '0001-01-01T00:00:00Z'), COALESCE(f.value ->> '$.scheduled_on', '0001-01-01T00:00:00Z'),
+    COALESCE(f.value ->> '$.estimated_on', '0001-01-01T00:00:00Z'), COALESCE(f.value ->> '$.actual_on', '0001-01-01T00:00:00Z'),
+    f.value ->> '$.scheduled_in', f.value ->> '$.estimated_in', f.value ->> '$.actual_in',
+    COALESCE(f.value ->> '$.progress_percent', 0), COALESCE(f.value ->> '$.status', ''), COALESCE(f.value ->> '$.route_distance', 0),
+    f.value ->> '$.filed_airspeed', f.value ->> '$.filed_altitude', f.value ->> '$.route', f.value ->> '$.baggage_claim',
+    f.value ->> '$.seats_cabin_business', f.value ->> '$.seats_cabin_coach', f.value ->> '$.seats_cabin_first',
+    f.value ->> '$.gate_origin', f.value ->> '$.gate_destination', f.value ->> '$.terminal_origin', f.value ->> '$.terminal_destination',
+    COALESCE(f.value ->> '$.type', ''), COALESCE(f.value ->> '$.site', ''),
+    COALESCE(f.value ->> '$.baro_altitude', 0), COALESCE(f.value ->> '$.geo_altitude', 0), COALESCE(f.value ->> '$.velocity', 0),
+    COALESCE(f.value ->> '$.true_track', 0), COALESCE(f.value ->> '$.vertical_rate', 0), COALESCE(f.value ->> '$.squawk', ''),
+    COALESCE(f.value ->> '$.on_ground', 0), COALESCE(f.value ->> '$.latitude', 0), COALESCE(f.value ->> '$.longitude', 0),
+    COALESCE(f.value ->> '$.distance_m', 0), COALESCE(f.value ->> '$.azimuth', 0), COALESCE(f.value ->> '$.elevation', 0),
+    COALESCE(f.value ->> '$.slant_range_m', 0), COALESCE(f.value ->> '$.co2_kg', 0)
+FROM flight_log f;
+
+UPDATE flight SET leg_id = (SELECT id FROM flight_leg WHERE flight_ident = flight.ident);
+
+INSERT INTO codeshare (leg_id, kind, position, ident)
+SELECT l.id, 'icao', c.key, c.value
+FROM flight_log f JOIN flight_leg l ON l.flight_ident = f.key, json_each(f.value, '$.codeshares') c
+WHERE json_type(f.value, '$.codeshares') = 'array';
+
+INSERT INTO codeshare (leg_id, kind, position, ident)
+SELECT l.id, 'iata', c.key, c.value
+FROM flight_log f JOIN flight_leg l ON l.flight_ident = f.key, json_each(f.value, '$.codeshares_iata') c
+WHERE json_type(f.value, '$.codeshares_iata') = 'array';
+
+DROP TABLE flight_log;
+
+-- The flights as they were logged before, read only, for the tools reading flight_log. SQLite functions take
+-- at most 127 arguments, the JSON is patched together; the fields that are null are left out of the later parts.
+CREATE VIEW flight_log AS
+SELECT f.ident AS key,
+    json_patch(json_patch(json_object(
+        'ident', l.ident, 'ident_icao', l.ident_icao, 'ident_iata', l.ident_iata,
+        'actual_runway_off', l.actual_runway_off, 'actual_runway_on', l.actual_runway_on, 'fa_flight_id', l.fa_flight_id,
+        'operator', COALESCE(o.code, ''), 'operator_icao', COALESCE(o.icao, ''), 'operator_iata', COALESCE(o.iata, ''),
+        'flight_number', l.flight_number, 'registration', COALESCE(a.registration, ''), 'atc_ident', l.atc_ident,
+        'inbound_fa_flight_id', l.inbound_fa_flight_id,
+        'codeshares', json((SELECT json_group_array(ident) FROM (SELECT ident FROM codeshare WHERE leg_id = l.id AND kind = 'icao' ORDER BY position))),
+        'codeshares_iata', json((SELECT json_group_array(ident) FROM (SELECT ident FROM codeshare WHERE leg_id = l.id AND kind = 'iata' ORDER BY position))),
+        'blocked', json(CASE WHEN l.blocked THEN 'true' ELSE 'false' END),
+        'diverted', json(CASE WHEN l.diverted THEN 'true' ELSE 'false' END),
+        'cancelled', json(CASE WHEN l.cancelled THEN 'true' ELSE 'false' END),
+        'position_only', json(CASE WHEN l.position_only THEN 'true' ELSE 'false' END),
+        'origin', CASE WHEN origin.id IS NULL THEN NULL ELSE json_object('code', origin.code, 'code_icao', origin.code_icao,
+            'code_iata', origin.code_iata, 'code_lid', origin.code_lid, 'timezone', origin.timezone, 'name', origin.name,
+            'city', origin.city, 'airport_info_url', origin.airport_info_url) END,
+        'destination', CASE WHEN destination.id IS NULL THEN NULL ELSE json_object('code', destination.code, 'code_icao', destination.code_icao,
+            'code_iata', destination.code_iata, 'code_lid', destination.code_lid, 'timezone', destination.timezone, 'name', destination.name,
+            'city', destination.city, 'airport_info_url', destination.airport_info_url) END
+    ), json_object(
+        'departure_delay', l.departure_delay, 'arrival_delay', l.arrival_delay, 'filed_ete', l.filed_ete,
+        'foresight_predictions_available', json(CASE WHEN l.foresight_predictions_available THEN 'true' ELSE 'false' END),
+        'scheduled_out', strftime('%Y-%m-%dT%H:%M:%SZ', l.scheduled_out), 'estimated_out', strftime('%Y-%m-%dT%H:%M:%SZ', l.estimated_out),
+        'actual_out', strftime('%Y-%m-%dT%H:%M:%SZ', l.actual_out), 'scheduled_off', strftime('%Y-%m-%dT%H:%M:%SZ', l.scheduled_off),
+        'estimated_off', strftime('%Y-%m-%dT%H:%M:%SZ', l.estimated_off), 'actual_off', strftime('%Y-%m-%dT%H:%M:%SZ', l.actual_off),
+        'scheduled_on', strftime('%Y-%m-%dT%H:%M:%SZ', l.scheduled_on), 'estimated_on', strftime('%Y-%m-%dT%H:%M:%SZ', l.estimated_on),
+        'actual_on', strftime('%Y-%m-%dT%H:%M:%SZ', l.actual_on), 'scheduled_in', strftime('%Y-%m-%dT%H:%M:%SZ', l.scheduled_in),
+        'estimated_in', strftime('%Y-%m-%dT%H:%M:%SZ', l.estimated_in), 'actual_in', strftime('%Y-%m-%dT%H:%M:%SZ', l.actual_in),
+        'progress_percent', l.progress_percent, 'status', l.status, 'aircraft_type', COALESCE(a.aircraft_type, ''),
+        'route_distance', l.route_distance, 'filed_airspeed', l.filed_airspeed, 'filed_altitude', l.filed_altitude, 'route', l.route,
+        'baggage_claim', l.baggage_claim, 'seats_cabin_business', l.seats_cabin_business, 'seats_cabin_coach', l.seats_cabin_coach,
+        'seats_cabin_first', l.seats_cabin_first, 'gate_origin', l.gate_origin, 'gate_destination', l.gate_destination,
+        'terminal_origin', l.terminal_origin, 'terminal_destination', l.terminal_destination
+    )), json_object(
+        'type', l.type, 'site', l.site, 'icao24', COALESCE(a.icao24, ''), 'baro_altitude', l.baro_altitude, 'geo_altitude', l.geo_altitude, 'velocity', l.velocity,
+        'true_track', l.true_track, 'vertical_rate', l.vertical_rate, 'squawk', l.squawk,
+        'on_ground', json(CASE WHEN l.on_ground THEN 'true' ELSE 'false' END),
+        'latitude', l.latitude, 'longitude', l.longitude, 'distance_m', l.distance, 'azimuth', l.azimuth, 'elevation', l.elevation,
+        'slant_range_m', l.slant_range, 'co2_kg', l.co2_kg
+    )) AS value,
+    f.last_seen,
+    f.identification_count
+FROM flight f
+JOIN flight_leg l ON l.id = f.leg_id
+LEFT JOIN operator o ON o.id = l.operator_id
+LEFT JOIN aircraft a ON a.id = l.aircraft_id
+LEFT JOIN airport origin ON origin.id = l.origin_id
+LEFT JOIN airport destination ON destination.id = l.destination_id;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS position (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    time DATETIME NOT NULL, -- when the position was reported
+    icao24 TEXT NOT NULL,
+    callsign TEXT NOT NULL DEFAULT '',
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    baro_altitude REAL NOT NULL DEFAULT 0,
+    geo_altitude REAL NOT NULL DEFAULT 0,
+    velocity REAL NOT NULL DEFAULT 0,
+    true_track REAL NOT NULL DEFAULT 0,
+    vertical_rate REAL NOT NULL DEFAULT 0,
+    on_ground BOOLEAN NOT NULL DEFAULT 0,
+    UNIQUE (icao24, time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_position_time ON position (time);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS maintenance_run (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job TEXT NOT NULL,
+    started_at DATETIME NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    affected INTEGER NOT NULL DEFAULT 0, -- rows deleted or pages freed, depending on the job
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_run_job_started_at ON maintenance_run (job, started_at);
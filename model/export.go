@@ -0,0 +1,91 @@
+package model
+
+import "time"
+
+// ExportRow is a sighting flattened with the flight its callsign was identified as by the end of the sighting,
+// the leg logged last by then, a row of the exports. The flight columns are empty for the sightings of callsigns
+// not identified by then; the kinematics are the state of the aircraft when the leg was last logged.
+type ExportRow struct {
+	SightingID   int64     `json:"sighting_id" parquet:"sighting_id"`
+	Site         string    `json:"site" parquet:"site"`
+	Icao24       string    `json:"icao24" parquet:"icao24"`
+	Callsign     string    `json:"callsign" parquet:"callsign"`
+	FirstSeen    time.Time `json:"first_seen" parquet:"first_seen"`
+	LastSeen     time.Time `json:"last_seen" parquet:"last_seen"`
+	MinDistance  float64   `json:"min_distance_m" parquet:"min_distance_m"`
+	MinAltitude  float64   `json:"min_altitude_m" parquet:"min_altitude_m"`
+	EntryBearing float64   `json:"entry_bearing" parquet:"entry_bearing"`
+	ExitBearing  float64   `json:"exit_bearing" parquet:"exit_bearing"`
+	SampleCount  int       `json:"sample_count" parquet:"sample_count"`
+	PeakNoise    float64   `json:"peak_noise_dba" parquet:"peak_noise_dba"`
+
+	Ident           string  `json:"ident" parquet:"ident"`
+	Operator        string  `json:"operator" parquet:"operator"`
+	OperatorIcao    string  `json:"operator_icao" parquet:"operator_icao"`
+	OperatorIata    string  `json:"operator_iata" parquet:"operator_iata"`
+	Origin          string  `json:"origin" parquet:"origin"`
+	OriginIata      string  `json:"origin_iata" parquet:"origin_iata"`
+	OriginCity      string  `json:"origin_city" parquet:"origin_city"`
+	Destination     string  `json:"destination" parquet:"destination"`
+	DestinationIata string  `json:"destination_iata" parquet:"destination_iata"`
+	DestinationCity string  `json:"destination_city" parquet:"destination_city"`
+	Route           string  `json:"route" parquet:"route"`
+	RouteDistance   int     `json:"route_distance" parquet:"route_distance"`
+	Registration    string  `json:"registration" parquet:"registration"`
+	AircraftType    string  `json:"aircraft_type" parquet:"aircraft_type"`
+	CO2KG           float64 `json:"co2_kg" parquet:"co2_kg"`
+
+	BaroAltitude float64 `json:"baro_altitude" parquet:"baro_altitude"`
+	GeoAltitude  float64 `json:"geo_altitude" parquet:"geo_altitude"`
+	Velocity     float64 `json:"velocity" parquet:"velocity"`
+	TrueTrack    float64 `json:"true_track" parquet:"true_track"`
+	VerticalRate float64 `json:"vertical_rate" parquet:"vertical_rate"`
+	Squawk       string  `json:"squawk" parquet:"squawk"`
+	OnGround     bool    `json:"on_ground" parquet:"on_ground"`
+}
+
+// NewExportRow flattens a sighting with its flight, nil when the callsign was not identified.
+func NewExportRow(s *Sighting, f *FlightInfo) ExportRow {
+	row := ExportRow{
+		SightingID:   s.ID,
+		Site:         s.Site,
+		Icao24:       s.Icao24,
+		Callsign:     s.Callsign,
+		FirstSeen:    s.FirstSeen,
+		LastSeen:     s.LastSeen,
+		MinDistance:  s.MinDistance,
+		MinAltitude:  s.MinAltitude,
+		EntryBearing: s.EntryBearing,
+		ExitBearing:  s.ExitBearing,
+		SampleCount:  s.SampleCount,
+		PeakNoise:    s.PeakNoise,
+	}
+	if f == nil {
+		return row
+	}
+	row.Ident = f.Ident
+	row.Operator = f.Operator
+	row.OperatorIcao = f.OperatorIcao
+	row.OperatorIata = f.OperatorIata
+	row.Origin = f.Origin.Code
+	row.OriginIata = f.Origin.CodeIata
+	row.OriginCity = f.Origin.City
+	row.Destination = f.Destination.Code
+	row.DestinationIata = f.Destination.CodeIata
+	row.DestinationCity = f.Destination.City
+	if f.Route != nil {
+		row.Route = *f.Route
+	}
+	row.RouteDistance = f.RouteDistance
+	row.Registration = f.Registration
+	row.AircraftType = f.AircraftType
+	row.CO2KG = f.CO2KG
+	row.BaroAltitude = f.BaroAltitude
+	row.GeoAltitude = f.GeoAltitude
+	row.Velocity = f.Velocity
+	row.TrueTrack = f.TrueTrack
+	row.VerticalRate = f.VerticalRate
+	row.Squawk = f.Squawk
+	row.OnGround = f.OnGround
+	return row
+}
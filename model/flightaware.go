@@ -66,15 +66,41 @@ type FlightInfo struct {
 	TerminalOrigin                *string       `json:"terminal_origin"`
 	TerminalDestination           *string       `json:"terminal_destination"`
 	Type                          string        `json:"type"`
+	Site                          string        `json:"site,omitempty"`
+	Icao24                        string        `json:"icao24"`
+	BaroAltitude                  float64       `json:"baro_altitude"`
+	GeoAltitude                   float64       `json:"geo_altitude"`
+	Velocity                      float64       `json:"velocity"`
+	TrueTrack                     float64       `json:"true_track"`
+	VerticalRate                  float64       `json:"vertical_rate"`
+	Squawk                        string        `json:"squawk"`
+	OnGround                      bool          `json:"on_ground"`
 	Latitude                      float64       `json:"latitude"`
 	Longitude                     float64       `json:"longitude"`
 	Distance                      float64       `json:"distance_m"`
+	Azimuth                       float64       `json:"azimuth"`       // degrees clockwise from north, seen from the site
+	Elevation                     float64       `json:"elevation"`     // degrees above the horizon of the site
+	SlantRange                    float64       `json:"slant_range_m"` // straight-line distance from the observer
 	CO2KG                         float64       `json:"co2_kg"`
 	DistanceDisplay               string        `json:"-"`
 	CO2KGDisplay                  string        `json:"-"`
 	IdentificationCount           int           `json:"-"`
 }
 
+// SetState copies the OpenSky state vector of the aircraft onto the FlightInfo.
+func (f *FlightInfo) SetState(state *Flight) {
+	f.Icao24 = state.Icao24
+	f.Latitude = state.Latitude
+	f.Longitude = state.Longitude
+	f.BaroAltitude = state.BaroAltitude
+	f.GeoAltitude = state.GeoAltitude
+	f.Velocity = state.Velocity
+	f.TrueTrack = state.TrueTrack
+	f.VerticalRate = state.VerticalRate
+	f.Squawk = state.Squawk
+	f.OnGround = state.OnGround
+}
+
 // OperatorInfo represents detailed information about an operator.
 type OperatorInfo struct {
 	Name      string `json:"name"`
@@ -82,6 +108,13 @@ type OperatorInfo struct {
 	Country   string `json:"country"`
 }
 
+// AirportInfo represents the location of an airport, as returned by the airports endpoint of AeroAPI.
+type AirportInfo struct {
+	Code      string  `json:"airport_code"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
 // AirportDetail represents detailed information about an airport.
 type AirportDetail struct {
 	Code           string  `json:"code"`
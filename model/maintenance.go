@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// MaintenanceRun is a run of a database maintenance job.
+type MaintenanceRun struct {
+	ID         int64     `json:"id"`
+	Job        string    `json:"job"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Affected   int64     `json:"affected"` // rows deleted or pages freed, depending on the job
+	Error      string    `json:"error,omitempty"`
+}
@@ -0,0 +1,9 @@
+package model
+
+// NoiseDay is the estimated noise of the passes started on a day.
+type NoiseDay struct {
+	Day     string  `json:"day"` // YYYY-MM-DD, local time
+	Passes  int     `json:"passes"`
+	Lden    float64 `json:"lden_dba"`    // day-evening-night level
+	Loudest float64 `json:"loudest_dba"` // peak level of the loudest pass
+}
@@ -30,10 +30,19 @@ type Flight struct {
 	Squawk         string  `json:"squawk"`
 	Spi            bool    `json:"spi"`
 	PositionSource int     `json:"position_source"`
+	Category       int     `json:"category"`
 	Origin         string  `json:"origin,omitempty"`      // ICAO airport code
 	Destination    string  `json:"destination,omitempty"` // ICAO airport code
 }
 
+// GeometricAltitude returns the GPS altitude of the aircraft, or its barometric altitude when unknown.
+func (f *Flight) GeometricAltitude() float64 {
+	if f.GeoAltitude != 0 {
+		return f.GeoAltitude
+	}
+	return f.BaroAltitude
+}
+
 // ToFlights converts the States object to a slice of Flight objects.
 func (s *States) ToFlights() []Flight {
 	var flights []Flight
@@ -97,7 +106,12 @@ func (s *States) ToFlights() []Flight {
 			}
 		}
 		if len(state) > 17 {
-			flight.Origin, _ = state[17].(string)
+			// Extended responses carry the aircraft category at this index
+			if val, ok := state[17].(float64); ok {
+				flight.Category = int(val)
+			} else {
+				flight.Origin, _ = state[17].(string)
+			}
 		}
 		if len(state) > 18 {
 			flight.Destination, _ = state[18].(string)
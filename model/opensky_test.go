@@ -11,7 +11,7 @@ func TestToFlights(t *testing.T) {
 		Time: 1,
 		States: [][]interface{}{
 			{"icao24", "callsign", "origin_country", float64(1), float64(2), 3.0, 4.0, 5.0, true, 6.0, 7.0, 8.0, nil, 9.0, "squawk", false, float64(0)},
-			{"icao24_2", nil, "origin_country_2", float64(10), float64(20), 30.0, 40.0, 50.0, false, 60.0, 70.0, 80.0, nil, 90.0, nil, true, float64(1)},
+			{"icao24_2", nil, "origin_country_2", float64(10), float64(20), 30.0, 40.0, 50.0, false, 60.0, 70.0, 80.0, nil, 90.0, nil, true, float64(1), float64(6)},
 		},
 	}
 
@@ -54,4 +54,5 @@ func TestToFlights(t *testing.T) {
 	assert.Equal(t, "", flights[1].Squawk)
 	assert.Equal(t, true, flights[1].Spi)
 	assert.Equal(t, 1, flights[1].PositionSource)
+	assert.Equal(t, 6, flights[1].Category)
 }
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Position is the state of an aircraft reported at a poll, a point of its track.
+type Position struct {
+	Time         time.Time `json:"time"` // when the position was reported
+	Icao24       string    `json:"icao24"`
+	Callsign     string    `json:"callsign"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	BaroAltitude float64   `json:"baro_altitude"` // meters
+	GeoAltitude  float64   `json:"geo_altitude"`  // meters
+	Velocity     float64   `json:"velocity"`      // m/s
+	TrueTrack    float64   `json:"true_track"`    // degrees clockwise from north
+	VerticalRate float64   `json:"vertical_rate"` // m/s
+	OnGround     bool      `json:"on_ground"`
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// Prediction is an aircraft predicted to fly over a site, from its last state vector outside the area.
+type Prediction struct {
+	Site            string    `json:"site"`
+	Icao24          string    `json:"icao24"`
+	Callsign        string    `json:"callsign"`
+	PredictedAt     time.Time `json:"predicted_at"` // when the aircraft was first predicted to enter the area
+	EntryTime       time.Time `json:"entry_time"`
+	EntryBearing    float64   `json:"entry_bearing"` // from the site, where the aircraft shows up
+	ClosestTime     time.Time `json:"closest_time"`
+	ClosestDistance float64   `json:"closest_distance_m"` // from the site, on the ground
+	ClosestAltitude float64   `json:"closest_altitude_m"`
+}
+
+// The outcomes of a prediction, once the aircraft entered the area or not.
+const (
+	PredictionEntered = "entered"
+	PredictionMissed  = "missed"
+	// PredictionUnpredicted is an aircraft that entered the area without being predicted.
+	PredictionUnpredicted = "unpredicted"
+)
+
+// PredictionOutcome compares a prediction with what happened.
+type PredictionOutcome struct {
+	Prediction
+	Outcome        string    `json:"outcome"`
+	ActualEntry    time.Time `json:"actual_entry"`      // for entered and unpredicted aircraft
+	ActualDistance float64   `json:"actual_distance_m"` // closest seen, for entered and unpredicted aircraft
+	ResolvedAt     time.Time `json:"resolved_at"`
+}
+
+// EntryError returns how late, in seconds, the aircraft entered the area compared to the prediction.
+func (o *PredictionOutcome) EntryError() float64 {
+	return o.ActualEntry.Sub(o.EntryTime).Seconds()
+}
+
+// DistanceError returns how much farther, in meters, the aircraft passed compared to the prediction.
+func (o *PredictionOutcome) DistanceError() float64 {
+	return o.ActualDistance - o.ClosestDistance
+}
+
+// Lead returns how long, in seconds, before entering the area the aircraft was first predicted.
+func (o *PredictionOutcome) Lead() float64 {
+	return o.ActualEntry.Sub(o.PredictedAt).Seconds()
+}
+
+// PredictionAccuracy summarizes the outcomes of the predictions over a period.
+type PredictionAccuracy struct {
+	Entered     int `json:"entered"`
+	Missed      int `json:"missed"`      // predicted aircraft that did not enter
+	Unpredicted int `json:"unpredicted"` // aircraft that entered without being predicted
+	// The means over the entered aircraft: absolute entry time and closest distance errors, and lead time
+	MeanEntryError    float64 `json:"mean_entry_error_s"`
+	MeanDistanceError float64 `json:"mean_distance_error_m"`
+	MeanLead          float64 `json:"mean_lead_s"`
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// Kinds of the attributes whose first sighting and frequency are tracked.
+const (
+	KindOperator     = "operator"
+	KindAircraftType = "aircraft_type"
+	KindRegistration = "registration"
+	KindRoute        = "route" // origin and destination codes, e.g. LSZH-KJFK
+	KindCountry      = "country"
+)
+
+// Kinds lists the tracked attribute kinds.
+var Kinds = []string{KindOperator, KindAircraftType, KindRegistration, KindRoute, KindCountry}
+
+// FirstSeen is the first sighting of an attribute value, with the number of passes showing it since.
+type FirstSeen struct {
+	Kind     string    `json:"kind"`
+	Value    string    `json:"value"`
+	Time     time.Time `json:"first_seen"`
+	Callsign string    `json:"callsign"`
+	Site     string    `json:"site"`
+	Count    int       `json:"count"`
+}
+
+// Attributes returns the tracked attribute values of a flight by kind, leaving out the unknown ones.
+// country is the country of the operator.
+func Attributes(flight *FlightInfo, country string) map[string]string {
+	attrs := make(map[string]string)
+	set := func(kind, value string) {
+		if value != "" {
+			attrs[kind] = value
+		}
+	}
+	set(KindOperator, flight.OperatorIcao)
+	set(KindAircraftType, flight.AircraftType)
+	set(KindRegistration, flight.Registration)
+	if flight.Origin.Code != "" && flight.Destination.Code != "" {
+		set(KindRoute, flight.Origin.Code+"-"+flight.Destination.Code)
+	}
+	set(KindCountry, country)
+	return attrs
+}
+
+// Rarity scores flights by how seldom the values of their attributes were seen.
+type Rarity struct {
+	seen   map[[2]string]*FirstSeen
+	passes int
+}
+
+// NewRarity creates a Rarity from the first sightings of the attribute values and the total number of passes.
+func NewRarity(seen []*FirstSeen, passes int) *Rarity {
+	r := &Rarity{seen: make(map[[2]string]*FirstSeen, len(seen)), passes: passes}
+	for _, s := range seen {
+		r.seen[[2]string{s.Kind, s.Value}] = s
+	}
+	return r
+}
+
+// Score returns the rarity of the rarest attribute, from 0 for a value every pass showed to 100 for a
+// value seen once: 100 × (1 - ln(count) / ln(passes + 1)), rounded to one decimal. Values never seen count once.
+func (r *Rarity) Score(attrs map[string]string) float64 {
+	score := 0.0
+	for kind, value := range attrs {
+		count := 1
+		if s, ok := r.seen[[2]string{kind, value}]; ok && s.Count > 1 {
+			count = s.Count
+		}
+		passes := max(r.passes, count)
+		score = math.Max(score, 1-math.Log(float64(count))/math.Log(float64(passes+1)))
+	}
+	return math.Round(score*1000) / 10
+}
+
+// firstSeenWindow is how far from the start of a pass its aircraft may be seen, longer than any pass over a site.
+const firstSeenWindow = time.Hour
+
+// FirstSeenWith returns the kinds, in the order of Kinds, whose value was seen for the first time on the pass
+// of callsign over site seen at the given time: the first sighting of the value is of the same callsign and site,
+// and started within firstSeenWindow of seen. The later passes of the callsign are not flagged.
+func (r *Rarity) FirstSeenWith(callsign, site string, seen time.Time, attrs map[string]string) []string {
+	var kinds []string
+	for _, kind := range Kinds {
+		value, ok := attrs[kind]
+		if !ok {
+			continue
+		}
+		s, ok := r.seen[[2]string{kind, value}]
+		if ok && s.Callsign == callsign && s.Site == site && seen.Sub(s.Time).Abs() <= firstSeenWindow {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributes(t *testing.T) {
+	flight := &FlightInfo{
+		OperatorIcao: "SWR",
+		AircraftType: "A333",
+		Origin:       AirportDetail{Code: "LSZH"},
+		Destination:  AirportDetail{Code: "KJFK"},
+	}
+	assert.Equal(t, map[string]string{
+		KindOperator:     "SWR",
+		KindAircraftType: "A333",
+		KindRoute:        "LSZH-KJFK",
+		KindCountry:      "CH",
+	}, Attributes(flight, "CH"))
+
+	// Routes need both ends
+	assert.Empty(t, Attributes(&FlightInfo{Origin: AirportDetail{Code: "LSZH"}}, ""))
+}
+
+func TestRarity(t *testing.T) {
+	now := time.Now()
+	rarity := NewRarity([]*FirstSeen{
+		{Kind: KindOperator, Value: "SWR", Time: now, Callsign: "SWR1", Site: "home", Count: 99},
+		{Kind: KindAircraftType, Value: "A333", Time: now, Callsign: "SWR1", Site: "home", Count: 10},
+		{Kind: KindAircraftType, Value: "A388", Time: now, Callsign: "SIA22", Count: 1},
+	}, 99)
+
+	assert.Equal(t, 0.2, rarity.Score(map[string]string{KindOperator: "SWR"}))
+	assert.Equal(t, 50.0, rarity.Score(map[string]string{KindOperator: "SWR", KindAircraftType: "A333"}))
+	assert.Equal(t, 100.0, rarity.Score(map[string]string{KindOperator: "SWR", KindAircraftType: "A388"}))
+	assert.Equal(t, 100.0, rarity.Score(map[string]string{KindRegistration: "HB-JHA"}), "never seen")
+	assert.Equal(t, 0.0, rarity.Score(nil))
+
+	attrs := map[string]string{KindOperator: "SWR", KindAircraftType: "A333", KindRegistration: "HB-JHA"}
+	assert.Equal(t, []string{KindOperator, KindAircraftType}, rarity.FirstSeenWith("SWR1", "home", now.Add(5*time.Minute), attrs))
+	assert.Empty(t, rarity.FirstSeenWith("SWR2", "home", now, attrs))
+	// Only the pass the values were first seen on is flagged, not the later passes of the callsign or the other sites
+	assert.Empty(t, rarity.FirstSeenWith("SWR1", "home", now.AddDate(0, 0, 1), attrs))
+	assert.Empty(t, rarity.FirstSeenWith("SWR1", "office", now, attrs))
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RecurringFlight is a callsign passing over a site at about the same time of day on some weekdays,
+// learned from the past sightings.
+type RecurringFlight struct {
+	Site        string         `json:"site"`
+	Callsign    string         `json:"callsign"`
+	Minute      int            `json:"minute"`        // typical time of the pass, in minutes after local midnight
+	Tolerance   int            `json:"tolerance_min"` // minutes around the typical time still on time
+	Weekdays    []time.Weekday `json:"weekdays"`      // 0 is Sunday
+	Occurrences int            `json:"occurrences"`   // passes on the weekdays
+	Regularity  float64        `json:"regularity"`    // share of the weekdays watched the flight passed on
+}
+
+// Clock returns the typical time of the pass, e.g. "07:42".
+func (r *RecurringFlight) Clock() string {
+	return fmt.Sprintf("%02d:%02d", r.Minute/60, r.Minute%60)
+}
+
+// Days describes the weekdays of the flight, e.g. "daily", "weekdays" or "Mon, Wed, Fri".
+func (r *RecurringFlight) Days() string {
+	weekend := []time.Weekday{time.Saturday, time.Sunday}
+	switch {
+	case len(r.Weekdays) == 7:
+		return "daily"
+	case len(r.Weekdays) == 5 && !slices.ContainsFunc(r.Weekdays, func(d time.Weekday) bool { return slices.Contains(weekend, d) }):
+		return "weekdays"
+	case len(r.Weekdays) == 2 && slices.Contains(r.Weekdays, time.Saturday) && slices.Contains(r.Weekdays, time.Sunday):
+		return "weekends"
+	}
+	names := make([]string, len(r.Weekdays))
+	for i, d := range r.Weekdays {
+		names[i] = d.String()[:3]
+	}
+	return strings.Join(names, ", ")
+}
+
+// The statuses of an expected flight.
+const (
+	ExpectedScheduled = "scheduled" // before its time window
+	ExpectedDue       = "due"       // in its time window, not seen yet
+	ExpectedOnTime    = "on_time"
+	ExpectedEarly     = "early"
+	ExpectedLate      = "late" // seen after its time window, or not seen yet
+	ExpectedMissing   = "missing"
+)
+
+// ExpectedFlight is a recurring flight expected on a day, compared with what was seen.
+type ExpectedFlight struct {
+	RecurringFlight
+	Expected time.Time  `json:"expected"`
+	Seen     *time.Time `json:"seen,omitempty"` // the first sighting of the pass
+	Delay    int        `json:"delay_min"`      // minutes the pass was seen after the expected time, when seen
+	Status   string     `json:"status"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurringFlight_Clock(t *testing.T) {
+	assert.Equal(t, "07:42", (&RecurringFlight{Minute: 7*60 + 42}).Clock())
+	assert.Equal(t, "00:05", (&RecurringFlight{Minute: 5}).Clock())
+}
+
+func TestRecurringFlight_Days(t *testing.T) {
+	days := func(weekdays ...time.Weekday) string { return (&RecurringFlight{Weekdays: weekdays}).Days() }
+	assert.Equal(t, "daily", days(0, 1, 2, 3, 4, 5, 6))
+	assert.Equal(t, "weekdays", days(1, 2, 3, 4, 5))
+	assert.Equal(t, "weekends", days(0, 6))
+	assert.Equal(t, "Mon, Wed, Fri", days(1, 3, 5))
+	assert.Equal(t, "Sun, Mon, Tue, Wed, Thu", days(0, 1, 2, 3, 4))
+}
@@ -0,0 +1,20 @@
+package model
+
+// Alert rule severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Rule raises an alert when its expression holds for an aircraft.
+type Rule struct {
+	ID         int64    `json:"id"` // 0 for rules of the configuration
+	Name       string   `json:"name"`
+	Expression string   `json:"expression"`
+	Severity   string   `json:"severity"`
+	Cooldown   int      `json:"cooldown"` // seconds before the rule fires again for the same aircraft
+	Actions    []string `json:"actions"`
+	Enabled    bool     `json:"enabled"`
+	ReadOnly   bool     `json:"read_only"` // rules of the configuration cannot be changed through the API
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// Observation is a single position report of an aircraft inside the observed area.
+type Observation struct {
+	Site     string
+	Icao24   string
+	Callsign string
+	Time     time.Time
+	Distance float64 // meters from the observer
+	Altitude float64 // meters
+	Bearing  float64 // degrees from the observer
+	// Noise is the estimated noise at the observer, zero when unknown
+	NoiseLevel    float64 // dB(A)
+	NoiseExposure float64 // dB(A)
+}
+
+// Sighting represents a single pass of an aircraft over the observed area,
+// grouping consecutive observations of the same ICAO24/callsign.
+type Sighting struct {
+	ID           int64     `json:"id"`
+	Site         string    `json:"site"`
+	Icao24       string    `json:"icao24"`
+	Callsign     string    `json:"callsign"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	MinDistance  float64   `json:"min_distance_m"`
+	MinAltitude  float64   `json:"min_altitude_m"`
+	EntryBearing float64   `json:"entry_bearing"`
+	ExitBearing  float64   `json:"exit_bearing"`
+	SampleCount  int       `json:"sample_count"`
+	// PeakNoise is the loudest estimate of the pass, with the sound exposure level of that flyover
+	PeakNoise     float64 `json:"peak_noise_dba,omitempty"`
+	NoiseExposure float64 `json:"noise_exposure_dba,omitempty"`
+}
+
+// LowerAltitude returns the lowest altitude of a pass, min so far, after an observation at altitude. The altitudes
+// zero or below are unknown, reported without one, and do not lower the pass: zero is kept until one is known.
+func LowerAltitude(min, altitude float64) float64 {
+	if altitude <= 0 {
+		return min
+	}
+	if min <= 0 {
+		return altitude
+	}
+	return math.Min(min, altitude)
+}
+
+// Duration returns how long the aircraft was observed during the pass.
+func (s *Sighting) Duration() time.Duration {
+	return s.LastSeen.Sub(s.FirstSeen)
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// compassPoints are the eight points of the compass, clockwise from north.
+var compassPoints = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// CompassPoint returns the point of the compass closest to an azimuth in degrees.
+func CompassPoint(azimuth float64) string {
+	i := int(math.Round(math.Mod(azimuth+360, 360)/45)) % len(compassPoints)
+	return compassPoints[i]
+}
+
+// LookDirection tells an observer at the site where to look for the aircraft, e.g. "look NE, 32° up".
+func (f *FlightInfo) LookDirection() string {
+	elevation := math.Round(f.Elevation)
+	if elevation < 0 {
+		return fmt.Sprintf("look %s, below the horizon", CompassPoint(f.Azimuth))
+	}
+	if elevation >= 85 {
+		return "look straight up"
+	}
+	return fmt.Sprintf("look %s, %.0f° up", CompassPoint(f.Azimuth), elevation)
+}
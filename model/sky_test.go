@@ -0,0 +1,20 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompassPoint(t *testing.T) {
+	for azimuth, expected := range map[float64]string{0: "N", 22: "N", 23: "NE", 45: "NE", 180: "S", 292.5: "NW", 337: "NW", 338: "N", 359: "N", -90: "W"} {
+		assert.Equal(t, expected, CompassPoint(azimuth), azimuth)
+	}
+}
+
+func TestLookDirection(t *testing.T) {
+	assert.Equal(t, "look NE, 32° up", (&FlightInfo{Azimuth: 44, Elevation: 31.6}).LookDirection())
+	assert.Equal(t, "look straight up", (&FlightInfo{Azimuth: 200, Elevation: 87}).LookDirection())
+	assert.Equal(t, "look W, 0° up", (&FlightInfo{Azimuth: 270, Elevation: 0.2}).LookDirection())
+	assert.Equal(t, "look E, below the horizon", (&FlightInfo{Azimuth: 90, Elevation: -1}).LookDirection())
+}
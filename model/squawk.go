@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// SquawkAlert is an aircraft flagged over a site by its squawk code or SPI, from the first to the last
+// state vector it was flagged in. The severity and squawk are the ones of the first, raising the alert, and the
+// callsign the first one known.
+// Aircraft without callsign are flagged too.
+type SquawkAlert struct {
+	ID        int64     `json:"id"`
+	Site      string    `json:"site"`
+	Icao24    string    `json:"icao24"`
+	Callsign  string    `json:"callsign"`
+	Kind      string    `json:"kind"` // emergency, hijack, radio_failure, spi or the name of a squawk range
+	Severity  string    `json:"severity"`
+	Squawk    string    `json:"squawk"`
+	State     Flight    `json:"state"`      // the state vector raising the alert
+	LastState Flight    `json:"last_state"` // the last flagged state vector
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
@@ -6,3 +6,10 @@ type AirportStat struct {
 	City  string
 	Count int
 }
+
+// FilterStat represents how many distinct aircraft a traffic filter rejected.
+type FilterStat struct {
+	Name  string
+	Today int
+	Total int
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+)
+
+// FlightSummary is the JSON representation of a logged flight, as served by /last-flight.
+type FlightSummary struct {
+	Flight              string    `json:"flight"`
+	Operator            string    `json:"operator"`
+	DestinationCity     string    `json:"destination_city"`
+	DestinationCodeIata string    `json:"destination_code_iata"`
+	DestinationCodeIcao string    `json:"destination_code_icao"`
+	SourceCity          string    `json:"source_city"`
+	SourceCodeIata      string    `json:"source_code_iata"`
+	SourceCodeIcao      string    `json:"source_code_icao"`
+	LastTimeSeen        time.Time `json:"last_time_seen"`
+	LastSeenAgo         string    `json:"last_seen_ago"`
+	AirplaneModel       string    `json:"airplane_model"`
+	Distance            float64   `json:"distance_m"` // Reverted to float64
+	Azimuth             float64   `json:"azimuth"`
+	Elevation           float64   `json:"elevation"`
+	SlantRange          float64   `json:"slant_range_m"`
+	Look                string    `json:"look"`
+	CO2KG               float64   `json:"co2_kg"` // Reverted to float64
+	Site                string    `json:"site,omitempty"`
+	Icao24              string    `json:"icao24"`
+	BaroAltitude        float64   `json:"baro_altitude"`
+	GeoAltitude         float64   `json:"geo_altitude"`
+	Velocity            float64   `json:"velocity"`
+	TrueTrack           float64   `json:"true_track"`
+	VerticalRate        float64   `json:"vertical_rate"`
+	Squawk              string    `json:"squawk"`
+	OnGround            bool      `json:"on_ground"`
+	FirstSeen           []string  `json:"first_seen,omitempty"` // kinds of the attributes first seen with this flight
+	Rarity              float64   `json:"rarity,omitempty"`     // 0 to 100, see Rarity.Score
+}
+
+// NewFlightSummary summarizes a flight last seen at lastSeen.
+func NewFlightSummary(flight *FlightInfo, operator *OperatorInfo, lastSeen time.Time) FlightSummary {
+	return FlightSummary{
+		Flight:              flight.Ident,
+		Operator:            operator.Shortname,
+		DestinationCity:     flight.Destination.City,
+		DestinationCodeIata: flight.Destination.CodeIata,
+		DestinationCodeIcao: flight.Destination.CodeIcao,
+		SourceCity:          flight.Origin.City,
+		SourceCodeIata:      flight.Origin.CodeIata,
+		SourceCodeIcao:      flight.Origin.CodeIcao,
+		LastTimeSeen:        lastSeen,
+		LastSeenAgo:         TimeAgo(lastSeen),
+		AirplaneModel:       flight.AircraftType,
+		Distance:            flight.Distance, // Assign raw float64
+		Azimuth:             flight.Azimuth,
+		Elevation:           flight.Elevation,
+		SlantRange:          flight.SlantRange,
+		Look:                flight.LookDirection(),
+		CO2KG:               flight.CO2KG, // Assign raw float64
+		Site:                flight.Site,
+		Icao24:              flight.Icao24,
+		BaroAltitude:        flight.BaroAltitude,
+		GeoAltitude:         flight.GeoAltitude,
+		Velocity:            flight.Velocity,
+		TrueTrack:           flight.TrueTrack,
+		VerticalRate:        flight.VerticalRate,
+		Squawk:              flight.Squawk,
+		OnGround:            flight.OnGround,
+	}
+}
+
+// TimeAgo returns a human-readable string indicating how long ago a time was.
+func TimeAgo(t time.Time) string {
+	d := time.Since(t).Truncate(time.Minute)
+	if d < time.Minute {
+		return "just now"
+	}
+	s := durafmt.Parse(d).LimitFirstN(2).String()
+	parts := strings.Split(s, " ")
+	if len(parts) == 4 {
+		return fmt.Sprintf("%s %s and %s %s ago", parts[0], parts[1], parts[2], parts[3])
+	}
+	return s + " ago"
+}
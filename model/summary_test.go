@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeAgo(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		t        time.Time
+		expected string
+	}{
+		{
+			name:     "Just now",
+			t:        now.Add(-30 * time.Second),
+			expected: "just now",
+		},
+		{
+			name:     "1 minute ago",
+			t:        now.Add(-1 * time.Minute),
+			expected: "1 minute ago",
+		},
+		{
+			name:     "1 minute 30 seconds ago",
+			t:        now.Add(-1*time.Minute - 30*time.Second),
+			expected: "1 minute ago",
+		},
+		{
+			name:     "1 hour 1 minute ago",
+			t:        now.Add(-1*time.Hour - 1*time.Minute),
+			expected: "1 hour and 1 minute ago",
+		},
+		{
+			name:     "1 hour 1 minute 30 seconds ago",
+			t:        now.Add(-1*time.Hour - 1*time.Minute - 30*time.Second),
+			expected: "1 hour and 1 minute ago",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := TimeAgo(tt.t)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// The bodies an aircraft can transit.
+const (
+	BodySun  = "sun"
+	BodyMoon = "moon"
+)
+
+// Transit is a predicted crossing, or near crossing, of the disk of the sun or the moon by an aircraft,
+// as seen from a site. The prediction extrapolates the last state vector of the aircraft.
+type Transit struct {
+	Site       string    `json:"site"`
+	Icao24     string    `json:"icao24"`
+	Callsign   string    `json:"callsign"`
+	Body       string    `json:"body"`
+	Time       time.Time `json:"time"`              // of the closest approach to the center of the disk
+	Separation float64   `json:"separation_arcmin"` // from the center of the disk at that time
+	BodyRadius float64   `json:"body_radius_arcmin"`
+	Duration   float64   `json:"duration_s"` // across the disk, 0 when the aircraft misses it
+	Azimuth    float64   `json:"azimuth"`
+	Elevation  float64   `json:"elevation"`
+	SlantRange float64   `json:"slant_range_m"` // of the aircraft
+	// ShiftDistance and ShiftBearing move the observer on the ground to see the aircraft cross the center of the disk.
+	ShiftDistance float64 `json:"shift_m"`
+	ShiftBearing  float64 `json:"shift_bearing"`
+}
+
+// Full reports whether the aircraft crosses the disk, rather than passing next to it.
+func (t *Transit) Full() bool {
+	return t.Separation <= t.BodyRadius
+}
+
+// ShiftHint tells the observer where to move to see the aircraft cross the center of the disk, e.g. "move 250 m SW".
+func (t *Transit) ShiftHint() string {
+	switch {
+	case t.ShiftDistance < 10:
+		return "stay where you are"
+	case t.ShiftDistance < 1000:
+		return fmt.Sprintf("move %.0f m %s", t.ShiftDistance, CompassPoint(t.ShiftBearing))
+	default:
+		return fmt.Sprintf("move %.1f km %s", t.ShiftDistance/1000, CompassPoint(t.ShiftBearing))
+	}
+}
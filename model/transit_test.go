@@ -0,0 +1,18 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransit_Full(t *testing.T) {
+	assert.True(t, (&Transit{Separation: 12, BodyRadius: 15.8}).Full())
+	assert.False(t, (&Transit{Separation: 16, BodyRadius: 15.8}).Full())
+}
+
+func TestTransit_ShiftHint(t *testing.T) {
+	assert.Equal(t, "stay where you are", (&Transit{ShiftDistance: 4, ShiftBearing: 90}).ShiftHint())
+	assert.Equal(t, "move 250 m SW", (&Transit{ShiftDistance: 250.4, ShiftBearing: 230}).ShiftHint())
+	assert.Equal(t, "move 1.5 km N", (&Transit{ShiftDistance: 1480, ShiftBearing: 355}).ShiftHint())
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is a rendered webhook request queued for delivery.
+type WebhookDelivery struct {
+	ID          int64      `json:"id"`
+	Webhook     string     `json:"webhook"`
+	EventType   string     `json:"event_type"`
+	Body        string     `json:"body"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	LastError   string     `json:"last_error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,382 @@
+package mqtt
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	online         = "online"
+	offline        = "offline"
+	publishTimeout = 10 * time.Second
+	// refreshInterval is how often the flights of today are recounted, so the count resets at midnight.
+	refreshInterval = time.Minute
+)
+
+var invalidID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Store is the storage the publisher reads: the flights and their operators, and the sightings counted.
+type Store interface {
+	storage.Flights
+	storage.Operators
+	storage.Sightings
+}
+
+// Publisher publishes, for each site, the aircraft overhead, the last flight and the number of flights
+// of today as retained JSON topics, with the Home Assistant MQTT discovery configs of matching sensors.
+//
+// The availability topic is "online" while connected and set to "offline" by the broker, as last will,
+// when the connection is lost. Everything is published again after each reconnection.
+type Publisher struct {
+	cfg      config.MQTTConfig
+	db       Store
+	sites    []string
+	location *time.Location
+	client   paho.Client
+
+	mu       sync.Mutex
+	overhead map[string]map[string]overheadFlight // by site, then by aircraft
+	retained map[string][]byte                    // last payload of each state topic
+}
+
+type overheadFlight struct {
+	flight model.FlightInfo
+	seen   time.Time
+}
+
+// overheadState is the payload of the overhead topic.
+type overheadState struct {
+	Count   int                   `json:"count"`
+	Flights []model.FlightSummary `json:"flights"`
+}
+
+// todayState is the payload of the today topic.
+type todayState struct {
+	Count int       `json:"count"`
+	Since time.Time `json:"since"`
+}
+
+// alertState is the payload of the alert topic.
+type alertState struct {
+	Rule     string               `json:"rule"`
+	Severity string               `json:"severity"`
+	Time     time.Time            `json:"time"`
+	Flight   *model.FlightSummary `json:"flight,omitempty"`
+}
+
+// discovery is a Home Assistant MQTT discovery config of a sensor.
+type discovery struct {
+	Name                string `json:"name"`
+	UniqueID            string `json:"unique_id"`
+	StateTopic          string `json:"state_topic"`
+	ValueTemplate       string `json:"value_template"`
+	JSONAttributesTopic string `json:"json_attributes_topic"`
+	AvailabilityTopic   string `json:"availability_topic"`
+	UnitOfMeasurement   string `json:"unit_of_measurement,omitempty"`
+	Icon                string `json:"icon"`
+	Device              device `json:"device"`
+}
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// New creates a Publisher for the watched sites of cfg.
+func New(cfg *config.Config, db Store) *Publisher {
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Printf("failed to load location %s: %v. Falling back to Local", cfg.Timezone, err)
+		loc = time.Local
+	}
+
+	p := &Publisher{
+		cfg:      cfg.MQTT,
+		db:       db,
+		location: loc,
+		overhead: make(map[string]map[string]overheadFlight),
+		retained: make(map[string][]byte),
+	}
+	for _, site := range cfg.WatchSites() {
+		p.sites = append(p.sites, site.Name)
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(p.cfg.Broker).
+		SetClientID(p.cfg.ClientID).
+		SetUsername(p.cfg.Username).
+		SetPassword(p.cfg.Password).
+		SetWill(p.availabilityTopic(), offline, 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(func(paho.Client) { p.publishAll() }).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("MQTT connection lost, reconnecting: %v", err)
+		})
+	p.client = paho.NewClient(opts)
+	return p
+}
+
+// Run connects to the broker and publishes the state of the sites, updated with the received events,
+// until ctx is canceled. It then marks the publisher offline and disconnects.
+func (p *Publisher) Run(ctx context.Context, received <-chan events.Event) error {
+	for _, site := range p.sites {
+		p.refresh(site)
+	}
+	// With ConnectRetry the connection is retried in the background and publishAll runs once connected
+	p.client.Connect()
+	defer p.disconnect()
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-received:
+			if !ok {
+				return nil
+			}
+			p.handle(e)
+		case <-ticker.C:
+			for _, site := range p.sites {
+				p.refreshToday(site)
+			}
+		}
+	}
+}
+
+// handle updates the overhead aircraft of the event site, and the last flight and
+// flights of today when a new aircraft enters it.
+func (p *Publisher) handle(e events.Event) {
+	if e.Flight == nil || !slices.Contains(p.sites, e.Site) {
+		return
+	}
+	key := e.Flight.Icao24 + "/" + e.Flight.Ident
+
+	p.mu.Lock()
+	overhead := p.overhead[e.Site]
+	if overhead == nil {
+		overhead = make(map[string]overheadFlight)
+		p.overhead[e.Site] = overhead
+	}
+	_, tracked := overhead[key]
+	switch e.Type {
+	case events.AircraftEntered:
+		overhead[key] = overheadFlight{flight: *e.Flight, seen: e.Time}
+	case events.EnrichmentCompleted, events.ClosestApproach:
+		if tracked {
+			overhead[key] = overheadFlight{flight: *e.Flight, seen: e.Time}
+		}
+	case events.AircraftLeft:
+		delete(overhead, key)
+	}
+	p.mu.Unlock()
+
+	p.publishOverhead(e.Site)
+	if e.Type == events.AircraftEntered {
+		p.refresh(e.Site)
+	}
+}
+
+// refresh publishes the last flight and the flights of today of a site, as stored in the database.
+func (p *Publisher) refresh(site string) {
+	p.refreshToday(site)
+
+	flight, lastSeen, err := p.db.GetLatestFlight(site)
+	if err != nil {
+		log.Printf("Error getting the last flight of site %s: %v", site, err)
+		return
+	}
+	if flight == nil {
+		return
+	}
+	operator, err := p.db.GetOperatorInfo(flight.OperatorIcao)
+	if err != nil {
+		log.Printf("Error getting operator %s: %v", flight.OperatorIcao, err)
+		return
+	}
+	p.publishState(p.stateTopic(site, "last_flight"), model.NewFlightSummary(flight, operator, lastSeen))
+}
+
+func (p *Publisher) refreshToday(site string) {
+	y, m, d := time.Now().In(p.location).Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, p.location)
+	// Sightings are stored in local time and compared as text
+	count, err := p.db.GetSightingCountSince(midnight.In(time.Local), site)
+	if err != nil {
+		log.Printf("Error counting the flights of today of site %s: %v", site, err)
+		return
+	}
+	p.publishState(p.stateTopic(site, "today"), todayState{Count: count, Since: midnight})
+}
+
+func (p *Publisher) publishOverhead(site string) {
+	p.mu.Lock()
+	flights := make([]overheadFlight, 0, len(p.overhead[site]))
+	for _, f := range p.overhead[site] {
+		flights = append(flights, f)
+	}
+	p.mu.Unlock()
+	slices.SortFunc(flights, func(a, b overheadFlight) int {
+		return cmp.Compare(a.flight.Distance, b.flight.Distance)
+	})
+
+	state := overheadState{Count: len(flights), Flights: []model.FlightSummary{}}
+	for _, f := range flights {
+		operator, err := p.db.GetOperatorInfo(f.flight.OperatorIcao)
+		if err != nil {
+			log.Printf("Error getting operator %s: %v", f.flight.OperatorIcao, err)
+			operator = &model.OperatorInfo{Shortname: "N/A"}
+		}
+		state.Flights = append(state.Flights, model.NewFlightSummary(&f.flight, operator, f.seen))
+	}
+	p.publishState(p.stateTopic(site, "overhead"), state)
+}
+
+// Alert publishes, not retained, a RuleMatched event on the alert topic of its site.
+func (p *Publisher) Alert(e events.Event) error {
+	if !p.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to %s", p.cfg.Broker)
+	}
+	state := alertState{Rule: e.Rule, Severity: e.Severity, Time: e.Time}
+	if e.Flight != nil {
+		operator, err := p.db.GetOperatorInfo(e.Flight.OperatorIcao)
+		if err != nil {
+			return err
+		}
+		summary := model.NewFlightSummary(e.Flight, operator, e.Time)
+		state.Flight = &summary
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	token := p.client.Publish(p.stateTopic(e.Site, "alert"), 1, false, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timeout publishing alert")
+	}
+	return token.Error()
+}
+
+// publishState publishes a state as retained JSON, unless it did not change.
+func (p *Publisher) publishState(topic string, state interface{}) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Error marshalling %s: %v", topic, err)
+		return
+	}
+
+	p.mu.Lock()
+	unchanged := string(p.retained[topic]) == string(payload)
+	p.retained[topic] = payload
+	p.mu.Unlock()
+
+	if !unchanged && p.client.IsConnectionOpen() {
+		p.publish(topic, payload)
+	}
+}
+
+// publishAll publishes the availability, the discovery configs and the last state of every topic.
+func (p *Publisher) publishAll() {
+	log.Printf("Connected to MQTT broker %s", p.cfg.Broker)
+	for _, site := range p.sites {
+		for _, sensor := range p.discoveryConfigs(site) {
+			payload, err := json.Marshal(sensor)
+			if err != nil {
+				log.Printf("Error marshalling discovery config %s: %v", sensor.UniqueID, err)
+				continue
+			}
+			p.publish(p.discoveryTopic(sensor.UniqueID), payload)
+		}
+	}
+
+	p.mu.Lock()
+	retained := make(map[string][]byte, len(p.retained))
+	for topic, payload := range p.retained {
+		retained[topic] = payload
+	}
+	p.mu.Unlock()
+	for topic, payload := range retained {
+		p.publish(topic, payload)
+	}
+
+	p.publish(p.availabilityTopic(), []byte(online))
+}
+
+func (p *Publisher) publish(topic string, payload []byte) {
+	token := p.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		log.Printf("Timeout publishing %s", topic)
+	} else if err := token.Error(); err != nil {
+		log.Printf("Error publishing %s: %v", topic, err)
+	}
+}
+
+// disconnect marks the publisher offline and disconnects from the broker.
+func (p *Publisher) disconnect() {
+	if p.client.IsConnectionOpen() {
+		p.publish(p.availabilityTopic(), []byte(offline))
+	}
+	p.client.Disconnect(250)
+}
+
+// discoveryConfigs returns the configs of the sensors of a site.
+func (p *Publisher) discoveryConfigs(site string) []discovery {
+	dev := device{
+		Identifiers:  []string{"sopra_" + objectID(site)},
+		Name:         fmt.Sprintf("Sopra %s", site),
+		Manufacturer: "sopra",
+	}
+	sensor := func(object, name, template, unit, icon string) discovery {
+		topic := p.stateTopic(site, object)
+		return discovery{
+			Name:                name,
+			UniqueID:            fmt.Sprintf("sopra_%s_%s", objectID(site), object),
+			StateTopic:          topic,
+			ValueTemplate:       template,
+			JSONAttributesTopic: topic,
+			AvailabilityTopic:   p.availabilityTopic(),
+			UnitOfMeasurement:   unit,
+			Icon:                icon,
+			Device:              dev,
+		}
+	}
+	return []discovery{
+		sensor("overhead", "Aircraft overhead", "{{ value_json.count }}", "aircraft", "mdi:airplane"),
+		sensor("last_flight", "Last flight", "{{ value_json.flight }}", "", "mdi:airplane-clock"),
+		sensor("today", "Flights today", "{{ value_json.count }}", "flights", "mdi:counter"),
+	}
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.cfg.TopicPrefix + "/status"
+}
+
+func (p *Publisher) stateTopic(site, object string) string {
+	return fmt.Sprintf("%s/%s/%s", p.cfg.TopicPrefix, objectID(site), object)
+}
+
+func (p *Publisher) discoveryTopic(uniqueID string) string {
+	return fmt.Sprintf("%s/sensor/%s/config", p.cfg.DiscoveryPrefix, uniqueID)
+}
+
+// objectID replaces the characters not allowed in topics and Home Assistant IDs.
+func objectID(name string) string {
+	return invalidID.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,270 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/memory"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// broker is a minimal MQTT 3.1.1 broker stand-in keeping the retained messages and the last will.
+type broker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	retained map[string]string
+	history  map[string][]string // every message of each topic
+	will     [2]string           // topic, message
+}
+
+func newBroker(t *testing.T) *broker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	b := &broker{listener: listener, retained: make(map[string]string), history: make(map[string][]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		b.dropConnections()
+	})
+	return b
+}
+
+func (b *broker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// dropConnections closes the client connections without a DISCONNECT, publishing their last will.
+func (b *broker) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *broker) get(topic string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return payload, ok
+}
+
+func (b *broker) messages(topic string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.history[topic]...)
+}
+
+func (b *broker) serve(conn net.Conn) {
+	graceful := false
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !graceful && b.will[0] != "" {
+			b.retained[b.will[0]] = b.will[1]
+			b.history[b.will[0]] = append(b.history[b.will[0]], b.will[1])
+		}
+	}()
+
+	for {
+		header := make([]byte, 1)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			digit := make([]byte, 1)
+			if _, err := io.ReadFull(conn, digit); err != nil {
+				return
+			}
+			length += int(digit[0]&127) * multiplier
+			multiplier *= 128
+			if digit[0]&128 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		switch header[0] >> 4 {
+		case 1: // CONNECT
+			b.connect(body)
+			_, _ = conn.Write([]byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			qos := header[0] >> 1 & 3
+			topicLen := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+topicLen])
+			rest := body[2+topicLen:]
+			if qos > 0 {
+				_, _ = conn.Write([]byte{0x40, 2, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			b.mu.Lock()
+			if header[0]&1 == 1 {
+				b.retained[topic] = string(rest)
+			}
+			b.history[topic] = append(b.history[topic], string(rest))
+			b.mu.Unlock()
+		case 12: // PINGREQ
+			_, _ = conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			graceful = true
+			return
+		}
+	}
+}
+
+// connect records the last will of a CONNECT packet.
+func (b *broker) connect(body []byte) {
+	readString := func() string {
+		n := int(binary.BigEndian.Uint16(body))
+		s := string(body[2 : 2+n])
+		body = body[2+n:]
+		return s
+	}
+	readString() // protocol name
+	flags := body[1]
+	body = body[4:] // level, flags, keep alive
+	readString()    // client ID
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if flags&0x04 != 0 {
+		b.will[0] = readString()
+		b.will[1] = readString()
+	}
+}
+
+func newTestDB(t *testing.T) *memory.Store {
+	t.Helper()
+	return memory.New()
+}
+
+func TestPublisher(t *testing.T) {
+	b := newBroker(t)
+	db := newTestDB(t)
+	assert.NoError(t, db.ClearFlightLog())
+
+	cfg := &config.Config{
+		Timezone: "UTC",
+		Sites:    []config.SiteConfig{{Name: "home office"}},
+		MQTT: config.MQTTConfig{
+			Broker:          b.url(),
+			ClientID:        "sopra-test",
+			TopicPrefix:     "sopra",
+			DiscoveryPrefix: "homeassistant",
+		},
+	}
+	publisher := New(cfg, db)
+
+	bus := events.NewBus(0)
+	sub := bus.Subscribe(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- publisher.Run(ctx, sub.C) }()
+
+	waitFor := func(topic string, check func(payload string) bool) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			payload, ok := b.get(topic)
+			return ok && check(payload)
+		}, 5*time.Second, 10*time.Millisecond, "topic %s", topic)
+	}
+	is := func(expected string) func(string) bool {
+		return func(payload string) bool { return payload == expected }
+	}
+
+	waitFor("sopra/status", is("online"))
+	discoveryPayload, ok := b.get("homeassistant/sensor/sopra_home_office_overhead/config")
+	assert.True(t, ok)
+	var sensor discovery
+	assert.NoError(t, json.Unmarshal([]byte(discoveryPayload), &sensor))
+	assert.Equal(t, "sopra/home_office/overhead", sensor.StateTopic)
+	assert.Equal(t, "sopra/status", sensor.AvailabilityTopic)
+	assert.Equal(t, "{{ value_json.count }}", sensor.ValueTemplate)
+	_, ok = b.get("homeassistant/sensor/sopra_home_office_last_flight/config")
+	assert.True(t, ok)
+	_, ok = b.get("homeassistant/sensor/sopra_home_office_today/config")
+	assert.True(t, ok)
+	waitFor("sopra/home_office/today", func(p string) bool { return countOf(p) == 0 })
+
+	// An aircraft entering the site is overhead, and is the last flight of today
+	flight := &model.FlightInfo{Ident: "SWR123", Icao24: "4b1805", Site: "home office", Distance: 1200}
+	assert.NoError(t, db.LogFlight(flight.Ident, flight))
+	_, err := db.RecordSighting(model.Observation{Site: "home office", Icao24: "4b1805", Callsign: "SWR123", Time: time.Now()}, time.Minute)
+	assert.NoError(t, err)
+	bus.Publish(events.Event{Type: events.AircraftEntered, Site: "home office", Flight: flight})
+
+	waitFor("sopra/home_office/overhead", func(p string) bool { return countOf(p) == 1 })
+	payload, _ := b.get("sopra/home_office/overhead")
+	var overhead overheadState
+	assert.NoError(t, json.Unmarshal([]byte(payload), &overhead))
+	assert.Equal(t, "SWR123", overhead.Flights[0].Flight)
+	waitFor("sopra/home_office/last_flight", func(p string) bool {
+		var last model.FlightSummary
+		return json.Unmarshal([]byte(p), &last) == nil && last.Flight == "SWR123" && last.Icao24 == "4b1805"
+	})
+	waitFor("sopra/home_office/today", func(p string) bool { return countOf(p) == 1 })
+
+	// The last will marks the publisher offline, and everything is published again once reconnected
+	b.mu.Lock()
+	assert.Equal(t, [2]string{"sopra/status", "offline"}, b.will)
+	b.retained = make(map[string]string)
+	b.history = make(map[string][]string)
+	b.mu.Unlock()
+	b.dropConnections()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"offline", "online"}, b.messages("sopra/status"))
+	}, 5*time.Second, 10*time.Millisecond)
+	waitFor("sopra/home_office/overhead", func(p string) bool { return countOf(p) == 1 })
+	_, ok = b.get("homeassistant/sensor/sopra_home_office_overhead/config")
+	assert.True(t, ok)
+
+	bus.Publish(events.Event{Type: events.AircraftLeft, Site: "home office", Flight: flight})
+	waitFor("sopra/home_office/overhead", func(p string) bool { return countOf(p) == 0 })
+
+	cancel()
+	assert.NoError(t, <-done)
+	status, _ := b.get("sopra/status")
+	assert.Equal(t, "offline", status)
+}
+
+// countOf returns the count of an overhead or today payload, or -1.
+func countOf(payload string) int {
+	var state struct {
+		Count *int `json:"count"`
+	}
+	if json.Unmarshal([]byte(payload), &state) != nil || state.Count == nil {
+		return -1
+	}
+	return *state.Count
+}
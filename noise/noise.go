@@ -0,0 +1,204 @@
+// Package noise estimates how loud an overflight is on the ground, from the aircraft type and its closest approach.
+//
+// It is a screening model, not a certified one: each aircraft type belongs to a class with reference
+// A-weighted maximum levels at 305 m (1000 ft), for climbing and for level or descending flight, in the
+// range of published noise-power-distance data. The level is scaled to the slant distance with spherical
+// spreading, a constant atmospheric absorption and the lateral attenuation of SAE AIR 5662 at low elevations.
+package noise
+
+import (
+	"bytes"
+	"cmp"
+	_ "embed"
+	"encoding/csv"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// Aircraft classes, from the loudest.
+const (
+	ClassHeavy      = "heavy"      // four engine widebodies and large freighters
+	ClassWidebody   = "widebody"   // twin engine widebodies
+	ClassNarrowbody = "narrowbody" // also the class of the unknown types, the most common overhead
+	ClassRegional   = "regional"   // regional jets
+	ClassBusiness   = "business"   // business jets
+	ClassTurboprop  = "turboprop"
+	ClassPiston     = "piston"
+	ClassHelicopter = "helicopter"
+)
+
+// reference is the A-weighted maximum level of a class at referenceDistance, dB(A).
+type reference struct {
+	climb, level float64
+}
+
+var references = map[string]reference{
+	ClassHeavy:      {climb: 99, level: 93},
+	ClassWidebody:   {climb: 96, level: 91},
+	ClassNarrowbody: {climb: 92, level: 88},
+	ClassRegional:   {climb: 88, level: 85},
+	ClassBusiness:   {climb: 86, level: 80},
+	ClassTurboprop:  {climb: 84, level: 79},
+	ClassPiston:     {climb: 76, level: 72},
+	ClassHelicopter: {climb: 86, level: 86},
+}
+
+const (
+	referenceDistance = 305.0 // meters, 1000 ft
+	absorption        = 2.0   // dB per km, effective for the A-weighted spectrum of a jet at 15 °C and 70% humidity
+	climbRate         = 2.5   // m/s, about 500 ft/min, above which an aircraft is climbing at take off thrust
+	minDistance       = 30.0  // meters, closer than this the point source model does not hold
+	defaultSpeed      = 70.0  // m/s, when the speed is unknown
+	// extrapolation is how far the path of an aircraft is extrapolated from a position report to find its closest approach.
+	extrapolation = 2 * time.Minute
+)
+
+//go:embed aircraft_types.csv
+var aircraftTypesCSV []byte
+
+// classes maps ICAO aircraft type designators to their class.
+var classes = loadClasses(aircraftTypesCSV)
+
+func loadClasses(data []byte) map[string]string {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		log.Fatalf("failed to read the aircraft types table: %v", err)
+	}
+	classes := make(map[string]string, len(records))
+	for _, record := range records[1:] {
+		if _, ok := references[record[1]]; !ok {
+			log.Fatalf("unknown noise class %q of aircraft type %s", record[1], record[0])
+		}
+		classes[record[0]] = record[1]
+	}
+	return classes
+}
+
+// ClassOf returns the class of an ICAO aircraft type designator, narrowbody when unknown.
+func ClassOf(aircraftType string) string {
+	if class, ok := classes[strings.ToUpper(strings.TrimSpace(aircraftType))]; ok {
+		return class
+	}
+	return ClassNarrowbody
+}
+
+// Estimate is the noise of an overflight at the observer.
+type Estimate struct {
+	Class    string
+	Level    float64 // peak A-weighted level, dB(A)
+	Exposure float64 // sound exposure level of the whole flyover, dB(A)
+	Distance float64 // slant distance of the closest approach, meters
+}
+
+// Peak estimates the noise at the observer, at obsLat, obsLon (degrees) and obsAlt (meters above sea level),
+// of an aircraft at its closest approach along its current path. Aircraft on the ground are not estimated.
+func Peak(obsLat, obsLon, obsAlt float64, flight *model.FlightInfo) (Estimate, bool) {
+	if flight.OnGround {
+		return Estimate{}, false
+	}
+
+	// The path in a flat frame around the observer, x east, y north, z up, in meters
+	distance := haversine.Distance(obsLat, obsLon, flight.Latitude, flight.Longitude) * 1000
+	bearing := haversine.Bearing(obsLat, obsLon, flight.Latitude, flight.Longitude) * math.Pi / 180
+	altitude := flight.GeoAltitude
+	if altitude == 0 {
+		altitude = flight.BaroAltitude
+	}
+	x, y, z := distance*math.Sin(bearing), distance*math.Cos(bearing), math.Max(altitude-obsAlt, 0)
+	track := flight.TrueTrack * math.Pi / 180
+	vx, vy, vz := flight.Velocity*math.Sin(track), flight.Velocity*math.Cos(track), flight.VerticalRate
+
+	// Closest approach within the extrapolation
+	if v2 := vx*vx + vy*vy + vz*vz; v2 > 0 {
+		limit := extrapolation.Seconds()
+		t := math.Max(-limit, math.Min(limit, -(x*vx+y*vy+z*vz)/v2))
+		x, y, z = x+vx*t, y+vy*t, math.Max(z+vz*t, 0)
+	}
+	slant := math.Max(math.Sqrt(x*x+y*y+z*z), minDistance)
+	elevation := math.Asin(z/slant) * 180 / math.Pi
+
+	class := ClassOf(flight.AircraftType)
+	ref := references[class].level
+	if flight.VerticalRate > climbRate {
+		ref = references[class].climb
+	}
+	level := ref -
+		20*math.Log10(slant/referenceDistance) -
+		absorption*(slant-referenceDistance)/1000 -
+		lateralAttenuation(elevation)
+
+	// A straight flyover at constant speed exposes for pi * distance / speed seconds at the peak level
+	speed := flight.Velocity
+	if speed <= 0 {
+		speed = defaultSpeed
+	}
+	exposure := level + 10*math.Log10(math.Pi*slant/speed)
+
+	return Estimate{Class: class, Level: round(level), Exposure: round(exposure), Distance: slant}, true
+}
+
+// lateralAttenuation is the extra attenuation, in dB, of the sound reaching the observer at a low elevation
+// angle in degrees, due to the ground, after SAE AIR 5662.
+func lateralAttenuation(elevation float64) float64 {
+	if elevation >= 50 {
+		return 0
+	}
+	return math.Max(1.137-0.0229*elevation+9.72*math.Exp(-0.142*elevation), 0)
+}
+
+// Evening and night hours, weighted 5 and 10 dB more in the Lden.
+const (
+	eveningStart = 19
+	nightStart   = 23
+	nightEnd     = 7
+)
+
+// Daily aggregates the noise of passes by the local day they started on, newest first: the number of passes,
+// the loudest and the Lden, the day-evening-night level of the day from the exposure of each pass, with
+// the passes in the evening 5 dB louder and the passes at night 10 dB louder. Passes without estimate are skipped.
+func Daily(sightings []*model.Sighting, loc *time.Location) []model.NoiseDay {
+	var days []model.NoiseDay
+	energy := make(map[string]float64)
+	index := make(map[string]int)
+	for _, s := range sightings {
+		if s.PeakNoise == 0 {
+			continue
+		}
+		start := s.FirstSeen.In(loc)
+		day := start.Format(time.DateOnly)
+		i, ok := index[day]
+		if !ok {
+			i = len(days)
+			index[day] = i
+			days = append(days, model.NoiseDay{Day: day})
+		}
+		days[i].Passes++
+		days[i].Loudest = math.Max(days[i].Loudest, s.PeakNoise)
+
+		penalty := 0.0
+		switch hour := start.Hour(); {
+		case hour >= nightStart || hour < nightEnd:
+			penalty = 10
+		case hour >= eveningStart:
+			penalty = 5
+		}
+		energy[day] += math.Pow(10, (s.NoiseExposure+penalty)/10)
+	}
+
+	for i := range days {
+		days[i].Lden = round(10 * math.Log10(energy[days[i].Day]/(24*time.Hour).Seconds()))
+	}
+	slices.SortFunc(days, func(a, b model.NoiseDay) int { return cmp.Compare(b.Day, a.Day) })
+	return days
+}
+
+// round rounds a level to a tenth of a decibel.
+func round(level float64) float64 {
+	return math.Round(level*10) / 10
+}
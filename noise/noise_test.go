@@ -0,0 +1,91 @@
+package noise
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassOf(t *testing.T) {
+	assert.Equal(t, ClassNarrowbody, ClassOf("A320"))
+	assert.Equal(t, ClassWidebody, ClassOf(" b77w "))
+	assert.Equal(t, ClassHeavy, ClassOf("A388"))
+	assert.Equal(t, ClassHelicopter, ClassOf("R44"))
+	assert.Equal(t, ClassNarrowbody, ClassOf("ZZZZ"), "unknown types")
+	assert.Equal(t, ClassNarrowbody, ClassOf(""))
+}
+
+func TestPeak(t *testing.T) {
+	lat, lon := 47.0, 8.0
+	at := func(distanceKm, bearing float64) (float64, float64) {
+		return haversine.Destination(lat, lon, bearing, distanceKm)
+	}
+
+	// Overhead at the reference distance, the reference level
+	estimate, ok := Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "A320", Latitude: lat, Longitude: lon, GeoAltitude: 705, Velocity: 80})
+	assert.True(t, ok)
+	assert.Equal(t, ClassNarrowbody, estimate.Class)
+	assert.Equal(t, 88.0, estimate.Level)
+	assert.Equal(t, 98.8, estimate.Exposure, "about 12 seconds at the peak level")
+	assert.InDelta(t, 305, estimate.Distance, 0.1)
+
+	// Climbing at take off thrust, a little closer a moment before
+	estimate, _ = Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "A320", Latitude: lat, Longitude: lon, GeoAltitude: 705, Velocity: 80, VerticalRate: 10})
+	assert.InDelta(t, 92.0, estimate.Level, 0.1)
+
+	// 2 km west flying east, the peak is overhead
+	flightLat, flightLon := at(2, 270)
+	estimate, _ = Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "A320", Latitude: flightLat, Longitude: flightLon, BaroAltitude: 705, Velocity: 100, TrueTrack: 90})
+	assert.Equal(t, 88.0, estimate.Level)
+
+	// 2 km west flying north, the peak is abeam at a low elevation
+	estimate, _ = Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "A320", Latitude: flightLat, Longitude: flightLon, BaroAltitude: 705, Velocity: 100})
+	slant := math.Hypot(2000, 305)
+	assert.InDelta(t, slant, estimate.Distance, 1)
+	assert.InDelta(t, 88-20*math.Log10(slant/305)-2*(slant-305)/1000-lateralAttenuation(8.67), estimate.Level, 0.1)
+
+	// The path is extrapolated for 2 minutes at most, 12 km of the 20 km to the closest approach
+	flightLat, flightLon = at(20, 270)
+	estimate, _ = Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "A320", Latitude: flightLat, Longitude: flightLon, BaroAltitude: 705, Velocity: 100, TrueTrack: 90})
+	assert.InDelta(t, 8000, estimate.Distance, 10)
+
+	// Louder classes are louder, on the ground nothing is estimated
+	heavy, _ := Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "B744", Latitude: lat, Longitude: lon, GeoAltitude: 3400, Velocity: 150})
+	light, _ := Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "C172", Latitude: lat, Longitude: lon, GeoAltitude: 3400, Velocity: 50})
+	assert.Greater(t, heavy.Level, light.Level+20)
+	_, ok = Peak(lat, lon, 400, &model.FlightInfo{AircraftType: "A320", Latitude: lat, Longitude: lon, OnGround: true})
+	assert.False(t, ok)
+}
+
+func TestLateralAttenuation(t *testing.T) {
+	assert.InDelta(t, 10.86, lateralAttenuation(0), 0.01)
+	assert.InDelta(t, 3.26, lateralAttenuation(10), 0.01)
+	assert.Zero(t, lateralAttenuation(50))
+	assert.Zero(t, lateralAttenuation(90))
+}
+
+func TestDaily(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	at := func(day, hour int) time.Time { return time.Date(2024, 6, day, hour, 30, 0, 0, loc) }
+	sightings := []*model.Sighting{
+		{FirstSeen: at(20, 10), PeakNoise: 70, NoiseExposure: 80},
+		{FirstSeen: at(20, 20), PeakNoise: 72, NoiseExposure: 80}, // evening
+		{FirstSeen: at(20, 23), PeakNoise: 65, NoiseExposure: 80}, // night
+		{FirstSeen: at(20, 12)},                                   // no estimate
+		{FirstSeen: at(21, 6), PeakNoise: 60, NoiseExposure: 75},  // night
+	}
+
+	days := Daily(sightings, loc)
+	assert.Len(t, days, 2)
+	assert.Equal(t, model.NoiseDay{Day: "2024-06-21", Passes: 1, Lden: 35.6, Loudest: 60}, days[0])
+	lden := 10 * math.Log10((math.Pow(10, 8)+math.Pow(10, 8.5)+math.Pow(10, 9))/86400)
+	assert.Equal(t, model.NoiseDay{Day: "2024-06-20", Passes: 3, Lden: math.Round(lden*10) / 10, Loudest: 72}, days[1])
+
+	// Days are local days
+	assert.Equal(t, "2024-06-20", Daily(sightings[4:], time.FixedZone("PDT", -7*3600))[0].Day)
+	assert.Empty(t, Daily(nil, loc))
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// copiedTables are the tables copied from SQLite, in an order where the referenced rows are copied first
+// but for flight and flight_leg, whose references are checked at the end of the copy.
+var copiedTables = []string{
+	"key_value_cache", "operator_log", "airport", "operator", "aircraft", "flight", "flight_leg", "codeshare",
+	"sighting", "filter_rejection", "webhook_delivery", "rule", "first_seen", "squawk_alert", "prediction",
+	"recurring_flight", "position", "maintenance_run",
+}
+
+// CopiedTable is how many rows of a table were copied.
+type CopiedTable struct {
+	Table string
+	Rows  int64
+}
+
+// Copy copies a SQLite database of sopra, migrated to its latest schema, into the Postgres database, which must be
+// empty, and returns how many rows of each table were copied. The rows keep their ids, and the latitude and the
+// longitude of the positions and the airports become their location. Nothing is copied when a table fails.
+func (c *DB) Copy(src *sql.DB) ([]CopiedTable, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range copiedTables {
+		var found bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM " + table + ")").Scan(&found); err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, fmt.Errorf("table %s is not empty, copy into an empty database", table)
+		}
+	}
+
+	var copied []CopiedTable
+	for _, table := range copiedTables {
+		rows, err := copyTable(tx, src, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+		copied = append(copied, CopiedTable{Table: table, Rows: rows})
+	}
+	return copied, tx.Commit()
+}
+
+// copyTable copies the rows of a table with COPY and moves the identity of the table past their ids.
+func copyTable(tx *sql.Tx, src *sql.DB, table string) (int64, error) {
+	rows, err := src.Query("SELECT * FROM " + table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	// The positions and the airports are points rather than a latitude and a longitude
+	latitude, longitude := -1, -1
+	target := columns
+	if table == "position" || table == "airport" {
+		latitude, longitude = slices.Index(columns, "latitude"), slices.Index(columns, "longitude")
+		if latitude < 0 || longitude < 0 {
+			return 0, fmt.Errorf("no latitude and longitude")
+		}
+		target = slices.DeleteFunc(slices.Clone(columns), func(column string) bool {
+			return column == "latitude" || column == "longitude"
+		})
+		target = append(target, "location")
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(table, target...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var copied int64
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		args := make([]any, 0, len(target))
+		for i, v := range values {
+			if i == latitude || i == longitude {
+				continue
+			}
+			if b, ok := v.([]byte); ok {
+				v = string(b) // text stored as blob
+			}
+			args = append(args, v)
+		}
+		if latitude >= 0 {
+			var point any // NULL for an airport not located
+			if values[latitude] != nil || values[longitude] != nil {
+				if point, err = ewkt(values[latitude], values[longitude]); err != nil {
+					return 0, err
+				}
+			}
+			args = append(args, point)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return 0, err
+		}
+		copied++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if _, err := stmt.Exec(); err != nil { // flushes the rows
+		return 0, err
+	}
+
+	if slices.Contains(columns, "id") {
+		_, err := tx.Exec("SELECT setval(pg_get_serial_sequence('" + table + "', 'id'), MAX(id)) FROM " + table)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return copied, nil
+}
+
+// ewkt returns the text of a geography point at a latitude and a longitude.
+func ewkt(latitude, longitude any) (string, error) {
+	lat, ok := latitude.(float64)
+	if !ok {
+		return "", fmt.Errorf("latitude %v is not a number", latitude)
+	}
+	lon, ok := longitude.(float64)
+	if !ok {
+		return "", fmt.Errorf("longitude %v is not a number", longitude)
+	}
+	return "SRID=4326;POINT(" + strconv.FormatFloat(lon, 'f', -1, 64) + " " + strconv.FormatFloat(lat, 'f', -1, 64) + ")", nil
+}
@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// RecordFilterRejection records that a traffic filter of a site rejected an aircraft.
+// Each aircraft is counted at most once per site, filter and day.
+func (c *DB) RecordFilterRejection(site, name, icao24 string, at time.Time) error {
+	_, err := c.db.Exec("INSERT INTO filter_rejection (site, name, day, icao24) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING", siteOrDefault(site), name, at.Format("2006-01-02"), icao24)
+	return err
+}
+
+// GetFilterStats retrieves the number of distinct aircraft rejected by each filter, today and overall,
+// optionally restricted to a site.
+func (c *DB) GetFilterStats(today time.Time, site string) ([]model.FilterStat, error) {
+	rows, err := c.db.Query(`
+		SELECT
+			name,
+			COUNT(DISTINCT icao24) FILTER (WHERE day = $1) AS today,
+			COUNT(DISTINCT (day, icao24)) AS total
+		FROM filter_rejection
+		WHERE $2 = '' OR site = $2
+		GROUP BY name
+		ORDER BY total DESC, name
+	`, today.Format("2006-01-02"), site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []model.FilterStat
+	for rows.Next() {
+		var s model.FilterStat
+		if err := rows.Scan(&s.Name, &s.Today, &s.Total); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const firstSeenColumns = "kind, value, first_seen, callsign, site, count"
+
+// RecordFirstSeen counts a pass of callsign over site showing the attribute values, by kind, and returns
+// the kinds, in the order of model.Kinds, whose value was seen for the first time.
+func (c *DB) RecordFirstSeen(attrs map[string]string, callsign, site string, at time.Time) ([]string, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var firsts []string
+	for _, kind := range model.Kinds {
+		value, ok := attrs[kind]
+		if !ok {
+			continue
+		}
+		var count int
+		err := tx.QueryRow(`
+			INSERT INTO first_seen (kind, value, first_seen, callsign, site, count) VALUES ($1, $2, $3, $4, $5, 1)
+			ON CONFLICT (kind, value) DO UPDATE SET count = first_seen.count + 1
+			RETURNING count`, kind, value, at, callsign, siteOrDefault(site)).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count == 1 {
+			firsts = append(firsts, kind)
+		}
+	}
+	return firsts, tx.Commit()
+}
+
+// GetFirstSeen returns the first sighting of every attribute value.
+func (c *DB) GetFirstSeen() ([]*model.FirstSeen, error) {
+	return c.queryFirstSeen("SELECT " + firstSeenColumns + " FROM first_seen")
+}
+
+// GetFirstSeenSince returns the attribute values seen for the first time since the given time, newest first,
+// optionally restricted to the ones first seen at a site.
+func (c *DB) GetFirstSeenSince(since time.Time, site string) ([]*model.FirstSeen, error) {
+	return c.queryFirstSeen("SELECT "+firstSeenColumns+" FROM first_seen WHERE first_seen >= $1 AND ($2 = '' OR site = $2) ORDER BY first_seen DESC, kind",
+		since, site)
+}
+
+func (c *DB) queryFirstSeen(query string, args ...interface{}) ([]*model.FirstSeen, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seen []*model.FirstSeen
+	for rows.Next() {
+		var s model.FirstSeen
+		if err := rows.Scan(&s.Kind, &s.Value, &s.Time, &s.Callsign, &s.Site, &s.Count); err != nil {
+			return nil, err
+		}
+		seen = append(seen, &s)
+	}
+	return seen, rows.Err()
+}
@@ -0,0 +1,375 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// legColumns are the columns of flight_leg holding the fields of a FlightInfo, in the order of legFields.
+var legColumns = []string{
+	"ident", "ident_icao", "ident_iata", "actual_runway_off", "actual_runway_on", "fa_flight_id", "flight_number", "atc_ident",
+	"inbound_fa_flight_id", "blocked", "diverted", "cancelled", "position_only", "departure_delay", "arrival_delay", "filed_ete",
+	"foresight_predictions_available", "scheduled_out", "estimated_out", "actual_out", "scheduled_off", "estimated_off",
+	"actual_off", "scheduled_on", "estimated_on", "actual_on", "scheduled_in", "estimated_in", "actual_in", "progress_percent",
+	"status", "route_distance", "filed_airspeed", "filed_altitude", "route", "baggage_claim", "seats_cabin_business",
+	"seats_cabin_coach", "seats_cabin_first", "gate_origin", "gate_destination", "terminal_origin", "terminal_destination",
+	"type", "site", "baro_altitude", "geo_altitude", "velocity", "true_track", "vertical_rate", "squawk", "on_ground",
+	"latitude", "longitude", "distance", "azimuth", "elevation", "slant_range", "co2_kg",
+}
+
+// legFields returns pointers to the fields of f stored in the legColumns, to write them as query arguments,
+// nil pointers being NULL, and to scan them.
+func legFields(f *model.FlightInfo) []any {
+	return []any{
+		&f.Ident, &f.IdentIcao, &f.IdentIata, &f.ActualRunwayOff, &f.ActualRunwayOn, &f.FaFlightID, &f.FlightNumber, &f.AtcIdent,
+		&f.InboundFaFlightID, &f.Blocked, &f.Diverted, &f.Cancelled, &f.PositionOnly, &f.DepartureDelay, &f.ArrivalDelay, &f.FiledEte,
+		&f.ForesightPredictionsAvailable, &f.ScheduledOut, &f.EstimatedOut, &f.ActualOut, &f.ScheduledOff, &f.EstimatedOff,
+		&f.ActualOff, &f.ScheduledOn, &f.EstimatedOn, &f.ActualOn, &f.ScheduledIn, &f.EstimatedIn, &f.ActualIn, &f.ProgressPercent,
+		&f.Status, &f.RouteDistance, &f.FiledAirspeed, &f.FiledAltitude, &f.Route, &f.BaggageClaim, &f.SeatsCabinBusiness,
+		&f.SeatsCabinCoach, &f.SeatsCabinFirst, &f.GateOrigin, &f.GateDestination, &f.TerminalOrigin, &f.TerminalDestination,
+		&f.Type, &f.Site, &f.BaroAltitude, &f.GeoAltitude, &f.Velocity, &f.TrueTrack, &f.VerticalRate, &f.Squawk, &f.OnGround,
+		&f.Latitude, &f.Longitude, &f.Distance, &f.Azimuth, &f.Elevation, &f.SlantRange, &f.CO2KG,
+	}
+}
+
+// placeholders returns n numbered parameters, from $first on.
+func placeholders(first, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return strings.Join(params, ", ")
+}
+
+// airportColumns are the columns of an airport joined as alias, empty when there is none.
+func airportColumns(alias string) string {
+	columns := make([]string, 0, 8)
+	for _, column := range []string{"code", "code_icao", "code_iata", "code_lid", "timezone", "name", "city", "airport_info_url"} {
+		if column == "code_lid" {
+			columns = append(columns, alias+"."+column)
+		} else {
+			columns = append(columns, "COALESCE("+alias+"."+column+", '')")
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+func airportFields(a *model.AirportDetail) []any {
+	return []any{&a.Code, &a.CodeIcao, &a.CodeIata, &a.CodeLid, &a.Timezone, &a.Name, &a.City, &a.AirportInfoURL}
+}
+
+// flightColumns select a FlightInfo from the flight f, its current leg l and what the leg refers to, joined by flightJoins.
+var flightColumns = "l." + strings.Join(legColumns, ", l.") + `,
+	COALESCE(o.code, ''), COALESCE(o.icao, ''), COALESCE(o.iata, ''),
+	COALESCE(a.icao24, ''), COALESCE(a.registration, ''), COALESCE(a.aircraft_type, ''),
+	` + airportColumns("origin") + `,
+	` + airportColumns("destination") + `,
+	(SELECT string_agg(ident, ',' ORDER BY position) FROM codeshare WHERE leg_id = l.id AND kind = 'icao'),
+	(SELECT string_agg(ident, ',' ORDER BY position) FROM codeshare WHERE leg_id = l.id AND kind = 'iata')`
+
+const flightJoins = `
+	JOIN flight_leg l ON l.id = f.leg_id
+	LEFT JOIN operator o ON o.id = l.operator_id
+	LEFT JOIN aircraft a ON a.id = l.aircraft_id
+	LEFT JOIN airport origin ON origin.id = l.origin_id
+	LEFT JOIN airport destination ON destination.id = l.destination_id`
+
+// scanFlight scans the flightColumns followed by the last seen time and the identification count.
+func scanFlight(row rowScanner) (*model.FlightInfo, time.Time, error) {
+	var f model.FlightInfo
+	var lastSeen time.Time
+	var codeshares, codesharesIata sql.NullString
+	dest := legFields(&f)
+	dest = append(dest, &f.Operator, &f.OperatorIcao, &f.OperatorIata, &f.Icao24, &f.Registration, &f.AircraftType)
+	dest = append(dest, airportFields(&f.Origin)...)
+	dest = append(dest, airportFields(&f.Destination)...)
+	dest = append(dest, &codeshares, &codesharesIata, &lastSeen, &f.IdentificationCount)
+	if err := row.Scan(dest...); err != nil {
+		return nil, time.Time{}, err
+	}
+	if codeshares.Valid {
+		f.Codeshares = strings.Split(codeshares.String, ",")
+	}
+	if codesharesIata.Valid {
+		f.CodesharesIata = strings.Split(codesharesIata.String, ",")
+	}
+	return &f, lastSeen, nil
+}
+
+// GetFlightCount returns the total number of flights in the cache.
+func (c *DB) GetFlightCount() (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM flight").Scan(&count)
+	return count, err
+}
+
+// GetFlight retrieves a cached FlightInfo by key.
+func (c *DB) GetFlight(key string) (*model.FlightInfo, time.Time, error) {
+	row := c.db.QueryRow("SELECT "+flightColumns+", f.last_seen, f.identification_count FROM flight f"+flightJoins+" WHERE f.ident = $1", key)
+	flightInfo, lastSeen, err := scanFlight(row)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, nil // Cache miss
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return flightInfo, lastSeen, nil
+}
+
+// flightLogQuery returns the query listing the logged flights newest first.
+// When site is not empty only the flights sighted there are listed, with their last sighting time at the site.
+func flightLogQuery(site string) (string, []interface{}) {
+	if site == "" {
+		return "SELECT " + flightColumns + ", f.last_seen, f.identification_count FROM flight f" + flightJoins + " ORDER BY f.last_seen DESC, l.ident", nil
+	}
+	return `
+		SELECT ` + flightColumns + `, s.last_seen, f.identification_count
+		FROM sighting s
+		JOIN flight f ON f.ident = s.callsign` + flightJoins + `
+		WHERE s.id IN (SELECT MAX(id) FROM sighting WHERE site = $1 GROUP BY callsign)
+		ORDER BY s.last_seen DESC, l.ident`, []interface{}{site}
+}
+
+// GetLast10Flights retrieves the last 10 logged FlightInfo, one per ident, optionally restricted to a site.
+func (c *DB) GetLast10Flights(site string) ([]*model.FlightInfo, []time.Time, error) {
+	if site != "" {
+		return c.GetAllFlights(10, site)
+	}
+	return c.queryFlights(`
+		SELECT ` + flightColumns + `, f.last_seen, f.identification_count
+		FROM flight f` + flightJoins + `
+		WHERE NOT EXISTS (
+			SELECT 1 FROM flight newer JOIN flight_leg nl ON nl.id = newer.leg_id
+			WHERE nl.ident = l.ident AND newer.last_seen > f.last_seen
+		)
+		ORDER BY f.last_seen DESC, l.ident
+		LIMIT 10
+	`)
+}
+
+// GetAllFlights retrieves the logged FlightInfo, optionally limited by the limit parameter
+// and restricted to the flights sighted at site.
+func (c *DB) GetAllFlights(limit int, site string) ([]*model.FlightInfo, []time.Time, error) {
+	query, args := flightLogQuery(site)
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return c.queryFlights(query, args...)
+}
+
+// queryFlights runs a query selecting the flightColumns, the last seen time and the identification count.
+func (c *DB) queryFlights(query string, args ...interface{}) ([]*model.FlightInfo, []time.Time, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var flights []*model.FlightInfo
+	var lastSeens []time.Time
+	for rows.Next() {
+		flightInfo, lastSeen, err := scanFlight(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		flights = append(flights, flightInfo)
+		lastSeens = append(lastSeens, lastSeen)
+	}
+	return flights, lastSeens, rows.Err()
+}
+
+// GetMostCommonFlights retrieves the 5 FlightInfo with the most sightings, optionally restricted to a site.
+// IdentificationCount is set to the number of sightings.
+func (c *DB) GetMostCommonFlights(site string) ([]*model.FlightInfo, error) {
+	flights, _, err := c.queryFlights(`
+		SELECT `+flightColumns+`, f.last_seen, common.sightings
+		FROM (
+			SELECT callsign, COUNT(*) AS sightings, MAX(last_seen) AS last_seen
+			FROM sighting
+			WHERE $1 = '' OR site = $1
+			GROUP BY callsign
+		) common
+		JOIN flight f ON f.ident = common.callsign`+flightJoins+`
+		ORDER BY common.sightings DESC, common.last_seen DESC
+		LIMIT 5
+	`, site)
+	return flights, err
+}
+
+// LogFlight stores a FlightInfo in the cache: the flight of the key, with its leg, the operator,
+// the aircraft and the airports it refers to.
+func (c *DB) LogFlight(key string, flightInfo *model.FlightInfo) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	operatorID, err := upsertReference(tx, `
+		INSERT INTO operator (code, icao, iata) VALUES ($1, $2, $3)
+		ON CONFLICT (code, icao, iata) DO UPDATE SET code = excluded.code
+		RETURNING id`, flightInfo.Operator, flightInfo.OperatorIcao, flightInfo.OperatorIata)
+	if err != nil {
+		return err
+	}
+	aircraftID, err := upsertReference(tx, `
+		INSERT INTO aircraft (icao24, registration, aircraft_type) VALUES ($1, $2, $3)
+		ON CONFLICT (icao24, registration, aircraft_type) DO UPDATE SET icao24 = excluded.icao24
+		RETURNING id`, flightInfo.Icao24, flightInfo.Registration, flightInfo.AircraftType)
+	if err != nil {
+		return err
+	}
+	originID, err := upsertAirport(tx, &flightInfo.Origin)
+	if err != nil {
+		return err
+	}
+	destinationID, err := upsertAirport(tx, &flightInfo.Destination)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	columns := append([]string{"flight_ident", "operator_id", "aircraft_id", "origin_id", "destination_id", "logged_at"}, legColumns...)
+	// A leg logged again keeps when it was first logged, the sightings it is exported with start from there
+	updates := make([]string, 0, len(columns))
+	for _, column := range columns[1:] {
+		if column != "logged_at" {
+			updates = append(updates, column+" = excluded."+column)
+		}
+	}
+	args := append([]any{key, operatorID, aircraftID, originID, destinationID, now}, legFields(flightInfo)...)
+	var legID int64
+	err = tx.QueryRow(`
+		INSERT INTO flight_leg (`+strings.Join(columns, ", ")+`) VALUES (`+placeholders(1, len(columns))+`)
+		ON CONFLICT (flight_ident, fa_flight_id) DO UPDATE SET `+strings.Join(updates, ", ")+`
+		RETURNING id`, args...).Scan(&legID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM codeshare WHERE leg_id = $1", legID); err != nil {
+		return err
+	}
+	for kind, idents := range map[string][]string{"icao": flightInfo.Codeshares, "iata": flightInfo.CodesharesIata} {
+		for i, ident := range idents {
+			if _, err := tx.Exec("INSERT INTO codeshare (leg_id, kind, position, ident) VALUES ($1, $2, $3, $4)", legID, kind, i, ident); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO flight (ident, leg_id, last_seen, identification_count) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (ident) DO UPDATE SET leg_id = excluded.leg_id, last_seen = excluded.last_seen,
+			identification_count = flight.identification_count + 1`,
+		key, legID, now)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Logged flight for key: %s\n", key)
+	return nil
+}
+
+// upsertReference runs an upsert returning the id of the row of the values, NULL when they are all empty.
+func upsertReference(tx *sql.Tx, query string, values ...string) (sql.NullInt64, error) {
+	if strings.Join(values, "") == "" {
+		return sql.NullInt64{}, nil
+	}
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	var id sql.NullInt64
+	err := tx.QueryRow(query, args...).Scan(&id)
+	return id, err
+}
+
+// upsertAirport stores the details of an airport and returns its id, NULL when it has no code.
+func upsertAirport(tx *sql.Tx, a *model.AirportDetail) (sql.NullInt64, error) {
+	if a.Code+a.CodeIcao+a.CodeIata == "" {
+		return sql.NullInt64{}, nil
+	}
+	var id sql.NullInt64
+	err := tx.QueryRow(`
+		INSERT INTO airport (code, code_icao, code_iata, code_lid, timezone, name, city, airport_info_url) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (code, code_icao, code_iata) DO UPDATE SET code_lid = excluded.code_lid, timezone = excluded.timezone,
+			name = excluded.name, city = excluded.city, airport_info_url = excluded.airport_info_url
+		RETURNING id`, airportFields(a)...).Scan(&id)
+	return id, err
+}
+
+// AirportLocated reports whether the airports of a code all have a location.
+func (c *DB) AirportLocated(code string) (bool, error) {
+	var located bool
+	err := c.db.QueryRow("SELECT NOT EXISTS (SELECT 1 FROM airport WHERE code = $1 AND location IS NULL)", code).Scan(&located)
+	return located, err
+}
+
+// SetAirportLocation stores the location of the airports of a code, a point at its latitude and longitude.
+func (c *DB) SetAirportLocation(code string, latitude, longitude float64) error {
+	_, err := c.db.Exec("UPDATE airport SET location = ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography WHERE code = $1", code, longitude, latitude)
+	return err
+}
+
+// GetLatestFlight retrieves the most recently logged FlightInfo, optionally restricted to a site.
+func (c *DB) GetLatestFlight(site string) (*model.FlightInfo, time.Time, error) {
+	flights, lastSeens, err := c.GetAllFlights(1, site)
+	if err != nil || len(flights) == 0 {
+		return nil, time.Time{}, err // No flights in cache
+	}
+	return flights[0], lastSeens[0], nil
+}
+
+// ClearFlightLog deletes all the logged flights, with their legs and what they refer to, the sightings and the first_seen records.
+func (c *DB) ClearFlightLog() error {
+	_, err := c.db.Exec("TRUNCATE first_seen, sighting, codeshare, flight_leg, flight, aircraft, operator, airport")
+	return err
+}
+
+// getTopAirports retrieves the top 10 origin, or destination, airports by number of sightings, optionally restricted to a site.
+func (c *DB) getTopAirports(destination bool, site string) ([]model.AirportStat, error) {
+	rows, err := c.db.Query(`
+		SELECT ap.code_iata, ap.city, COUNT(s.id) AS total_count
+		FROM sighting s
+		JOIN flight f ON f.ident = s.callsign
+		JOIN flight_leg l ON l.id = f.leg_id
+		JOIN airport ap ON ap.id = CASE WHEN $1 THEN l.destination_id ELSE l.origin_id END
+		WHERE ap.code_iata != '' AND ($2 = '' OR s.site = $2)
+		GROUP BY ap.code_iata, ap.city
+		ORDER BY total_count DESC, ap.code_iata, ap.city
+		LIMIT 10
+	`, destination, site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []model.AirportStat
+	for rows.Next() {
+		var s model.AirportStat
+		if err := rows.Scan(&s.Iata, &s.City, &s.Count); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// GetTopDestinations retrieves the top 10 destination airports by number of sightings, optionally restricted to a site.
+func (c *DB) GetTopDestinations(site string) ([]model.AirportStat, error) {
+	return c.getTopAirports(true, site)
+}
+
+// GetTopSources retrieves the top 10 source airports by number of sightings, optionally restricted to a site.
+func (c *DB) GetTopSources(site string) ([]model.AirportStat, error) {
+	return c.getTopAirports(false, site)
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// DeleteExpiredCache deletes the cache entries expired at the given time and returns how many were deleted.
+func (c *DB) DeleteExpiredCache(now time.Time) (int64, error) {
+	res, err := c.db.Exec("DELETE FROM key_value_cache WHERE expires_at < $1", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Optimize updates the statistics used by the query planner.
+func (c *DB) Optimize() error {
+	_, err := c.db.Exec("ANALYZE")
+	return err
+}
+
+// IncrementalVacuum makes the space of the deleted rows reusable. Postgres keeps it for the new rows rather than
+// returning it to the file system, so no pages are counted as freed.
+func (c *DB) IncrementalVacuum() (int64, error) {
+	_, err := c.db.Exec("VACUUM")
+	return 0, err
+}
+
+// Checkpoint copies nothing: the server checkpoints its write-ahead log on its own.
+func (c *DB) Checkpoint() (int64, error) {
+	return 0, nil
+}
+
+// RecordMaintenanceRun stores a run of a maintenance job.
+func (c *DB) RecordMaintenanceRun(run *model.MaintenanceRun) error {
+	return c.db.QueryRow(
+		"INSERT INTO maintenance_run (job, started_at, duration_ms, affected, error) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		run.Job, run.StartedAt, run.DurationMs, run.Affected, run.Error,
+	).Scan(&run.ID)
+}
+
+// GetMaintenanceRuns retrieves the latest runs of the maintenance jobs, newest first, up to limit.
+func (c *DB) GetMaintenanceRuns(limit int) ([]*model.MaintenanceRun, error) {
+	rows, err := c.db.Query(`
+		SELECT id, job, started_at, duration_ms, affected, error
+		FROM maintenance_run
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1`, limitOrAll(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*model.MaintenanceRun
+	for rows.Next() {
+		var run model.MaintenanceRun
+		if err := rows.Scan(&run.ID, &run.Job, &run.StartedAt, &run.DurationMs, &run.Affected, &run.Error); err != nil {
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
+
+// GetLastMaintenanceRuns returns when each maintenance job last ran, by job.
+func (c *DB) GetLastMaintenanceRuns() (map[string]time.Time, error) {
+	rows, err := c.db.Query("SELECT DISTINCT ON (job) job, started_at FROM maintenance_run ORDER BY job, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	last := make(map[string]time.Time)
+	for rows.Next() {
+		var job string
+		var startedAt time.Time
+		if err := rows.Scan(&job, &startedAt); err != nil {
+			return nil, err
+		}
+		last[job] = startedAt
+	}
+	return last, rows.Err()
+}
+
+// DeleteMaintenanceRunsBefore deletes the runs of the maintenance jobs started before the given time
+// and returns how many were deleted.
+func (c *DB) DeleteMaintenanceRunsBefore(before time.Time) (int64, error) {
+	res, err := c.db.Exec("DELETE FROM maintenance_run WHERE started_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS maintenance_run;
+DROP TABLE IF EXISTS position;
+DROP TABLE IF EXISTS recurring_flight;
+DROP TABLE IF EXISTS prediction;
+DROP TABLE IF EXISTS squawk_alert;
+DROP TABLE IF EXISTS first_seen;
+DROP TABLE IF EXISTS rule;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS filter_rejection;
+DROP TABLE IF EXISTS sighting;
+DROP TABLE IF EXISTS codeshare;
+DROP TABLE IF EXISTS flight CASCADE;
+DROP TABLE IF EXISTS flight_leg;
+DROP TABLE IF EXISTS aircraft;
+DROP TABLE IF EXISTS operator;
+DROP TABLE IF EXISTS airport;
+DROP TABLE IF EXISTS operator_log;
+DROP TABLE IF EXISTS key_value_cache;
@@ -0,0 +1,281 @@
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE key_value_cache (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE operator_log (
+    icao TEXT PRIMARY KEY,
+    value JSONB
+);
+
+CREATE TABLE airport (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    code TEXT NOT NULL DEFAULT '',
+    code_icao TEXT NOT NULL DEFAULT '',
+    code_iata TEXT NOT NULL DEFAULT '',
+    code_lid TEXT,
+    timezone TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    city TEXT NOT NULL DEFAULT '',
+    airport_info_url TEXT NOT NULL DEFAULT '',
+    -- not known from the flights, filled from the airports of FlightAware
+    location GEOGRAPHY(POINT, 4326),
+    UNIQUE (code, code_icao, code_iata)
+);
+CREATE INDEX idx_airport_code_iata ON airport (code_iata);
+CREATE INDEX idx_airport_location ON airport USING GIST (location);
+
+CREATE TABLE operator (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    code TEXT NOT NULL DEFAULT '',
+    icao TEXT NOT NULL DEFAULT '',
+    iata TEXT NOT NULL DEFAULT '',
+    UNIQUE (code, icao, iata)
+);
+CREATE INDEX idx_operator_icao ON operator (icao);
+
+CREATE TABLE aircraft (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    icao24 TEXT NOT NULL DEFAULT '',
+    registration TEXT NOT NULL DEFAULT '',
+    aircraft_type TEXT NOT NULL DEFAULT '',
+    UNIQUE (icao24, registration, aircraft_type)
+);
+CREATE INDEX idx_aircraft_type ON aircraft (aircraft_type);
+
+-- flight and flight_leg refer to each other: the references are checked when the logging transaction commits
+CREATE TABLE flight (
+    ident TEXT PRIMARY KEY,
+    leg_id BIGINT,
+    last_seen TIMESTAMPTZ NOT NULL,
+    identification_count INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_flight_last_seen ON flight (last_seen);
+
+CREATE TABLE flight_leg (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    flight_ident TEXT NOT NULL REFERENCES flight (ident) DEFERRABLE INITIALLY DEFERRED,
+    fa_flight_id TEXT NOT NULL DEFAULT '',
+    operator_id BIGINT REFERENCES operator (id),
+    aircraft_id BIGINT REFERENCES aircraft (id),
+    origin_id BIGINT REFERENCES airport (id),
+    destination_id BIGINT REFERENCES airport (id),
+    logged_at TIMESTAMPTZ NOT NULL,
+    ident TEXT NOT NULL DEFAULT '',
+    ident_icao TEXT NOT NULL DEFAULT '',
+    ident_iata TEXT NOT NULL DEFAULT '',
+    actual_runway_off TEXT NOT NULL DEFAULT '',
+    actual_runway_on TEXT NOT NULL DEFAULT '',
+    flight_number TEXT NOT NULL DEFAULT '',
+    atc_ident TEXT,
+    inbound_fa_flight_id TEXT NOT NULL DEFAULT '',
+    blocked BOOLEAN NOT NULL DEFAULT FALSE,
+    diverted BOOLEAN NOT NULL DEFAULT FALSE,
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    position_only BOOLEAN NOT NULL DEFAULT FALSE,
+    departure_delay INTEGER NOT NULL DEFAULT 0,
+    arrival_delay INTEGER NOT NULL DEFAULT 0,
+    filed_ete INTEGER NOT NULL DEFAULT 0,
+    foresight_predictions_available BOOLEAN NOT NULL DEFAULT FALSE,
+    scheduled_out TIMESTAMPTZ,
+    estimated_out TIMESTAMPTZ,
+    actual_out TIMESTAMPTZ,
+    scheduled_off TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    estimated_off TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    actual_off TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    scheduled_on TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    estimated_on TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    actual_on TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01T00:00:00Z',
+    scheduled_in TIMESTAMPTZ,
+    estimated_in TIMESTAMPTZ,
+    actual_in TIMESTAMPTZ,
+    progress_percent INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT '',
+    route_distance INTEGER NOT NULL DEFAULT 0,
+    filed_airspeed INTEGER,
+    filed_altitude INTEGER,
+    route TEXT,
+    baggage_claim TEXT,
+    seats_cabin_business INTEGER,
+    seats_cabin_coach INTEGER,
+    seats_cabin_first INTEGER,
+    gate_origin TEXT,
+    gate_destination TEXT,
+    terminal_origin TEXT,
+    terminal_destination TEXT,
+    type TEXT NOT NULL DEFAULT '',
+    site TEXT NOT NULL DEFAULT '',
+    -- the state of the aircraft when the flight was logged
+    baro_altitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    geo_altitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    velocity DOUBLE PRECISION NOT NULL DEFAULT 0,
+    true_track DOUBLE PRECISION NOT NULL DEFAULT 0,
+    vertical_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+    squawk TEXT NOT NULL DEFAULT '',
+    on_ground BOOLEAN NOT NULL DEFAULT FALSE,
+    latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    distance DOUBLE PRECISION NOT NULL DEFAULT 0,
+    azimuth DOUBLE PRECISION NOT NULL DEFAULT 0,
+    elevation DOUBLE PRECISION NOT NULL DEFAULT 0,
+    slant_range DOUBLE PRECISION NOT NULL DEFAULT 0,
+    co2_kg DOUBLE PRECISION NOT NULL DEFAULT 0,
+    UNIQUE (flight_ident, fa_flight_id)
+);
+CREATE INDEX idx_flight_leg_origin ON flight_leg (origin_id);
+CREATE INDEX idx_flight_leg_destination ON flight_leg (destination_id);
+CREATE INDEX idx_flight_leg_operator ON flight_leg (operator_id);
+CREATE INDEX idx_flight_leg_aircraft ON flight_leg (aircraft_id);
+
+ALTER TABLE flight ADD CONSTRAINT flight_leg_id_fkey
+    FOREIGN KEY (leg_id) REFERENCES flight_leg (id) DEFERRABLE INITIALLY DEFERRED;
+
+CREATE TABLE codeshare (
+    leg_id BIGINT NOT NULL REFERENCES flight_leg (id),
+    kind TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    ident TEXT NOT NULL,
+    PRIMARY KEY (leg_id, kind, position)
+);
+
+CREATE TABLE sighting (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site TEXT NOT NULL DEFAULT 'default',
+    icao24 TEXT NOT NULL DEFAULT '',
+    callsign TEXT NOT NULL,
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    min_distance DOUBLE PRECISION,
+    min_altitude DOUBLE PRECISION,
+    entry_bearing DOUBLE PRECISION,
+    exit_bearing DOUBLE PRECISION,
+    sample_count INTEGER NOT NULL DEFAULT 1,
+    peak_noise DOUBLE PRECISION,
+    noise_exposure DOUBLE PRECISION
+);
+CREATE INDEX idx_sighting_last_seen ON sighting (last_seen);
+CREATE INDEX idx_sighting_callsign_last_seen ON sighting (callsign, site, last_seen);
+CREATE INDEX idx_sighting_site_last_seen ON sighting (site, last_seen);
+CREATE INDEX idx_sighting_peak_noise ON sighting (peak_noise);
+
+CREATE TABLE filter_rejection (
+    site TEXT NOT NULL DEFAULT 'default',
+    name TEXT NOT NULL,
+    day DATE NOT NULL,
+    icao24 TEXT NOT NULL,
+    PRIMARY KEY (site, name, day, icao24)
+);
+
+CREATE TABLE webhook_delivery (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    webhook TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ
+);
+CREATE INDEX idx_webhook_delivery_status_next_attempt ON webhook_delivery (status, next_attempt);
+
+CREATE TABLE rule (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    expression TEXT NOT NULL,
+    severity TEXT NOT NULL DEFAULT 'info',
+    cooldown INTEGER NOT NULL DEFAULT 0,
+    actions TEXT NOT NULL DEFAULT 'log',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE first_seen (
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    first_seen TIMESTAMPTZ NOT NULL,
+    callsign TEXT NOT NULL,
+    site TEXT NOT NULL DEFAULT 'default',
+    count INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (kind, value)
+);
+CREATE INDEX idx_first_seen_first_seen ON first_seen (first_seen);
+
+CREATE TABLE squawk_alert (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site TEXT NOT NULL DEFAULT 'default',
+    icao24 TEXT NOT NULL,
+    callsign TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    squawk TEXT NOT NULL DEFAULT '',
+    state JSONB NOT NULL, -- raising the alert
+    last_state JSONB NOT NULL,
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_squawk_alert_icao24_last_seen ON squawk_alert (site, icao24, kind, last_seen);
+CREATE INDEX idx_squawk_alert_last_seen ON squawk_alert (last_seen);
+
+CREATE TABLE prediction (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site TEXT NOT NULL DEFAULT 'default',
+    icao24 TEXT NOT NULL,
+    callsign TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    -- the last prediction, NULL for the unpredicted aircraft
+    predicted_at TIMESTAMPTZ,
+    entry_time TIMESTAMPTZ,
+    closest_distance DOUBLE PRECISION,
+    -- what happened, NULL for the missed predictions
+    actual_entry TIMESTAMPTZ,
+    actual_distance DOUBLE PRECISION,
+    entry_error DOUBLE PRECISION,
+    distance_error DOUBLE PRECISION,
+    lead DOUBLE PRECISION,
+    resolved_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_prediction_resolved_at ON prediction (resolved_at);
+
+CREATE TABLE recurring_flight (
+    site TEXT NOT NULL DEFAULT 'default',
+    callsign TEXT NOT NULL,
+    minute INTEGER NOT NULL,
+    tolerance INTEGER NOT NULL,
+    weekdays JSONB NOT NULL,
+    occurrences INTEGER NOT NULL,
+    regularity DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (site, callsign, minute)
+);
+
+CREATE TABLE position (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    time TIMESTAMPTZ NOT NULL, -- when the position was reported
+    icao24 TEXT NOT NULL,
+    callsign TEXT NOT NULL DEFAULT '',
+    location GEOGRAPHY(POINT, 4326) NOT NULL,
+    baro_altitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    geo_altitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    velocity DOUBLE PRECISION NOT NULL DEFAULT 0,
+    true_track DOUBLE PRECISION NOT NULL DEFAULT 0,
+    vertical_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+    on_ground BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (icao24, time)
+);
+CREATE INDEX idx_position_time ON position (time);
+CREATE INDEX idx_position_location ON position USING GIST (location);
+
+CREATE TABLE maintenance_run (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    job TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    affected BIGINT NOT NULL DEFAULT 0, -- rows deleted, depending on the job
+    error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_maintenance_run_job_started_at ON maintenance_run (job, started_at);
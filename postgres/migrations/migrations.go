@@ -0,0 +1,7 @@
+// Package migrations holds the schema of the Postgres database, apart from the SQLite one as the SQL differs.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Migrations embed.FS
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// trackMargin is how long before the first and after the last observation of a sighting the positions are part
+// of its track: the positions reported by OpenSky are up to several seconds older than the polls observing them.
+const trackMargin = time.Minute
+
+// RecordPositions stores the positions of the states polled at, reported at their time position or, when unknown,
+// at the poll. A position already stored, reported again by a later poll, is skipped, and so are states without one.
+func (c *DB) RecordPositions(states []model.Flight, at time.Time) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO position (time, icao24, callsign, location, baro_altitude, geo_altitude, velocity, true_track, vertical_rate, on_ground)
+		VALUES ($1, $2, $3, ST_SetSRID(ST_MakePoint($4, $5), 4326)::geography, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (icao24, time) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, state := range states {
+		if state.Latitude == 0 && state.Longitude == 0 {
+			continue
+		}
+		reported := at
+		if state.TimePosition > 0 {
+			reported = time.Unix(int64(state.TimePosition), 0)
+		}
+		_, err := stmt.Exec(reported, state.Icao24, state.Callsign, state.Longitude, state.Latitude, state.BaroAltitude,
+			state.GeoAltitude, state.Velocity, state.TrueTrack, state.VerticalRate, state.OnGround)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTrack returns the positions of the aircraft of a sighting during the pass, in time order.
+func (c *DB) GetTrack(sighting *model.Sighting) ([]model.Position, error) {
+	rows, err := c.db.Query("SELECT "+positionColumns+`
+		FROM position
+		WHERE icao24 = $1 AND time >= $2 AND time <= $3
+		ORDER BY time`,
+		sighting.Icao24, sighting.FirstSeen.Add(-trackMargin), sighting.LastSeen.Add(trackMargin))
+	if err != nil {
+		return nil, err
+	}
+	return scanPositions(rows)
+}
+
+// GetPositionsWithin returns the positions reported in [from, to) within radiusKm of a point, in time order,
+// measured on the spheroid with the spatial index of the locations.
+func (c *DB) GetPositionsWithin(lat, lon, radiusKm float64, from, to time.Time) ([]model.Position, error) {
+	rows, err := c.db.Query("SELECT "+positionColumns+`
+		FROM position
+		WHERE ST_DWithin(location, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3) AND time >= $4 AND time < $5
+		ORDER BY time, id`,
+		lon, lat, radiusKm*1000, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanPositions(rows)
+}
+
+// positionColumns are the columns of a position, its location as a latitude and a longitude.
+const positionColumns = `time, icao24, callsign, ST_Y(location::geometry), ST_X(location::geometry),
+	baro_altitude, geo_altitude, velocity, true_track, vertical_rate, on_ground`
+
+// scanPositions reads the positions selected with positionColumns and closes the rows.
+func scanPositions(rows *sql.Rows) ([]model.Position, error) {
+	defer rows.Close()
+	var positions []model.Position
+	for rows.Next() {
+		var p model.Position
+		if err := rows.Scan(&p.Time, &p.Icao24, &p.Callsign, &p.Latitude, &p.Longitude, &p.BaroAltitude, &p.GeoAltitude,
+			&p.Velocity, &p.TrueTrack, &p.VerticalRate, &p.OnGround); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// DownsamplePositions keeps, of the positions reported before the given time, the first of each aircraft
+// in every interval, and returns how many positions were deleted.
+func (c *DB) DownsamplePositions(before time.Time, interval time.Duration) (int64, error) {
+	res, err := c.db.Exec(`
+		DELETE FROM position
+		WHERE time < $1 AND id NOT IN (
+			SELECT MIN(id) FROM position WHERE time < $1
+			GROUP BY icao24, floor(extract(epoch FROM time) / $2)
+		)`, before, int64(interval.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeletePositionsBefore deletes the positions reported before the given time and returns how many were deleted.
+func (c *DB) DeletePositionsBefore(before time.Time) (int64, error) {
+	res, err := c.db.Exec("DELETE FROM position WHERE time < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+	"github.com/carlo-colombo/sopra/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB connects to the Postgres database at SOPRA_TEST_POSTGRES_URL, with PostGIS available, and empties it.
+// The test is skipped when the variable is not set.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	url := os.Getenv("SOPRA_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("SOPRA_TEST_POSTGRES_URL is not set")
+	}
+	db, err := NewDB(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.db.Exec("TRUNCATE " + strings.Join(copiedTables, ", ") + " RESTART IDENTITY")
+	require.NoError(t, err)
+	return db
+}
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return newTestDB(t)
+	})
+}
+
+func TestCopy(t *testing.T) {
+	db := newTestDB(t)
+
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	src, err := database.NewDB(dbName)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		src.Close()
+		os.Remove(dbName)
+	})
+	require.NoError(t, src.ClearFlightLog())
+
+	route := "GERSA UN871 BADEP"
+	flight := &model.FlightInfo{
+		Ident: "SWR12", Operator: "SWR", Icao24: "4b1805", Codeshares: []string{"UAL9730"}, Route: &route,
+		Origin:      model.AirportDetail{Code: "LSZH", CodeIata: "ZRH", City: "Zurich"},
+		Destination: model.AirportDetail{Code: "KJFK", CodeIata: "JFK", City: "New York"},
+	}
+	require.NoError(t, src.LogFlight("SWR12", flight))
+	require.NoError(t, src.SetAirportLocation("LSZH", 47.458056, 8.548056))
+	at := time.Now().Truncate(time.Second)
+	sighting, err := src.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR12", Time: at, NoiseLevel: 62}, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, src.RecordPositions([]model.Flight{{Icao24: "4b1805", Latitude: 47.45, Longitude: 8.5625, OnGround: true}}, at))
+	rule := &model.Rule{Name: "low", Expression: "altitude < 1000", Actions: []string{"log"}, Enabled: true}
+	require.NoError(t, src.CreateRule(rule))
+
+	copied, err := db.Copy(src.SQL())
+	require.NoError(t, err)
+	rows := make(map[string]int64)
+	for _, table := range copied {
+		rows[table.Table] = table.Rows
+	}
+	assert.Equal(t, int64(1), rows["flight"])
+	assert.Equal(t, int64(2), rows["airport"])
+	assert.Equal(t, int64(1), rows["position"])
+
+	got, _, err := db.GetFlight("SWR12")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, []string{"UAL9730"}, got.Codeshares)
+	assert.Equal(t, route, *got.Route)
+	assert.Equal(t, "New York", got.Destination.City)
+	// The located airport is a point, the other one has none
+	var latitude, longitude float64
+	require.NoError(t, db.db.QueryRow("SELECT ST_Y(location::geometry), ST_X(location::geometry) FROM airport WHERE code = 'LSZH'").Scan(&latitude, &longitude))
+	assert.InDelta(t, 47.458056, latitude, 1e-9)
+	assert.InDelta(t, 8.548056, longitude, 1e-9)
+	located, err := db.AirportLocated("KJFK")
+	require.NoError(t, err)
+	assert.False(t, located)
+
+	copiedSighting, err := db.GetSighting(sighting.ID)
+	require.NoError(t, err)
+	require.NotNil(t, copiedSighting)
+	assert.True(t, at.Equal(copiedSighting.FirstSeen))
+	assert.Equal(t, 62.0, copiedSighting.PeakNoise)
+
+	track, err := db.GetTrack(sighting)
+	require.NoError(t, err)
+	require.Len(t, track, 1)
+	assert.Equal(t, 47.45, track[0].Latitude)
+	assert.Equal(t, 8.5625, track[0].Longitude)
+	assert.True(t, track[0].OnGround)
+
+	// The ids go on after the copied ones
+	copiedRule, err := db.GetRule(rule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, rule, copiedRule)
+	next := &model.Rule{Name: "high", Expression: "altitude > 10000"}
+	require.NoError(t, db.CreateRule(next))
+	assert.Greater(t, next.ID, rule.ID)
+
+	// Only into an empty database
+	_, err = db.Copy(src.SQL())
+	assert.ErrorContains(t, err, "not empty")
+}
+
+func TestEwkt(t *testing.T) {
+	point, err := ewkt(47.45, 8.5625)
+	require.NoError(t, err)
+	assert.Equal(t, "SRID=4326;POINT(8.5625 47.45)", point)
+	_, err = ewkt(nil, 8.5)
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// RecordPredictionOutcome stores how a look-ahead prediction turned out, with its errors when the aircraft entered.
+func (c *DB) RecordPredictionOutcome(o *model.PredictionOutcome) error {
+	var predictedAt, entryTime, actualEntry sql.NullTime
+	var closestDistance, actualDistance, entryError, distanceError, lead sql.NullFloat64
+	if o.Outcome != model.PredictionUnpredicted {
+		predictedAt = sql.NullTime{Time: o.PredictedAt, Valid: true}
+		entryTime = sql.NullTime{Time: o.EntryTime, Valid: true}
+		closestDistance = sql.NullFloat64{Float64: o.ClosestDistance, Valid: true}
+	}
+	if o.Outcome != model.PredictionMissed {
+		actualEntry = sql.NullTime{Time: o.ActualEntry, Valid: true}
+		actualDistance = sql.NullFloat64{Float64: o.ActualDistance, Valid: true}
+	}
+	if o.Outcome == model.PredictionEntered {
+		entryError = sql.NullFloat64{Float64: o.EntryError(), Valid: true}
+		distanceError = sql.NullFloat64{Float64: o.DistanceError(), Valid: true}
+		lead = sql.NullFloat64{Float64: o.Lead(), Valid: true}
+	}
+	_, err := c.db.Exec(`INSERT INTO prediction (site, icao24, callsign, outcome, predicted_at, entry_time, closest_distance,
+		actual_entry, actual_distance, entry_error, distance_error, lead, resolved_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		siteOrDefault(o.Site), o.Icao24, o.Callsign, o.Outcome, predictedAt, entryTime, closestDistance,
+		actualEntry, actualDistance, entryError, distanceError, lead, o.ResolvedAt)
+	return err
+}
+
+// GetPredictionAccuracy summarizes the outcomes of the predictions resolved since the given time, optionally restricted to a site.
+func (c *DB) GetPredictionAccuracy(since time.Time, site string) (*model.PredictionAccuracy, error) {
+	var a model.PredictionAccuracy
+	err := c.db.QueryRow(`SELECT
+			COUNT(*) FILTER (WHERE outcome = $1), COUNT(*) FILTER (WHERE outcome = $2), COUNT(*) FILTER (WHERE outcome = $3),
+			COALESCE(AVG(ABS(entry_error)), 0), COALESCE(AVG(ABS(distance_error)), 0), COALESCE(AVG(lead), 0)
+		FROM prediction WHERE resolved_at >= $4 AND ($5 = '' OR site = $5)`,
+		model.PredictionEntered, model.PredictionMissed, model.PredictionUnpredicted, since, site).
+		Scan(&a.Entered, &a.Missed, &a.Unpredicted, &a.MeanEntryError, &a.MeanDistanceError, &a.MeanLead)
+	if err != nil {
+		return nil, err
+	}
+	a.MeanEntryError = math.Round(a.MeanEntryError*10) / 10
+	a.MeanDistanceError = math.Round(a.MeanDistanceError)
+	a.MeanLead = math.Round(a.MeanLead)
+	return &a, nil
+}
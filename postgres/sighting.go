@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const sightingColumns = "id, site, icao24, callsign, first_seen, last_seen, min_distance, min_altitude, entry_bearing, exit_bearing, sample_count, peak_noise, noise_exposure"
+
+func scanSighting(row rowScanner) (*model.Sighting, error) {
+	var s model.Sighting
+	var minDistance, minAltitude, entryBearing, exitBearing, peakNoise, noiseExposure sql.NullFloat64
+	if err := row.Scan(&s.ID, &s.Site, &s.Icao24, &s.Callsign, &s.FirstSeen, &s.LastSeen,
+		&minDistance, &minAltitude, &entryBearing, &exitBearing, &s.SampleCount, &peakNoise, &noiseExposure); err != nil {
+		return nil, err
+	}
+	s.MinDistance = minDistance.Float64
+	s.MinAltitude = minAltitude.Float64
+	s.EntryBearing = entryBearing.Float64
+	s.ExitBearing = exitBearing.Float64
+	s.PeakNoise = peakNoise.Float64
+	s.NoiseExposure = noiseExposure.Float64
+	return &s, nil
+}
+
+// RecordSighting adds an observation to the open sighting of the same aircraft at the same site,
+// or starts a new sighting when the last one was seen more than gap ago. The noise estimate of the
+// loudest observation is kept.
+func (c *DB) RecordSighting(obs model.Observation, gap time.Duration) (*model.Sighting, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The open sighting is locked until the transaction ends, so concurrent observations extend it one at a time
+	row := tx.QueryRow("SELECT "+sightingColumns+" FROM sighting WHERE site = $1 AND icao24 = $2 AND callsign = $3 AND last_seen >= $4 ORDER BY last_seen DESC LIMIT 1 FOR UPDATE",
+		siteOrDefault(obs.Site), obs.Icao24, obs.Callsign, obs.Time.Add(-gap))
+	sighting, err := scanSighting(row)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if sighting == nil {
+		sighting = &model.Sighting{
+			Site:          siteOrDefault(obs.Site),
+			Icao24:        obs.Icao24,
+			Callsign:      obs.Callsign,
+			FirstSeen:     obs.Time,
+			LastSeen:      obs.Time,
+			MinDistance:   obs.Distance,
+			MinAltitude:   model.LowerAltitude(0, obs.Altitude),
+			EntryBearing:  obs.Bearing,
+			ExitBearing:   obs.Bearing,
+			SampleCount:   1,
+			PeakNoise:     obs.NoiseLevel,
+			NoiseExposure: obs.NoiseExposure,
+		}
+		err := tx.QueryRow("INSERT INTO sighting (site, icao24, callsign, first_seen, last_seen, min_distance, min_altitude, entry_bearing, exit_bearing, sample_count, peak_noise, noise_exposure) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id",
+			sighting.Site, sighting.Icao24, sighting.Callsign, sighting.FirstSeen, sighting.LastSeen, sighting.MinDistance, nullIfZero(sighting.MinAltitude), sighting.EntryBearing, sighting.ExitBearing, sighting.SampleCount,
+			nullIfZero(sighting.PeakNoise), nullIfZero(sighting.NoiseExposure)).Scan(&sighting.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		sighting.LastSeen = obs.Time
+		sighting.MinDistance = math.Min(sighting.MinDistance, obs.Distance)
+		sighting.MinAltitude = model.LowerAltitude(sighting.MinAltitude, obs.Altitude)
+		sighting.ExitBearing = obs.Bearing
+		sighting.SampleCount++
+		if obs.NoiseLevel != 0 && (sighting.PeakNoise == 0 || obs.NoiseLevel > sighting.PeakNoise) {
+			sighting.PeakNoise = obs.NoiseLevel
+			sighting.NoiseExposure = obs.NoiseExposure
+		}
+		_, err := tx.Exec("UPDATE sighting SET last_seen = $1, min_distance = $2, min_altitude = $3, exit_bearing = $4, sample_count = $5, peak_noise = $6, noise_exposure = $7 WHERE id = $8",
+			sighting.LastSeen, sighting.MinDistance, nullIfZero(sighting.MinAltitude), sighting.ExitBearing, sighting.SampleCount,
+			nullIfZero(sighting.PeakNoise), nullIfZero(sighting.NoiseExposure), sighting.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sighting, nil
+}
+
+// GetSighting retrieves a sighting by id, nil when there is none.
+func (c *DB) GetSighting(id int64) (*model.Sighting, error) {
+	sighting, err := scanSighting(c.db.QueryRow("SELECT "+sightingColumns+" FROM sighting WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sighting, err
+}
+
+// querySightings runs a query selecting the sightingColumns.
+func (c *DB) querySightings(query string, args ...interface{}) ([]*model.Sighting, error) {
+	rows, err := c.db.Query("SELECT "+sightingColumns+" FROM sighting "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sightings []*model.Sighting
+	for rows.Next() {
+		s, err := scanSighting(rows)
+		if err != nil {
+			return nil, err
+		}
+		sightings = append(sightings, s)
+	}
+	return sightings, rows.Err()
+}
+
+// GetRecentSightings retrieves the most recent sightings, newest first, optionally restricted to a site.
+func (c *DB) GetRecentSightings(limit int, site string) ([]*model.Sighting, error) {
+	return c.querySightings("WHERE $1 = '' OR site = $1 ORDER BY last_seen DESC, id DESC LIMIT $2", site, limitOrAll(limit))
+}
+
+// GetNoisySightingsSince retrieves the sightings with a noise estimate started since the given time,
+// optionally restricted to a site, the loudest first.
+func (c *DB) GetNoisySightingsSince(since time.Time, site string) ([]*model.Sighting, error) {
+	return c.querySightings("WHERE peak_noise IS NOT NULL AND first_seen >= $1 AND ($2 = '' OR site = $2) ORDER BY peak_noise DESC", since, site)
+}
+
+// GetSightingsBetween retrieves the sightings started from the given time and before the other,
+// optionally restricted to a site, in the order they started.
+func (c *DB) GetSightingsBetween(from, to time.Time, site string) ([]*model.Sighting, error) {
+	return c.querySightings("WHERE first_seen >= $1 AND first_seen < $2 AND ($3 = '' OR site = $3) ORDER BY first_seen, id", from, to, site)
+}
+
+// nullIfZero stores unknown values, zero, as NULL.
+func nullIfZero(v float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: v, Valid: v != 0}
+}
+
+// GetSightingCount returns the total number of sightings.
+func (c *DB) GetSightingCount() (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM sighting").Scan(&count)
+	return count, err
+}
+
+// GetSightingCountSince returns the number of sightings started since the given time, optionally restricted to a site.
+func (c *DB) GetSightingCountSince(since time.Time, site string) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM sighting WHERE first_seen >= $1 AND ($2 = '' OR site = $2)", since, site).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const webhookDeliveryColumns = "id, webhook, event_type, body, status, attempts, next_attempt, last_error, created_at, delivered_at"
+
+func scanWebhookDelivery(row rowScanner) (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var deliveredAt sql.NullTime
+	if err := row.Scan(&d.ID, &d.Webhook, &d.EventType, &d.Body, &d.Status, &d.Attempts,
+		&d.NextAttempt, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+		return nil, err
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+func (c *DB) queryWebhookDeliveries(query string, args ...interface{}) ([]*model.WebhookDelivery, error) {
+	rows, err := c.db.Query("SELECT "+webhookDeliveryColumns+" FROM webhook_delivery "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// EnqueueWebhookDelivery stores a pending delivery, due at its NextAttempt, and sets its ID.
+func (c *DB) EnqueueWebhookDelivery(d *model.WebhookDelivery) error {
+	d.Status = model.DeliveryPending
+	return c.db.QueryRow("INSERT INTO webhook_delivery (webhook, event_type, body, status, next_attempt, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		d.Webhook, d.EventType, d.Body, d.Status, d.NextAttempt, d.CreatedAt).Scan(&d.ID)
+}
+
+// GetDueWebhookDeliveries retrieves up to limit pending deliveries due at now, oldest first.
+func (c *DB) GetDueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	return c.queryWebhookDeliveries("WHERE status = $1 AND next_attempt <= $2 ORDER BY next_attempt, id LIMIT $3", model.DeliveryPending, now, limitOrAll(limit))
+}
+
+// GetDeadWebhookDeliveries retrieves up to limit deliveries that ran out of attempts, newest first.
+func (c *DB) GetDeadWebhookDeliveries(limit int) ([]*model.WebhookDelivery, error) {
+	return c.queryWebhookDeliveries("WHERE status = $1 ORDER BY id DESC LIMIT $2", model.DeliveryDead, limitOrAll(limit))
+}
+
+// MarkWebhookDelivered records a successful delivery.
+func (c *DB) MarkWebhookDelivered(id int64, attempts int, at time.Time) error {
+	_, err := c.db.Exec("UPDATE webhook_delivery SET status = $1, attempts = $2, delivered_at = $3, last_error = '' WHERE id = $4",
+		model.DeliveryDelivered, attempts, at, id)
+	return err
+}
+
+// MarkWebhookFailed records a failed attempt, scheduling the next one at next,
+// or moving the delivery to the dead letters when dead is true.
+func (c *DB) MarkWebhookFailed(id int64, attempts int, next time.Time, lastError string, dead bool) error {
+	status := model.DeliveryPending
+	if dead {
+		status = model.DeliveryDead
+	}
+	_, err := c.db.Exec("UPDATE webhook_delivery SET status = $1, attempts = $2, next_attempt = $3, last_error = $4 WHERE id = $5",
+		status, attempts, next, lastError, id)
+	return err
+}
+
+// RequeueWebhookDelivery moves a dead delivery back to the queue, due at now with its attempts reset.
+// It returns false when there is no dead delivery with that ID.
+func (c *DB) RequeueWebhookDelivery(id int64, now time.Time) (bool, error) {
+	res, err := c.db.Exec("UPDATE webhook_delivery SET status = $1, attempts = 0, next_attempt = $2 WHERE id = $3 AND status = $4",
+		model.DeliveryPending, now, id, model.DeliveryDead)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
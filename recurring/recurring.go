@@ -0,0 +1,250 @@
+// Package recurring learns the flights passing over the sites at about the same time on the same weekdays,
+// from the past sightings only, and compares the flights expected on a day with the ones seen.
+package recurring
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+const (
+	// clusterGap splits the passes of a callsign into distinct daily flights when they are this far apart.
+	clusterGap = 60
+	// minTolerance and maxTolerance bound the minutes around the typical time of a flight still on time.
+	minTolerance = 10
+	maxTolerance = 30
+	// minRegularity is the share of the watched days of a weekday a flight has to pass on for the weekday to count.
+	minRegularity = 0.5
+	// lateLimit is how long after its time window a flight not seen yet is late, before it is missing.
+	lateLimit = time.Hour
+	// relearnInterval is how often the flights are learned again.
+	relearnInterval = 24 * time.Hour
+)
+
+// Learn finds the recurring flights in the sightings. The weekdays of a flight are the ones it passed on
+// at least half of the days the site was watched, i.e. had any sighting, and at least twice; a flight needs
+// minOccurrences passes on its weekdays. Days are local to loc; flights around midnight are not recognized.
+func Learn(sightings []*model.Sighting, loc *time.Location, minOccurrences int) []model.RecurringFlight {
+	type pass struct {
+		day    string
+		minute int
+		dow    time.Weekday
+	}
+	watched := make(map[string]map[string]time.Weekday) // days with any sighting, by site
+	passes := make(map[[2]string][]pass)                // by site and callsign
+	for _, s := range sightings {
+		t := s.FirstSeen.In(loc)
+		day := t.Format(time.DateOnly)
+		if watched[s.Site] == nil {
+			watched[s.Site] = make(map[string]time.Weekday)
+		}
+		watched[s.Site][day] = t.Weekday()
+		if s.Callsign != "" {
+			key := [2]string{s.Site, s.Callsign}
+			passes[key] = append(passes[key], pass{day: day, minute: t.Hour()*60 + t.Minute(), dow: t.Weekday()})
+		}
+	}
+
+	var flights []model.RecurringFlight
+	for key, all := range passes {
+		var watchedDays [7]int
+		for _, dow := range watched[key[0]] {
+			watchedDays[dow]++
+		}
+
+		slices.SortFunc(all, func(a, b pass) int { return cmp.Compare(a.minute, b.minute) })
+		for start := 0; start < len(all); {
+			end := start + 1
+			for end < len(all) && all[end].minute-all[end-1].minute <= clusterGap {
+				end++
+			}
+			cluster := all[start:end]
+			start = end
+
+			// One pass a day, the earliest
+			seen := make(map[string]bool)
+			var daily []pass
+			var perWeekday [7]int
+			for _, p := range cluster {
+				if !seen[p.day] {
+					seen[p.day] = true
+					daily = append(daily, p)
+					perWeekday[p.dow]++
+				}
+			}
+			if len(daily) < minOccurrences {
+				continue
+			}
+
+			flight := model.RecurringFlight{Site: key[0], Callsign: key[1]}
+			var days int
+			for dow := range 7 {
+				if perWeekday[dow] >= 2 && float64(perWeekday[dow]) >= minRegularity*float64(watchedDays[dow]) {
+					flight.Weekdays = append(flight.Weekdays, time.Weekday(dow))
+					flight.Occurrences += perWeekday[dow]
+					days += watchedDays[dow]
+				}
+			}
+			if flight.Occurrences < minOccurrences {
+				continue
+			}
+			flight.Regularity = math.Round(float64(flight.Occurrences)/float64(days)*100) / 100
+
+			var minutes []int
+			for _, p := range daily {
+				if slices.Contains(flight.Weekdays, p.dow) {
+					minutes = append(minutes, p.minute)
+				}
+			}
+			flight.Minute = median(minutes)
+			deviations := make([]int, len(minutes))
+			for i, m := range minutes {
+				deviations[i] = max(m-flight.Minute, flight.Minute-m)
+			}
+			flight.Tolerance = min(max(2*median(deviations), minTolerance), maxTolerance)
+			flights = append(flights, flight)
+		}
+	}
+	slices.SortFunc(flights, func(a, b model.RecurringFlight) int {
+		return cmp.Or(cmp.Compare(a.Minute, b.Minute), cmp.Compare(a.Site, b.Site), cmp.Compare(a.Callsign, b.Callsign))
+	})
+	return flights
+}
+
+// median returns the median of the values, the lower one of an even count.
+func median(values []int) int {
+	sorted := slices.Sorted(slices.Values(values))
+	return sorted[(len(sorted)-1)/2]
+}
+
+// Today returns the recurring flights expected on the day of now, in time order, with the sightings of the day
+// matched to them: on time within the tolerance of the expected time, early or late outside of it. A flight not
+// seen is scheduled before its time window, due within it, late after it and missing an hour later.
+func Today(flights []model.RecurringFlight, sightings []*model.Sighting, now time.Time, loc *time.Location) []model.ExpectedFlight {
+	now = now.In(loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	today := now.Format(time.DateOnly)
+
+	var expected []model.ExpectedFlight
+	for _, f := range flights {
+		if slices.Contains(f.Weekdays, now.Weekday()) {
+			expected = append(expected, model.ExpectedFlight{RecurringFlight: f, Expected: midnight.Add(time.Duration(f.Minute) * time.Minute)})
+		}
+	}
+	slices.SortFunc(expected, func(a, b model.ExpectedFlight) int { return a.Expected.Compare(b.Expected) })
+
+	used := make(map[int64]bool)
+	for i := range expected {
+		e := &expected[i]
+		tolerance := time.Duration(e.Tolerance) * time.Minute
+
+		// The closest pass of the day, when a callsign is expected more than once
+		var match *model.Sighting
+		for _, s := range sightings {
+			if s.Site != e.Site || s.Callsign != e.Callsign || used[s.ID] || s.FirstSeen.In(loc).Format(time.DateOnly) != today {
+				continue
+			}
+			if match == nil || s.FirstSeen.Sub(e.Expected).Abs() < match.FirstSeen.Sub(e.Expected).Abs() {
+				match = s
+			}
+		}
+
+		if match != nil {
+			used[match.ID] = true
+			seen := match.FirstSeen.In(loc)
+			e.Seen = &seen
+			e.Delay = int(math.Round(seen.Sub(e.Expected).Minutes()))
+			switch {
+			case seen.Before(e.Expected.Add(-tolerance)):
+				e.Status = model.ExpectedEarly
+			case seen.After(e.Expected.Add(tolerance)):
+				e.Status = model.ExpectedLate
+			default:
+				e.Status = model.ExpectedOnTime
+			}
+			continue
+		}
+		switch {
+		case now.Before(e.Expected.Add(-tolerance)):
+			e.Status = model.ExpectedScheduled
+		case !now.After(e.Expected.Add(tolerance)):
+			e.Status = model.ExpectedDue
+		case !now.After(e.Expected.Add(tolerance + lateLimit)):
+			e.Status = model.ExpectedLate
+		default:
+			e.Status = model.ExpectedMissing
+		}
+	}
+	return expected
+}
+
+// Store is the storage the learner uses: the sightings it learns from and the recurring flights it stores.
+type Store interface {
+	storage.Sightings
+	storage.RecurringFlights
+}
+
+// Learner periodically learns the recurring flights from the sightings of the last days and stores them.
+type Learner struct {
+	db             Store
+	days           int
+	minOccurrences int
+	location       *time.Location
+}
+
+// New creates a Learner from the configuration.
+func New(cfg *config.Config, db Store) (*Learner, error) {
+	if cfg.Recurring.Days < 7 {
+		return nil, fmt.Errorf("the recurring flights need at least 7 days of sightings")
+	}
+	if cfg.Recurring.MinOccurrences < 2 {
+		return nil, fmt.Errorf("a recurring flight needs at least 2 occurrences")
+	}
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Printf("failed to load location %s: %v. Falling back to Local", cfg.Timezone, err)
+		location = time.Local
+	}
+	return &Learner{db: db, days: cfg.Recurring.Days, minOccurrences: cfg.Recurring.MinOccurrences, location: location}, nil
+}
+
+// Run learns the recurring flights right away and then once a day, until ctx is canceled.
+func (l *Learner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(relearnInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.Learn(time.Now()); err != nil {
+			log.Printf("Error learning the recurring flights: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Learn replaces the stored recurring flights with the ones learned from the sightings of the full days before now.
+func (l *Learner) Learn(now time.Time) error {
+	now = now.In(l.location)
+	until := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, l.location)
+	sightings, err := l.db.GetSightingsBetween(until.AddDate(0, 0, -l.days), until, "")
+	if err != nil {
+		return err
+	}
+	flights := Learn(sightings, l.location, l.minOccurrences)
+	if err := l.db.ReplaceRecurringFlights(flights); err != nil {
+		return err
+	}
+	log.Printf("Learned %d recurring flights from %d sightings of the last %d days", len(flights), len(sightings), l.days)
+	return nil
+}
@@ -0,0 +1,170 @@
+package recurring
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cet = time.FixedZone("CET", 3600)
+
+// fourWeeks returns the sightings of 28 days from Monday 2024-06-03: a pass without callsign at noon every day,
+// so that every day is watched, EZY1234 between 07:39 and 07:43 on weekdays but one Wednesday, DLH2 at 18:10 and 21:30
+// every day, and a few irregular flights.
+func fourWeeks() []*model.Sighting {
+	var sightings []*model.Sighting
+	pass := func(site, callsign string, day, hour, minute int) {
+		sightings = append(sightings, &model.Sighting{ID: int64(len(sightings) + 1), Site: site, Callsign: callsign,
+			FirstSeen: time.Date(2024, 6, 3+day, hour, minute, 0, 0, cet)})
+	}
+	for day := range 28 {
+		pass("home", "", day, 12, 0)
+		if weekday := time.Date(2024, 6, 3+day, 0, 0, 0, 0, cet).Weekday(); weekday != time.Saturday && weekday != time.Sunday && day != 9 {
+			pass("home", "EZY1234", day, 7, 39+day%7)
+		}
+		pass("home", "DLH2", day, 18, 10)
+		pass("home", "DLH2", day, 21, 30)
+	}
+	pass("home", "RND1", 1, 9, 0)
+	pass("home", "RND1", 8, 15, 0)
+	pass("home", "RND1", 15, 20, 0)
+	pass("home", "TUE1", 1, 10, 0) // two Tuesdays out of four, but too few passes
+	pass("home", "TUE1", 8, 10, 0)
+	pass("office", "EZY1234", 0, 7, 50)
+	return sightings
+}
+
+func TestLearn(t *testing.T) {
+	flights := Learn(fourWeeks(), cet, 4)
+	require.Len(t, flights, 3)
+
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	assert.Equal(t, model.RecurringFlight{Site: "home", Callsign: "EZY1234", Minute: 7*60 + 41, Tolerance: 10,
+		Weekdays: weekdays, Occurrences: 19, Regularity: 0.95}, flights[0])
+	assert.Equal(t, "DLH2", flights[1].Callsign)
+	assert.Equal(t, "18:10", flights[1].Clock())
+	assert.Len(t, flights[1].Weekdays, 7)
+	assert.Equal(t, 28, flights[1].Occurrences)
+	assert.Equal(t, 1.0, flights[1].Regularity)
+	assert.Equal(t, "21:30", flights[2].Clock())
+
+	// In another time zone the passes are at other times of the day
+	flights = Learn(fourWeeks(), time.FixedZone("EET", 2*3600), 4)
+	assert.Equal(t, "08:41", flights[0].Clock())
+	assert.Empty(t, Learn(fourWeeks(), cet, 30))
+	assert.Empty(t, Learn(nil, cet, 4))
+}
+
+func TestToday(t *testing.T) {
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	flight := func(callsign string, hour, minute int, weekdays []time.Weekday) model.RecurringFlight {
+		return model.RecurringFlight{Site: "home", Callsign: callsign, Minute: hour*60 + minute, Tolerance: 10, Weekdays: weekdays}
+	}
+	flights := []model.RecurringFlight{
+		flight("EZY1234", 7, 42, weekdays),
+		flight("LATE", 8, 0, weekdays),
+		flight("GONE", 7, 0, weekdays),
+		flight("DUE", 8, 55, weekdays),
+		flight("LATER", 10, 0, weekdays),
+		flight("EARLY", 6, 0, weekdays),
+		flight("ONTIME", 8, 30, weekdays),
+		flight("TWICE", 6, 30, weekdays),
+		flight("TWICE", 8, 40, weekdays),
+		flight("WEEKEND", 8, 0, []time.Weekday{time.Saturday, time.Sunday}),
+	}
+	// Wednesday 2024-07-03 at 09:00
+	now := time.Date(2024, 7, 3, 9, 0, 0, 0, cet)
+	at := func(id int64, callsign string, hour, minute int) *model.Sighting {
+		return &model.Sighting{ID: id, Site: "home", Callsign: callsign, FirstSeen: time.Date(2024, 7, 3, hour, minute, 0, 0, cet)}
+	}
+	sightings := []*model.Sighting{
+		at(1, "EZY1234", 7, 58),
+		at(2, "EARLY", 5, 45),
+		at(3, "ONTIME", 8, 33),
+		at(4, "TWICE", 6, 31),
+		at(5, "TWICE", 8, 38),
+		{ID: 6, Site: "home", Callsign: "GONE", FirstSeen: time.Date(2024, 7, 2, 7, 0, 0, 0, cet)},   // yesterday
+		{ID: 7, Site: "office", Callsign: "LATE", FirstSeen: time.Date(2024, 7, 3, 8, 0, 0, 0, cet)}, // elsewhere
+	}
+
+	expected := Today(flights, sightings, now.UTC(), cet)
+	require.Len(t, expected, 9)
+	status := make(map[string]string)
+	for i, e := range expected {
+		if i > 0 {
+			assert.False(t, e.Expected.Before(expected[i-1].Expected), "in time order")
+		}
+		status[e.Callsign+" "+e.Clock()] = e.Status
+	}
+	assert.Equal(t, map[string]string{
+		"EARLY 06:00":   model.ExpectedEarly,
+		"TWICE 06:30":   model.ExpectedOnTime,
+		"GONE 07:00":    model.ExpectedMissing,
+		"EZY1234 07:42": model.ExpectedLate,
+		"LATE 08:00":    model.ExpectedLate,
+		"ONTIME 08:30":  model.ExpectedOnTime,
+		"TWICE 08:40":   model.ExpectedOnTime,
+		"DUE 08:55":     model.ExpectedDue,
+		"LATER 10:00":   model.ExpectedScheduled,
+	}, status)
+
+	ezy := expected[3]
+	assert.Equal(t, time.Date(2024, 7, 3, 7, 42, 0, 0, cet), ezy.Expected)
+	require.NotNil(t, ezy.Seen)
+	assert.Equal(t, 16, ezy.Delay)
+	assert.Nil(t, expected[4].Seen)
+	assert.Equal(t, -15, expected[0].Delay)
+}
+
+func TestLearner_Learn(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := database.NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+	for _, s := range fourWeeks() {
+		_, err := db.RecordSighting(model.Observation{Site: s.Site, Icao24: "abc123", Callsign: s.Callsign, Time: s.FirstSeen}, time.Minute)
+		require.NoError(t, err)
+	}
+
+	cfg := &config.Config{Timezone: "Europe/Zurich", Recurring: config.RecurringConfig{Days: 28, MinOccurrences: 4}}
+	learner, err := New(cfg, db)
+	require.NoError(t, err)
+
+	// The day of now is not learned from
+	require.NoError(t, learner.Learn(time.Date(2024, 7, 1, 9, 0, 0, 0, cet)))
+	flights, err := db.GetRecurringFlights("home")
+	require.NoError(t, err)
+	require.Len(t, flights, 3)
+	assert.Equal(t, "EZY1234", flights[0].Callsign)
+	assert.Equal(t, 19, flights[0].Occurrences)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, flights[0].Weekdays)
+
+	// Learned again from a single week, with no weekday passed on twice, the flights are replaced
+	require.NoError(t, learner.Learn(time.Date(2024, 6, 10, 9, 0, 0, 0, cet)))
+	flights, err = db.GetRecurringFlights("")
+	require.NoError(t, err)
+	assert.Empty(t, flights)
+	flights, err = db.GetRecurringFlights("office")
+	require.NoError(t, err)
+	assert.Empty(t, flights)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	for _, cfg := range []config.RecurringConfig{{MinOccurrences: 4}, {Days: 28, MinOccurrences: 1}} {
+		_, err := New(&config.Config{Recurring: cfg}, nil)
+		assert.Error(t, err, cfg)
+	}
+}
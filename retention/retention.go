@@ -0,0 +1,71 @@
+// Package retention thins out the stored positions of the aircraft as they age: positions are kept as reported
+// for some days, downsampled afterwards and deleted after some months.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+// interval is how often the positions are thinned out when the maintenance scheduler is disabled.
+const interval = time.Hour
+
+// Job applies the retention of the positions, run periodically by the maintenance scheduler, or by Run without it.
+type Job struct {
+	db         storage.Positions
+	fullDays   int
+	downsample time.Duration
+	months     int
+}
+
+// New creates a Job from the positions configuration.
+func New(cfg config.PositionsConfig, db storage.Positions) (*Job, error) {
+	if cfg.FullDays < 1 {
+		return nil, fmt.Errorf("the positions must be kept as reported for at least 1 day")
+	}
+	if cfg.Downsample < 1 {
+		return nil, fmt.Errorf("the positions must be downsampled to at least 1 second")
+	}
+	if cfg.Months < 1 || cfg.Months*28 < cfg.FullDays {
+		return nil, fmt.Errorf("the positions must be kept for at least 1 month, and not less than full_days")
+	}
+	return &Job{db: db, fullDays: cfg.FullDays, downsample: time.Duration(cfg.Downsample) * time.Second, months: cfg.Months}, nil
+}
+
+// Run applies the retention right away and then every hour, until ctx is canceled.
+func (j *Job) Run(ctx context.Context) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := j.Apply(time.Now()); err != nil {
+			log.Printf("Error applying the retention of the positions: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Apply deletes the positions older than the months kept, and downsamples the ones older than the days kept as reported.
+// It returns how many positions were deleted in all.
+func (j *Job) Apply(now time.Time) (int64, error) {
+	deleted, err := j.db.DeletePositionsBefore(now.AddDate(0, -j.months, 0))
+	if err != nil {
+		return 0, err
+	}
+	downsampled, err := j.db.DownsamplePositions(now.AddDate(0, 0, -j.fullDays), j.downsample)
+	if err != nil {
+		return deleted, err
+	}
+	if deleted > 0 || downsampled > 0 {
+		log.Printf("Deleted %d positions older than %d months, and %d downsampling the ones older than %d days", deleted, j.months, downsampled, j.fullDays)
+	}
+	return deleted + downsampled, nil
+}
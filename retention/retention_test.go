@@ -0,0 +1,101 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_Apply(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := database.NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.Local)
+	// Two minutes of positions every 10 seconds, a day, 10 days and 7 months ago
+	passes := map[string]time.Time{"a00001": now.AddDate(0, 0, -1), "a00002": now.AddDate(0, 0, -10), "a00003": now.AddDate(0, -7, 0)}
+	for icao24, start := range passes {
+		for i := range 12 {
+			at := start.Add(time.Duration(i) * 10 * time.Second)
+			state := model.Flight{Icao24: icao24, Callsign: "SWR12", TimePosition: int(at.Unix()), Latitude: 47.4, Longitude: 8.5 + float64(i)/100}
+			require.NoError(t, db.RecordPositions([]model.Flight{state}, at))
+		}
+	}
+
+	job, err := New(config.PositionsConfig{FullDays: 7, Downsample: 60, Months: 6}, db)
+	require.NoError(t, err)
+	deleted, err := job.Apply(now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12+10), deleted)
+
+	counts := make(map[string]int)
+	for icao24, start := range passes {
+		track, err := db.GetTrack(&model.Sighting{Icao24: icao24, FirstSeen: start, LastSeen: start.Add(2 * time.Minute)})
+		require.NoError(t, err)
+		counts[icao24] = len(track)
+	}
+	assert.Equal(t, map[string]int{"a00001": 12, "a00002": 2, "a00003": 0}, counts)
+
+	// Applying the retention again changes nothing
+	deleted, err = job.Apply(now)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	track, err := db.GetTrack(&model.Sighting{Icao24: "a00002", FirstSeen: passes["a00002"], LastSeen: passes["a00002"].Add(2 * time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, track, 2)
+	assert.Equal(t, passes["a00002"].Unix(), track[0].Time.Unix())
+	assert.Equal(t, passes["a00002"].Add(time.Minute).Unix(), track[1].Time.Unix())
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	for _, cfg := range []config.PositionsConfig{
+		{Downsample: 60, Months: 6},
+		{FullDays: 7, Months: 6},
+		{FullDays: 7, Downsample: 60},
+		{FullDays: 90, Downsample: 60, Months: 1},
+	} {
+		_, err := New(cfg, nil)
+		assert.Error(t, err, cfg)
+	}
+}
+
+func TestJob_Run(t *testing.T) {
+	dbName := fmt.Sprintf("%s.db", t.Name())
+	os.Remove(dbName)
+	db, err := database.NewDB(dbName)
+	if err != nil {
+		t.Fatalf("failed to create test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbName)
+	})
+
+	old := time.Now().AddDate(-1, 0, 0)
+	require.NoError(t, db.RecordPositions([]model.Flight{{Icao24: "a00001", TimePosition: int(old.Unix()), Latitude: 47.4, Longitude: 8.5}}, old))
+
+	// The retention is applied right away, before waiting for the next hour
+	job, err := New(config.PositionsConfig{FullDays: 7, Downsample: 60, Months: 6}, db)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, job.Run(ctx))
+	track, err := db.GetTrack(&model.Sighting{Icao24: "a00001", FirstSeen: old.Add(-time.Minute), LastSeen: old.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Empty(t, track)
+}
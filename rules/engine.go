@@ -0,0 +1,320 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+// Built-in action names.
+const (
+	ActionLog     = "log"
+	ActionWebhook = "webhook"
+	ActionMQTT    = "mqtt"
+)
+
+// DefaultCooldown is how long a rule waits before firing again for the same aircraft, when unset.
+const DefaultCooldown = 900
+
+// ErrInvalidRule is wrapped by the errors of rules that cannot be saved.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Action receives the RuleMatched events of the rules listing it.
+type Action func(e events.Event) error
+
+// compiled is a rule with its compiled expression.
+type compiled struct {
+	model.Rule
+	expr *Expr
+}
+
+// cooldownKey identifies the aircraft a rule fired for.
+type cooldownKey struct {
+	rule   string
+	icao24 string
+}
+
+// Store is the storage the engine uses: the rules stored in the database and the flights they are tested against.
+type Store interface {
+	storage.Rules
+	storage.Flights
+}
+
+// Engine evaluates the alert rules, from the configuration and the database, against the
+// enriched aircraft of each watch cycle, and runs the actions of the matching rules.
+type Engine struct {
+	db      Store
+	config  []*compiled
+	actions map[string]Action
+	now     func() time.Time
+
+	mu    sync.Mutex
+	rules []*compiled
+	fired map[cooldownKey]time.Time
+}
+
+// New creates an Engine with the rules of the configuration and the ones stored in the database.
+// Only the log action is available until others are set with SetAction.
+func New(cfgs []config.RuleConfig, db Store) (*Engine, error) {
+	e := &Engine{
+		db:      db,
+		actions: map[string]Action{ActionLog: logAction},
+		now:     time.Now,
+		fired:   make(map[cooldownKey]time.Time),
+	}
+	for _, cfg := range cfgs {
+		rule := model.Rule{
+			Name:       cfg.Name,
+			Expression: cfg.Expression,
+			Severity:   cfg.Severity,
+			Cooldown:   cfg.Cooldown,
+			Actions:    cfg.Actions,
+			Enabled:    true,
+			ReadOnly:   true,
+		}
+		c, err := e.compile(&rule)
+		if err != nil {
+			return nil, err
+		}
+		e.config = append(e.config, c)
+	}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetAction makes an action available to the rules.
+func (e *Engine) SetAction(name string, action Action) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.actions[name] = action
+}
+
+// reload compiles the rules stored in the database, after the ones of the configuration.
+func (e *Engine) reload() error {
+	stored, err := e.db.GetRules()
+	if err != nil {
+		return err
+	}
+	rules := slices.Clone(e.config)
+	for _, rule := range stored {
+		c, err := e.compile(rule)
+		if err != nil {
+			// Rules are validated before being stored, but the language may have changed since
+			log.Printf("Skipping rule %s: %v", rule.Name, err)
+			continue
+		}
+		rules = append(rules, c)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	return nil
+}
+
+// compile validates a rule, filling in its defaults, and compiles its expression.
+func (e *Engine) compile(rule *model.Rule) (*compiled, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("%w: a rule needs a name", ErrInvalidRule)
+	}
+	if rule.Severity == "" {
+		rule.Severity = model.SeverityInfo
+	}
+	if !slices.Contains([]string{model.SeverityInfo, model.SeverityWarning, model.SeverityCritical}, rule.Severity) {
+		return nil, fmt.Errorf("%w: rule %s: severity must be info, warning or critical", ErrInvalidRule, rule.Name)
+	}
+	if rule.Cooldown < 0 {
+		return nil, fmt.Errorf("%w: rule %s: negative cooldown", ErrInvalidRule, rule.Name)
+	}
+	if rule.Cooldown == 0 {
+		rule.Cooldown = DefaultCooldown
+	}
+	if len(rule.Actions) == 0 {
+		rule.Actions = []string{ActionLog}
+	}
+	for _, action := range rule.Actions {
+		if !slices.Contains([]string{ActionLog, ActionWebhook, ActionMQTT}, action) {
+			return nil, fmt.Errorf("%w: rule %s: unknown action %q", ErrInvalidRule, rule.Name, action)
+		}
+	}
+	expr, err := Compile(rule.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: rule %s: %v", ErrInvalidRule, rule.Name, err)
+	}
+	return &compiled{Rule: *rule, expr: expr}, nil
+}
+
+// Rules returns the rules of the configuration followed by the ones stored in the database.
+func (e *Engine) Rules() []model.Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := make([]model.Rule, 0, len(e.rules))
+	for _, c := range e.rules {
+		rules = append(rules, c.Rule)
+	}
+	return rules
+}
+
+// Rule returns a stored rule, or nil if there is none with that ID.
+func (e *Engine) Rule(id int64) (*model.Rule, error) {
+	return e.db.GetRule(id)
+}
+
+// SaveRule validates a rule and stores it, creating it when its ID is 0.
+// It returns false when there is no stored rule with its ID.
+func (e *Engine) SaveRule(rule *model.Rule) (bool, error) {
+	if _, err := e.compile(rule); err != nil {
+		return false, err
+	}
+	for _, other := range e.Rules() {
+		if other.Name == rule.Name && (other.ReadOnly || other.ID != rule.ID) {
+			return false, fmt.Errorf("%w: duplicate rule name %q", ErrInvalidRule, rule.Name)
+		}
+	}
+
+	found := true
+	var err error
+	if rule.ID == 0 {
+		err = e.db.CreateRule(rule)
+	} else {
+		found, err = e.db.UpdateRule(rule)
+	}
+	if err != nil || !found {
+		return found, err
+	}
+	return true, e.reload()
+}
+
+// DeleteRule deletes a stored rule. It returns false when there is no stored rule with that ID.
+func (e *Engine) DeleteRule(id int64) (bool, error) {
+	found, err := e.db.DeleteRule(id)
+	if err != nil || !found {
+		return found, err
+	}
+	return true, e.reload()
+}
+
+// Run evaluates the rules against the aircraft of the received events until ctx is canceled.
+func (e *Engine) Run(ctx context.Context, received <-chan events.Event) error {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-received:
+			if !ok {
+				return nil
+			}
+			e.Evaluate(ev)
+		case <-ticker.C:
+			e.prune()
+		}
+	}
+}
+
+// prune forgets the aircraft whose cooldown is over.
+func (e *Engine) prune() {
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, last := range e.fired {
+		i := slices.IndexFunc(e.rules, func(c *compiled) bool { return c.Name == key.rule })
+		if i < 0 || now.Sub(last) >= time.Duration(e.rules[i].Cooldown)*time.Second {
+			delete(e.fired, key)
+		}
+	}
+}
+
+// Evaluate runs the actions of the enabled rules matching the aircraft of an event, unless the
+// rule is cooling down for that aircraft, and returns the RuleMatched events of the rules that fired.
+func (e *Engine) Evaluate(ev events.Event) []events.Event {
+	if ev.Flight == nil {
+		return nil
+	}
+	env := &Env{Flight: ev.Flight, Event: ev.Type}
+	now := e.now()
+
+	e.mu.Lock()
+	var matches []events.Event
+	var fired []*compiled
+	for _, rule := range e.rules {
+		if !rule.Enabled || !rule.expr.Eval(env) {
+			continue
+		}
+		key := cooldownKey{rule.Name, ev.Flight.Icao24}
+		if last, ok := e.fired[key]; ok && now.Sub(last) < time.Duration(rule.Cooldown)*time.Second {
+			continue
+		}
+		e.fired[key] = now
+		fired = append(fired, rule)
+		matches = append(matches, events.Event{
+			Type:     events.RuleMatched,
+			Time:     now,
+			Site:     ev.Site,
+			Flight:   ev.Flight,
+			Sighting: ev.Sighting,
+			Rule:     rule.Name,
+			Severity: rule.Severity,
+		})
+	}
+	actions := maps.Clone(e.actions)
+	e.mu.Unlock()
+
+	for i, rule := range fired {
+		for _, name := range rule.Actions {
+			action, ok := actions[name]
+			if !ok {
+				log.Printf("Rule %s: action %s is not configured", rule.Name, name)
+				continue
+			}
+			if err := action(matches[i]); err != nil {
+				log.Printf("Rule %s: action %s failed: %v", rule.Name, name, err)
+			}
+		}
+	}
+	return matches
+}
+
+func logAction(e events.Event) error {
+	log.Printf("Rule %s (%s) matched %s (%s) over %s", e.Rule, e.Severity, e.Flight.Ident, e.Flight.Icao24, e.Site)
+	return nil
+}
+
+// DryRunMatch is a logged flight an expression holds for.
+type DryRunMatch struct {
+	Flight   *model.FlightInfo `json:"flight"`
+	LastSeen time.Time         `json:"last_seen"`
+}
+
+// DryRun evaluates an expression against the last limit logged flights, newest first, and returns
+// the number of flights evaluated with the ones it holds for. Cooldowns are not applied.
+func (e *Engine) DryRun(expression string, limit int) ([]DryRunMatch, int, error) {
+	expr, err := Compile(expression)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	flights, lastSeens, err := e.db.GetAllFlights(limit, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := []DryRunMatch{}
+	for i, flight := range flights {
+		if expr.Eval(&Env{Flight: flight}) {
+			matches = append(matches, DryRunMatch{Flight: flight, LastSeen: lastSeens[i]})
+		}
+	}
+	return matches, len(flights), nil
+}
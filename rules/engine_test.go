@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/memory"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDB(t *testing.T) *memory.Store {
+	t.Helper()
+	return memory.New()
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := New([]config.RuleConfig{
+		{Name: "heavy", Expression: `aircraft_type in ["A388", "B748"] and distance_m < 8000`, Severity: "warning", Actions: []string{"webhook", "log"}},
+		{Name: "low swiss", Expression: `operator_icao == "SWR" and altitude < 3000`, Cooldown: 60, Actions: []string{"mqtt"}},
+	}, newTestDB(t))
+	assert.NoError(t, err)
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+
+	var webhooks, mqtts []events.Event
+	engine.SetAction(ActionWebhook, func(e events.Event) error {
+		webhooks = append(webhooks, e)
+		return nil
+	})
+	engine.SetAction(ActionMQTT, func(e events.Event) error {
+		mqtts = append(mqtts, e)
+		return errors.New("not connected") // failures are logged
+	})
+
+	a388 := &model.FlightInfo{Ident: "SIA22", Icao24: "76cdb4", AircraftType: "A388", Distance: 6000, BaroAltitude: 9000}
+	swiss := &model.FlightInfo{Ident: "SWR12", Icao24: "4b1805", OperatorIcao: "SWR", Distance: 20000, BaroAltitude: 2000}
+
+	matches := engine.Evaluate(events.Event{Type: events.EnrichmentCompleted, Site: "home", Flight: a388})
+	assert.Len(t, matches, 1)
+	assert.Equal(t, events.RuleMatched, matches[0].Type)
+	assert.Equal(t, "heavy", matches[0].Rule)
+	assert.Equal(t, "warning", matches[0].Severity)
+	assert.Equal(t, "home", matches[0].Site)
+	assert.Len(t, webhooks, 1)
+
+	engine.Evaluate(events.Event{Type: events.EnrichmentCompleted, Site: "home", Flight: swiss})
+	assert.Len(t, mqtts, 1)
+	assert.Equal(t, "info", mqtts[0].Severity)
+
+	// Each rule cools down per aircraft
+	now = now.Add(time.Minute)
+	assert.Empty(t, engine.Evaluate(events.Event{Type: events.EnrichmentCompleted, Flight: a388}))
+	assert.Len(t, engine.Evaluate(events.Event{Type: events.EnrichmentCompleted, Flight: swiss}), 1)
+	other := *a388
+	other.Icao24 = "76cdb5"
+	assert.Len(t, engine.Evaluate(events.Event{Type: events.EnrichmentCompleted, Flight: &other}), 1)
+
+	now = now.Add(DefaultCooldown * time.Second)
+	assert.Len(t, engine.Evaluate(events.Event{Type: events.EnrichmentCompleted, Flight: a388}), 1)
+	assert.Len(t, webhooks, 3)
+
+	// Only the aircraft that just fired again is still cooling down
+	engine.prune()
+	assert.Len(t, engine.fired, 1)
+	now = now.Add(DefaultCooldown * time.Second)
+	engine.prune()
+	assert.Empty(t, engine.fired)
+}
+
+func TestEngine_SaveRule(t *testing.T) {
+	db := newTestDB(t)
+	engine, err := New([]config.RuleConfig{{Name: "heavy", Expression: `aircraft_type == "A388"`}}, db)
+	assert.NoError(t, err)
+
+	rule := &model.Rule{Name: "low", Expression: `altitude < 300`, Enabled: true}
+	found, err := engine.SaveRule(rule)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NotZero(t, rule.ID)
+	assert.Equal(t, DefaultCooldown, rule.Cooldown)
+	assert.Equal(t, []string{"log"}, rule.Actions)
+
+	rules := engine.Rules()
+	assert.Len(t, rules, 2)
+	assert.True(t, rules[0].ReadOnly)
+	assert.Equal(t, "low", rules[1].Name)
+
+	low := &model.FlightInfo{Icao24: "abc", BaroAltitude: 100}
+	assert.Len(t, engine.Evaluate(events.Event{Flight: low}), 1)
+
+	// Disabled rules are not evaluated
+	rule.Enabled = false
+	_, err = engine.SaveRule(rule)
+	assert.NoError(t, err)
+	low.Icao24 = "def"
+	assert.Empty(t, engine.Evaluate(events.Event{Flight: low}))
+
+	for _, invalid := range []*model.Rule{
+		{Name: "heavy", Expression: `true`},
+		{Name: "", Expression: `true`},
+		{Name: "bad", Expression: `altitude <`},
+		{Name: "bad", Expression: `true`, Severity: "fatal"},
+		{Name: "bad", Expression: `true`, Actions: []string{"email"}},
+		{Name: "bad", Expression: `true`, Cooldown: -1},
+	} {
+		_, err := engine.SaveRule(invalid)
+		assert.ErrorIs(t, err, ErrInvalidRule, invalid.Name)
+	}
+
+	found, err = engine.SaveRule(&model.Rule{ID: 42, Name: "missing", Expression: `true`})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	found, err = engine.DeleteRule(rule.ID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Len(t, engine.Rules(), 1)
+
+	// Stored rules are loaded at startup
+	_, err = engine.SaveRule(&model.Rule{Name: "stored", Expression: `true`, Enabled: true})
+	assert.NoError(t, err)
+	reloaded, err := New(nil, db)
+	assert.NoError(t, err)
+	assert.Len(t, reloaded.Rules(), 1)
+	assert.Equal(t, "stored", reloaded.Rules()[0].Name)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New([]config.RuleConfig{{Name: "bad", Expression: `speed > 3`}}, newTestDB(t))
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	db := newTestDB(t)
+	assert.NoError(t, db.ClearFlightLog())
+	assert.NoError(t, db.LogFlight("SWR12", &model.FlightInfo{Ident: "SWR12", OperatorIcao: "SWR", BaroAltitude: 2000}))
+	assert.NoError(t, db.LogFlight("DLH4", &model.FlightInfo{Ident: "DLH4", OperatorIcao: "DLH", BaroAltitude: 1000}))
+	assert.NoError(t, db.LogFlight("SWR14", &model.FlightInfo{Ident: "SWR14", OperatorIcao: "SWR", BaroAltitude: 9000}))
+
+	engine, err := New(nil, db)
+	assert.NoError(t, err)
+	matches, evaluated, err := engine.DryRun(`operator_icao == "SWR" and altitude < 3000`, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, evaluated)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "SWR12", matches[0].Flight.Ident)
+
+	_, _, err = engine.DryRun(`altitude <`, 100)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
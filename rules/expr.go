@@ -0,0 +1,574 @@
+package rules
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// Env is what expressions are evaluated against.
+type Env struct {
+	Flight *model.FlightInfo
+	Event  events.Type
+}
+
+// kind is the static type of an expression.
+type kind int
+
+const (
+	kindBool kind = iota
+	kindNumber
+	kindString
+	kindList
+)
+
+func (k kind) String() string {
+	return [...]string{"bool", "number", "string", "list"}[k]
+}
+
+type field struct {
+	kind kind
+	get  func(f *model.FlightInfo, e *Env) interface{}
+}
+
+func stringField(get func(f *model.FlightInfo) string) field {
+	return field{kindString, func(f *model.FlightInfo, _ *Env) interface{} { return get(f) }}
+}
+
+func numberField(get func(f *model.FlightInfo) float64) field {
+	return field{kindNumber, func(f *model.FlightInfo, _ *Env) interface{} { return get(f) }}
+}
+
+// fields are the identifiers expressions can refer to.
+var fields = map[string]field{
+	"ident":            stringField(func(f *model.FlightInfo) string { return f.Ident }),
+	"icao24":           stringField(func(f *model.FlightInfo) string { return f.Icao24 }),
+	"registration":     stringField(func(f *model.FlightInfo) string { return f.Registration }),
+	"operator":         stringField(func(f *model.FlightInfo) string { return f.Operator }),
+	"operator_icao":    stringField(func(f *model.FlightInfo) string { return f.OperatorIcao }),
+	"operator_iata":    stringField(func(f *model.FlightInfo) string { return f.OperatorIata }),
+	"aircraft_type":    stringField(func(f *model.FlightInfo) string { return f.AircraftType }),
+	"origin_icao":      stringField(func(f *model.FlightInfo) string { return f.Origin.CodeIcao }),
+	"origin_iata":      stringField(func(f *model.FlightInfo) string { return f.Origin.CodeIata }),
+	"origin_city":      stringField(func(f *model.FlightInfo) string { return f.Origin.City }),
+	"destination_icao": stringField(func(f *model.FlightInfo) string { return f.Destination.CodeIcao }),
+	"destination_iata": stringField(func(f *model.FlightInfo) string { return f.Destination.CodeIata }),
+	"destination_city": stringField(func(f *model.FlightInfo) string { return f.Destination.City }),
+	"status":           stringField(func(f *model.FlightInfo) string { return f.Status }),
+	"squawk":           stringField(func(f *model.FlightInfo) string { return f.Squawk }),
+	"site":             stringField(func(f *model.FlightInfo) string { return f.Site }),
+	"distance_m":       numberField(func(f *model.FlightInfo) float64 { return f.Distance }),
+	"altitude":         numberField(func(f *model.FlightInfo) float64 { return f.BaroAltitude }),
+	"azimuth":          numberField(func(f *model.FlightInfo) float64 { return f.Azimuth }),
+	"elevation":        numberField(func(f *model.FlightInfo) float64 { return f.Elevation }),
+	"slant_range_m":    numberField(func(f *model.FlightInfo) float64 { return f.SlantRange }),
+	"geo_altitude":     numberField(func(f *model.FlightInfo) float64 { return f.GeoAltitude }),
+	"velocity":         numberField(func(f *model.FlightInfo) float64 { return f.Velocity }),
+	"vertical_rate":    numberField(func(f *model.FlightInfo) float64 { return f.VerticalRate }),
+	"true_track":       numberField(func(f *model.FlightInfo) float64 { return f.TrueTrack }),
+	"latitude":         numberField(func(f *model.FlightInfo) float64 { return f.Latitude }),
+	"longitude":        numberField(func(f *model.FlightInfo) float64 { return f.Longitude }),
+	"co2_kg":           numberField(func(f *model.FlightInfo) float64 { return f.CO2KG }),
+	"route_distance":   numberField(func(f *model.FlightInfo) float64 { return float64(f.RouteDistance) }),
+	"on_ground": {kindBool, func(f *model.FlightInfo, _ *Env) interface{} {
+		return f.OnGround
+	}},
+	"event": {kindString, func(_ *model.FlightInfo, e *Env) interface{} {
+		return string(e.Event)
+	}},
+}
+
+// Fields returns the names of the fields expressions can refer to, sorted.
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Expr is a compiled boolean expression.
+type Expr struct {
+	source string
+	root   node
+}
+
+// Compile parses a boolean expression over the fields, such as
+//
+//	aircraft_type in ["A388", "B748"] and distance_m < 8000
+//
+// Expressions combine comparisons (==, !=, <, <=, >, >=), membership in a list ([not] in),
+// regular expression matches (=~) and the boolean operators and, or and not, with parentheses.
+// Types are checked at compile time, so evaluation cannot fail.
+func Compile(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	if root.kind() != kindBool {
+		return nil, fmt.Errorf("expression is a %s, not a bool", root.kind())
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// Eval reports whether the expression holds for env.
+func (e *Expr) Eval(env *Env) bool {
+	flight := env.Flight
+	if flight == nil {
+		flight = &model.FlightInfo{}
+	}
+	return e.root.eval(flight, env).(bool)
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// node is a typed node of the syntax tree.
+type node interface {
+	kind() kind
+	eval(f *model.FlightInfo, env *Env) interface{}
+}
+
+type literal struct {
+	k     kind
+	value interface{}
+}
+
+func (n *literal) kind() kind                               { return n.k }
+func (n *literal) eval(*model.FlightInfo, *Env) interface{} { return n.value }
+
+type listLiteral struct {
+	elem   kind
+	values []interface{}
+}
+
+func (n *listLiteral) kind() kind                               { return kindList }
+func (n *listLiteral) eval(*model.FlightInfo, *Env) interface{} { return n.values }
+
+type fieldRef struct {
+	field
+}
+
+func (n *fieldRef) kind() kind { return n.field.kind }
+func (n *fieldRef) eval(f *model.FlightInfo, env *Env) interface{} {
+	return n.get(f, env)
+}
+
+type notNode struct {
+	x node
+}
+
+func (n *notNode) kind() kind { return kindBool }
+func (n *notNode) eval(f *model.FlightInfo, env *Env) interface{} {
+	return !n.x.eval(f, env).(bool)
+}
+
+type logical struct {
+	and  bool
+	l, r node
+}
+
+func (n *logical) kind() kind { return kindBool }
+func (n *logical) eval(f *model.FlightInfo, env *Env) interface{} {
+	l := n.l.eval(f, env).(bool)
+	if n.and {
+		return l && n.r.eval(f, env).(bool)
+	}
+	return l || n.r.eval(f, env).(bool)
+}
+
+type comparison struct {
+	op   string
+	l, r node
+}
+
+func (n *comparison) kind() kind { return kindBool }
+func (n *comparison) eval(f *model.FlightInfo, env *Env) interface{} {
+	l, r := n.l.eval(f, env), n.r.eval(f, env)
+	switch n.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	var c int
+	if n.l.kind() == kindNumber {
+		c = cmp.Compare(l.(float64), r.(float64))
+	} else {
+		c = strings.Compare(l.(string), r.(string))
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+type membership struct {
+	negate bool
+	x      node
+	list   *listLiteral
+}
+
+func (n *membership) kind() kind { return kindBool }
+func (n *membership) eval(f *model.FlightInfo, env *Env) interface{} {
+	return slices.Contains(n.list.values, n.x.eval(f, env)) != n.negate
+}
+
+type match struct {
+	x  node
+	re *regexp.Regexp
+}
+
+func (n *match) kind() kind { return kindBool }
+func (n *match) eval(f *model.FlightInfo, env *Env) interface{} {
+	return n.re.MatchString(n.x.eval(f, env).(string))
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "-"}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, source[start:i], start})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(source) && unicode.IsDigit(rune(source[i+1]))):
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, source[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			for i < len(source) && rune(source[i]) != c {
+				if source[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("at %d: unterminated string", start)
+			}
+			i++
+			text := source[start:i]
+			if c == '\'' {
+				text = `"` + strings.ReplaceAll(text[1:len(text)-1], `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: invalid string %s", start, source[start:i])
+			}
+			tokens = append(tokens, token{tokString, value, start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %d: unexpected character %q", i, c)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(source)}), nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token when it is one of the given operators or keywords.
+func (p *parser) accept(texts ...string) (token, bool) {
+	tok := p.peek()
+	if (tok.kind == tokOp || tok.kind == tokIdent) && slices.Contains(texts, tok.text) {
+		return p.next(), true
+	}
+	return tok, false
+}
+
+func (p *parser) expect(text string) error {
+	if tok, ok := p.accept(text); !ok {
+		return p.errorf(tok, "expected %q, found %s", text, tok)
+	}
+	return nil
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("or", "||")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, l, r); err != nil {
+			return nil, err
+		}
+		l = &logical{and: false, l: l, r: r}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("and", "&&")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, l, r); err != nil {
+			return nil, err
+		}
+		l = &logical{and: true, l: l, r: r}
+	}
+}
+
+func (p *parser) checkBool(tok token, operands ...node) error {
+	for _, n := range operands {
+		if n.kind() != kindBool {
+			return p.errorf(tok, "%s needs bool operands, found a %s", tok, n.kind())
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	// "not in" is handled by parseComparison
+	if tok, ok := p.accept("not", "!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, x); err != nil {
+			return nil, err
+		}
+		return &notNode{x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok, ok := p.accept("==", "!=", "<", "<=", ">", ">="); ok {
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if l.kind() != r.kind() || l.kind() == kindList {
+			return nil, p.errorf(tok, "cannot compare a %s with a %s", l.kind(), r.kind())
+		}
+		if tok.text != "==" && tok.text != "!=" && l.kind() == kindBool {
+			return nil, p.errorf(tok, "cannot order bools")
+		}
+		return &comparison{op: tok.text, l: l, r: r}, nil
+	}
+
+	if tok, ok := p.accept("=~"); ok {
+		pattern := p.next()
+		if pattern.kind != tokString {
+			return nil, p.errorf(pattern, "=~ needs a string pattern, found %s", pattern)
+		}
+		if l.kind() != kindString {
+			return nil, p.errorf(tok, "=~ needs a string, found a %s", l.kind())
+		}
+		re, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, p.errorf(pattern, "invalid pattern: %v", err)
+		}
+		return &match{x: l, re: re}, nil
+	}
+
+	negate := false
+	if tok := p.peek(); tok.kind == tokIdent && tok.text == "not" && p.tokens[p.pos+1].text == "in" {
+		p.next()
+		negate = true
+	}
+	if tok, ok := p.accept("in"); ok {
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list, isList := r.(*listLiteral)
+		if !isList {
+			return nil, p.errorf(tok, "in needs a list, found a %s", r.kind())
+		}
+		if len(list.values) > 0 && list.elem != l.kind() {
+			return nil, p.errorf(tok, "cannot look for a %s in a list of %ss", l.kind(), list.elem)
+		}
+		return &membership{negate: negate, x: l, list: list}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return p.number(tok, 1)
+	case tokString:
+		return &literal{kindString, tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literal{kindBool, tok.text == "true"}, nil
+		case "and", "or", "not", "in":
+			return nil, p.errorf(tok, "unexpected %s", tok)
+		}
+		f, ok := fields[tok.text]
+		if !ok {
+			return nil, p.errorf(tok, "unknown field %s", tok)
+		}
+		return &fieldRef{f}, nil
+	case tokOp:
+		switch tok.text {
+		case "-":
+			number := p.next()
+			if number.kind != tokNumber {
+				return nil, p.errorf(number, "expected a number, found %s", number)
+			}
+			return p.number(number, -1)
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			return p.parseList(tok)
+		}
+	}
+	return nil, p.errorf(tok, "unexpected %s", tok)
+}
+
+func (p *parser) number(tok token, sign float64) (node, error) {
+	value, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		return nil, p.errorf(tok, "invalid number %s", tok)
+	}
+	return &literal{kindNumber, sign * value}, nil
+}
+
+func (p *parser) parseList(open token) (node, error) {
+	list := &listLiteral{}
+	if _, ok := p.accept("]"); ok {
+		return list, nil
+	}
+	for {
+		x, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		value, ok := x.(*literal)
+		if !ok {
+			return nil, p.errorf(open, "lists can only hold literals")
+		}
+		if len(list.values) > 0 && value.k != list.elem {
+			return nil, p.errorf(open, "lists cannot mix %ss and %ss", list.elem, value.k)
+		}
+		list.elem = value.k
+		list.values = append(list.values, value.value)
+
+		if _, ok := p.accept("]"); ok {
+			return list, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	env := &Env{
+		Event: events.EnrichmentCompleted,
+		Flight: &model.FlightInfo{
+			Ident:        "SWR38",
+			OperatorIcao: "SWR",
+			AircraftType: "A388",
+			Destination:  model.AirportDetail{CodeIata: "JFK", City: "New York"},
+			Distance:     6500,
+			BaroAltitude: 2800,
+			VerticalRate: -4.5,
+			Squawk:       "7700",
+		},
+	}
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`aircraft_type in ["A388", "B748"] and distance_m < 8000`, true},
+		{`aircraft_type in ["A388", "B748"] and distance_m < 5000`, false},
+		{`operator_icao == "SWR" and altitude < 3000`, true},
+		{`operator_icao == 'SWR' && altitude >= 3000`, false},
+		{`operator_icao != "SWR" or squawk == "7700"`, true},
+		{`not on_ground and vertical_rate < -2`, true},
+		{`!(vertical_rate > -1.5)`, true},
+		{`aircraft_type not in ["A388"]`, false},
+		{`aircraft_type in []`, false},
+		{`ident =~ "^SWR[0-9]+$"`, true},
+		{`destination_city =~ "(?i)^new"`, true},
+		{`destination_iata < "LAX"`, true},
+		{`event == "enrichment_completed"`, true},
+		{`true`, true},
+		{`(operator_icao == "DLH" or operator_icao == "SWR") and (distance_m < 7000.5 or altitude < 100)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			expr, err := Compile(tt.expression)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.expected, expr.Eval(env))
+		})
+	}
+}
+
+func TestEval_NoFlight(t *testing.T) {
+	expr, err := Compile(`distance_m == 0 and ident == ""`)
+	assert.NoError(t, err)
+	assert.True(t, expr.Eval(&Env{}))
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		expression string
+		message    string
+	}{
+		{``, `at 0: unexpected end of expression`},
+		{`altitude`, `expression is a number, not a bool`},
+		{`speed > 100`, `at 0: unknown field "speed"`},
+		{`altitude < "high"`, `at 9: cannot compare a number with a string`},
+		{`on_ground < true`, `at 10: cannot order bools`},
+		{`altitude in ["A388"]`, `at 9: cannot look for a number in a list of strings`},
+		{`aircraft_type in "A388"`, `at 14: in needs a list, found a string`},
+		{`aircraft_type in ["A388", 1]`, `at 17: lists cannot mix strings and numbers`},
+		{`altitude < 100 and`, `at 18: unexpected end of expression`},
+		{`altitude < 100 and distance_m`, `at 15: "and" needs bool operands, found a number`},
+		{`(altitude < 100`, `at 15: expected ")", found end of expression`},
+		{`altitude < 100)`, `at 14: unexpected ")"`},
+		{`ident == "SWR`, `at 9: unterminated string`},
+		{`ident =~ "["`, "at 9: invalid pattern: error parsing regexp: missing closing ]: `[`"},
+		{`altitude # 3`, `at 9: unexpected character '#'`},
+		{`not altitude`, `at 0: "not" needs bool operands, found a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Compile(tt.expression)
+			assert.EqualError(t, err, tt.message)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron(t *testing.T) {
+	// 2025-01-06 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2025, 1, 6, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expr     string
+		t        time.Time
+		expected bool
+	}{
+		{"* * * * *", monday(3, 17), true},
+		{"* 0-5 * * *", monday(3, 17), true},
+		{"* 0-5 * * *", monday(6, 0), false},
+		{"* 22,23 * * *", monday(23, 59), true},
+		{"*/15 * * * *", monday(10, 30), true},
+		{"*/15 * * * *", monday(10, 31), false},
+		{"0-30/10 * * * *", monday(10, 20), true},
+		{"* * * * 1-5", monday(12, 0), true},
+		{"* * * * 0,6", monday(12, 0), false},
+		{"* * * * 7", time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC), true},
+		{"* * 1 * 1", monday(12, 0), true}, // either day field matches
+		{"* * 1 * 2", monday(12, 0), false},
+		{"* * * 2 *", monday(12, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, c.Matches(tt.t))
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* 5-1 * * *", "*/0 * * * *", "a * * * *", "* * 0 * *"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
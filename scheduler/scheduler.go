@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// RetryAfter is implemented by errors of upstreams asking to wait before the next request.
+type RetryAfter interface {
+	RetryAfter() time.Duration
+}
+
+// Scheduler decides how long to wait before polling an area again.
+//
+// It polls at the regular interval, sooner when an aircraft is about to enter or leave
+// the area, and backs off exponentially while the sky is empty or requests fail.
+// During quiet hours it polls at the quiet interval.
+type Scheduler struct {
+	area       geofence.Area
+	interval   time.Duration
+	min        time.Duration
+	max        time.Duration
+	quiet      time.Duration
+	quietHours []*Cron
+	location   *time.Location
+	backoff    time.Duration
+}
+
+// New creates a Scheduler for an area polled every interval.
+// Quiet hours are evaluated in location.
+func New(area geofence.Area, interval time.Duration, cfg config.ScheduleConfig, location *time.Location) (*Scheduler, error) {
+	s := &Scheduler{
+		area:     area,
+		interval: interval,
+		min:      time.Duration(cfg.MinInterval) * time.Second,
+		max:      time.Duration(cfg.MaxInterval) * time.Second,
+		quiet:    time.Duration(cfg.QuietInterval) * time.Second,
+		location: location,
+	}
+	if s.min <= 0 || s.min > interval {
+		s.min = interval
+	}
+	if s.max < interval {
+		s.max = interval
+	}
+	if s.quiet <= 0 {
+		s.quiet = s.max
+	}
+	if s.location == nil {
+		s.location = time.Local
+	}
+
+	for _, expr := range cfg.QuietHours {
+		c, err := ParseCron(expr)
+		if err != nil {
+			return nil, err
+		}
+		s.quietHours = append(s.quietHours, c)
+	}
+	return s, nil
+}
+
+// Next returns the delay before the next poll, given the aircraft returned by the
+// poll that just ran at now, or the error it failed with.
+// The aircraft may include the ones around the area, which are checked for approaching it.
+func (s *Scheduler) Next(now time.Time, states []model.Flight, err error) time.Duration {
+	if err != nil {
+		var retry RetryAfter
+		if errors.As(err, &retry) && retry.RetryAfter() > 0 {
+			s.backoff = max(s.backoff, retry.RetryAfter())
+			return s.backoff
+		}
+		return s.backOff()
+	}
+
+	if s.Quiet(now) {
+		s.backoff = 0
+		return s.quiet
+	}
+
+	delay, busy := s.crossing(states)
+	if !busy {
+		return s.backOff()
+	}
+	s.backoff = 0
+	return delay
+}
+
+// Quiet reports whether t falls in the quiet hours.
+func (s *Scheduler) Quiet(t time.Time) bool {
+	t = t.In(s.location)
+	for _, c := range s.quietHours {
+		if c.Matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// backOff doubles the delay after each consecutive empty or failed poll, up to the maximum interval.
+func (s *Scheduler) backOff() time.Duration {
+	if s.backoff < s.interval {
+		s.backoff = s.interval
+	} else {
+		s.backoff = min(s.backoff*2, s.max)
+	}
+	return s.backoff
+}
+
+// crossing returns how long until the first aircraft enters or leaves the area, bounded by the
+// minimum and regular interval, and whether any aircraft is inside or approaching the area.
+func (s *Scheduler) crossing(states []model.Flight) (time.Duration, bool) {
+	delay := s.interval
+	busy := false
+	for i := range states {
+		state := &states[i]
+		if state.OnGround || (state.Latitude == 0 && state.Longitude == 0) {
+			continue
+		}
+		inside := s.area.Contains(state.Latitude, state.Longitude)
+		t, crosses := crossingTime(s.area, state, inside, s.interval)
+		if inside || crosses {
+			busy = true
+		}
+		if crosses {
+			delay = min(delay, t)
+		}
+	}
+	return max(delay, s.min), busy
+}
+
+// crossingSteps is the number of positions extrapolated within the horizon.
+const crossingSteps = 60
+
+// crossingTime extrapolates the aircraft along its track and returns, for an aircraft inside
+// the area, the last time it is still inside, or for an aircraft outside the first time it is
+// inside. It reports false when the aircraft does not cross the boundary within horizon.
+func crossingTime(area geofence.Area, state *model.Flight, inside bool, horizon time.Duration) (time.Duration, bool) {
+	if state.Velocity <= 0 {
+		return 0, false
+	}
+	step := horizon / crossingSteps
+	for t := step; t <= horizon; t += step {
+		lat, lon := haversine.Destination(state.Latitude, state.Longitude, state.TrueTrack, state.Velocity*t.Seconds()/1000)
+		if area.Contains(lat, lon) != inside {
+			if inside {
+				return t - step, true
+			}
+			return t, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type retryError time.Duration
+
+func (e retryError) Error() string             { return "rate limited" }
+func (e retryError) RetryAfter() time.Duration { return time.Duration(e) }
+
+func newTestScheduler(t *testing.T, cfg config.ScheduleConfig) *Scheduler {
+	t.Helper()
+	area := geofence.Circle{Latitude: 47.3769, Longitude: 8.5417, RadiusKm: 10}
+	s, err := New(area, 5*time.Minute, cfg, time.UTC)
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	return s
+}
+
+func TestNext_EmptySkyBacksOff(t *testing.T) {
+	s := newTestScheduler(t, config.ScheduleConfig{MinInterval: 15, MaxInterval: 1200})
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 5*time.Minute, s.Next(now, nil, nil))
+	assert.Equal(t, 10*time.Minute, s.Next(now, nil, nil))
+	assert.Equal(t, 20*time.Minute, s.Next(now, nil, nil))
+	assert.Equal(t, 20*time.Minute, s.Next(now, nil, nil))
+
+	// An aircraft inside the area resets the back off
+	inside := []model.Flight{{Latitude: 47.3769, Longitude: 8.5417}}
+	assert.Equal(t, 5*time.Minute, s.Next(now, inside, nil))
+}
+
+func TestNext_NoBackOffByDefault(t *testing.T) {
+	s := newTestScheduler(t, config.ScheduleConfig{MinInterval: 15})
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	// Without max_interval an empty sky keeps the site interval
+	for range 3 {
+		assert.Equal(t, 5*time.Minute, s.Next(now, nil, nil))
+	}
+}
+
+func TestNext_CrossingAircraft(t *testing.T) {
+	s := newTestScheduler(t, config.ScheduleConfig{MinInterval: 15, MaxInterval: 1200})
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	// 5 km from the center flying east at 250 m/s leaves the 10 km circle in about 20 seconds
+	leaving := []model.Flight{{Latitude: 47.3769, Longitude: 8.6080, Velocity: 250, TrueTrack: 90}}
+	delay := s.Next(now, leaving, nil)
+	assert.GreaterOrEqual(t, delay, 15*time.Second)
+	assert.Less(t, delay, 30*time.Second)
+
+	// 20 km west flying east at 100 m/s enters the circle in about 100 seconds
+	approaching := []model.Flight{{Latitude: 47.3769, Longitude: 8.2760, Velocity: 100, TrueTrack: 90}}
+	delay = s.Next(now, approaching, nil)
+	assert.Greater(t, delay, 90*time.Second)
+	assert.Less(t, delay, 120*time.Second)
+
+	// Flying away from the area does not count as traffic
+	departing := []model.Flight{{Latitude: 47.3769, Longitude: 8.2760, Velocity: 100, TrueTrack: 270}}
+	assert.Equal(t, 5*time.Minute, s.Next(now, departing, nil))
+	assert.Equal(t, 10*time.Minute, s.Next(now, departing, nil))
+}
+
+func TestNext_Errors(t *testing.T) {
+	s := newTestScheduler(t, config.ScheduleConfig{MaxInterval: 1200})
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 5*time.Minute, s.Next(now, nil, errors.New("timeout")))
+	assert.Equal(t, 10*time.Minute, s.Next(now, nil, errors.New("timeout")))
+	assert.Equal(t, time.Hour, s.Next(now, nil, retryError(time.Hour)))
+}
+
+func TestNext_QuietHours(t *testing.T) {
+	s := newTestScheduler(t, config.ScheduleConfig{MaxInterval: 1200, QuietHours: []string{"* 0-5 * * *"}, QuietInterval: 3600})
+	inside := []model.Flight{{Latitude: 47.3769, Longitude: 8.5417}}
+
+	assert.Equal(t, time.Hour, s.Next(time.Date(2025, 1, 6, 3, 0, 0, 0, time.UTC), inside, nil))
+	assert.Equal(t, 5*time.Minute, s.Next(time.Date(2025, 1, 6, 6, 0, 0, 0, time.UTC), inside, nil))
+}
+
+func TestNew_Defaults(t *testing.T) {
+	// Without schedule settings the interval stays fixed
+	s := newTestScheduler(t, config.ScheduleConfig{})
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Minute, s.Next(now, nil, nil))
+	assert.Equal(t, 5*time.Minute, s.Next(now, nil, nil))
+
+	_, err := New(geofence.Circle{}, time.Minute, config.ScheduleConfig{QuietHours: []string{"bad"}}, nil)
+	assert.Error(t, err)
+}
@@ -115,6 +115,17 @@ func main() {
 		if err := db.LogFlight(f.Ident, f); err != nil {
 			log.Printf("failed to log flight %s: %v", f.Ident, err)
 		}
+
+		obs := model.Observation{
+			Callsign: f.Ident,
+			Time:     time.Now().Add(-time.Duration(100-i) * time.Hour),
+			Distance: r.Float64() * 20000,
+			Altitude: 1000 + r.Float64()*10000,
+			Bearing:  r.Float64() * 360,
+		}
+		if _, err := db.RecordSighting(obs, 15*time.Minute); err != nil {
+			log.Printf("failed to record sighting %s: %v", f.Ident, err)
+		}
 	}
 
 	log.Printf("Sample database created at %s with 100 flight logs", dbPath)
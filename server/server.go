@@ -1,19 +1,28 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/carlo-colombo/sopra/config"
-	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/export"
+	"github.com/carlo-colombo/sopra/geofence"
 	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/noise"
+	"github.com/carlo-colombo/sopra/recurring"
+	"github.com/carlo-colombo/sopra/rules"
+	"github.com/carlo-colombo/sopra/storage"
 	"github.com/hako/durafmt"
 	// "github.com/carlo-colombo/sopra/service" // Removed as no longer used
 )
@@ -24,35 +33,47 @@ var indexHTML string
 //go:embed statics/flight_table.html
 var flightTableHTML string
 
+//go:embed statics/transits.html
+var transitsHTML string
+
 // FlightService defines the interface for the flight service.
 type FlightService interface {
-	GetFlightsInRadius(lat, lon, radius float64) ([]model.FlightInfo, error)
+	GetFlights(site string) ([]model.FlightInfo, error)
+	Overhead(site string) []model.FlightInfo
+	Transits(site string) []model.Transit
+	Upcoming(site string) []model.Prediction
+	Area(site string) geofence.Area
+	PauseWatch()
+	ResumeWatch()
+	WatchPaused() bool
+}
+
+// Store is the storage the server reads, and the dead webhook deliveries it requeues.
+type Store interface {
+	storage.Operators
+	storage.Flights
+	storage.Sightings
+	storage.Stats
+	storage.FirstSeen
+	storage.SquawkAlerts
+	storage.Positions
+	storage.RecurringFlights
+	storage.WebhookDeliveries
 }
 
 // Server holds the HTTP server and its dependencies.
 type Server struct {
 	service  FlightService
 	config   *config.Config
-	db       *database.DB
+	db       Store
 	template *template.Template
-}
-
-// formatTimeAgo returns a human-readable string indicating how long ago a time was.
-func formatTimeAgo(t time.Time) string {
-	d := time.Since(t).Truncate(time.Minute)
-	if d < time.Minute {
-		return "just now"
-	}
-	s := durafmt.Parse(d).LimitFirstN(2).String()
-	parts := strings.Split(s, " ")
-	if len(parts) == 4 {
-		return fmt.Sprintf("%s %s and %s %s ago", parts[0], parts[1], parts[2], parts[3])
-	}
-	return s + " ago"
+	http     *http.Server
+	rules    *rules.Engine
+	location *time.Location // of the days in the statistics
 }
 
 // NewServer creates a new Server instance.
-func NewServer(s FlightService, cfg *config.Config, db *database.DB) *Server {
+func NewServer(s FlightService, cfg *config.Config, db Store) *Server {
 	loc, err := time.LoadLocation(cfg.Timezone)
 	if err != nil {
 		log.Printf("failed to load location %s: %v. Falling back to Local", cfg.Timezone, err)
@@ -63,7 +84,29 @@ func NewServer(s FlightService, cfg *config.Config, db *database.DB) *Server {
 		"formatTime": func(t time.Time) string {
 			return t.In(loc).Format("02/01/2006 15:04")
 		},
-		"timeAgo": formatTimeAgo,
+		"timeAgo": model.TimeAgo,
+		"formatAltitude": func(m float64) string {
+			return formatNumberWithThousandsSeparator(m)
+		},
+		"formatSpeed": func(mps float64) string {
+			return formatNumberWithThousandsSeparator(mps * 3.6)
+		},
+		"formatKm": func(m float64) string {
+			return formatNumberWithThousandsSeparator(m / 1000)
+		},
+		"formatDuration": func(d time.Duration) string {
+			if d < time.Minute {
+				return "< 1 minute"
+			}
+			return durafmt.Parse(d.Truncate(time.Minute)).LimitFirstN(2).String()
+		},
+		"kindName": func(kind string) string {
+			return strings.ReplaceAll(kind, "_", " ")
+		},
+		"formatClock": func(t time.Time) string {
+			return t.In(loc).Format("15:04:05")
+		},
+		"compassPoint": model.CompassPoint,
 	}
 
 	tmpl, err := template.New("index").Funcs(funcMap).Parse(indexHTML)
@@ -75,12 +118,42 @@ func NewServer(s FlightService, cfg *config.Config, db *database.DB) *Server {
 	if err != nil {
 		log.Fatalf("failed to parse flight_table template: %v", err)
 	}
-	return &Server{
+
+	_, err = tmpl.New("transits").Parse(transitsHTML)
+	if err != nil {
+		log.Fatalf("failed to parse transits template: %v", err)
+	}
+	srv := &Server{
 		service:  s,
 		config:   cfg,
 		db:       db,
 		template: tmpl,
+		location: loc,
 	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", srv.getStatsHandler)
+	mux.HandleFunc("/flights", srv.getFlightsHandler)
+	mux.HandleFunc("/last-flight", srv.getLastFlightHandler)
+	mux.HandleFunc("/all-flights", srv.getAllFlightsHandler)
+	mux.HandleFunc("/export/{format}", srv.exportHandler)
+	mux.HandleFunc("/geofence", srv.getGeofenceHandler)
+	mux.HandleFunc("/sky-chart.svg", srv.skyChartHandler)
+	mux.HandleFunc("/transits", srv.transitsHandler)
+	mux.HandleFunc("/noise", srv.noiseHandler)
+	mux.HandleFunc("/upcoming", srv.upcomingHandler)
+	mux.HandleFunc("/expected", srv.expectedHandler)
+	mux.HandleFunc("/sightings/{id}/track", srv.trackHandler)
+	mux.HandleFunc("/admin/watcher", srv.adminOnly(srv.watcherHandler))
+	mux.HandleFunc("/admin/webhooks/dead", srv.adminOnly(srv.deadWebhooksHandler))
+	mux.HandleFunc("/admin/rules", srv.adminOnly(srv.rulesHandler))
+	mux.HandleFunc("/admin/rules/{id}", srv.adminOnly(srv.ruleHandler))
+	mux.HandleFunc("/admin/rules/dry-run", srv.adminOnly(srv.dryRunRuleHandler))
+	srv.http = &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: mux,
+	}
+	return srv
 }
 
 // formatNumberWithThousandsSeparator adds thousand separators to a float64 number,
@@ -107,37 +180,314 @@ func formatNumberWithThousandsSeparator(n float64) string {
 	return result.String()
 }
 
-// Start starts the HTTP server.
-func (s *Server) Start() error {
-	http.HandleFunc("/", s.getStatsHandler)
-	http.HandleFunc("/flights", s.getFlightsHandler)
-	http.HandleFunc("/last-flight", s.getLastFlightHandler)
-	http.HandleFunc("/all-flights", s.getAllFlightsHandler)
+// SetRules enables the alert rule endpoints, managing the rules of engine.
+func (s *Server) SetRules(engine *rules.Engine) {
+	s.rules = engine
+}
 
-	port := fmt.Sprintf(":%d", s.config.Port)
-	if err := http.ListenAndServe(port, nil); err != nil {
+// Start starts the HTTP server and blocks until it fails or is shut down.
+func (s *Server) Start() error {
+	if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("server failed to start: %w", err)
 	}
 	return nil
 }
 
-func (s *Server) getOperatorInfo(icao string) (*model.OperatorInfo, error) {
-	operatorJSON, err := s.db.GetOperator(icao)
+// Shutdown stops accepting requests and waits for the ones in progress until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+// adminOnly requires the configured admin token as a bearer token. Without a token the admin endpoints are not found.
+func (s *Server) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.config.AdminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// watcherHandler reports whether the watcher is paused, and pauses or resumes it
+// on POST with action=pause or action=resume.
+func (s *Server) watcherHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		switch action := r.FormValue("action"); action {
+		case "pause":
+			s.service.PauseWatch()
+			log.Println("Watcher paused")
+		case "resume":
+			s.service.ResumeWatch()
+			log.Println("Watcher resumed")
+		default:
+			http.Error(w, fmt.Sprintf("invalid action %q, expected pause or resume", action), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"paused": s.service.WatchPaused()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// deadWebhooksHandler lists the webhook deliveries that ran out of attempts,
+// and requeues one on POST with its id.
+func (s *Server) deadWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := 100
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		deliveries, err := s.db.GetDeadWebhookDeliveries(limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if deliveries == nil {
+			deliveries = []*model.WebhookDelivery{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		requeued, err := s.db.RequeueWebhookDelivery(id, time.Now().UTC())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !requeued {
+			http.Error(w, fmt.Sprintf("no dead delivery %d", id), http.StatusNotFound)
+			return
+		}
+		log.Printf("Webhook delivery %d requeued", id)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]int64{"requeued": id}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// rulesEnabled replies with 503 and returns false when there is no rule engine.
+func (s *Server) rulesEnabled(w http.ResponseWriter) bool {
+	if s.rules == nil {
+		http.Error(w, "alert rules are not enabled", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// writeRuleError replies with 400 for invalid rules, and 500 for any other error.
+func writeRuleError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, rules.ErrInvalidRule) {
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// rulesHandler lists the alert rules, and creates one on POST.
+func (s *Server) rulesHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.rulesEnabled(w) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.rules.Rules())
+	case http.MethodPost:
+		rule := model.Rule{Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, fmt.Sprintf("invalid rule: %v", err), http.StatusBadRequest)
+			return
+		}
+		rule.ID = 0
+		rule.ReadOnly = false
+		if _, err := s.rules.SaveRule(&rule); err != nil {
+			writeRuleError(w, err)
+			return
+		}
+		log.Printf("Rule %d (%s) created", rule.ID, rule.Name)
+		writeJSON(w, http.StatusCreated, rule)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ruleHandler gets, replaces or deletes a rule stored in the database.
+func (s *Server) ruleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.rulesEnabled(w) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := s.rules.Rule(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rule == nil {
+			http.Error(w, fmt.Sprintf("no rule %d", id), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodPut:
+		var rule model.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, fmt.Sprintf("invalid rule: %v", err), http.StatusBadRequest)
+			return
+		}
+		rule.ID = id
+		rule.ReadOnly = false
+		found, err := s.rules.SaveRule(&rule)
+		if err != nil {
+			writeRuleError(w, err)
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("no rule %d", id), http.StatusNotFound)
+			return
+		}
+		log.Printf("Rule %d (%s) updated", rule.ID, rule.Name)
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodDelete:
+		found, err := s.rules.DeleteRule(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("no rule %d", id), http.StatusNotFound)
+			return
+		}
+		log.Printf("Rule %d deleted", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// dryRunRuleHandler evaluates an expression against the logged flights, without running any action.
+func (s *Server) dryRunRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.rulesEnabled(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	request := struct {
+		Expression string `json:"expression"`
+		Limit      int    `json:"limit"`
+	}{Limit: 1000}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	matches, evaluated, err := s.rules.DryRun(request.Expression, request.Limit)
 	if err != nil {
-		return nil, err
+		writeRuleError(w, err)
+		return
 	}
-	if operatorJSON == "" {
-		return &model.OperatorInfo{Shortname: "N/A"}, nil
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"evaluated": evaluated,
+		"matched":   len(matches),
+		"matches":   matches,
+	})
+}
+
+// rarity loads what the rarity of the flights is scored from: the first sightings and the number of passes.
+func (s *Server) rarity() (*model.Rarity, error) {
+	seen, err := s.db.GetFirstSeen()
+	if err != nil {
+		return nil, err
 	}
-	var operatorInfo model.OperatorInfo
-	if err := json.Unmarshal([]byte(operatorJSON), &operatorInfo); err != nil {
+	passes, err := s.db.GetSightingCount()
+	if err != nil {
 		return nil, err
 	}
-	return &operatorInfo, nil
+	return model.NewRarity(seen, passes), nil
+}
+
+// siteNames returns the names of the sites to choose from, none when there is a single site.
+func (s *Server) siteNames() []string {
+	var sites []string
+	if watched := s.config.WatchSites(); len(watched) > 1 {
+		for _, w := range watched {
+			sites = append(sites, w.Name)
+		}
+	}
+	return sites
+}
+
+// siteParam returns the site selected with the site query parameter, empty meaning all sites.
+// It replies with 404 and returns false when the site is not configured.
+func (s *Server) siteParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	site := r.URL.Query().Get("site")
+	if site == "" {
+		return "", true
+	}
+	for _, watched := range s.config.WatchSites() {
+		if watched.Name == site {
+			return site, true
+		}
+	}
+	http.Error(w, fmt.Sprintf("unknown site %q", site), http.StatusNotFound)
+	return "", false
 }
 
 func (s *Server) getLastFlightHandler(w http.ResponseWriter, r *http.Request) {
-	flight, lastSeen, err := s.db.GetLatestFlight()
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
+	flight, lastSeen, err := s.db.GetLatestFlight(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -147,41 +497,13 @@ func (s *Server) getLastFlightHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	operator, err := s.getOperatorInfo(flight.OperatorIcao)
+	operator, err := s.db.GetOperatorInfo(flight.OperatorIcao)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	response := struct {
-		Flight              string    `json:"flight"`
-		Operator            string    `json:"operator"`
-		DestinationCity     string    `json:"destination_city"`
-		DestinationCodeIata string    `json:"destination_code_iata"`
-		DestinationCodeIcao string    `json:"destination_code_icao"`
-		SourceCity          string    `json:"source_city"`
-		SourceCodeIata      string    `json:"source_code_iata"`
-		SourceCodeIcao      string    `json:"source_code_icao"`
-		LastTimeSeen        time.Time `json:"last_time_seen"`
-		LastSeenAgo         string    `json:"last_seen_ago"`
-		AirplaneModel       string    `json:"airplane_model"`
-		Distance            float64   `json:"distance_m"` // Reverted to float64
-		CO2KG               float64   `json:"co2_kg"`     // Reverted to float64
-	}{
-		Flight:              flight.Ident,
-		Operator:            operator.Shortname,
-		DestinationCity:     flight.Destination.City,
-		DestinationCodeIata: flight.Destination.CodeIata,
-		DestinationCodeIcao: flight.Destination.CodeIcao,
-		SourceCity:          flight.Origin.City,
-		SourceCodeIata:      flight.Origin.CodeIata,
-		SourceCodeIcao:      flight.Origin.CodeIcao,
-		LastTimeSeen:        lastSeen,
-		LastSeenAgo:         formatTimeAgo(lastSeen),
-		AirplaneModel:       flight.AircraftType,
-		Distance:            flight.Distance, // Assign raw float64
-		CO2KG:               flight.CO2KG,    // Assign raw float64
-	}
+	response := model.NewFlightSummary(flight, operator, lastSeen)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -191,19 +513,24 @@ func (s *Server) getLastFlightHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
-	lastFlight, lastFlightSeen, err := s.db.GetLatestFlight()
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
+	lastFlight, lastFlightSeen, err := s.db.GetLatestFlight(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	last10Flights, last10FlightsSeen, err := s.db.GetLast10Flights()
+	last10Flights, last10FlightsSeen, err := s.db.GetLast10Flights(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	mostCommonFlights, err := s.db.GetMostCommonFlights()
+	mostCommonFlights, err := s.db.GetMostCommonFlights(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -232,10 +559,18 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rarity, err := s.rarity()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	type FlightData struct {
 		*model.FlightInfo
-		Operator *model.OperatorInfo
-		LastSeen time.Time
+		Operator  *model.OperatorInfo
+		LastSeen  time.Time
+		FirstSeen []string
+		Rarity    float64
 	}
 
 	var lastFlightData *FlightData
@@ -253,10 +588,13 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 		lastFlight.DistanceDisplay = formatNumberWithThousandsSeparator(lastFlight.Distance / 1000)
 		lastFlight.CO2KGDisplay = fmt.Sprintf("%.0f", lastFlight.CO2KG)
 
+		attrs := model.Attributes(lastFlight, operator.Country)
 		lastFlightData = &FlightData{
 			FlightInfo: lastFlight,
 			Operator:   &operator,
 			LastSeen:   lastFlightSeen,
+			FirstSeen:  rarity.FirstSeenWith(lastFlight.Ident, flightSite(lastFlight), lastFlightSeen, attrs),
+			Rarity:     rarity.Score(attrs),
 		}
 	}
 
@@ -275,16 +613,22 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 		flight.DistanceDisplay = formatNumberWithThousandsSeparator(flight.Distance / 1000)
 		flight.CO2KGDisplay = fmt.Sprintf("%.0f", flight.CO2KG)
 
+		attrs := model.Attributes(flight, operator.Country)
 		last10FlightsData = append(last10FlightsData, FlightData{
 			FlightInfo: flight,
 			Operator:   &operator,
 			LastSeen:   last10FlightsSeen[i],
+			FirstSeen:  rarity.FirstSeenWith(flight.Ident, flightSite(flight), last10FlightsSeen[i], attrs),
+			Rarity:     rarity.Score(attrs),
 		})
 	}
 
+	// The most common flights are not tied to a pass, FirstSeen is left empty for the shared flight table
 	type MostCommonFlightData struct {
 		*model.FlightInfo
-		Operator *model.OperatorInfo
+		Operator  *model.OperatorInfo
+		FirstSeen []string
+		Rarity    float64
 	}
 
 	var mostCommonFlightsData []MostCommonFlightData
@@ -302,19 +646,21 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 		flight.DistanceDisplay = formatNumberWithThousandsSeparator(flight.Distance / 1000)
 		flight.CO2KGDisplay = fmt.Sprintf("%.0f", flight.CO2KG)
 
+		attrs := model.Attributes(flight, operator.Country)
 		mostCommonFlightsData = append(mostCommonFlightsData, MostCommonFlightData{
 			FlightInfo: flight,
 			Operator:   &operator,
+			Rarity:     rarity.Score(attrs),
 		})
 	}
 
-	topDestinations, err := s.db.GetTopDestinations()
+	topDestinations, err := s.db.GetTopDestinations(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	topSources, err := s.db.GetTopSources()
+	topSources, err := s.db.GetTopSources(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -343,21 +689,79 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return res
 	}
 
+	recentSightings, err := s.db.GetRecentSightings(10, site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filterStats, err := s.db.GetFilterStats(time.Now(), site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	squawkAlerts, err := s.db.GetSquawkAlertsSince(time.Now().Add(-24*time.Hour), site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	newThisWeek, err := s.db.GetFirstSeenSince(time.Now().AddDate(0, 0, -7), site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	noisy, err := s.db.GetNoisySightingsSince(s.daysAgo(noiseDays), site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	expectedToday, err := s.expectedToday(site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	destStats := getStatsWithPerc(topDestinations)
 	srcStats := getStatsWithPerc(topSources)
 
+	var lastFlightTable interface{}
+	if lastFlightData != nil {
+		lastFlightTable = map[string]interface{}{
+			"Flights": []FlightData{*lastFlightData},
+			"Header":  "Last Seen",
+			"Class":   "last-flight",
+		}
+	}
+
 	data := struct {
+		Sites             []string
+		Site              string
+		SkyChart          bool
+		SquawkAlerts      []*model.SquawkAlert
 		LastFlight        interface{}
 		Last10Flights     interface{}
 		MostCommonFlights interface{}
+		RecentSightings   []*model.Sighting
+		NewThisWeek       []*model.FirstSeen
+		ExpectedToday     []model.ExpectedFlight
+		NoiseDays         []model.NoiseDay
+		LoudestPasses     []*model.Sighting
+		FilterStats       []model.FilterStat
 		TopDestinations   []StatWithPerc
 		TopSources        []StatWithPerc
+		Transits          bool
 	}{
-		LastFlight: map[string]interface{}{
-			"Flights": []FlightData{*lastFlightData},
-			"Header":  "Last Seen",
-			"Class":   "last-flight",
-		},
+		Sites:    s.siteNames(),
+		Site:     site,
+		SkyChart: s.config.Watch && (site != "" || len(s.config.WatchSites()) == 1), // never fetching from the APIs
+		Transits: s.transitsEnabled(),
+
+		SquawkAlerts: squawkAlerts,
+		LastFlight:   lastFlightTable,
 		Last10Flights: map[string]interface{}{
 			"Flights": last10FlightsData,
 			"Header":  "Last Seen",
@@ -365,9 +769,15 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 		},
 		MostCommonFlights: map[string]interface{}{
 			"Flights": mostCommonFlightsData,
-			"Header":  "Count",
+			"Header":  "Passes",
 			"Class":   "most-common-flights",
 		},
+		RecentSightings: recentSightings,
+		NewThisWeek:     newThisWeek,
+		ExpectedToday:   expectedToday,
+		NoiseDays:       noise.Daily(noisy, s.location),
+		LoudestPasses:   noisy[:min(loudestPasses, len(noisy))],
+		FilterStats:     filterStats,
 		TopDestinations: destStats,
 		TopSources:      srcStats,
 	}
@@ -379,6 +789,11 @@ func (s *Server) getStatsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getAllFlightsHandler(w http.ResponseWriter, r *http.Request) {
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
 	limitStr := r.URL.Query().Get("limit")
 	limit := 0
 	if limitStr != "" {
@@ -390,7 +805,7 @@ func (s *Server) getAllFlightsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	flights, lastSeens, err := s.db.GetAllFlights(limit)
+	flights, lastSeens, err := s.db.GetAllFlights(limit, site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -417,23 +832,13 @@ func (s *Server) getAllFlightsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type FlightResponse struct {
-		Flight              string    `json:"flight"`
-		Operator            string    `json:"operator"`
-		DestinationCity     string    `json:"destination_city"`
-		DestinationCodeIata string    `json:"destination_code_iata"`
-		DestinationCodeIcao string    `json:"destination_code_icao"`
-		SourceCity          string    `json:"source_city"`
-		SourceCodeIata      string    `json:"source_code_iata"`
-		SourceCodeIcao      string    `json:"source_code_icao"`
-		LastTimeSeen        time.Time `json:"last_time_seen"`
-		LastSeenAgo         string    `json:"last_seen_ago"`
-		AirplaneModel       string    `json:"airplane_model"`
-		Distance            float64   `json:"distance_m"` // Reverted to float64
-		CO2KG               float64   `json:"co2_kg"`     // Reverted to float64
+	rarity, err := s.rarity()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	var responses []FlightResponse
+	var responses []model.FlightSummary
 	for i, flight := range flights {
 		var operator model.OperatorInfo
 		if opJSON, ok := operatorMap[flight.OperatorIcao]; ok {
@@ -444,21 +849,10 @@ func (s *Server) getAllFlightsHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			operator.Shortname = "N/A"
 		}
-		response := FlightResponse{
-			Flight:              flight.Ident,
-			Operator:            operator.Shortname,
-			DestinationCity:     flight.Destination.City,
-			DestinationCodeIata: flight.Destination.CodeIata,
-			DestinationCodeIcao: flight.Destination.CodeIcao,
-			SourceCity:          flight.Origin.City,
-			SourceCodeIata:      flight.Origin.CodeIata,
-			SourceCodeIcao:      flight.Origin.CodeIcao,
-			LastTimeSeen:        lastSeens[i],
-			LastSeenAgo:         formatTimeAgo(lastSeens[i]),
-			AirplaneModel:       flight.AircraftType,
-			Distance:            flight.Distance, // Assign raw float64
-			CO2KG:               flight.CO2KG,    // Assign raw float64
-		}
+		response := model.NewFlightSummary(flight, &operator, lastSeens[i])
+		attrs := model.Attributes(flight, operator.Country)
+		response.FirstSeen = rarity.FirstSeenWith(flight.Ident, flightSite(flight), lastSeens[i], attrs)
+		response.Rarity = rarity.Score(attrs)
 		responses = append(responses, response)
 	}
 
@@ -469,8 +863,44 @@ func (s *Server) getAllFlightsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// exportHandler streams the sightings started between the since and until parameters, by default all of them
+// until now, flattened with their flights, in the format of the path: csv, ndjson or parquet.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.PathValue("format")
+	if !slices.Contains(export.Formats, format) {
+		http.Error(w, fmt.Sprintf("unknown format %q, must be one of %s", format, strings.Join(export.Formats, ", ")), http.StatusNotFound)
+		return
+	}
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := export.Range(r.URL.Query().Get("since"), r.URL.Query().Get("until"), s.location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="sightings.`+format+`"`)
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The rows are written as they are read, once the first ones are sent an error can only cut the response short
+	if _, err := export.Sightings(s.db, writer, from, to, site); err != nil {
+		log.Printf("Error exporting sightings: %v", err)
+	}
+}
+
 func (s *Server) getFlightsHandler(w http.ResponseWriter, r *http.Request) {
-	flights, err := s.service.GetFlightsInRadius(s.config.Service.Latitude, s.config.Service.Longitude, s.config.Service.Radius)
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
+	flights, err := s.service.GetFlights(site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -482,3 +912,279 @@ func (s *Server) getFlightsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// skyChartHandler draws the aircraft over a site on an SVG polar chart of its sky. In watch mode these are
+// the aircraft of the open passes, otherwise the ones currently inside the area are fetched.
+func (s *Server) skyChartHandler(w http.ResponseWriter, r *http.Request) {
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+	if site == "" && len(s.config.WatchSites()) > 1 {
+		http.Error(w, "the site parameter is required with several sites", http.StatusBadRequest)
+		return
+	}
+
+	var flights []model.FlightInfo
+	if s.config.Watch {
+		flights = s.service.Overhead(site)
+	} else {
+		var err error
+		if flights, err = s.service.GetFlights(site); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if err := writeSkyChart(w, flights); err != nil {
+		log.Printf("Error writing sky chart: %v", err)
+	}
+}
+
+// Noise statistics shown on the index page: the days of the daily levels and the number of loudest passes.
+const (
+	noiseDays     = 7
+	loudestPasses = 5
+)
+
+// daysAgo returns the start of the local day n-1 days before today, so that n days include today.
+func (s *Server) daysAgo(n int) time.Time {
+	now := time.Now().In(s.location)
+	return time.Date(now.Year(), now.Month(), now.Day()-n+1, 0, 0, 0, 0, s.location)
+}
+
+// trackHandler returns a sighting with the positions of its aircraft during the pass, empty when none were stored.
+func (s *Server) trackHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	sighting, err := s.db.GetSighting(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sighting == nil {
+		http.Error(w, fmt.Sprintf("no sighting %d", id), http.StatusNotFound)
+		return
+	}
+	track, err := s.db.GetTrack(sighting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if track == nil {
+		track = []model.Position{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Sighting *model.Sighting  `json:"sighting"`
+		Track    []model.Position `json:"track"`
+	}{sighting, track})
+}
+
+// noiseHandler returns the estimated noise of the passes over the last days (7, or the days parameter up to 90):
+// the daily levels, newest first, and the loudest passes.
+func (s *Server) noiseHandler(w http.ResponseWriter, r *http.Request) {
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+	days := noiseDays
+	if param := r.URL.Query().Get("days"); param != "" {
+		var err error
+		if days, err = strconv.Atoi(param); err != nil || days < 1 || days > 90 {
+			http.Error(w, "days must be a number between 1 and 90", http.StatusBadRequest)
+			return
+		}
+	}
+
+	noisy, err := s.db.GetNoisySightingsSince(s.daysAgo(days), site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Days    []model.NoiseDay  `json:"days"`
+		Loudest []*model.Sighting `json:"loudest"`
+	}{
+		Days:    noise.Daily(noisy, s.location),
+		Loudest: noisy[:min(10, len(noisy))],
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// transitsEnabled reports whether transits across the sun and the moon are predicted, which happens in watch mode.
+func (s *Server) transitsEnabled() bool {
+	return s.config.Watch && s.config.Transits.Enabled
+}
+
+// transitsHandler shows the transits across the sun and the moon predicted over the selected site,
+// upcoming and of the last hour.
+func (s *Server) transitsHandler(w http.ResponseWriter, r *http.Request) {
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	var upcoming, recent []model.Transit
+	for _, t := range s.service.Transits(site) {
+		if t.Time.Before(now) {
+			recent = append(recent, t)
+		} else {
+			upcoming = append(upcoming, t)
+		}
+	}
+	slices.Reverse(recent) // the latest first
+
+	data := struct {
+		Enabled  bool
+		Sites    []string
+		Site     string
+		Upcoming []model.Transit
+		Recent   []model.Transit
+	}{
+		Enabled:  s.transitsEnabled(),
+		Sites:    s.siteNames(),
+		Site:     site,
+		Upcoming: upcoming,
+		Recent:   recent,
+	}
+	if err := s.template.ExecuteTemplate(w, "transits", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// expectedToday returns the recurring flights expected today over a site, or all sites, with the passes seen so far.
+func (s *Server) expectedToday(site string) ([]model.ExpectedFlight, error) {
+	flights, err := s.db.GetRecurringFlights(site)
+	if err != nil {
+		return nil, err
+	}
+	sightings, err := s.db.GetSightingsBetween(s.daysAgo(1), s.daysAgo(0), site)
+	if err != nil {
+		return nil, err
+	}
+	return recurring.Today(flights, sightings, time.Now(), s.location), nil
+}
+
+// expectedHandler returns the timeline of the recurring flights expected today, learned from the past sightings,
+// compared with the passes seen so far.
+func (s *Server) expectedHandler(w http.ResponseWriter, r *http.Request) {
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+	expected, err := s.expectedToday(site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if expected == nil {
+		expected = []model.ExpectedFlight{}
+	}
+
+	response := struct {
+		Date    string                 `json:"date"`
+		Flights []model.ExpectedFlight `json:"flights"`
+	}{time.Now().In(s.location).Format(time.DateOnly), expected}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// accuracyDays is the period the accuracy of the look-ahead predictions is summarized over.
+const accuracyDays = 7
+
+// upcomingHandler returns the aircraft predicted to fly over the selected site, or all sites, soonest first,
+// with the accuracy of the predictions of the last 7 days. Predictions are made in watch mode only.
+func (s *Server) upcomingHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.config.Watch || !s.config.Lookahead.Enabled {
+		http.Error(w, "look-ahead predictions are disabled", http.StatusNotFound)
+		return
+	}
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
+	accuracy, err := s.db.GetPredictionAccuracy(s.daysAgo(accuracyDays), site)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	upcoming := s.service.Upcoming(site)
+	if upcoming == nil {
+		upcoming = []model.Prediction{}
+	}
+
+	response := struct {
+		Upcoming []model.Prediction        `json:"upcoming"`
+		Accuracy *model.PredictionAccuracy `json:"accuracy"`
+	}{upcoming, accuracy}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// geofenceFeature is a GeoJSON Feature of a watched area, with the site and observer location as properties.
+type geofenceFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geofence.Geometry      `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// getGeofenceHandler returns the watched area of the selected site as a GeoJSON Feature,
+// or a FeatureCollection of all sites when several are configured and none is selected.
+func (s *Server) getGeofenceHandler(w http.ResponseWriter, r *http.Request) {
+	site, ok := s.siteParam(w, r)
+	if !ok {
+		return
+	}
+
+	var features []geofenceFeature
+	for _, watched := range s.config.WatchSites() {
+		if site != "" && watched.Name != site {
+			continue
+		}
+		features = append(features, geofenceFeature{
+			Type:     "Feature",
+			Geometry: s.service.Area(watched.Name).GeoJSON(),
+			Properties: map[string]interface{}{
+				"site":      watched.Name,
+				"latitude":  watched.Latitude,
+				"longitude": watched.Longitude,
+			},
+		})
+	}
+
+	var response interface{} = features[0]
+	if len(features) > 1 {
+		response = struct {
+			Type     string            `json:"type"`
+			Features []geofenceFeature `json:"features"`
+		}{"FeatureCollection", features}
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// flightSite returns the site a flight was seen from, the flights logged before the sites belong to the default site.
+func flightSite(flight *model.FlightInfo) string {
+	if flight.Site == "" {
+		return config.DefaultSite
+	}
+	return flight.Site
+}
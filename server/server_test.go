@@ -5,15 +5,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/carlo-colombo/sopra/config"
-	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/memory"
 	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/rules"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockService is a mock implementation of the Service.
@@ -21,24 +24,47 @@ type MockService struct {
 	mock.Mock
 }
 
-func (m *MockService) GetFlightsInRadius(lat, lon, radius float64) ([]model.FlightInfo, error) {
-	args := m.Called(lat, lon, radius)
+func (m *MockService) GetFlights(site string) ([]model.FlightInfo, error) {
+	args := m.Called(site)
 	return args.Get(0).([]model.FlightInfo), args.Error(1)
 }
 
-func newTestDB(t *testing.T) *database.DB {
+func (m *MockService) Overhead(site string) []model.FlightInfo {
+	args := m.Called(site)
+	return args.Get(0).([]model.FlightInfo)
+}
+
+func (m *MockService) Transits(site string) []model.Transit {
+	args := m.Called(site)
+	return args.Get(0).([]model.Transit)
+}
+
+func (m *MockService) Upcoming(site string) []model.Prediction {
+	args := m.Called(site)
+	return args.Get(0).([]model.Prediction)
+}
+
+func (m *MockService) Area(site string) geofence.Area {
+	args := m.Called(site)
+	return args.Get(0).(geofence.Area)
+}
+
+func (m *MockService) PauseWatch() {
+	m.Called()
+}
+
+func (m *MockService) ResumeWatch() {
+	m.Called()
+}
+
+func (m *MockService) WatchPaused() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+func newTestDB(t *testing.T) *memory.Store {
 	t.Helper()
-	dbName := fmt.Sprintf("%s.db", t.Name())
-	os.Remove(dbName) // Clean up before test
-	db, err := database.NewDB(dbName)
-	if err != nil {
-		t.Fatalf("failed to create test db: %v", err)
-	}
-	t.Cleanup(func() {
-		db.Close()
-		os.Remove(dbName)
-	})
-	return db
+	return memory.New()
 }
 
 func TestGetFlightsHandler(t *testing.T) {
@@ -48,7 +74,7 @@ func TestGetFlightsHandler(t *testing.T) {
 		{Ident: "UAL123", Operator: "United Airlines"},
 		{Ident: "DAL456", Operator: "Delta Airlines"},
 	}
-	mockService.On("GetFlightsInRadius", mock.Anything, mock.Anything, mock.Anything).Return(expectedFlights, nil)
+	mockService.On("GetFlights", "").Return(expectedFlights, nil)
 
 	// Create a new server with the mock service
 	cfg := &config.Config{}
@@ -113,6 +139,12 @@ func TestGetAllFlightsHandler(t *testing.T) {
 		},
 		AircraftType: "A320",
 		Distance:     5678.9,
+		Icao24:       "4b1805",
+		BaroAltitude: 3048,
+		Velocity:     150,
+		TrueTrack:    270,
+		VerticalRate: -5,
+		Squawk:       "1000",
 	}
 	if err := db.LogFlight("FL001", flight1); err != nil {
 		t.Fatalf("failed to log flight FL001: %v", err)
@@ -120,6 +152,20 @@ func TestGetAllFlightsHandler(t *testing.T) {
 	if err := db.LogFlight("FL002", flight2); err != nil {
 		t.Fatalf("failed to log flight FL002: %v", err)
 	}
+	// FL001 brought the first B737, while 3 of the 4 passes were of an A320
+	for i, ident := range []string{"FL001", "FL002", "FL002", "FL002"} {
+		if _, err := db.RecordSighting(model.Observation{Callsign: ident, Time: time.Now().Add(time.Duration(i) * time.Hour)}, time.Minute); err != nil {
+			t.Fatalf("failed to record sighting %s: %v", ident, err)
+		}
+	}
+	if _, err := db.RecordFirstSeen(map[string]string{model.KindAircraftType: "B737"}, "FL001", "", time.Now()); err != nil {
+		t.Fatalf("failed to record first sighting: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.RecordFirstSeen(map[string]string{model.KindAircraftType: "A320"}, "FL000", "", time.Now()); err != nil {
+			t.Fatalf("failed to record first sighting: %v", err)
+		}
+	}
 
 	// Create a new server with the test database
 	cfg := &config.Config{}
@@ -146,8 +192,18 @@ func TestGetAllFlightsHandler(t *testing.T) {
 	assert.Len(t, actualFlights, 2)
 	assert.Equal(t, "FL002", actualFlights[0]["flight"])
 	assert.Equal(t, 5678.9, actualFlights[0]["distance_m"])
+	assert.Equal(t, "4b1805", actualFlights[0]["icao24"])
+	assert.Equal(t, 3048.0, actualFlights[0]["baro_altitude"])
+	assert.Equal(t, 150.0, actualFlights[0]["velocity"])
+	assert.Equal(t, 270.0, actualFlights[0]["true_track"])
+	assert.Equal(t, -5.0, actualFlights[0]["vertical_rate"])
+	assert.Equal(t, "1000", actualFlights[0]["squawk"])
+	assert.Equal(t, 31.7, actualFlights[0]["rarity"]) // 100 × (1 - ln 3 / ln 5)
+	assert.Nil(t, actualFlights[0]["first_seen"])
 	assert.Equal(t, "FL001", actualFlights[1]["flight"])
 	assert.Equal(t, 1234.5, actualFlights[1]["distance_m"])
+	assert.Equal(t, 100.0, actualFlights[1]["rarity"])
+	assert.Equal(t, []interface{}{"aircraft_type"}, actualFlights[1]["first_seen"])
 
 	// Test with limit parameter
 	req, err = http.NewRequest("GET", "/all-flights?limit=1", nil)
@@ -172,45 +228,569 @@ func TestGetAllFlightsHandler(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
-func TestFormatTimeAgo(t *testing.T) {
+func TestGetLastFlightHandler(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.ClearFlightLog(); err != nil {
+		t.Fatalf("failed to clear flight log: %v", err)
+	}
+
+	flight := &model.FlightInfo{
+		Ident:        "SWR123",
+		OperatorIcao: "SWR",
+		AircraftType: "A333",
+		Icao24:       "4b1805",
+		BaroAltitude: 10668,
+		GeoAltitude:  10900,
+		Velocity:     230,
+		TrueTrack:    45,
+		OnGround:     false,
+	}
+	if err := db.LogFlight("SWR123", flight); err != nil {
+		t.Fatalf("failed to log flight SWR123: %v", err)
+	}
+
+	server := NewServer(nil, &config.Config{}, db)
+
+	req, err := http.NewRequest("GET", "/last-flight", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.getLastFlightHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var actual map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &actual)
+	assert.NoError(t, err)
+	assert.Equal(t, "SWR123", actual["flight"])
+	assert.Equal(t, "A333", actual["airplane_model"])
+	assert.Equal(t, "4b1805", actual["icao24"])
+	assert.Equal(t, 10668.0, actual["baro_altitude"])
+	assert.Equal(t, 10900.0, actual["geo_altitude"])
+	assert.Equal(t, 230.0, actual["velocity"])
+	assert.Equal(t, 45.0, actual["true_track"])
+	assert.Equal(t, false, actual["on_ground"])
+}
+
+func TestGetGeofenceHandler(t *testing.T) {
+	fence, err := geofence.Parse([]byte(`{"type":"Polygon","coordinates":[[[8.4,47.3],[8.7,47.3],[8.7,47.5],[8.4,47.5],[8.4,47.3]]]}`))
+	assert.NoError(t, err)
+
+	mockService := new(MockService)
+	mockService.On("Area", config.DefaultSite).Return(fence)
+
+	cfg := &config.Config{}
+	cfg.Service.Latitude = 47.4
+	cfg.Service.Longitude = 8.5
+	server := NewServer(mockService, cfg, nil)
+
+	req, err := http.NewRequest("GET", "/geofence", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.getGeofenceHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+
+	var feature struct {
+		Type     string `json:"type"`
+		Geometry struct {
+			Type        string         `json:"type"`
+			Coordinates [][][2]float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &feature)
+	assert.NoError(t, err)
+	assert.Equal(t, "Feature", feature.Type)
+	assert.Equal(t, "Polygon", feature.Geometry.Type)
+	assert.Len(t, feature.Geometry.Coordinates[0], 5)
+	assert.Equal(t, 47.4, feature.Properties["latitude"])
+	assert.Equal(t, config.DefaultSite, feature.Properties["site"])
+}
+
+func TestGetGeofenceHandler_Sites(t *testing.T) {
+	mockService := new(MockService)
+	mockService.On("Area", "zurich").Return(geofence.Circle{Latitude: 47.4, Longitude: 8.5, RadiusKm: 10})
+	mockService.On("Area", "geneva").Return(geofence.Circle{Latitude: 46.2, Longitude: 6.1, RadiusKm: 10})
+
+	cfg := &config.Config{Sites: []config.SiteConfig{
+		{Name: "zurich", ServiceConfig: config.ServiceConfig{Latitude: 47.4, Longitude: 8.5, Radius: 10}},
+		{Name: "geneva", ServiceConfig: config.ServiceConfig{Latitude: 46.2, Longitude: 6.1, Radius: 10}},
+	}}
+	server := NewServer(mockService, cfg, nil)
+
+	// Without a site all sites are returned as a collection
+	req, err := http.NewRequest("GET", "/geofence", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.getGeofenceHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Len(t, collection.Features, 2)
+	assert.Equal(t, "geneva", collection.Features[1].Properties["site"])
+
+	// A single site is returned as a feature
+	req, err = http.NewRequest("GET", "/geofence?site=geneva", nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.getGeofenceHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var feature struct {
+		Type       string                 `json:"type"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &feature))
+	assert.Equal(t, "Feature", feature.Type)
+	assert.Equal(t, 46.2, feature.Properties["latitude"])
+
+	// Unknown sites are not found
+	req, err = http.NewRequest("GET", "/geofence?site=basel", nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.getGeofenceHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestWatcherHandler(t *testing.T) {
+	mockService := new(MockService)
+	mockService.On("PauseWatch").Return()
+	mockService.On("WatchPaused").Return(true)
+
+	cfg := &config.Config{AdminToken: "secret"}
+	server := NewServer(mockService, cfg, nil)
+	handler := server.adminOnly(server.watcherHandler)
+
+	// Without the token the watcher cannot be paused
+	req, err := http.NewRequest("POST", "/admin/watcher?action=pause", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockService.AssertNotCalled(t, "PauseWatch")
+
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"paused": true}`, rr.Body.String())
+	mockService.AssertCalled(t, "PauseWatch")
+
+	req, err = http.NewRequest("POST", "/admin/watcher?action=stop", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Without an admin token the admin endpoints are disabled
+	server = NewServer(mockService, &config.Config{}, nil)
+	for _, target := range []string{"/admin/watcher", "/admin/webhooks/dead", "/admin/rules", "/admin/rules/1", "/admin/rules/dry-run"} {
+		req, err = http.NewRequest("POST", target+"?action=resume", nil)
+		assert.NoError(t, err)
+		rr = httptest.NewRecorder()
+		server.http.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code, target)
+	}
+	mockService.AssertNotCalled(t, "ResumeWatch")
+}
+
+func TestDeadWebhooksHandler(t *testing.T) {
+	db := newTestDB(t)
+	server := NewServer(new(MockService), &config.Config{}, db)
+	handler := http.HandlerFunc(server.deadWebhooksHandler)
+
+	now := time.Now().UTC()
+	delivery := &model.WebhookDelivery{Webhook: "hook", EventType: "aircraft_entered", Body: "{}", NextAttempt: now, CreatedAt: now}
+	assert.NoError(t, db.EnqueueWebhookDelivery(delivery))
+	assert.NoError(t, db.MarkWebhookFailed(delivery.ID, 8, now, "unexpected status: 500", true))
+
+	req, err := http.NewRequest("GET", "/admin/webhooks/dead", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var dead []model.WebhookDelivery
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &dead))
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "unexpected status: 500", dead[0].LastError)
+
+	req, err = http.NewRequest("POST", fmt.Sprintf("/admin/webhooks/dead?id=%d", delivery.ID), nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Requeued deliveries are no longer dead
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	due, err := db.GetDueWebhookDeliveries(time.Now().UTC(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, 0, due[0].Attempts)
+}
+
+func TestRulesHandlers(t *testing.T) {
+	db := newTestDB(t)
+	assert.NoError(t, db.ClearFlightLog())
+	assert.NoError(t, db.LogFlight("SIA22", &model.FlightInfo{Ident: "SIA22", AircraftType: "A388"}))
+	assert.NoError(t, db.LogFlight("SWR12", &model.FlightInfo{Ident: "SWR12", AircraftType: "A320"}))
+
+	server := NewServer(new(MockService), &config.Config{AdminToken: "secret"}, db)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, target, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		server.http.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The endpoints are unavailable without a rule engine
+	assert.Equal(t, http.StatusServiceUnavailable, do("GET", "/admin/rules", "").Code)
+
+	engine, err := rules.New([]config.RuleConfig{{Name: "configured", Expression: "on_ground"}}, db)
+	assert.NoError(t, err)
+	server.SetRules(engine)
+
+	rr := do("POST", "/admin/rules", `{"name": "heavy", "expression": "aircraft_type == \"A388\"", "severity": "warning"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created model.Rule
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.NotZero(t, created.ID)
+	assert.True(t, created.Enabled)
+	assert.Equal(t, rules.DefaultCooldown, created.Cooldown)
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/rules", `{"name": "bad", "expression": "altitude >"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/rules", `{"name": "configured", "expression": "true"}`).Code)
+
+	rr = do("GET", "/admin/rules", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var list []model.Rule
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(t, list, 2)
+	assert.True(t, list[0].ReadOnly)
+
+	path := fmt.Sprintf("/admin/rules/%d", created.ID)
+	assert.Equal(t, http.StatusOK, do("GET", path, "").Code)
+	rr = do("PUT", path, `{"name": "heavy", "expression": "aircraft_type == \"B748\"", "enabled": false}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var updated model.Rule
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &updated))
+	assert.Equal(t, created.ID, updated.ID)
+	assert.False(t, updated.Enabled)
+	assert.Equal(t, http.StatusNotFound, do("PUT", "/admin/rules/999", `{"name": "other", "expression": "true"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/admin/rules/abc", "").Code)
+
+	rr = do("POST", "/admin/rules/dry-run", `{"expression": "aircraft_type in [\"A388\", \"B748\"]"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var dryRun struct {
+		Evaluated int `json:"evaluated"`
+		Matched   int `json:"matched"`
+		Matches   []struct {
+			Flight model.FlightInfo `json:"flight"`
+		} `json:"matches"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &dryRun))
+	assert.Equal(t, 2, dryRun.Evaluated)
+	assert.Equal(t, 1, dryRun.Matched)
+	assert.Equal(t, "SIA22", dryRun.Matches[0].Flight.Ident)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/rules/dry-run", `{"expression": "speed > 3"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, do("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", path, "").Code)
+}
+
+func TestSkyChartHandler(t *testing.T) {
+	mockService := new(MockService)
+	mockService.On("Overhead", "").Return([]model.FlightInfo{
+		{Ident: "SWR12", Azimuth: 90, Elevation: 45, SlantRange: 12000},
+		{Icao24: "4b1805", Azimuth: 0, Elevation: 90},
+		{Ident: "LOW1", Azimuth: 180, Elevation: -2},
+	})
+	server := NewServer(mockService, &config.Config{Watch: true}, newTestDB(t))
+
+	req, err := http.NewRequest("GET", "/sky-chart.svg", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.skyChartHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/svg+xml", rr.Header().Get("Content-Type"))
+	body := rr.Body.String()
+	assert.Contains(t, body, "<title>SWR12: look E, 45° up, 12.0 km away</title>")
+	assert.Contains(t, body, `<circle cx="290.0" cy="200.0" r="5"`, "halfway between the horizon and the zenith")
+	assert.Contains(t, body, `<circle cx="200.0" cy="200.0" r="5"`, "the zenith is at the center")
+	assert.Contains(t, body, ">4b1805</text>")
+	assert.NotContains(t, body, "LOW1", "below the horizon")
+
+	// Several sites need a site to draw the sky of
+	server = NewServer(mockService, &config.Config{Watch: true, Sites: []config.SiteConfig{{Name: "home"}, {Name: "office"}}}, newTestDB(t))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.skyChartHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestTransitsHandler(t *testing.T) {
 	now := time.Now()
-	tests := []struct {
-		name     string
-		t        time.Time
-		expected string
-	}{
-		{
-			name:     "Just now",
-			t:        now.Add(-30 * time.Second),
-			expected: "just now",
-		},
-		{
-			name:     "1 minute ago",
-			t:        now.Add(-1 * time.Minute),
-			expected: "1 minute ago",
-		},
-		{
-			name:     "1 minute 30 seconds ago",
-			t:        now.Add(-1*time.Minute - 30*time.Second),
-			expected: "1 minute ago",
-		},
-		{
-			name:     "1 hour 1 minute ago",
-			t:        now.Add(-1*time.Hour - 1*time.Minute),
-			expected: "1 hour and 1 minute ago",
-		},
-		{
-			name:     "1 hour 1 minute 30 seconds ago",
-			t:        now.Add(-1*time.Hour - 1*time.Minute - 30*time.Second),
-			expected: "1 hour and 1 minute ago",
-		},
+	mockService := new(MockService)
+	mockService.On("Transits", "").Return([]model.Transit{
+		{Icao24: "4b1805", Callsign: "SWR12", Body: model.BodySun, Time: now.Add(-10 * time.Minute), Separation: 4.2, BodyRadius: 15.8, Duration: 0.61,
+			Azimuth: 135, Elevation: 60, SlantRange: 11500, ShiftDistance: 250, ShiftBearing: 225},
+		{Icao24: "3c6444", Body: model.BodyMoon, Time: now.Add(2 * time.Minute), Separation: 22.5, BodyRadius: 16.1,
+			Azimuth: 90, Elevation: 30, SlantRange: 20000, ShiftDistance: 1500, ShiftBearing: 0},
+	})
+	server := NewServer(mockService, &config.Config{Watch: true, Transits: config.TransitConfig{Enabled: true}}, newTestDB(t))
+
+	req, err := http.NewRequest("GET", "/transits", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.transitsHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	upcoming, recent := strings.Index(body, "Upcoming"), strings.Index(body, "Last Hour")
+	assert.Greater(t, strings.Index(body, "3c6444"), upcoming)
+	assert.Less(t, strings.Index(body, "3c6444"), recent)
+	assert.Greater(t, strings.Index(body, "SWR12 (4b1805)"), recent)
+	assert.Contains(t, body, `<tr class="full">`)
+	assert.Contains(t, body, "0.61 s")
+	assert.Contains(t, body, "move 250 m SW")
+	assert.Contains(t, body, "misses the disk")
+	assert.Contains(t, body, "move 1.5 km N")
+	assert.Contains(t, body, "SE, 60&deg; up")
+
+	// Without watch mode nothing is predicted
+	server = NewServer(mockService, &config.Config{Transits: config.TransitConfig{Enabled: true}}, newTestDB(t))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.transitsHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Transit predictions are disabled")
+}
+
+func TestUpcomingHandler(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	prediction := model.Prediction{Site: "default", Icao24: "4b1805", Callsign: "SWR12", PredictedAt: now.Add(-time.Minute),
+		EntryTime: now.Add(2 * time.Minute), EntryBearing: 270, ClosestTime: now.Add(3 * time.Minute), ClosestDistance: 1500, ClosestAltitude: 3000}
+	assert.NoError(t, db.RecordPredictionOutcome(&model.PredictionOutcome{Prediction: prediction, Outcome: model.PredictionEntered,
+		ActualEntry: prediction.EntryTime.Add(10 * time.Second), ActualDistance: 1800, ResolvedAt: now}))
+	assert.NoError(t, db.RecordPredictionOutcome(&model.PredictionOutcome{Prediction: prediction, Outcome: model.PredictionMissed, ResolvedAt: now}))
+	mockService := new(MockService)
+	mockService.On("Upcoming", "").Return([]model.Prediction{prediction})
+	server := NewServer(mockService, &config.Config{Watch: true, Lookahead: config.LookaheadConfig{Enabled: true}}, db)
+
+	req, err := http.NewRequest("GET", "/upcoming", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.upcomingHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Upcoming []model.Prediction       `json:"upcoming"`
+		Accuracy model.PredictionAccuracy `json:"accuracy"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Upcoming, 1)
+	assert.Equal(t, "SWR12", response.Upcoming[0].Callsign)
+	assert.Equal(t, 1500.0, response.Upcoming[0].ClosestDistance)
+	assert.Equal(t, model.PredictionAccuracy{Entered: 1, Missed: 1, MeanEntryError: 10, MeanDistanceError: 300, MeanLead: 190}, response.Accuracy)
+
+	// Unknown sites, and no predictions without watch mode
+	req, err = http.NewRequest("GET", "/upcoming?site=elsewhere", nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.upcomingHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	server = NewServer(mockService, &config.Config{Lookahead: config.LookaheadConfig{Enabled: true}}, db)
+	req, err = http.NewRequest("GET", "/upcoming", nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.upcomingHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "look-ahead predictions are disabled")
+}
+
+func TestExpectedHandler(t *testing.T) {
+	db := newTestDB(t)
+	server := NewServer(nil, &config.Config{}, db)
+	now := time.Now().In(server.location)
+	minute := now.Hour()*60 + now.Minute()
+	everyDay := []time.Weekday{0, 1, 2, 3, 4, 5, 6}
+	assert.NoError(t, db.ReplaceRecurringFlights([]model.RecurringFlight{
+		{Site: config.DefaultSite, Callsign: "SWR12", Minute: minute, Tolerance: 10, Weekdays: everyDay, Occurrences: 20, Regularity: 0.9},
+		{Site: config.DefaultSite, Callsign: "EZY34", Minute: minute, Tolerance: 10, Weekdays: everyDay, Occurrences: 12, Regularity: 0.6},
+		{Site: config.DefaultSite, Callsign: "DLH56", Minute: minute, Tolerance: 10, Weekdays: []time.Weekday{(now.Weekday() + 1) % 7}, Occurrences: 4, Regularity: 1},
+	}))
+	_, err := db.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR12", Time: now}, time.Minute)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/expected", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.expectedHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Date    string                 `json:"date"`
+		Flights []model.ExpectedFlight `json:"flights"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, now.Format(time.DateOnly), response.Date)
+	// The flight of tomorrow only is not expected
+	require.Len(t, response.Flights, 2)
+	statuses := map[string]string{}
+	for _, f := range response.Flights {
+		statuses[f.Callsign] = f.Status
+	}
+	assert.Equal(t, map[string]string{"SWR12": model.ExpectedOnTime, "EZY34": model.ExpectedDue}, statuses)
+
+	req, err = http.NewRequest("GET", "/expected?site=elsewhere", nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.expectedHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTrackHandler(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	sighting, err := db.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR12", Time: now}, time.Minute)
+	assert.NoError(t, err)
+	_, err = db.RecordSighting(model.Observation{Icao24: "4b1805", Callsign: "SWR12", Time: now.Add(20 * time.Second)}, time.Minute)
+	assert.NoError(t, err)
+	for i := range 3 {
+		state := model.Flight{Icao24: "4b1805", Callsign: "SWR12", TimePosition: int(now.Unix()) + i*10, Latitude: 47.4, Longitude: 8.5 + float64(i)/100, BaroAltitude: 3000}
+		assert.NoError(t, db.RecordPositions([]model.Flight{state}, now))
+	}
+	server := NewServer(nil, &config.Config{}, db)
+	do := func(target string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", target, nil)
+		assert.NoError(t, err)
+		rr := httptest.NewRecorder()
+		server.http.Handler.ServeHTTP(rr, req)
+		return rr
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			actual := formatTimeAgo(tt.t)
-			assert.Equal(t, tt.expected, actual)
-		})
+	rr := do(fmt.Sprintf("/sightings/%d/track", sighting.ID))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Sighting model.Sighting   `json:"sighting"`
+		Track    []model.Position `json:"track"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Sighting.SampleCount)
+	require.Len(t, response.Track, 3)
+	assert.Equal(t, 8.52, response.Track[2].Longitude)
+
+	assert.Equal(t, http.StatusNotFound, do("/sightings/999/track").Code)
+	assert.Equal(t, http.StatusBadRequest, do("/sightings/abc/track").Code)
+}
+
+func TestExportHandler(t *testing.T) {
+	db := newTestDB(t)
+	assert.NoError(t, db.LogFlight("SWR12", &model.FlightInfo{Ident: "SWR12", Operator: "SWR", CO2KG: 98000}))
+	// Sighted after the flight was logged, and an unknown callsign an hour before
+	at := time.Now().UTC()
+	for i, callsign := range []string{"SWR12", "EZY45"} {
+		_, err := db.RecordSighting(model.Observation{Icao24: fmt.Sprintf("a%05d", i), Callsign: callsign, Time: at.Add(-time.Duration(i) * time.Hour)}, time.Minute)
+		assert.NoError(t, err)
+	}
+	server := NewServer(nil, &config.Config{}, db)
+	do := func(target string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", target, nil)
+		assert.NoError(t, err)
+		rr := httptest.NewRecorder()
+		server.http.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("/export/csv")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="sightings.csv"`, rr.Header().Get("Content-Disposition"))
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "sighting_id,site,icao24,callsign,first_seen,"))
+	assert.Contains(t, lines[1], ",EZY45,")
+	assert.Contains(t, lines[2], ",SWR12,")
+	assert.Contains(t, lines[2], ",98000,")
+
+	rr = do("/export/ndjson?since=" + at.Add(-90*time.Minute).Format(time.RFC3339) + "&until=" + at.Add(-30*time.Minute).Format(time.RFC3339))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	var row model.ExportRow
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &row))
+	assert.Equal(t, "EZY45", row.Callsign)
+
+	rr = do("/export/parquet")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "PAR1", rr.Body.String()[:4])
+
+	assert.Equal(t, http.StatusNotFound, do("/export/xlsx").Code)
+	assert.Equal(t, http.StatusNotFound, do("/export/csv?site=nowhere").Code)
+	assert.Equal(t, http.StatusBadRequest, do("/export/csv?since=yesterday").Code)
+}
+
+func TestNoiseHandler(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	for i, level := range []float64{62, 0, 71.5} {
+		_, err := db.RecordSighting(model.Observation{Icao24: fmt.Sprintf("a%05d", i), Callsign: fmt.Sprintf("FL%03d", i), Time: now.Add(-time.Duration(i) * time.Minute),
+			NoiseLevel: level, NoiseExposure: level + 10}, time.Minute)
+		assert.NoError(t, err)
+	}
+	_, err := db.RecordSighting(model.Observation{Icao24: "a00009", Callsign: "OLD", Time: now.AddDate(0, 0, -10), NoiseLevel: 90, NoiseExposure: 100}, time.Minute)
+	assert.NoError(t, err)
+	server := NewServer(nil, &config.Config{}, db)
+
+	req, err := http.NewRequest("GET", "/noise", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.noiseHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Days    []model.NoiseDay  `json:"days"`
+		Loudest []*model.Sighting `json:"loudest"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Days)
+	assert.Equal(t, 71.5, response.Days[0].Loudest)
+	require.Len(t, response.Loudest, 2)
+	assert.Equal(t, "FL002", response.Loudest[0].Callsign)
+	assert.Equal(t, 81.5, response.Loudest[0].NoiseExposure)
+	assert.Equal(t, "FL000", response.Loudest[1].Callsign)
+
+	// Older passes with more days
+	req, err = http.NewRequest("GET", "/noise?days=30", nil)
+	assert.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.noiseHandler).ServeHTTP(rr, req)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Loudest, 3)
+	assert.Equal(t, "OLD", response.Loudest[0].Callsign)
+
+	for _, days := range []string{"abc", "0", "91"} {
+		req, err = http.NewRequest("GET", "/noise?days="+days, nil)
+		assert.NoError(t, err)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(server.noiseHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, days)
 	}
 }
 
@@ -253,10 +833,26 @@ func TestGetStatsHandler(t *testing.T) {
 	if err := db.LogFlight("FL002", flight2); err != nil {
 		t.Fatalf("failed to log flight FL002: %v", err)
 	}
+	for _, ident := range []string{"FL001", "FL002"} {
+		if _, err := db.RecordSighting(model.Observation{Callsign: ident, Time: time.Now(), Distance: 1500, Altitude: 3000, NoiseLevel: 68.4, NoiseExposure: 77.9}, time.Minute); err != nil {
+			t.Fatalf("failed to record sighting %s: %v", ident, err)
+		}
+	}
+	if _, err := db.RecordFirstSeen(map[string]string{model.KindAircraftType: "B737"}, "FL001", "", time.Now()); err != nil {
+		t.Fatalf("failed to record first sighting: %v", err)
+	}
+	if _, _, err := db.RecordSquawkAlert("", "emergency", "critical", &model.Flight{Icao24: "a1b2c3", Squawk: "7700"}, time.Now(), time.Minute); err != nil {
+		t.Fatalf("failed to record squawk alert: %v", err)
+	}
 
 	// Create a new server with the test database
 	cfg := &config.Config{}
 	server := NewServer(nil, cfg, db)
+	now := time.Now().In(server.location)
+	if err := db.ReplaceRecurringFlights([]model.RecurringFlight{{Site: config.DefaultSite, Callsign: "FL002", Minute: now.Hour()*60 + now.Minute(), Tolerance: 10,
+		Weekdays: []time.Weekday{0, 1, 2, 3, 4, 5, 6}, Occurrences: 20, Regularity: 0.9}}); err != nil {
+		t.Fatalf("failed to store recurring flights: %v", err)
+	}
 
 	// Create a new HTTP request
 	req, err := http.NewRequest("GET", "/", nil)
@@ -275,11 +871,25 @@ func TestGetStatsHandler(t *testing.T) {
 	// Check the response body
 	body := rr.Body.String()
 	assert.Contains(t, body, "<h1>Flight Statistics</h1>")
+	assert.Contains(t, body, "<h2>Squawk Alerts (last 24 hours)</h2>")
+	assert.Contains(t, body, `<tr class="severity-critical">`)
+	assert.Contains(t, body, "<td>a1b2c3</td>")
 	assert.Contains(t, body, "<h2>Last Flight Seen</h2>")
 	assert.Contains(t, body, "<td>FL002</td>")
 	assert.Contains(t, body, "<h2>Last 10 Flights Seen</h2>")
-	assert.Contains(t, body, "<td>FL001</td>")
+	assert.Contains(t, body, `<td>FL001 <span class="first-seen">new aircraft type</span></td>`)
 	assert.Contains(t, body, "<h2>5 Most Common Flights</h2>")
+	assert.Contains(t, body, "<h2>Recent Passes</h2>")
+	assert.Contains(t, body, "<h2>New This Week</h2>")
+	assert.Contains(t, body, "<td>aircraft type</td>")
+	assert.Contains(t, body, "<td>B737</td>")
+	assert.Contains(t, body, "<h2>Expected Today</h2>")
+	assert.Contains(t, body, `<tr class="expected-on_time">`)
+	assert.Contains(t, body, "<td>daily</td>")
+	assert.Contains(t, body, "<h2>Noise (estimated, last 7 days)</h2>")
+	assert.Contains(t, body, "<h2>Loudest Passes</h2>")
+	assert.Contains(t, body, "<td>68.4</td>")
+	assert.Contains(t, body, "<td>77.9</td>")
 	assert.Contains(t, body, "<h2>Top 10 Destinations</h2>")
 	assert.Contains(t, body, "TSB (Testburg)")
 	assert.Contains(t, body, "<h2>Top 10 Sources</h2>")
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+const (
+	skyChartSize   = 400 // width and height of the chart in pixels
+	skyChartRadius = 180 // radius of the horizon circle in pixels
+)
+
+// skyChartPosition returns where an aircraft is drawn: the zenith at the center, the horizon on
+// the outer circle, and north up and east to the right like on a map.
+func skyChartPosition(azimuth, elevation float64) (float64, float64) {
+	r := skyChartRadius * (90 - math.Max(0, math.Min(90, elevation))) / 90
+	a := azimuth * math.Pi / 180
+	return skyChartSize/2 + r*math.Sin(a), skyChartSize/2 - r*math.Cos(a)
+}
+
+// writeSkyChart writes an SVG polar chart of the sky of a site with the aircraft above its horizon.
+func writeSkyChart(w io.Writer, flights []model.FlightInfo) error {
+	var b strings.Builder
+	center := skyChartSize / 2
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		skyChartSize, skyChartSize, skyChartSize, skyChartSize)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#0b1d3a"/>`+"\n", skyChartSize, skyChartSize)
+
+	// Elevation rings every 30 degrees, and the cardinal directions
+	for _, elevation := range []int{0, 30, 60} {
+		r := skyChartRadius * (90 - elevation) / 90
+		fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="none" stroke="#4a6fa5" stroke-width="1"/>`+"\n", center, center, r)
+		if elevation > 0 {
+			fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#4a6fa5">%d°</text>`+"\n", center+3, center-r-3, elevation)
+		}
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#4a6fa5"/>`+"\n", center, center-skyChartRadius, center, center+skyChartRadius)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#4a6fa5"/>`+"\n", center-skyChartRadius, center, center+skyChartRadius, center)
+	for i, point := range []string{"N", "E", "S", "W"} {
+		a := float64(i) * math.Pi / 2
+		x := float64(center) + (skyChartRadius+11)*math.Sin(a)
+		y := float64(center) - (skyChartRadius+11)*math.Cos(a)
+		fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" fill="#ffffff" text-anchor="middle" dominant-baseline="middle">%s</text>`+"\n", x, y, point)
+	}
+
+	for _, flight := range flights {
+		if flight.Elevation < 0 {
+			continue
+		}
+		label := flight.Ident
+		if label == "" {
+			label = flight.Icao24
+		}
+		x, y := skyChartPosition(flight.Azimuth, flight.Elevation)
+		fmt.Fprintf(&b, `<g class="aircraft"><title>%s: %s, %.1f km away</title>`, html.EscapeString(label), html.EscapeString(flight.LookDirection()), flight.SlantRange/1000)
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="5" fill="#f1c40f"/>`, x, y)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="#f1c40f">%s</text></g>`+"\n", x+8, y+4, html.EscapeString(label))
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStates is a state provider returning a scripted list of states on each call.
+type fakeStates struct {
+	mu    sync.Mutex
+	steps [][]model.Flight
+}
+
+func (f *fakeStates) GetStatesInArea(area geofence.Area) ([]model.Flight, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.steps) == 0 {
+		return nil, nil
+	}
+	states := f.steps[0]
+	f.steps = f.steps[1:]
+	return states, nil
+}
+
+func TestWatchCycle_Events(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.ClearFlightLog(); err != nil {
+		t.Fatalf("failed to clear flight log: %v", err)
+	}
+
+	at := func(lon float64) []model.Flight {
+		return []model.Flight{{Icao24: "abc123", Callsign: "XYZ12", Latitude: 47.0, Longitude: lon, BaroAltitude: 3000, Velocity: 200, TrueTrack: 90}}
+	}
+	// An aircraft crossing the site from west to east, then missed by a poll and out of the site, still fetched
+	states := &fakeStates{steps: [][]model.Flight{at(7.9), at(8.0), at(8.1), nil, at(8.5)}}
+
+	mockFlightAwareClient := new(MockFlightAwareClient)
+	mockFlightAwareClient.On("GetFlightInfo", "XYZ12").Return(&model.FlightInfo{Ident: "XYZ12", OperatorIcao: "XYZ"}, nil)
+	mockFlightAwareClient.On("GetOperator", "XYZ").Return(`{"name": "Xyz Air", "shortname": "xyz"}`, nil).Once()
+	mockTravelImpactModelClient := new(MockTravelImpactModelClient)
+	mockTravelImpactModelClient.On("GetFlightEmission", mock.Anything).Return(0.0, nil)
+
+	cfg := &config.Config{Service: config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 20}, Positions: config.PositionsConfig{Enabled: true}}
+	service, err := NewService(states, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
+
+	sub := service.Events().Subscribe(100, events.AircraftEntered, events.ClosestApproach, events.AircraftLeft, events.OperatorFirstSeen)
+	enriched := service.Events().Subscribe(100, events.EnrichmentCompleted)
+
+	for i := range 5 {
+		_, err := service.watchCycle(service.Sites())
+		assert.NoError(t, err)
+		if i == 1 || i == 3 {
+			// Overhead while its pass is open, also when missed by a poll
+			overhead := service.Overhead(config.DefaultSite)
+			assert.Len(t, overhead, 1)
+			assert.Equal(t, "XYZ12", overhead[0].Ident)
+			assert.Empty(t, service.Overhead("elsewhere"))
+		}
+	}
+	// The pass is closed once its aircraft is out of the site for two polls, well before the sighting gap
+	assert.Empty(t, service.Overhead(""))
+	sub.Close()
+
+	var types []events.Type
+	for e := range sub.C {
+		assert.Equal(t, config.DefaultSite, e.Site)
+		types = append(types, e.Type)
+		if e.Type == events.ClosestApproach {
+			assert.Less(t, e.Sighting.MinDistance, 100.0)
+		}
+		if e.Type == events.AircraftLeft {
+			assert.Equal(t, 3, e.Sighting.SampleCount)
+		}
+	}
+	assert.Equal(t, []events.Type{events.OperatorFirstSeen, events.AircraftEntered, events.ClosestApproach, events.AircraftLeft}, types)
+	assert.Len(t, enriched.C, 3)
+
+	// The positions of every poll make the track of the pass, up to the poll closing it
+	sightings, err := db.GetRecentSightings(1, "")
+	assert.NoError(t, err)
+	track, err := db.GetTrack(sightings[0])
+	assert.NoError(t, err)
+	assert.Len(t, track, 4)
+	assert.Equal(t, 8.5, track[3].Longitude)
+
+	// A late subscriber gets the remembered events
+	late := service.Events().Subscribe(100)
+	assert.Len(t, late.C, 7)
+}
+
+func TestTrackedStates(t *testing.T) {
+	cfg := &config.Config{Service: config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 20}, Positions: config.PositionsConfig{Enabled: true}}
+	service, err := NewService(&fakeStates{}, new(MockFlightAwareClient), new(MockTravelImpactModelClient), newTestDB(t), cfg)
+	require.NoError(t, err)
+	service.passes[passKey{config.DefaultSite, "leaving", "XYZ34"}] = &pass{}
+
+	states := []model.Flight{
+		{Icao24: "inside", Latitude: 47.0, Longitude: 8.1},
+		{Icao24: "leaving", Latitude: 47.0, Longitude: 8.5}, // just out of the site, its pass still open
+		{Icao24: "ahead", Latitude: 47.0, Longitude: 8.5},   // only in the box widened for the predictions
+	}
+	var tracked []string
+	for _, state := range service.trackedStates(states, service.Sites()) {
+		tracked = append(tracked, state.Icao24)
+	}
+	assert.Equal(t, []string{"inside", "leaving"}, tracked)
+}
+
+// TestWatchCycle_ClosestApproach reads the event while and after the pass goes on, as the consumers of the bus do,
+// run with -race.
+func TestWatchCycle_ClosestApproach(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, db.ClearFlightLog())
+
+	at := func(lon float64) []model.Flight {
+		return []model.Flight{{Icao24: "abc123", Callsign: "XYZ12", Latitude: 47.0, Longitude: lon, BaroAltitude: 3000, Velocity: 200, TrueTrack: 90}}
+	}
+	states := &fakeStates{steps: [][]model.Flight{at(7.9), at(8.0), at(8.05), at(8.1), at(8.15)}}
+	mockFlightAwareClient := new(MockFlightAwareClient)
+	mockFlightAwareClient.On("GetFlightInfo", "XYZ12").Return(&model.FlightInfo{Ident: "XYZ12"}, nil)
+	mockTravelImpactModelClient := new(MockTravelImpactModelClient)
+	mockTravelImpactModelClient.On("GetFlightEmission", mock.Anything).Return(0.0, nil)
+	cfg := &config.Config{Service: config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 20}}
+	service, err := NewService(states, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
+
+	sub := service.Events().Subscribe(10, events.ClosestApproach)
+	received := make(chan float64, 1)
+	go func() {
+		e := <-sub.C
+		received <- e.Flight.Longitude
+	}()
+	var approach events.Event
+	for i := range 5 {
+		_, err := service.watchCycle(service.Sites())
+		require.NoError(t, err)
+		if i == 2 {
+			approach = service.Events().History()[len(service.Events().History())-1]
+		}
+	}
+	assert.Equal(t, 8.0, <-received)
+	// Still the closest position after the next polls
+	require.Equal(t, events.ClosestApproach, approach.Type)
+	assert.Equal(t, 8.0, approach.Flight.Longitude)
+	sub.Close()
+}
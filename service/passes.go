@@ -0,0 +1,114 @@
+package service
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// passKey identifies an open pass of an aircraft over a site.
+type passKey struct {
+	site, icao24, callsign string
+}
+
+// passMisses is how many polls in a row the aircraft of a pass must be outside its site for the pass to be closed,
+// so that a state missing from a single poll does not split a pass.
+const passMisses = 2
+
+// pass is an open pass followed to publish its lifecycle events.
+type pass struct {
+	flight       model.FlightInfo
+	sighting     *model.Sighting
+	lastDistance float64
+	approached   bool // ClosestApproach has been published
+	missed       int  // polls of the site in a row the aircraft was outside it
+}
+
+// Events returns the bus the service publishes sighting lifecycle events on.
+func (s *Service) Events() *events.Bus {
+	return s.bus
+}
+
+// Overhead returns the aircraft of the open passes over a site, or over all sites when site is empty, closest first.
+func (s *Service) Overhead(site string) []model.FlightInfo {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	var flights []model.FlightInfo
+	for key, p := range s.passes {
+		if site == "" || key.site == site {
+			flights = append(flights, p.flight)
+		}
+	}
+	slices.SortFunc(flights, func(a, b model.FlightInfo) int { return cmp.Compare(a.Distance, b.Distance) })
+	return flights
+}
+
+// trackPass updates the pass of a logged flight, publishing AircraftEntered for a new pass
+// and ClosestApproach when the aircraft starts moving away from the site.
+func (s *Service) trackPass(flight *model.FlightInfo, sighting *model.Sighting) {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	key := passKey{sighting.Site, sighting.Icao24, sighting.Callsign}
+	p, ok := s.passes[key]
+	if !ok {
+		s.passes[key] = &pass{flight: *flight, sighting: sighting, lastDistance: flight.Distance}
+		s.publish(events.AircraftEntered, sighting.LastSeen, flight, sighting)
+		return
+	}
+
+	if !p.approached && flight.Distance > p.lastDistance {
+		p.approached = true
+		approach := p.flight // the pass goes on, the subscribers read the event later
+		s.publish(events.ClosestApproach, sighting.LastSeen, &approach, sighting)
+	}
+	p.flight = *flight
+	p.sighting = sighting
+	p.lastDistance = flight.Distance
+}
+
+// closePasses publishes AircraftLeft at the given time for the open passes over the polled sites whose aircraft was
+// outside the area of the site, in the states of the poll, for passMisses polls in a row. The sighting is kept
+// open for the sighting gap, so that an aircraft coming back soon continues it. A pass closed before its aircraft
+// moved away gets its ClosestApproach at its last position.
+func (s *Service) closePasses(sites []*Site, states []model.Flight, now time.Time) {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	for key, p := range s.passes {
+		i := slices.IndexFunc(sites, func(site *Site) bool { return site.Name == key.site })
+		if i < 0 {
+			continue
+		}
+		if slices.ContainsFunc(states, func(state model.Flight) bool {
+			return state.Icao24 == key.icao24 && sites[i].Area.Contains(state.Latitude, state.Longitude)
+		}) {
+			p.missed = 0
+			continue
+		}
+		if p.missed++; p.missed < passMisses {
+			continue
+		}
+		approach, left := p.flight, p.flight
+		if !p.approached {
+			s.publish(events.ClosestApproach, p.sighting.LastSeen, &approach, p.sighting)
+		}
+		s.publish(events.AircraftLeft, now, &left, p.sighting)
+		delete(s.passes, key)
+	}
+}
+
+func (s *Service) publish(eventType events.Type, at time.Time, flight *model.FlightInfo, sighting *model.Sighting) {
+	e := events.Event{Type: eventType, Time: at, Flight: flight, Sighting: sighting}
+	if flight != nil {
+		e.Site = flight.Site
+	}
+	if sighting != nil {
+		e.Site = sighting.Site
+	}
+	s.bus.Publish(e)
+}
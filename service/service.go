@@ -1,27 +1,41 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/carlo-colombo/sopra/config"
-	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/filter"
+	"github.com/carlo-colombo/sopra/geofence"
 	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/lookahead"
 	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/noise"
+	"github.com/carlo-colombo/sopra/scheduler"
+	"github.com/carlo-colombo/sopra/squawk"
+	"github.com/carlo-colombo/sopra/storage"
+	"github.com/carlo-colombo/sopra/transit"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
 // OpenSkyAPIClient defines the interface for the OpenSky API client.
 type OpenSkyAPIClient interface {
-	GetStatesInRadius(lat, lon, radiusKm float64) ([]model.Flight, error)
+	GetStatesInArea(area geofence.Area) ([]model.Flight, error)
 }
 
 // FlightAwareAPIClient defines the interface for the FlightAware AeroAPI client.
 type FlightAwareAPIClient interface {
 	GetFlightInfo(ident string) (*model.FlightInfo, error)
 	GetOperator(icao string) (string, error)
+	GetAirport(code string) (*model.AirportInfo, error)
 }
 
 // TravelImpactModelAPIClient defines the interface for the Google Travel Impact Model API client.
@@ -29,38 +43,248 @@ type TravelImpactModelAPIClient interface {
 	GetFlightEmission(flightInfo *model.FlightInfo) (float64, error)
 }
 
+// Store is the storage the service records the polls in: the flights, their operators, airports and sightings,
+// the positions, the first sightings, the squawk alerts and the statistics of the filters and the predictions.
+type Store interface {
+	storage.Operators
+	storage.Airports
+	storage.Flights
+	storage.Sightings
+	storage.Stats
+	storage.FirstSeen
+	storage.SquawkAlerts
+	storage.Positions
+}
+
 // Service is the main service for the application.
 type Service struct {
 	openskyClient           OpenSkyAPIClient
 	flightawareClient       FlightAwareAPIClient
 	travelImpactModelClient TravelImpactModelAPIClient // Add Travel Impact Model client
-	db                      *database.DB
+	db                      Store
 	cfg                     *config.Config // Add config to the service struct
+	filters                 *filter.Set
+	squawks                 *squawk.Detector
+	transits                *transit.Predictor   // nil when disabled
+	lookahead               *lookahead.Predictor // nil when disabled
+	sites                   []*Site
+
+	watchMu sync.Mutex
+	paused  bool
+	resumed chan struct{}
+
+	bus    *events.Bus
+	passMu sync.Mutex
+	passes map[passKey]*pass
+
+	transitMu sync.Mutex
+	predicted map[transitKey]*model.Transit
+
+	upcomingMu sync.Mutex
+	upcoming   map[upcomingKey]*upcoming
+	inside     map[string]map[string]bool // ICAO24 addresses inside each site at the last poll
 }
 
-// NewService creates a new Service.
-func NewService(openskyClient OpenSkyAPIClient, flightawareClient FlightAwareAPIClient, travelImpactModelClient TravelImpactModelAPIClient, db *database.DB, cfg *config.Config) *Service {
+// eventReplay is the number of events replayed to late subscribers.
+const eventReplay = 100
+
+// Site is a named location watched for overflights, with its own area, interval and filters.
+type Site struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+	Altitude  float64 // meters above sea level
+	Interval  time.Duration
+	Area      geofence.Area
+	filters   *filter.Set
+	schedule  *scheduler.Scheduler // when the site is polled in watch mode
+}
+
+// NewService creates a new Service, failing when the configuration is invalid.
+func NewService(openskyClient OpenSkyAPIClient, flightawareClient FlightAwareAPIClient, travelImpactModelClient TravelImpactModelAPIClient, db Store, cfg *config.Config) (*Service, error) {
+	filters, err := filter.New(cfg.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure traffic filters: %w", err)
+	}
+
+	squawks, err := squawk.New(cfg.SquawkRanges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure squawk ranges: %w", err)
+	}
+
+	var transits *transit.Predictor
+	if cfg.Transits.Enabled {
+		if transits, err = transit.New(cfg.Transits); err != nil {
+			return nil, fmt.Errorf("failed to configure transit predictions: %w", err)
+		}
+	}
+
+	var ahead *lookahead.Predictor
+	if cfg.Lookahead.Enabled {
+		if ahead, err = lookahead.New(cfg.Lookahead); err != nil {
+			return nil, fmt.Errorf("failed to configure look-ahead predictions: %w", err)
+		}
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Printf("failed to load location %s: %v. Falling back to Local", cfg.Timezone, err)
+		location = time.Local
+	}
+
+	var sites []*Site
+	for _, siteCfg := range cfg.WatchSites() {
+		siteFilters, err := filter.New(siteCfg.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure traffic filters of site %s: %w", siteCfg.Name, err)
+		}
+		if names := siteFilters.Names(); len(names) > 0 {
+			log.Printf("Traffic filters enabled for site %s: %v", siteCfg.Name, names)
+		}
+		area, err := geofence.FromConfig(siteCfg.ServiceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load geofence of site %s: %w", siteCfg.Name, err)
+		}
+		interval := time.Duration(siteCfg.Interval) * time.Second
+		schedule, err := scheduler.New(area, interval, cfg.Schedule, location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure the schedule of site %s: %w", siteCfg.Name, err)
+		}
+		sites = append(sites, &Site{
+			Name:      siteCfg.Name,
+			Latitude:  siteCfg.Latitude,
+			Longitude: siteCfg.Longitude,
+			Altitude:  siteCfg.Altitude,
+			Interval:  interval,
+			Area:      area,
+			filters:   siteFilters,
+			schedule:  schedule,
+		})
+	}
+
 	return &Service{
 		openskyClient:           openskyClient,
 		flightawareClient:       flightawareClient,
 		travelImpactModelClient: travelImpactModelClient, // Store the Travel Impact Model client
 		db:                      db,
 		cfg:                     cfg, // Store the config
+		filters:                 filters,
+		squawks:                 squawks,
+		transits:                transits,
+		lookahead:               ahead,
+		sites:                   sites,
+		resumed:                 make(chan struct{}, 1),
+		bus:                     events.NewBus(eventReplay),
+		passes:                  make(map[passKey]*pass),
+		predicted:               make(map[transitKey]*model.Transit),
+		upcoming:                make(map[upcomingKey]*upcoming),
+		inside:                  make(map[string]map[string]bool),
+	}, nil
+}
+
+// Sites returns the watched sites.
+func (s *Service) Sites() []*Site {
+	return s.sites
+}
+
+// Site returns the watched site with the given name, or nil if there is none.
+func (s *Service) Site(name string) *Site {
+	for _, site := range s.sites {
+		if site.Name == name {
+			return site
+		}
+	}
+	return nil
+}
+
+// Area returns the area watched at a site, or the union of all sites when site is empty.
+// It returns nil for an unknown site.
+func (s *Service) Area(site string) geofence.Area {
+	if site != "" {
+		if st := s.Site(site); st != nil {
+			return st.Area
+		}
+		return nil
+	}
+	if len(s.sites) == 1 {
+		return s.sites[0].Area
+	}
+	return siteAreas(s.sites)
+}
+
+// GetFlights returns a list of enriched FlightInfo objects inside the area of a site,
+// or of all sites when site is empty.
+func (s *Service) GetFlights(site string) ([]model.FlightInfo, error) {
+	if site == "" {
+		return s.GetFlightsAt(s.sites)
+	}
+	st := s.Site(site)
+	if st == nil {
+		return nil, fmt.Errorf("unknown site %q", site)
 	}
+	return s.GetFlightsAt([]*Site{st})
 }
 
 // GetFlightsInRadius returns a list of enriched FlightInfo objects within a given radius from a location.
 func (s *Service) GetFlightsInRadius(lat, lon, radius float64) ([]model.FlightInfo, error) {
 	log.Printf("Request for flights in radius %f from position (%f, %f)\n", radius, lat, lon)
+	return s.GetFlightsAt([]*Site{{
+		Name:      config.DefaultSite,
+		Latitude:  lat,
+		Longitude: lon,
+		Area:      geofence.Circle{Latitude: lat, Longitude: lon, RadiusKm: radius},
+		filters:   s.filters,
+	}})
+}
+
+// GetFlightsAt returns a list of enriched FlightInfo objects inside the areas of the sites.
+// The areas are fetched with a single merged OpenSky request and each aircraft is enriched once;
+// an aircraft inside several sites is returned once per site, tagged with the site name.
+func (s *Service) GetFlightsAt(sites []*Site) ([]model.FlightInfo, error) {
+	openskyFlights, err := s.getStates(sites, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.enrich(openskyFlights, sites), nil
+}
+
+// getStates fetches the OpenSky states within the bounding boxes of the sites, widened by marginKm,
+// including the aircraft around the areas.
+func (s *Service) getStates(sites []*Site, marginKm float64) ([]model.Flight, error) {
+	var area geofence.Area = siteAreas(sites)
+	if len(sites) == 1 {
+		area = sites[0].Area
+	}
+
 	startOpenSky := time.Now()
-	openskyFlights, err := s.openskyClient.GetStatesInRadius(lat, lon, radius)
+	openskyFlights, err := s.openskyClient.GetStatesInArea(geofence.Envelope{Area: area, MarginKm: marginKm})
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("OpenSky API call took %s to get %d flights\n", time.Since(startOpenSky), len(openskyFlights))
+	return openskyFlights, nil
+}
 
+// enrich filters and enriches the aircraft inside the areas of the sites.
+func (s *Service) enrich(openskyFlights []model.Flight, sites []*Site) []model.FlightInfo {
 	var enrichedFlights []model.FlightInfo
 	for _, flight := range openskyFlights {
+		var candidates []*Site
+		for _, site := range sites {
+			if !site.Area.Contains(flight.Latitude, flight.Longitude) {
+				continue
+			}
+			s.detectSquawks(site, &flight) // before the filters and regardless of the callsign
+			if rejectedBy := site.filters.CheckState(&flight); rejectedBy != "" {
+				s.recordRejection(site.Name, rejectedBy, &flight)
+				continue // Filtered out before spending any enrichment API credits
+			}
+			candidates = append(candidates, site)
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
 		if flight.Callsign == "" {
 			continue // Skip flights without a callsign for FlightAware lookup
 		}
@@ -74,9 +298,18 @@ func (s *Service) GetFlightsInRadius(lat, lon, radius float64) ([]model.FlightIn
 		log.Printf("FlightAware GetFlightInfo for %s took %s\n", flight.Callsign, time.Since(startFlightAwareInfo))
 
 		if flightInfo != nil {
-			flightInfo.Latitude = flight.Latitude
-			flightInfo.Longitude = flight.Longitude
-			flightInfo.Distance = haversine.Distance(lat, lon, flight.Latitude, flight.Longitude) * 1000
+			flightInfo.SetState(&flight)
+			var accepted []*Site
+			for _, site := range candidates {
+				if rejectedBy := site.filters.CheckEnriched(&flight, flightInfo); rejectedBy != "" {
+					s.recordRejection(site.Name, rejectedBy, &flight)
+					continue
+				}
+				accepted = append(accepted, site)
+			}
+			if len(accepted) == 0 {
+				continue
+			}
 
 			// --- START Google Travel Impact Model Integration ---
 			startTIM := time.Now()
@@ -92,47 +325,128 @@ func (s *Service) GetFlightsInRadius(lat, lon, radius float64) ([]model.FlightIn
 
 			if flightInfo.OperatorIcao != "" {
 				startOperatorInfo := time.Now()
-				_, err := s.getOperatorInfo(flightInfo.OperatorIcao)
+				_, firstSeen, err := s.getOperatorInfo(flightInfo.OperatorIcao)
 				if err != nil {
 					log.Printf("Could not get operator info for ICAO %s: %v. Took %s\n", flightInfo.OperatorIcao, err, time.Since(startOperatorInfo))
 				}
+				if firstSeen {
+					for _, site := range accepted {
+						s.bus.Publish(events.Event{Type: events.OperatorFirstSeen, Site: site.Name, Flight: flightInfo, Operator: flightInfo.OperatorIcao})
+					}
+				}
 				log.Printf("GetOperatorInfo for %s took %s\n", flightInfo.OperatorIcao, time.Since(startOperatorInfo))
 			}
-			enrichedFlights = append(enrichedFlights, *flightInfo)
+			s.locateAirports(flightInfo)
+
+			for _, site := range accepted {
+				siteFlight := *flightInfo
+				siteFlight.Site = site.Name
+				siteFlight.Distance = haversine.Distance(site.Latitude, site.Longitude, flight.Latitude, flight.Longitude) * 1000
+				siteFlight.Azimuth, siteFlight.Elevation, siteFlight.SlantRange = haversine.LookAngles(
+					site.Latitude, site.Longitude, site.Altitude, flight.Latitude, flight.Longitude, flight.GeometricAltitude())
+				enrichedFlights = append(enrichedFlights, siteFlight)
+				s.bus.Publish(events.Event{Type: events.EnrichmentCompleted, Site: site.Name, Flight: &siteFlight})
+			}
 		}
 	}
-	return enrichedFlights, nil
+	return enrichedFlights
 }
 
-func (s *Service) getOperatorInfo(icao string) (*model.OperatorInfo, error) {
+// siteAreas returns the union of the areas of the sites.
+func siteAreas(sites []*Site) geofence.Union {
+	areas := make(geofence.Union, len(sites))
+	for i, site := range sites {
+		areas[i] = site.Area
+	}
+	return areas
+}
+
+// detectSquawks records and publishes the alerts raised by the squawk code or SPI of an aircraft over a site.
+func (s *Service) detectSquawks(site *Site, state *model.Flight) {
+	for _, detection := range s.squawks.Detect(state) {
+		alert, opened, err := s.db.RecordSquawkAlert(site.Name, detection.Kind, detection.Severity, state, time.Now(), s.sightingGap())
+		if err != nil {
+			log.Printf("Error recording %s alert for ICAO24 %s: %v", detection.Kind, state.Icao24, err)
+			continue
+		}
+		if !opened {
+			continue
+		}
+		log.Printf("ALERT %s (%s): ICAO24 %s, callsign %q, squawk %s over site %s", detection.Kind, detection.Severity, state.Icao24, state.Callsign, state.Squawk, site.Name)
+		flight := &model.FlightInfo{Ident: state.Callsign, Site: site.Name}
+		flight.SetState(state)
+		s.bus.Publish(events.Event{Type: events.SquawkAlert, Time: alert.FirstSeen, Site: site.Name, Flight: flight, Severity: detection.Severity, Alert: alert})
+	}
+}
+
+// recordRejection logs and stores that a traffic filter of a site rejected an aircraft.
+func (s *Service) recordRejection(site, filterName string, flight *model.Flight) {
+	log.Printf("Flight %s (ICAO24: %s) rejected by filter %s of site %s\n", flight.Callsign, flight.Icao24, filterName, site)
+	if err := s.db.RecordFilterRejection(site, filterName, flight.Icao24, time.Now()); err != nil {
+		log.Printf("Error recording rejection by filter %s: %v", filterName, err)
+	}
+}
+
+// locateAirports stores the location of the airports of a flight not located yet, from FlightAware.
+// An airport FlightAware does not know is left without, and looked up again with the next flight.
+func (s *Service) locateAirports(flightInfo *model.FlightInfo) {
+	for _, code := range []string{flightInfo.Origin.Code, flightInfo.Destination.Code} {
+		if code == "" {
+			continue
+		}
+		located, err := s.db.AirportLocated(code)
+		if err != nil {
+			log.Printf("Error checking the location of airport %s: %v", code, err)
+			continue
+		}
+		if located {
+			continue
+		}
+		airport, err := s.flightawareClient.GetAirport(code)
+		if err != nil {
+			log.Printf("Error getting airport %s from FlightAware: %v", code, err)
+			continue
+		}
+		if airport == nil {
+			continue
+		}
+		if err := s.db.SetAirportLocation(code, airport.Latitude, airport.Longitude); err != nil {
+			log.Printf("Error storing the location of airport %s: %v", code, err)
+		}
+	}
+}
+
+// getOperatorInfo returns the operator, from the cache or FlightAware.
+// It reports whether the operator was seen for the first time, i.e. fetched from FlightAware.
+func (s *Service) getOperatorInfo(icao string) (*model.OperatorInfo, bool, error) {
 	startDbGet := time.Now()
 	cachedOperator, err := s.db.GetOperator(icao)
 	if err != nil {
 		log.Printf("Error getting operator %s from DB: %v. Took %s\n", icao, err, time.Since(startDbGet))
-		return nil, err
+		return nil, false, err
 	}
 	log.Printf("DB GetOperator for %s took %s\n", icao, time.Since(startDbGet))
 
 	if cachedOperator != "" {
 		var operatorInfo model.OperatorInfo
 		if err := json.Unmarshal([]byte(cachedOperator), &operatorInfo); err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		caser := cases.Title(language.English)
 		operatorInfo.Shortname = caser.String(operatorInfo.Shortname)
-		return &operatorInfo, nil
+		return &operatorInfo, false, nil
 	}
 
 	startFlightAwareOperator := time.Now()
 	operatorJSON, err := s.flightawareClient.GetOperator(icao)
 	if err != nil {
 		log.Printf("Error getting operator %s from FlightAware: %v. Took %s\n", icao, err, time.Since(startFlightAwareOperator))
-		return nil, err
+		return nil, false, err
 	}
 	log.Printf("FlightAware GetOperator for %s took %s\n", icao, time.Since(startFlightAwareOperator))
 
 	if operatorJSON == "" {
-		return nil, nil
+		return nil, false, nil
 	}
 
 	startDbLog := time.Now()
@@ -143,37 +457,208 @@ func (s *Service) getOperatorInfo(icao string) (*model.OperatorInfo, error) {
 	}
 	var operatorInfo model.OperatorInfo
 	if err := json.Unmarshal([]byte(operatorJSON), &operatorInfo); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	caser := cases.Title(language.English)
 	operatorInfo.Shortname = caser.String(operatorInfo.Shortname)
-	return &operatorInfo, nil
+	return &operatorInfo, true, nil
 }
 
-// LogFlights logs a slice of flights to the database.
+// LogFlights logs a slice of flights to the database and records their sightings.
 func (s *Service) LogFlights(flights []model.FlightInfo) {
 	for _, flight := range flights { // Changed back to use flight
 		err := s.db.LogFlight(flight.Ident, &flight)
 		if err != nil {
 			log.Printf("Error logging flight %s: %v", flight.Ident, err)
 		}
+		// Seen once logged, so that the sighting is not older than the leg it is exported with
+		now := time.Now()
+
+		site := s.Site(flight.Site)
+		if site == nil {
+			site = s.sites[0]
+		}
+		obs := model.Observation{
+			Site:     site.Name,
+			Icao24:   flight.Icao24,
+			Callsign: flight.Ident,
+			Time:     now,
+			Distance: flight.Distance,
+			Altitude: flight.BaroAltitude,
+			Bearing:  haversine.Bearing(site.Latitude, site.Longitude, flight.Latitude, flight.Longitude),
+		}
+		if estimate, ok := noise.Peak(site.Latitude, site.Longitude, site.Altitude, &flight); ok {
+			obs.NoiseLevel, obs.NoiseExposure = estimate.Level, estimate.Exposure
+		}
+		sighting, err := s.db.RecordSighting(obs, s.sightingGap())
+		if err != nil {
+			log.Printf("Error recording sighting for flight %s: %v", flight.Ident, err)
+			continue
+		}
+		if sighting.SampleCount == 1 {
+			s.recordFirstSeen(&flight, sighting)
+		}
+		s.trackPass(&flight, sighting)
 	}
 }
 
-// RunWatchMode continuously fetches and logs flights at a specified interval.
-func (s *Service) RunWatchMode(interval int) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	defer ticker.Stop()
+// recordFirstSeen counts a new pass towards the frequency of the attributes of its flight, logging the first-ever ones.
+func (s *Service) recordFirstSeen(flight *model.FlightInfo, sighting *model.Sighting) {
+	country := ""
+	if flight.OperatorIcao != "" {
+		operator, err := s.db.GetOperatorInfo(flight.OperatorIcao)
+		if err != nil {
+			log.Printf("Error getting operator %s: %v", flight.OperatorIcao, err)
+		} else {
+			country = operator.Country
+		}
+	}
+	attrs := model.Attributes(flight, country)
+	firsts, err := s.db.RecordFirstSeen(attrs, sighting.Callsign, sighting.Site, sighting.FirstSeen)
+	if err != nil {
+		log.Printf("Error recording first sightings of flight %s: %v", flight.Ident, err)
+		return
+	}
+	for _, kind := range firsts {
+		log.Printf("First-ever %s %s, seen with %s over %s", strings.ReplaceAll(kind, "_", " "), attrs[kind], flight.Ident, sighting.Site)
+	}
+}
 
-	for range ticker.C {
-		log.Println("Watching for flights...")
+// sightingGap returns how long an aircraft may go unseen before its sighting is closed.
+func (s *Service) sightingGap() time.Duration {
+	if s.cfg.SightingGap <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(s.cfg.SightingGap) * time.Second
+}
 
-		flights, err := s.GetFlightsInRadius(s.cfg.Service.Latitude, s.cfg.Service.Longitude, s.cfg.Service.Radius)
-		if err != nil {
-			log.Printf("Error getting flights: %v", err)
+// PauseWatch pauses watch mode after its current cycle, until ResumeWatch is called.
+func (s *Service) PauseWatch() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	s.paused = true
+}
+
+// ResumeWatch resumes a paused watch mode, polling all sites right away.
+func (s *Service) ResumeWatch() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if !s.paused {
+		return
+	}
+	s.paused = false
+	select {
+	case s.resumed <- struct{}{}:
+	default:
+	}
+}
+
+// WatchPaused reports whether watch mode is paused.
+func (s *Service) WatchPaused() bool {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	return s.paused
+}
+
+// RunWatchMode continuously fetches and logs flights until ctx is canceled.
+// Each site is polled by its own scheduler, starting from the site interval, the top level one
+// when the site has none. The sites due at the same time share a single merged OpenSky request.
+// A cycle in progress when ctx is canceled completes, so that its writes are not lost.
+func (s *Service) RunWatchMode(ctx context.Context) {
+	nextRun := make(map[string]time.Time)
+	for _, site := range s.sites {
+		nextRun[site.Name] = time.Now()
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			log.Println("Watch mode stopped")
+			return
+		case now = <-timer.C:
+		case <-s.resumed:
+			now = time.Now()
+			for name := range nextRun {
+				nextRun[name] = now
+			}
+		}
+		if s.WatchPaused() {
+			// Wait for a resume or the shutdown without polling
 			continue
 		}
 
-		s.LogFlights(flights)
+		// Sites due within a second are fetched together to share the request.
+		var due []*Site
+		for _, site := range s.sites {
+			if !nextRun[site.Name].After(now.Add(time.Second)) {
+				due = append(due, site)
+			}
+		}
+		if len(due) > 0 {
+			log.Printf("Watching for flights at %d site(s)...", len(due))
+
+			states, err := s.watchCycle(due)
+			if err != nil {
+				log.Printf("Error getting flights: %v", err)
+			}
+			for _, site := range due {
+				delay := site.schedule.Next(now, states, err)
+				nextRun[site.Name] = now.Add(delay)
+				log.Printf("Next poll of site %s in %s", site.Name, delay)
+			}
+		}
+
+		next := now.Add(time.Hour)
+		for _, run := range nextRun {
+			if run.Before(next) {
+				next = run
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// watchCycle fetches, enriches and logs the flights over the sites, stores their positions, closes the passes of the aircraft
+// no longer seen and predicts the transits across the sun and the moon and the aircraft about to fly over
+// the sites. It returns the states fetched from OpenSky.
+func (s *Service) watchCycle(sites []*Site) ([]model.Flight, error) {
+	start := time.Now()
+	states, err := s.getStates(sites, s.lookaheadMargin())
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.Positions.Enabled {
+		if err := s.db.RecordPositions(s.trackedStates(states, sites), start); err != nil {
+			log.Printf("Error recording the positions: %v", err)
+		}
+	}
+	s.LogFlights(s.enrich(states, sites))
+	s.closePasses(sites, states, start)
+	s.predictTransits(states, sites, start)
+	s.predictOverflights(states, sites, start)
+	return states, nil
+}
+
+// trackedStates returns the states whose positions are stored: the aircraft inside the area of a site, or of an open
+// pass still, not the rest of the box widened for the predictions.
+func (s *Service) trackedStates(states []model.Flight, sites []*Site) []model.Flight {
+	s.passMu.Lock()
+	open := make(map[string]bool, len(s.passes))
+	for key := range s.passes {
+		open[key.icao24] = true
+	}
+	s.passMu.Unlock()
+
+	var tracked []model.Flight
+	for _, state := range states {
+		if open[state.Icao24] || slices.ContainsFunc(sites, func(site *Site) bool {
+			return site.Area.Contains(state.Latitude, state.Longitude)
+		}) {
+			tracked = append(tracked, state)
+		}
 	}
+	return tracked
 }
@@ -2,31 +2,23 @@ package service
 
 import (
 	"errors"
-	"fmt"
-	"os"
 	"testing"
+	"time"
 
 	"github.com/carlo-colombo/sopra/config"
-	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/memory"
 	"github.com/carlo-colombo/sopra/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // newTestDB creates a new in-memory database for testing.
-func newTestDB(t *testing.T) *database.DB {
+func newTestDB(t *testing.T) *memory.Store {
 	t.Helper()
-	dbName := fmt.Sprintf("%s.db", t.Name())
-	os.Remove(dbName) // Clean up before test
-	db, err := database.NewDB(dbName)
-	if err != nil {
-		t.Fatalf("failed to create test db: %v", err)
-	}
-	t.Cleanup(func() {
-		db.Close()
-		os.Remove(dbName)
-	})
-	return db
+	return memory.New()
 }
 
 // MockOpenSkyClient is a mock implementation of the OpenSkyAPIClient interface.
@@ -34,8 +26,8 @@ type MockOpenSkyClient struct {
 	mock.Mock
 }
 
-func (m *MockOpenSkyClient) GetStatesInRadius(lat, lon, radiusKm float64) ([]model.Flight, error) {
-	args := m.Called(lat, lon, radiusKm)
+func (m *MockOpenSkyClient) GetStatesInArea(area geofence.Area) ([]model.Flight, error) {
+	args := m.Called(area)
 	return args.Get(0).([]model.Flight), args.Error(1)
 }
 
@@ -58,6 +50,14 @@ func (m *MockFlightAwareClient) GetOperator(icao string) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockFlightAwareClient) GetAirport(code string) (*model.AirportInfo, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AirportInfo), args.Error(1)
+}
+
 // MockTravelImpactModelClient is a mock implementation of the TravelImpactModelAPIClient interface.
 type MockTravelImpactModelClient struct {
 	mock.Mock
@@ -78,10 +78,16 @@ func TestGetFlightsInRadius(t *testing.T) {
 	// Mock OpenSky client to return a list of flights
 	openskyFlights := []model.Flight{
 		{
-			Icao24:    "a1b2c3",
-			Callsign:  "UAL123",
-			Latitude:  40.0,
-			Longitude: -74.0,
+			Icao24:       "a1b2c3",
+			Callsign:     "UAL123",
+			Latitude:     40.0,
+			Longitude:    -74.0,
+			BaroAltitude: 10000,
+			GeoAltitude:  10200,
+			Velocity:     240,
+			TrueTrack:    90,
+			VerticalRate: 0.5,
+			Squawk:       "2000",
 		},
 		{
 			Icao24:    "d4e5f6",
@@ -90,7 +96,7 @@ func TestGetFlightsInRadius(t *testing.T) {
 			Longitude: -75.0,
 		},
 	}
-	mockOpenSkyClient.On("GetStatesInRadius", mock.Anything, mock.Anything, mock.Anything).Return(openskyFlights, nil)
+	mockOpenSkyClient.On("GetStatesInArea", mock.Anything).Return(openskyFlights, nil)
 
 	// Mock FlightAware client to return flight info for UAL123
 	flightAwareInfo := &model.FlightInfo{
@@ -103,6 +109,10 @@ func TestGetFlightsInRadius(t *testing.T) {
 		RouteDistance: 1000, // Example distance in NM
 	}
 	mockFlightAwareClient.On("GetFlightInfo", "UAL123").Return(flightAwareInfo, nil)
+	// Logged as the client does, with airports not located yet, one unknown to FlightAware
+	require.NoError(t, db.LogFlight("UAL123", flightAwareInfo))
+	mockFlightAwareClient.On("GetAirport", "KORD").Return(&model.AirportInfo{Code: "KORD", Latitude: 41.978611, Longitude: -87.904722}, nil).Once()
+	mockFlightAwareClient.On("GetAirport", "KLAX").Return(nil, nil).Once()
 
 	// Mock Climatiq client to return a CO2 emission
 	mockTravelImpactModelClient.On("GetFlightEmission", flightAwareInfo).Return(18520.0, nil)
@@ -111,8 +121,9 @@ func TestGetFlightsInRadius(t *testing.T) {
 	operatorInfoJSON := `{"name": "United Airlines", "shortname": "united"}`
 	mockFlightAwareClient.On("GetOperator", "UAL").Return(operatorInfoJSON, nil)
 
-	cfg := &config.Config{}                                                                               // Dummy config
-	service := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg) // Pass db
+	cfg := &config.Config{}                                                                                    // Dummy config
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg) // Pass db
+	require.NoError(t, err)
 
 	// Act
 	flights, err := service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
@@ -128,6 +139,17 @@ func TestGetFlightsInRadius(t *testing.T) {
 	assert.Equal(t, flightAwareInfo.Origin.Code, flights[0].Origin.Code)
 	assert.Equal(t, flightAwareInfo.Destination.Code, flights[0].Destination.Code)
 	assert.NotZero(t, flights[0].Distance)
+	// About 79 km south at 10200 m, a little lower than the plain angle because of the curvature of the earth
+	assert.InDelta(t, 180, flights[0].Azimuth, 1)
+	assert.InDelta(t, 7.0, flights[0].Elevation, 0.1)
+	assert.Greater(t, flights[0].SlantRange, flights[0].Distance)
+	assert.Equal(t, "a1b2c3", flights[0].Icao24)
+	assert.Equal(t, 10000.0, flights[0].BaroAltitude)
+	assert.Equal(t, 10200.0, flights[0].GeoAltitude)
+	assert.Equal(t, 240.0, flights[0].Velocity)
+	assert.Equal(t, 90.0, flights[0].TrueTrack)
+	assert.Equal(t, 0.5, flights[0].VerticalRate)
+	assert.Equal(t, "2000", flights[0].Squawk)
 	assert.Equal(t, 18520.0, flights[0].CO2KG) // Assert CO2KG is set by Climatiq mock
 
 	// Check that the operator info was cached
@@ -135,6 +157,13 @@ func TestGetFlightsInRadius(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, operatorInfoJSON, cachedOperator)
 
+	located, err := db.AirportLocated("KORD")
+	require.NoError(t, err)
+	assert.True(t, located)
+	located, err = db.AirportLocated("KLAX")
+	require.NoError(t, err)
+	assert.False(t, located)
+
 	mockOpenSkyClient.AssertExpectations(t)
 	mockFlightAwareClient.AssertExpectations(t)
 }
@@ -145,10 +174,11 @@ func TestGetFlightsInRadius_OpenSkyError(t *testing.T) {
 	mockTravelImpactModelClient := new(MockTravelImpactModelClient) // Initialize mock Travel Impact Model client
 	db := newTestDB(t)
 
-	mockOpenSkyClient.On("GetStatesInRadius", mock.Anything, mock.Anything, mock.Anything).Return([]model.Flight{}, errors.New("opensky error"))
+	mockOpenSkyClient.On("GetStatesInArea", mock.Anything).Return([]model.Flight{}, errors.New("opensky error"))
 
 	cfg := &config.Config{} // Dummy config
-	service := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
 
 	flights, err := service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
 
@@ -172,11 +202,12 @@ func TestGetFlightsInRadius_FlightAwareError(t *testing.T) {
 			Longitude: -74.0,
 		},
 	}
-	mockOpenSkyClient.On("GetStatesInRadius", mock.Anything, mock.Anything, mock.Anything).Return(openskyFlights, nil)
+	mockOpenSkyClient.On("GetStatesInArea", mock.Anything).Return(openskyFlights, nil)
 	mockFlightAwareClient.On("GetFlightInfo", "UAL123").Return(nil, errors.New("flightaware error"))
 
 	cfg := &config.Config{} // Dummy config
-	service := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
 
 	flights, err := service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
 
@@ -201,10 +232,11 @@ func TestGetFlightsInRadius_NoCallsign(t *testing.T) {
 			Longitude: -74.0,
 		},
 	}
-	mockOpenSkyClient.On("GetStatesInRadius", mock.Anything, mock.Anything, mock.Anything).Return(openskyFlights, nil)
+	mockOpenSkyClient.On("GetStatesInArea", mock.Anything).Return(openskyFlights, nil)
 
 	cfg := &config.Config{} // Dummy config
-	service := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
 
 	flights, err := service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
 
@@ -215,20 +247,64 @@ func TestGetFlightsInRadius_NoCallsign(t *testing.T) {
 	mockFlightAwareClient.AssertNotCalled(t, "GetFlightInfo", mock.Anything)
 }
 
+func TestGetFlightsInRadius_SquawkAlerts(t *testing.T) {
+	mockOpenSkyClient := new(MockOpenSkyClient)
+	mockFlightAwareClient := new(MockFlightAwareClient)
+	mockTravelImpactModelClient := new(MockTravelImpactModelClient)
+	db := newTestDB(t)
+
+	openskyFlights := []model.Flight{
+		{Icao24: "a1b2c3", Squawk: "7700", Latitude: 40.0, Longitude: -74.0, OnGround: true}, // no callsign, filtered out
+		{Icao24: "d4e5f6", Squawk: "4410", Latitude: 40.0, Longitude: -74.0},
+		{Icao24: "0a0b0c", Squawk: "7600", Latitude: 10.0, Longitude: 10.0}, // outside the area
+	}
+	mockOpenSkyClient.On("GetStatesInArea", mock.Anything).Return(openskyFlights, nil)
+
+	cfg := &config.Config{SquawkRanges: []config.SquawkRangeConfig{{Name: "military", From: "4400", To: "4477"}}}
+	cfg.Filters.ExcludeOnGround = true
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
+	sub := service.Events().Subscribe(10, events.SquawkAlert)
+
+	_, err = service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
+	assert.NoError(t, err)
+	_, err = service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
+	assert.NoError(t, err)
+
+	alerts, err := db.GetSquawkAlertsSince(time.Now().Add(-time.Minute), "")
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 2)
+
+	// Events are published once per alert
+	var kinds []string
+	for len(sub.C) > 0 {
+		e := <-sub.C
+		kinds = append(kinds, e.Alert.Kind)
+		assert.Equal(t, e.Alert.Icao24, e.Flight.Icao24)
+	}
+	assert.ElementsMatch(t, []string{"emergency", "military"}, kinds)
+	mockFlightAwareClient.AssertNotCalled(t, "GetFlightInfo", mock.Anything)
+}
+
 func TestLogFlights(t *testing.T) {
 	// Arrange
 	mockOpenSkyClient := new(MockOpenSkyClient)
 	mockFlightAwareClient := new(MockFlightAwareClient)
 	mockTravelImpactModelClient := new(MockTravelImpactModelClient) // Initialize mock Travel Impact Model client
 	db := newTestDB(t)
+	if err := db.ClearFlightLog(); err != nil {
+		t.Fatalf("failed to clear flight log: %v", err)
+	}
 	cfg := &config.Config{} // Dummy config
-	service := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
 
 	flightsToLog := []model.FlightInfo{
 		{
-			Ident:    "UAL123",
-			Operator: "United Airlines",
-			Status:   "En Route",
+			Ident:        "UAL123",
+			Operator:     "United Airlines",
+			Status:       "En Route",
+			AircraftType: "B789",
 		},
 		{
 			Ident:    "DAL456",
@@ -249,4 +325,127 @@ func TestLogFlights(t *testing.T) {
 		assert.Equal(t, expectedFlight.Operator, loggedFlight.Operator)
 		assert.Equal(t, expectedFlight.Status, loggedFlight.Status)
 	}
+
+	// Logging the same flights again within the gap extends the existing sightings
+	service.LogFlights(flightsToLog)
+	sightings, err := db.GetRecentSightings(10, "")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 2)
+	for _, sighting := range sightings {
+		assert.Equal(t, 2, sighting.SampleCount)
+		assert.Greater(t, sighting.PeakNoise, 0.0)
+	}
+
+	// Attributes are counted once per pass
+	seen, err := db.GetFirstSeen()
+	assert.NoError(t, err)
+	assert.Len(t, seen, 1)
+	assert.Equal(t, "B789", seen[0].Value)
+	assert.Equal(t, "UAL123", seen[0].Callsign)
+	assert.Equal(t, 1, seen[0].Count)
+}
+
+func TestGetFlightsInRadius_Filters(t *testing.T) {
+	mockOpenSkyClient := new(MockOpenSkyClient)
+	mockFlightAwareClient := new(MockFlightAwareClient)
+	mockTravelImpactModelClient := new(MockTravelImpactModelClient)
+	db := newTestDB(t)
+
+	openskyFlights := []model.Flight{
+		{Icao24: "a1b2c3", Callsign: "UAL123", Latitude: 40.0, Longitude: -74.0, OnGround: true},
+		{Icao24: "d4e5f6", Callsign: "DAL456", Latitude: 40.0, Longitude: -74.0, BaroAltitude: 3000},
+	}
+	mockOpenSkyClient.On("GetStatesInArea", mock.Anything).Return(openskyFlights, nil)
+	mockFlightAwareClient.On("GetFlightInfo", "DAL456").Return(&model.FlightInfo{Ident: "DAL456", AircraftType: "C172"}, nil)
+
+	cfg := &config.Config{}
+	cfg.Filters.ExcludeOnGround = true
+	cfg.Filters.ExcludeAircraftTypes = []string{"C172"}
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
+
+	flights, err := service.GetFlightsInRadius(40.7128, -74.0060, 100.0)
+
+	assert.NoError(t, err)
+	assert.Empty(t, flights)
+	mockFlightAwareClient.AssertNotCalled(t, "GetFlightInfo", "UAL123")
+	mockTravelImpactModelClient.AssertNotCalled(t, "GetFlightEmission", mock.Anything)
+
+	stats, err := db.GetFilterStats(time.Now(), "")
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	for _, stat := range stats {
+		assert.Equal(t, 1, stat.Today)
+	}
+}
+
+func TestGetFlights_Sites(t *testing.T) {
+	mockOpenSkyClient := new(MockOpenSkyClient)
+	mockFlightAwareClient := new(MockFlightAwareClient)
+	mockTravelImpactModelClient := new(MockTravelImpactModelClient)
+	db := newTestDB(t)
+	if err := db.ClearFlightLog(); err != nil {
+		t.Fatalf("failed to clear flight log: %v", err)
+	}
+
+	openskyFlights := []model.Flight{
+		{Icao24: "a1b2c3", Callsign: "UAL123", Latitude: 40.05, Longitude: -74.0, BaroAltitude: 3000}, // inside both sites
+		{Icao24: "d4e5f6", Callsign: "DAL456", Latitude: 40.3, Longitude: -74.0, OnGround: true},      // only inside north
+	}
+	mockOpenSkyClient.On("GetStatesInArea", mock.AnythingOfType("geofence.Envelope")).Return(openskyFlights, nil).Once()
+	mockFlightAwareClient.On("GetFlightInfo", "UAL123").Return(&model.FlightInfo{Ident: "UAL123"}, nil).Once()
+	mockTravelImpactModelClient.On("GetFlightEmission", mock.Anything).Return(0.0, nil)
+
+	cfg := &config.Config{Sites: []config.SiteConfig{
+		{Name: "north", ServiceConfig: config.ServiceConfig{Latitude: 40.2, Longitude: -74.0, Radius: 20}},
+		{Name: "south", ServiceConfig: config.ServiceConfig{Latitude: 40.0, Longitude: -74.0, Radius: 20}},
+	}}
+	cfg.Filters.ExcludeOnGround = true
+	service, err := NewService(mockOpenSkyClient, mockFlightAwareClient, mockTravelImpactModelClient, db, cfg)
+	require.NoError(t, err)
+
+	flights, err := service.GetFlights("")
+
+	assert.NoError(t, err)
+	assert.Len(t, flights, 2)
+	assert.Equal(t, "north", flights[0].Site)
+	assert.Equal(t, "south", flights[1].Site)
+	assert.Greater(t, flights[0].Distance, flights[1].Distance)
+	mockOpenSkyClient.AssertExpectations(t)
+	mockFlightAwareClient.AssertExpectations(t)
+
+	service.LogFlights(flights)
+	sightings, err := db.GetRecentSightings(10, "south")
+	assert.NoError(t, err)
+	assert.Len(t, sightings, 1)
+
+	stats, err := db.GetFilterStats(time.Now(), "north")
+	assert.NoError(t, err)
+	assert.Equal(t, []model.FilterStat{{Name: "on_ground", Today: 1, Total: 1}}, stats)
+
+	_, err = service.GetFlights("west")
+	assert.Error(t, err)
+}
+
+func TestNewService_InvalidConfig(t *testing.T) {
+	site := config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 10}
+	for name, tc := range map[string]struct {
+		cfg  config.Config
+		want string
+	}{
+		"filters":   {config.Config{Service: site, Filters: config.FilterConfig{IncludeCallsigns: []string{"SWR["}}}, "traffic filters"},
+		"squawks":   {config.Config{Service: site, SquawkRanges: []config.SquawkRangeConfig{{Name: "military", From: "4477", To: "4400"}}}, "squawk ranges"},
+		"transits":  {config.Config{Service: site, Transits: config.TransitConfig{Enabled: true}}, "transit predictions"},
+		"lookahead": {config.Config{Service: site, Lookahead: config.LookaheadConfig{Enabled: true, Horizon: 600, Margin: 1000}}, "look-ahead predictions"},
+		"site filters": {config.Config{Sites: []config.SiteConfig{{Name: "office", ServiceConfig: site, Filters: config.FilterConfig{ExcludeCallsigns: []string{"("}}}}},
+			"traffic filters of site office"},
+		"geofence": {config.Config{Service: config.ServiceConfig{Geofence: `{"type": "Point", "coordinates": [8, 47]}`}}, "geofence of site default"},
+		"schedule": {config.Config{Service: site, Interval: 60, Schedule: config.ScheduleConfig{QuietHours: []string{"every night"}}}, "schedule of site default"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service, err := NewService(nil, nil, nil, nil, &tc.cfg)
+			assert.ErrorContains(t, err, tc.want)
+			assert.Nil(t, service)
+		})
+	}
 }
@@ -1,6 +1,7 @@
 package service_test
 
 import (
+	"context"
 	"log"
 	"os"
 	"sync" // Added sync import
@@ -9,21 +10,23 @@ import (
 
 	"github.com/carlo-colombo/sopra/config"
 	"github.com/carlo-colombo/sopra/database"
+	"github.com/carlo-colombo/sopra/geofence"
 	"github.com/carlo-colombo/sopra/model"
 	"github.com/carlo-colombo/sopra/service" // Import the service package
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockOpenSkyClient is a mock implementation of OpenSkyAPIClient for testing.
 type MockOpenSkyClient struct {
 	mu              sync.Mutex
 	GetStatesCalls  int
-	FlightsToReturn []model.Flight // Flights to return on GetStatesInRadius call
-	ErrToReturn     error          // Error to return on GetStatesInRadius call
+	FlightsToReturn []model.Flight // Flights to return on GetStatesInArea call
+	ErrToReturn     error          // Error to return on GetStatesInArea call
 }
 
-// GetStatesInRadius increments the call counter and returns predefined flights or an error.
-func (m *MockOpenSkyClient) GetStatesInRadius(lat, lon, radiusKm float64) ([]model.Flight, error) {
+// GetStatesInArea increments the call counter and returns predefined flights or an error.
+func (m *MockOpenSkyClient) GetStatesInArea(area geofence.Area) ([]model.Flight, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.GetStatesCalls++
@@ -50,6 +53,10 @@ func (m *MockFlightAwareClient) GetOperator(icao string) (string, error) {
 	return "", nil
 }
 
+func (m *MockFlightAwareClient) GetAirport(code string) (*model.AirportInfo, error) {
+	return nil, nil
+}
+
 // MockTravelImpactModelClient is a mock implementation of the TravelImpactModelAPIClient interface.
 type MockTravelImpactModelClient struct {
 	mock.Mock
@@ -99,11 +106,7 @@ func TestService_RunWatchMode(t *testing.T) {
 
 	// 4. Configure a test config
 	testCfg := &config.Config{
-		Service: struct {
-			Latitude  float64 `mapstructure:"latitude"`
-			Longitude float64 `mapstructure:"longitude"`
-			Radius    float64 `mapstructure:"radius"`
-		}{
+		Service: config.ServiceConfig{
 			Latitude:  34.052235,
 			Longitude: -118.243683,
 			Radius:    100,
@@ -125,25 +128,78 @@ func TestService_RunWatchMode(t *testing.T) {
 	}
 
 	// 5. Initialize the service with mocks and test config
-	appService := service.NewService(mockOpenSky, mockFlightAware, mockTravelImpactModel, db, testCfg)
+	appService, err := service.NewService(mockOpenSky, mockFlightAware, mockTravelImpactModel, db, testCfg)
+	require.NoError(t, err)
 
 	// 6. Run RunWatchMode in a goroutine
+	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		appService.RunWatchMode(testCfg.Interval)
+		appService.RunWatchMode(ctx)
 		close(done)
 	}()
 
-	// 7. Wait for a few intervals
+	// 7. Wait for a few intervals, then stop the watcher
 	time.Sleep(2500 * time.Millisecond) // Wait for 2-3 ticks (interval is 1 second)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunWatchMode did not stop after the context was canceled")
+	}
 
-	// To stop the RunWatchMode gracefully in test environment we need to close done channel or implement a stop chan
-	// For now, we will simply not wait for `done` and let the test finish.
-	// In a real application, a context.Context with cancellation would be used to stop the watcher.
-
-	// 8. Assert that GetStatesInRadius was called multiple times
+	// 8. Assert that GetStatesInArea was called multiple times
 	expectedCalls := 2 // At least 2 calls for 2.5 seconds with 1 second interval
 	if mockOpenSky.GetStatesCalls < expectedCalls {
-		t.Errorf("Expected at least %d calls to GetStatesInRadius, but got %d", expectedCalls, mockOpenSky.GetStatesCalls)
+		t.Errorf("Expected at least %d calls to GetStatesInArea, but got %d", expectedCalls, mockOpenSky.GetStatesCalls)
+	}
+}
+
+func TestService_PauseWatch(t *testing.T) {
+	mockOpenSky := &MockOpenSkyClient{}
+	mockTravelImpactModel := new(MockTravelImpactModelClient)
+
+	tempDBPath := "test_pause_sopra.db"
+	db, err := database.NewDB(tempDBPath)
+	if err != nil {
+		t.Fatalf("Failed to create temporary database: %v", err)
+	}
+	defer func() {
+		db.Close()
+		os.Remove(tempDBPath)
+	}()
+
+	testCfg := &config.Config{
+		Service:  config.ServiceConfig{Latitude: 34.052235, Longitude: -118.243683, Radius: 100},
+		Interval: 60,
+	}
+	appService, err := service.NewService(mockOpenSky, &MockFlightAwareClient{}, mockTravelImpactModel, db, testCfg)
+	require.NoError(t, err)
+
+	// Paused before starting: no poll happens
+	appService.PauseWatch()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go appService.RunWatchMode(ctx)
+
+	time.Sleep(200 * time.Millisecond)
+	mockOpenSky.mu.Lock()
+	calls := mockOpenSky.GetStatesCalls
+	mockOpenSky.mu.Unlock()
+	if calls != 0 {
+		t.Errorf("Expected no calls while paused, but got %d", calls)
+	}
+
+	// Resuming polls right away instead of waiting for the interval
+	appService.ResumeWatch()
+	if appService.WatchPaused() {
+		t.Error("Expected the watcher to be resumed")
+	}
+	time.Sleep(200 * time.Millisecond)
+	mockOpenSky.mu.Lock()
+	calls = mockOpenSky.GetStatesCalls
+	mockOpenSky.mu.Unlock()
+	if calls != 1 {
+		t.Errorf("Expected 1 call after resuming, but got %d", calls)
 	}
 }
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/transit"
+)
+
+// transitHistory is how long past transits are kept.
+const transitHistory = time.Hour
+
+// transitKey identifies the predicted transit of an aircraft across a body, seen from a site.
+type transitKey struct {
+	site, icao24, body string
+}
+
+// Transits returns the transits predicted over a site, or over all sites when site is empty,
+// of the last hour and upcoming, soonest first.
+func (s *Service) Transits(site string) []model.Transit {
+	s.transitMu.Lock()
+	defer s.transitMu.Unlock()
+
+	var transits []model.Transit
+	for key, t := range s.predicted {
+		if site == "" || key.site == site {
+			transits = append(transits, *t)
+		}
+	}
+	slices.SortFunc(transits, func(a, b model.Transit) int { return a.Time.Compare(b.Time) })
+	return transits
+}
+
+// predictTransits predicts the transits across the sun and the moon of the aircraft inside the sites,
+// publishing TransitPredicted for the new ones. Upcoming transits no longer predicted, because the aircraft
+// turned or left, are dropped.
+func (s *Service) predictTransits(states []model.Flight, sites []*Site, at time.Time) {
+	if s.transits == nil {
+		return
+	}
+	s.transitMu.Lock()
+	defer s.transitMu.Unlock()
+
+	for _, site := range sites {
+		inside := make(map[string]*model.Flight)
+		var siteStates []model.Flight
+		for i := range states {
+			if site.Area.Contains(states[i].Latitude, states[i].Longitude) {
+				inside[states[i].Icao24] = &states[i]
+				siteStates = append(siteStates, states[i])
+			}
+		}
+
+		observer := transit.Observer{Site: site.Name, Latitude: site.Latitude, Longitude: site.Longitude, Altitude: site.Altitude}
+		predicted := make(map[transitKey]bool)
+		for _, t := range s.transits.Predict(observer, siteStates, at) {
+			key := transitKey{site.Name, t.Icao24, t.Body}
+			predicted[key] = true
+			previous, announced := s.predicted[key]
+			s.predicted[key] = &t
+			if announced && !previous.Time.Before(at) {
+				continue // an update of an upcoming transit
+			}
+			log.Printf("Transit of %s (ICAO24 %s) across the %s at %s, %.1f' from the center, seen from site %s: %s",
+				t.Callsign, t.Icao24, t.Body, t.Time.Format(time.TimeOnly), t.Separation, site.Name, t.ShiftHint())
+			flight := &model.FlightInfo{Ident: t.Callsign, Site: site.Name}
+			flight.SetState(inside[t.Icao24])
+			s.bus.Publish(events.Event{Type: events.TransitPredicted, Time: at, Site: site.Name, Flight: flight, Transit: &t})
+		}
+
+		for key, t := range s.predicted {
+			if key.site == site.Name && !predicted[key] && t.Time.After(at) {
+				delete(s.predicted, key)
+			}
+		}
+	}
+
+	for key, t := range s.predicted {
+		if t.Time.Before(at.Add(-transitHistory)) {
+			delete(s.predicted, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/astro"
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredictTransits(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{
+		Service:  config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 20},
+		Transits: config.TransitConfig{Enabled: true, Horizon: 300, MaxSeparation: 30},
+	}
+	service, err := NewService(nil, nil, nil, db, cfg)
+	require.NoError(t, err)
+	sub := service.Events().Subscribe(10, events.TransitPredicted)
+
+	// An aircraft 10 km up in front of the sun at 10:00, flying east
+	at := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+	sun := astro.Sun(at, 47.0, 8.0, 0)
+	lat, lon := haversine.Destination(47.0, 8.0, sun.Azimuth, 10/math.Tan(sun.Elevation*math.Pi/180))
+	states := []model.Flight{{Icao24: "abc123", Callsign: "XYZ12", TimePosition: int(at.Add(-30 * time.Second).Unix()),
+		Latitude: lat, Longitude: lon, GeoAltitude: 10000, Velocity: 200, TrueTrack: 90}}
+	states[0].Longitude -= 200 * 30 / (111320 * math.Cos(lat*math.Pi/180)) // 30 seconds before
+
+	service.predictTransits(states, service.Sites(), at.Add(-30*time.Second))
+	transits := service.Transits(config.DefaultSite)
+	require.Len(t, transits, 1)
+	assert.Equal(t, model.BodySun, transits[0].Body)
+	assert.WithinDuration(t, at, transits[0].Time, time.Second)
+	assert.True(t, transits[0].Full())
+	require.Len(t, sub.C, 1)
+	e := <-sub.C
+	assert.Equal(t, config.DefaultSite, e.Site)
+	assert.Equal(t, "XYZ12", e.Flight.Ident)
+	assert.Equal(t, 10000.0, e.Flight.GeoAltitude)
+	assert.Equal(t, transits[0], *e.Transit)
+
+	// Updating an upcoming transit is not announced again
+	service.predictTransits(states, service.Sites(), at.Add(-20*time.Second))
+	assert.Len(t, service.Transits(""), 1)
+	assert.Empty(t, sub.C)
+
+	// The aircraft turned: the transit is no longer upcoming
+	service.predictTransits(nil, service.Sites(), at.Add(-10*time.Second))
+	assert.Empty(t, service.Transits(""))
+
+	// Past transits are kept for an hour
+	service.predictTransits(states, service.Sites(), at.Add(-20*time.Second))
+	assert.Len(t, sub.C, 1)
+	service.predictTransits(nil, service.Sites(), at.Add(time.Minute))
+	assert.Len(t, service.Transits(config.DefaultSite), 1)
+	assert.Empty(t, service.Transits("elsewhere"))
+	service.predictTransits(nil, service.Sites(), at.Add(2*time.Hour))
+	assert.Empty(t, service.Transits(""))
+}
+
+func TestPredictTransits_Disabled(t *testing.T) {
+	cfg := &config.Config{Service: config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 20}}
+	service, err := NewService(nil, nil, nil, newTestDB(t), cfg)
+	require.NoError(t, err)
+
+	at := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+	service.predictTransits([]model.Flight{{Icao24: "abc123", Latitude: 47.0, Longitude: 8.0, GeoAltitude: 10000, Velocity: 200}}, service.Sites(), at)
+	assert.Empty(t, service.Transits(""))
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"cmp"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/lookahead"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// missGrace is how long after its predicted entry a predicted aircraft that is no longer reported is waited for.
+const missGrace = time.Minute
+
+// upcomingKey identifies an aircraft followed by the look-ahead at a site.
+type upcomingKey struct {
+	site, icao24 string
+}
+
+// upcoming is an aircraft followed until its prediction turns out right or wrong: a predicted aircraft until
+// it enters the area or is no longer predicted to, an aircraft inside the area until it leaves.
+type upcoming struct {
+	prediction     model.Prediction
+	predicted      bool // false for an aircraft that entered the area without being predicted
+	entered        bool
+	actualEntry    time.Time
+	actualDistance float64
+}
+
+// Upcoming returns the aircraft predicted to fly over a site, or over all sites when site is empty, soonest first.
+func (s *Service) Upcoming(site string) []model.Prediction {
+	s.upcomingMu.Lock()
+	defer s.upcomingMu.Unlock()
+
+	var predictions []model.Prediction
+	for key, u := range s.upcoming {
+		if u.predicted && !u.entered && (site == "" || key.site == site) {
+			predictions = append(predictions, u.prediction)
+		}
+	}
+	slices.SortFunc(predictions, func(a, b model.Prediction) int {
+		return cmp.Or(a.EntryTime.Compare(b.EntryTime), cmp.Compare(a.Icao24, b.Icao24))
+	})
+	return predictions
+}
+
+// lookaheadMargin returns how far, in km, the boxes fetched in watch mode are widened to see the aircraft coming.
+func (s *Service) lookaheadMargin() float64 {
+	if s.lookahead == nil {
+		return 0
+	}
+	return s.cfg.Lookahead.Margin
+}
+
+// predictOverflights predicts the aircraft around the sites about to enter their areas, publishing
+// OverflightPredicted for the new ones, and records how the previous predictions turned out: the aircraft
+// entered, with the errors of the prediction, or was no longer predicted to enter. The aircraft entering
+// an area without being predicted are recorded too.
+func (s *Service) predictOverflights(states []model.Flight, sites []*Site, at time.Time) {
+	if s.lookahead == nil {
+		return
+	}
+	s.upcomingMu.Lock()
+	defer s.upcomingMu.Unlock()
+
+	for _, site := range sites {
+		present := make(map[string]*model.Flight)
+		inside := make(map[string]bool)
+		var outside []model.Flight
+		for i := range states {
+			state := &states[i]
+			present[state.Icao24] = state
+			if site.Area.Contains(state.Latitude, state.Longitude) {
+				inside[state.Icao24] = true
+			} else {
+				outside = append(outside, *state)
+			}
+		}
+
+		// The aircraft inside the area: predicted ones entering, unpredicted ones showing up
+		for icao24 := range inside {
+			state := present[icao24]
+			key := upcomingKey{site.Name, icao24}
+			distance := haversine.Distance(site.Latitude, site.Longitude, state.Latitude, state.Longitude) * 1000
+			u, followed := s.upcoming[key]
+			switch {
+			case followed && u.entered:
+				u.actualDistance = min(u.actualDistance, distance)
+			case followed:
+				u.entered, u.actualEntry, u.actualDistance = true, reportTime(state, at), distance
+			case s.inside[site.Name] != nil && !s.inside[site.Name][icao24]:
+				s.upcoming[key] = &upcoming{
+					prediction:     model.Prediction{Site: site.Name, Icao24: icao24, Callsign: state.Callsign},
+					entered:        true,
+					actualEntry:    reportTime(state, at),
+					actualDistance: distance,
+				}
+			}
+		}
+		s.inside[site.Name] = inside
+
+		target := lookahead.Site{Name: site.Name, Latitude: site.Latitude, Longitude: site.Longitude, Area: site.Area}
+		predicted := make(map[string]bool)
+		for _, p := range s.lookahead.Predict(target, outside, at) {
+			key := upcomingKey{site.Name, p.Icao24}
+			if u, followed := s.upcoming[key]; followed {
+				if u.entered {
+					continue // left the area and coming back, followed again once resolved
+				}
+				predicted[p.Icao24] = true
+				p.PredictedAt = u.prediction.PredictedAt
+				u.prediction = p
+				continue
+			}
+			predicted[p.Icao24] = true
+			s.upcoming[key] = &upcoming{prediction: p, predicted: true}
+			log.Printf("Flight %s (ICAO24 %s) predicted over site %s at %s, from %.0f°, closest at %.1f km",
+				p.Callsign, p.Icao24, site.Name, p.EntryTime.Format(time.TimeOnly), p.EntryBearing, p.ClosestDistance/1000)
+			flight := &model.FlightInfo{Ident: p.Callsign, Site: site.Name}
+			flight.SetState(present[p.Icao24])
+			s.bus.Publish(events.Event{Type: events.OverflightPredicted, Time: at, Site: site.Name, Flight: flight, Prediction: &p})
+		}
+
+		for key, u := range s.upcoming {
+			if key.site != site.Name {
+				continue
+			}
+			outcome := model.PredictionOutcome{Prediction: u.prediction, ActualEntry: u.actualEntry, ActualDistance: u.actualDistance, ResolvedAt: at}
+			switch {
+			case u.entered && !inside[key.icao24]:
+				outcome.Outcome = model.PredictionEntered
+				if !u.predicted {
+					outcome.Outcome = model.PredictionUnpredicted
+				}
+			case !u.entered && !predicted[key.icao24] && (present[key.icao24] != nil || at.After(u.prediction.EntryTime.Add(missGrace))):
+				outcome.Outcome = model.PredictionMissed
+			default:
+				continue
+			}
+			delete(s.upcoming, key)
+			if err := s.db.RecordPredictionOutcome(&outcome); err != nil {
+				log.Printf("Error recording the %s prediction of ICAO24 %s over site %s: %v", outcome.Outcome, key.icao24, site.Name, err)
+			}
+		}
+	}
+}
+
+// reportTime returns when the position of an aircraft was reported, or at when unknown.
+func reportTime(state *model.Flight, at time.Time) time.Time {
+	if state.TimePosition > 0 {
+		return time.Unix(int64(state.TimePosition), 0)
+	}
+	return at
+}
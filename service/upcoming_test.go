@@ -0,0 +1,146 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/geofence"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredictOverflights(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{
+		Service:   config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 10},
+		Lookahead: config.LookaheadConfig{Enabled: true, Margin: 50, Horizon: 600},
+	}
+	service, err := NewService(nil, nil, nil, db, cfg)
+	require.NoError(t, err)
+	sub := service.Events().Subscribe(10, events.OverflightPredicted)
+	assert.Equal(t, 50.0, service.lookaheadMargin())
+
+	start := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+	// An aircraft bearing km from the site flying along track at 100 m/s, reported at
+	state := func(icao24 string, bearing, km, track float64, at time.Time) model.Flight {
+		lat, lon := haversine.Destination(47.0, 8.0, bearing, km)
+		return model.Flight{Icao24: icao24, Callsign: "C" + icao24, TimePosition: int(at.Unix()), Latitude: lat, Longitude: lon, Velocity: 100, TrueTrack: track}
+	}
+
+	// Inbound from the west and from the north, outbound to the south, one already overhead
+	service.predictOverflights([]model.Flight{
+		state("west01", 270, 20, 90, start),
+		state("north1", 0, 20, 180, start),
+		state("south1", 180, 20, 180, start),
+		state("over01", 0, 1, 90, start),
+	}, service.Sites(), start)
+	upcoming := service.Upcoming("")
+	require.Len(t, upcoming, 2)
+	// Entering at the same time, ordered by icao24
+	assert.Equal(t, "north1", upcoming[0].Icao24)
+	assert.Equal(t, "west01", upcoming[1].Icao24)
+	assert.WithinDuration(t, start.Add(100*time.Second), upcoming[1].EntryTime, time.Second)
+	require.Len(t, sub.C, 2)
+	<-sub.C
+	e := <-sub.C
+	assert.Equal(t, config.DefaultSite, e.Site)
+	assert.Equal(t, "Cwest01", e.Flight.Ident)
+	assert.Equal(t, upcoming[1], *e.Prediction)
+
+	// A minute later: updated without a new event, the northern one turned away, a new one popped up overhead
+	minute := start.Add(time.Minute)
+	service.predictOverflights([]model.Flight{
+		state("west01", 270, 14, 90, minute),
+		state("north1", 0, 14, 0, minute),
+		state("over01", 0, 2, 90, minute),
+		state("pop001", 90, 3, 90, minute),
+	}, service.Sites(), minute)
+	upcoming = service.Upcoming(config.DefaultSite)
+	require.Len(t, upcoming, 1)
+	assert.Equal(t, start, upcoming[0].PredictedAt)
+	assert.Empty(t, sub.C)
+	assert.Empty(t, service.Upcoming("elsewhere"))
+
+	// Two minutes later the western one is overhead, then it leaves
+	service.predictOverflights([]model.Flight{state("west01", 270, 3, 90, start.Add(3*time.Minute))}, service.Sites(), start.Add(3*time.Minute))
+	assert.Empty(t, service.Upcoming(""))
+	service.predictOverflights([]model.Flight{state("west01", 90, 2, 90, start.Add(4*time.Minute))}, service.Sites(), start.Add(4*time.Minute))
+	service.predictOverflights(nil, service.Sites(), start.Add(5*time.Minute))
+
+	accuracy, err := db.GetPredictionAccuracy(start, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, accuracy.Entered)
+	assert.Equal(t, 1, accuracy.Missed)
+	assert.Equal(t, 1, accuracy.Unpredicted, "the aircraft overhead at the first poll is not counted")
+	// First seen inside at 3 km, the closest seen 2 km past the site, predicted to enter after 100 seconds and to fly overhead
+	assert.Equal(t, 80.0, accuracy.MeanEntryError)
+	assert.InDelta(t, 2000, accuracy.MeanDistanceError, 50)
+	assert.Equal(t, 180.0, accuracy.MeanLead)
+}
+
+func TestPredictOverflights_NotReported(t *testing.T) {
+	cfg := &config.Config{
+		Service:   config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 10},
+		Lookahead: config.LookaheadConfig{Enabled: true, Margin: 50, Horizon: 600},
+	}
+	db := newTestDB(t)
+	service, err := NewService(nil, nil, nil, db, cfg)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+	lat, lon := haversine.Destination(47.0, 8.0, 270, 20)
+	service.predictOverflights([]model.Flight{{Icao24: "west01", TimePosition: int(start.Unix()), Latitude: lat, Longitude: lon, Velocity: 100, TrueTrack: 90}},
+		service.Sites(), start)
+	require.Len(t, service.Upcoming(""), 1)
+
+	// Missing reports are waited for until a minute past the predicted entry
+	service.predictOverflights(nil, service.Sites(), start.Add(time.Minute))
+	assert.Len(t, service.Upcoming(""), 1)
+	service.predictOverflights(nil, service.Sites(), start.Add(3*time.Minute))
+	assert.Empty(t, service.Upcoming(""))
+	accuracy, err := db.GetPredictionAccuracy(start, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, accuracy.Missed)
+}
+
+func TestPredictOverflights_Disabled(t *testing.T) {
+	cfg := &config.Config{Service: config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 10}}
+	service, err := NewService(nil, nil, nil, newTestDB(t), cfg)
+	require.NoError(t, err)
+	assert.Zero(t, service.lookaheadMargin())
+
+	start := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC)
+	lat, lon := haversine.Destination(47.0, 8.0, 270, 20)
+	service.predictOverflights([]model.Flight{{Icao24: "west01", Latitude: lat, Longitude: lon, Velocity: 100, TrueTrack: 90}}, service.Sites(), start)
+	assert.Empty(t, service.Upcoming(""))
+}
+
+func TestWatchCycle_LookaheadMargin(t *testing.T) {
+	cfg := &config.Config{
+		Service:   config.ServiceConfig{Latitude: 47.0, Longitude: 8.0, Radius: 10},
+		Lookahead: config.LookaheadConfig{Enabled: true, Margin: 50, Horizon: 600},
+	}
+	margin := func(km float64) interface{} {
+		return mock.MatchedBy(func(area geofence.Area) bool {
+			envelope, ok := area.(geofence.Envelope)
+			return ok && envelope.MarginKm == km
+		})
+	}
+	mockOpenSkyClient := new(MockOpenSkyClient)
+	mockOpenSkyClient.On("GetStatesInArea", margin(50)).Return([]model.Flight{}, nil).Once()
+	mockOpenSkyClient.On("GetStatesInArea", margin(0)).Return([]model.Flight{}, nil).Once()
+	service, err := NewService(mockOpenSkyClient, nil, nil, newTestDB(t), cfg)
+	require.NoError(t, err)
+
+	// Only watch mode looks around the sites
+	_, err = service.watchCycle(service.Sites())
+	assert.NoError(t, err)
+	_, err = service.GetFlights("")
+	assert.NoError(t, err)
+	mockOpenSkyClient.AssertExpectations(t)
+}
@@ -0,0 +1,108 @@
+package squawk
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// Kinds of the built-in detections. Configured ranges use their name as kind.
+const (
+	KindHijack       = "hijack"        // squawk 7500
+	KindRadioFailure = "radio_failure" // squawk 7600
+	KindEmergency    = "emergency"     // squawk 7700
+	KindSPI          = "spi"           // special position identification, the "ident" button
+)
+
+// emergencies are the codes every aircraft squawks in the same situations.
+var emergencies = map[string]string{
+	"7500": KindHijack,
+	"7600": KindRadioFailure,
+	"7700": KindEmergency,
+}
+
+// Detection is why an aircraft is flagged, with the severity of the alert.
+type Detection struct {
+	Kind     string
+	Severity string
+}
+
+// codeRange is a configured block of squawk codes, as numbers.
+type codeRange struct {
+	name     string
+	severity string
+	from, to int
+}
+
+// Detector flags the aircraft squawking an emergency or a special purpose code, or with SPI active.
+type Detector struct {
+	ranges []codeRange
+}
+
+// New creates a Detector flagging the configured ranges on top of the emergency codes.
+func New(cfgs []config.SquawkRangeConfig) (*Detector, error) {
+	d := &Detector{}
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("every squawk range needs a name")
+		}
+		if slices.Contains([]string{KindHijack, KindRadioFailure, KindEmergency, KindSPI}, cfg.Name) ||
+			slices.ContainsFunc(d.ranges, func(r codeRange) bool { return r.name == cfg.Name }) {
+			return nil, fmt.Errorf("duplicate squawk range name %q", cfg.Name)
+		}
+		if cfg.To == "" {
+			cfg.To = cfg.From
+		}
+		from, err := parseCode(cfg.From)
+		if err != nil {
+			return nil, fmt.Errorf("squawk range %s: %w", cfg.Name, err)
+		}
+		to, err := parseCode(cfg.To)
+		if err != nil {
+			return nil, fmt.Errorf("squawk range %s: %w", cfg.Name, err)
+		}
+		if from > to {
+			return nil, fmt.Errorf("squawk range %s: %s is after %s", cfg.Name, cfg.From, cfg.To)
+		}
+		if cfg.Severity == "" {
+			cfg.Severity = model.SeverityWarning
+		}
+		if !slices.Contains([]string{model.SeverityInfo, model.SeverityWarning, model.SeverityCritical}, cfg.Severity) {
+			return nil, fmt.Errorf("squawk range %s: severity must be info, warning or critical", cfg.Name)
+		}
+		d.ranges = append(d.ranges, codeRange{name: cfg.Name, severity: cfg.Severity, from: from, to: to})
+	}
+	return d, nil
+}
+
+// parseCode parses a squawk code: four octal digits.
+func parseCode(code string) (int, error) {
+	n, err := strconv.ParseUint(code, 8, 16)
+	if err != nil || len(code) != 4 {
+		return 0, fmt.Errorf("invalid squawk code %q, expected four digits from 0 to 7", code)
+	}
+	return int(n), nil
+}
+
+// Detect returns why an aircraft is flagged from its state vector: emergencies, which are critical,
+// then SPI, a warning, then the configured ranges containing its code.
+func (d *Detector) Detect(state *model.Flight) []Detection {
+	var detections []Detection
+	if kind, ok := emergencies[state.Squawk]; ok {
+		detections = append(detections, Detection{Kind: kind, Severity: model.SeverityCritical})
+	}
+	if state.Spi {
+		detections = append(detections, Detection{Kind: KindSPI, Severity: model.SeverityWarning})
+	}
+	if code, err := parseCode(state.Squawk); err == nil {
+		for _, r := range d.ranges {
+			if code >= r.from && code <= r.to {
+				detections = append(detections, Detection{Kind: r.name, Severity: r.severity})
+			}
+		}
+	}
+	return detections
+}
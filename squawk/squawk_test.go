@@ -0,0 +1,50 @@
+package squawk
+
+import (
+	"testing"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	d, err := New([]config.SquawkRangeConfig{
+		{Name: "military", From: "4400", To: "4477"},
+		{Name: "police", From: "0020", Severity: "info"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		state    model.Flight
+		expected []Detection
+	}{
+		{model.Flight{Squawk: "7700"}, []Detection{{KindEmergency, model.SeverityCritical}}},
+		{model.Flight{Squawk: "7500"}, []Detection{{KindHijack, model.SeverityCritical}}},
+		{model.Flight{Squawk: "7600", Spi: true}, []Detection{{KindRadioFailure, model.SeverityCritical}, {KindSPI, model.SeverityWarning}}},
+		{model.Flight{Squawk: "4412"}, []Detection{{"military", model.SeverityWarning}}},
+		{model.Flight{Squawk: "4477"}, []Detection{{"military", model.SeverityWarning}}},
+		{model.Flight{Squawk: "0020"}, []Detection{{"police", model.SeverityInfo}}},
+		{model.Flight{Squawk: "0021"}, nil},
+		{model.Flight{Squawk: "1000"}, nil},
+		{model.Flight{}, nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, d.Detect(&tt.state), tt.state.Squawk)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfgs := range [][]config.SquawkRangeConfig{
+		{{From: "4400"}},
+		{{Name: "military", From: "4480"}},
+		{{Name: "military", From: "440"}},
+		{{Name: "military", From: "4477", To: "4400"}},
+		{{Name: "military", From: "4400", Severity: "fatal"}},
+		{{Name: "emergency", From: "4400"}},
+		{{Name: "military", From: "4400"}, {Name: "military", From: "4500"}},
+	} {
+		_, err := New(cfgs)
+		assert.Error(t, err, "%+v", cfgs)
+	}
+}
@@ -0,0 +1,206 @@
+// Package storage defines the repositories the flights, the passes and everything derived from them are stored in.
+// The database package implements them on SQLite, the postgres package on PostgreSQL with PostGIS, and the memory
+// package in memory, for tests and ephemeral runs.
+//
+// Empty sites in the queries mean all the sites; records stored with an empty site belong to config.DefaultSite.
+package storage
+
+import (
+	"time"
+
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// KeyValueCache caches values, such as API responses, until they expire.
+type KeyValueCache interface {
+	// Set stores a value with an expiration time.
+	Set(key string, value string, ttl time.Duration) error
+	// Get returns the value of a key, empty when missing or expired.
+	Get(key string) (string, error)
+	// DeleteExpiredCache deletes the entries expired at the given time and returns how many were deleted.
+	DeleteExpiredCache(now time.Time) (int64, error)
+}
+
+// Operators stores the details of the airlines, as returned by FlightAware, by ICAO code.
+type Operators interface {
+	// LogOperator stores the JSON details of an operator, unless already stored.
+	LogOperator(icao string, jsonValue string) error
+	// GetOperator returns the JSON details of an operator, empty when unknown.
+	GetOperator(icao string) (string, error)
+	// GetOperators returns the JSON details of the known operators among icaos, by ICAO code.
+	GetOperators(icaos []string) (map[string]string, error)
+	// GetOperatorInfo returns the details of an operator, with "N/A" as short name for unknown operators.
+	GetOperatorInfo(icao string) (*model.OperatorInfo, error)
+}
+
+// Airports stores where the airports the flights refer to are.
+type Airports interface {
+	// AirportLocated reports whether the airports of a code stored with the flights all have a location.
+	AirportLocated(code string) (bool, error)
+	// SetAirportLocation stores the location of the airports of a code.
+	SetAirportLocation(code string, latitude, longitude float64) error
+}
+
+// Flights is the enrichment cache: the flights identified with FlightAware, by the callsign they were looked up with,
+// with when they were last seen and how many times they were identified.
+type Flights interface {
+	GetFlightCount() (int, error)
+	// GetFlight returns a flight with when it was last seen, nil when missing.
+	GetFlight(key string) (*model.FlightInfo, time.Time, error)
+	// LogFlight stores a flight, seen now, and counts its identification.
+	LogFlight(key string, flightInfo *model.FlightInfo) error
+	// GetLatestFlight returns the flight seen last, nil when there is none.
+	GetLatestFlight(site string) (*model.FlightInfo, time.Time, error)
+	// GetLast10Flights returns the 10 flights seen last, one per ident.
+	GetLast10Flights(site string) ([]*model.FlightInfo, []time.Time, error)
+	// GetAllFlights returns the flights newest first, all when limit is not positive. Restricted to a site,
+	// only the flights sighted there are returned, with the time of their last sighting there.
+	GetAllFlights(limit int, site string) ([]*model.FlightInfo, []time.Time, error)
+	// ClearFlightLog deletes the flights, the sightings and the first seen values.
+	ClearFlightLog() error
+}
+
+// Sightings stores the passes of the aircraft over the sites.
+type Sightings interface {
+	// RecordSighting adds an observation to the open sighting of the aircraft at the site,
+	// or starts a new one when the last was seen more than gap ago.
+	RecordSighting(obs model.Observation, gap time.Duration) (*model.Sighting, error)
+	// GetSighting returns a sighting by id, nil when missing.
+	GetSighting(id int64) (*model.Sighting, error)
+	// GetRecentSightings returns up to limit sightings, seen last first.
+	GetRecentSightings(limit int, site string) ([]*model.Sighting, error)
+	// GetNoisySightingsSince returns the sightings with a noise estimate started since the given time, the loudest first.
+	GetNoisySightingsSince(since time.Time, site string) ([]*model.Sighting, error)
+	// GetSightingsBetween returns the sightings started in [from, to), in the order they started.
+	GetSightingsBetween(from, to time.Time, site string) ([]*model.Sighting, error)
+	GetSightingCount() (int, error)
+	GetSightingCountSince(since time.Time, site string) (int, error)
+	// ExportSightings calls fn with the sightings started in [from, to), in the order they started, flattened with
+	// their flights. The rows are read one at a time, and the first error returned by fn stops the export.
+	ExportSightings(from, to time.Time, site string, fn func(*model.ExportRow) error) error
+}
+
+// Stats records what the statistics count and aggregates the flights, the passes and the predictions.
+type Stats interface {
+	// GetMostCommonFlights returns the 5 flights with the most sightings, with their count as IdentificationCount.
+	GetMostCommonFlights(site string) ([]*model.FlightInfo, error)
+	// GetTopDestinations returns the 10 destinations with the most sightings.
+	GetTopDestinations(site string) ([]model.AirportStat, error)
+	// GetTopSources returns the 10 origins with the most sightings.
+	GetTopSources(site string) ([]model.AirportStat, error)
+	// RecordFilterRejection counts an aircraft rejected by a traffic filter, at most once a day.
+	RecordFilterRejection(site, name, icao24 string, at time.Time) error
+	// GetFilterStats returns the distinct aircraft rejected by each filter, today and overall.
+	GetFilterStats(today time.Time, site string) ([]model.FilterStat, error)
+	RecordPredictionOutcome(o *model.PredictionOutcome) error
+	// GetPredictionAccuracy summarizes the predictions resolved since the given time.
+	GetPredictionAccuracy(since time.Time, site string) (*model.PredictionAccuracy, error)
+}
+
+// FirstSeen stores when the attribute values of the flights, such as operators or aircraft types, were first seen.
+type FirstSeen interface {
+	// RecordFirstSeen counts a pass showing the attribute values, by kind, and returns the kinds seen for the first time.
+	RecordFirstSeen(attrs map[string]string, callsign, site string, at time.Time) ([]string, error)
+	GetFirstSeen() ([]*model.FirstSeen, error)
+	// GetFirstSeenSince returns the values first seen since the given time, newest first.
+	GetFirstSeenSince(since time.Time, site string) ([]*model.FirstSeen, error)
+}
+
+// SquawkAlerts stores the emergency and special purpose squawks.
+type SquawkAlerts interface {
+	// RecordSquawkAlert adds a flagged state to the open alert of its kind for the aircraft at the site,
+	// or opens a new one when the last was seen more than gap ago, reporting whether it did.
+	RecordSquawkAlert(site, kind, severity string, state *model.Flight, at time.Time, gap time.Duration) (*model.SquawkAlert, bool, error)
+	// GetSquawkAlertsSince returns the alerts seen since the given time, seen last first.
+	GetSquawkAlertsSince(since time.Time, site string) ([]*model.SquawkAlert, error)
+}
+
+// Positions stores the positions reported at every poll, the tracks of the aircraft.
+type Positions interface {
+	// RecordPositions stores the positions of the states polled at, skipping the ones already stored.
+	RecordPositions(states []model.Flight, at time.Time) error
+	// GetTrack returns the positions of the aircraft of a sighting during the pass, in time order.
+	GetTrack(sighting *model.Sighting) ([]model.Position, error)
+	// GetPositionsWithin returns the positions reported in [from, to) within radiusKm of a point, in time order.
+	GetPositionsWithin(lat, lon, radiusKm float64, from, to time.Time) ([]model.Position, error)
+	// DownsamplePositions keeps, before the given time, the first position of each aircraft in every interval,
+	// and returns how many were deleted.
+	DownsamplePositions(before time.Time, interval time.Duration) (int64, error)
+	// DeletePositionsBefore deletes the positions reported before the given time and returns how many were deleted.
+	DeletePositionsBefore(before time.Time) (int64, error)
+}
+
+// RecurringFlights stores the flights learned to pass at about the same time on the same weekdays.
+type RecurringFlights interface {
+	ReplaceRecurringFlights(flights []model.RecurringFlight) error
+	// GetRecurringFlights returns the recurring flights in time of day order.
+	GetRecurringFlights(site string) ([]model.RecurringFlight, error)
+}
+
+// Rules stores the alert rules created through the API.
+type Rules interface {
+	// GetRules returns the rules ordered by ID.
+	GetRules() ([]*model.Rule, error)
+	// GetRule returns a rule, nil when missing.
+	GetRule(id int64) (*model.Rule, error)
+	// CreateRule stores a new rule and sets its ID.
+	CreateRule(r *model.Rule) error
+	// UpdateRule replaces a rule, returning false when missing.
+	UpdateRule(r *model.Rule) (bool, error)
+	// DeleteRule deletes a rule, returning false when missing.
+	DeleteRule(id int64) (bool, error)
+}
+
+// WebhookDeliveries is the queue of the events to deliver to the webhooks.
+type WebhookDeliveries interface {
+	// EnqueueWebhookDelivery stores a pending delivery, due at its NextAttempt, and sets its ID.
+	EnqueueWebhookDelivery(d *model.WebhookDelivery) error
+	// GetDueWebhookDeliveries returns up to limit pending deliveries due at now, oldest first.
+	GetDueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error)
+	// GetDeadWebhookDeliveries returns up to limit deliveries that ran out of attempts, newest first.
+	GetDeadWebhookDeliveries(limit int) ([]*model.WebhookDelivery, error)
+	MarkWebhookDelivered(id int64, attempts int, at time.Time) error
+	// MarkWebhookFailed records a failed attempt, due again at next or dead.
+	MarkWebhookFailed(id int64, attempts int, next time.Time, lastError string, dead bool) error
+	// RequeueWebhookDelivery moves a dead delivery back to the queue, returning false when there is no such dead delivery.
+	RequeueWebhookDelivery(id int64, now time.Time) (bool, error)
+}
+
+// Maintenance keeps the storage tidy and records the runs of the maintenance jobs.
+type Maintenance interface {
+	// Optimize refreshes the statistics of the query planner, if any.
+	Optimize() error
+	// IncrementalVacuum returns the free space to the file system, if any, and returns how many pages were freed.
+	IncrementalVacuum() (int64, error)
+	// Checkpoint copies the write-ahead log, if any, into the database and returns how many pages were copied.
+	Checkpoint() (int64, error)
+	// RecordMaintenanceRun stores a run and sets its ID.
+	RecordMaintenanceRun(run *model.MaintenanceRun) error
+	// GetMaintenanceRuns returns up to limit runs, newest first.
+	GetMaintenanceRuns(limit int) ([]*model.MaintenanceRun, error)
+	// GetLastMaintenanceRuns returns when each job last ran, by job.
+	GetLastMaintenanceRuns() (map[string]time.Time, error)
+	// DeleteMaintenanceRunsBefore deletes the runs started before the given time and returns how many were deleted.
+	DeleteMaintenanceRunsBefore(before time.Time) (int64, error)
+}
+
+// Store is all the repositories in a single storage, as opened by the commands. The consumers depend on the
+// repositories they use only.
+type Store interface {
+	KeyValueCache
+	Operators
+	Airports
+	Flights
+	Sightings
+	Stats
+	FirstSeen
+	SquawkAlerts
+	Positions
+	RecurringFlights
+	Rules
+	WebhookDeliveries
+	Maintenance
+
+	// Close releases the storage, once the pending writes are done.
+	Close() error
+}
@@ -0,0 +1,739 @@
+// Package storagetest checks that an implementation of the storage repositories behaves as the application expects,
+// with the same tests for all the implementations.
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the tests of the repositories against the stores created by newStore, an empty one for each test
+// but for the flights seeded by migrations, which the tests clear.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T, s storage.Store)
+	}{
+		{"KeyValueCache", testKeyValueCache},
+		{"Operators", testOperators},
+		{"Airports", testAirports},
+		{"Flights", testFlights},
+		{"Sightings", testSightings},
+		{"ExportSightings", testExportSightings},
+		{"Stats", testStats},
+		{"FirstSeen", testFirstSeen},
+		{"SquawkAlerts", testSquawkAlerts},
+		{"Positions", testPositions},
+		{"RecurringFlights", testRecurringFlights},
+		{"Rules", testRules},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"Maintenance", testMaintenance},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStore(t)
+			require.NoError(t, s.ClearFlightLog())
+			test.run(t, s)
+		})
+	}
+}
+
+// now is a time in the local timezone, as the application stores, without the fractions of a second.
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+func testKeyValueCache(t *testing.T, s storage.Store) {
+	require.NoError(t, s.Set("fresh", "a", time.Hour))
+	require.NoError(t, s.Set("expired", "b", -time.Minute))
+	require.NoError(t, s.Set("swept", "c", -time.Minute))
+
+	value, err := s.Get("fresh")
+	require.NoError(t, err)
+	assert.Equal(t, "a", value)
+	value, err = s.Get("expired")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+	value, err = s.Get("missing")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	// The expired entry read is already deleted
+	deleted, err := s.DeleteExpiredCache(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	value, err = s.Get("fresh")
+	require.NoError(t, err)
+	assert.Equal(t, "a", value)
+}
+
+func testOperators(t *testing.T, s storage.Store) {
+	require.NoError(t, s.LogOperator("SWR", `{"shortname": "Swiss"}`))
+	require.NoError(t, s.LogOperator("SWR", `{"shortname": "Swissair"}`)) // already stored
+
+	operator, err := s.GetOperator("SWR")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"shortname": "Swiss"}`, operator)
+	operators, err := s.GetOperators([]string{"SWR", "DLH"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"SWR": operator}, operators)
+	operators, err = s.GetOperators(nil)
+	require.NoError(t, err)
+	assert.Empty(t, operators)
+
+	info, err := s.GetOperatorInfo("SWR")
+	require.NoError(t, err)
+	assert.Equal(t, "Swiss", info.Shortname)
+	info, err = s.GetOperatorInfo("DLH")
+	require.NoError(t, err)
+	assert.Equal(t, "N/A", info.Shortname)
+}
+
+func testAirports(t *testing.T, s storage.Store) {
+	require.NoError(t, s.LogFlight("SWR8", flight("SWR8", "ZRH", "JFK")))
+
+	located, err := s.AirportLocated("LSZH")
+	require.NoError(t, err)
+	assert.False(t, located)
+	require.NoError(t, s.SetAirportLocation("LSZH", 47.458056, 8.548056))
+	located, err = s.AirportLocated("LSZH")
+	require.NoError(t, err)
+	assert.True(t, located)
+	// Logged again, the airport keeps its location
+	require.NoError(t, s.LogFlight("SWR8", flight("SWR8", "ZRH", "JFK")))
+	located, err = s.AirportLocated("LSZH")
+	require.NoError(t, err)
+	assert.True(t, located)
+
+	located, err = s.AirportLocated("KJFK")
+	require.NoError(t, err)
+	assert.False(t, located)
+	// No flight refers to it, there is nothing to locate
+	located, err = s.AirportLocated("EDDF")
+	require.NoError(t, err)
+	assert.True(t, located)
+
+	require.NoError(t, s.ClearFlightLog())
+	located, err = s.AirportLocated("KJFK")
+	require.NoError(t, err)
+	assert.True(t, located)
+}
+
+// flight returns a FlightInfo with most kinds of fields set.
+func flight(ident, origin, destination string) *model.FlightInfo {
+	route, altitude := "GERSA UN871 BADEP", 370
+	scheduledOut := time.Date(2024, 6, 21, 7, 5, 0, 0, time.UTC)
+	return &model.FlightInfo{
+		Ident:          ident,
+		FaFlightID:     ident + "-1718900000-schedule-0001",
+		Operator:       "SWR",
+		OperatorIcao:   "SWR",
+		OperatorIata:   "LX",
+		Registration:   "HB-JNA",
+		AircraftType:   "B77W",
+		Icao24:         "4b1805",
+		Codeshares:     []string{"UAL9730", "ACA6725"},
+		CodesharesIata: []string{"UA9730"},
+		Origin:         model.AirportDetail{Code: "LSZH", CodeIcao: "LSZH", CodeIata: origin, Name: "Zurich", City: origin + " city"},
+		Destination:    model.AirportDetail{Code: "K" + destination, CodeIata: destination, City: destination + " city"},
+		ScheduledOut:   &scheduledOut,
+		Route:          &route,
+		FiledAltitude:  &altitude,
+		Diverted:       true,
+		RouteDistance:  3930,
+		Status:         "En Route",
+		Distance:       1234.5,
+		CO2KG:          98000,
+	}
+}
+
+// idents returns the idents of the flights.
+func idents(flights []*model.FlightInfo) []string {
+	var idents []string
+	for _, f := range flights {
+		idents = append(idents, f.Ident)
+	}
+	return idents
+}
+
+// sight records a single observation of the aircraft of a flight at a site.
+func sight(t *testing.T, s storage.Sightings, site, icao24, callsign string, at time.Time) *model.Sighting {
+	sighting, err := s.RecordSighting(model.Observation{Site: site, Icao24: icao24, Callsign: callsign, Time: at}, 10*time.Minute)
+	require.NoError(t, err)
+	return sighting
+}
+
+func testFlights(t *testing.T, s storage.Store) {
+	count, err := s.GetFlightCount()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	latest, _, err := s.GetLatestFlight("")
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	logged := flight("SWR12", "ZRH", "JFK")
+	logged.DistanceDisplay = "1.2 km" // not stored
+	require.NoError(t, s.LogFlight("SWR12", logged))
+	require.NoError(t, s.LogFlight("SWR12", logged))
+
+	got, lastSeen, err := s.GetFlight("SWR12")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.WithinDuration(t, time.Now(), lastSeen, time.Minute)
+	assert.Equal(t, 2, got.IdentificationCount)
+	assert.True(t, logged.ScheduledOut.Equal(*got.ScheduledOut))
+	assert.True(t, got.ScheduledOff.IsZero())
+	got.ScheduledOut, got.IdentificationCount = logged.ScheduledOut, 0
+	got.ScheduledOff, got.EstimatedOff, got.ActualOff = time.Time{}, time.Time{}, time.Time{}
+	got.ScheduledOn, got.EstimatedOn, got.ActualOn = time.Time{}, time.Time{}, time.Time{}
+	logged.DistanceDisplay = ""
+	assert.Equal(t, logged, got)
+
+	missing, _, err := s.GetFlight("DLH4")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// A flight without airports nor codeshares
+	bare := &model.FlightInfo{Ident: "EZY45", Codeshares: []string{}}
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.LogFlight("EZY45", bare))
+	got, _, err = s.GetFlight("EZY45")
+	require.NoError(t, err)
+	assert.Nil(t, got.Codeshares)
+	assert.Equal(t, model.AirportDetail{}, got.Origin)
+
+	count, err = s.GetFlightCount()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	latest, _, err = s.GetLatestFlight("")
+	require.NoError(t, err)
+	assert.Equal(t, "EZY45", latest.Ident)
+	all, lastSeens, err := s.GetAllFlights(0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EZY45", "SWR12"}, idents(all))
+	assert.Len(t, lastSeens, 2)
+	all, _, err = s.GetAllFlights(1, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EZY45"}, idents(all))
+
+	// The same ident looked up by another callsign is listed once, by the latest
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.LogFlight("LX12", flight("SWR12", "ZRH", "JFK")))
+	last10, _, err := s.GetLast10Flights("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SWR12", "EZY45"}, idents(last10))
+
+	// Restricted to a site, the flights sighted there, by the time of their last sighting
+	at := now()
+	sight(t, s, "home", "4b1805", "SWR12", at.Add(-time.Hour))
+	sight(t, s, "home", "4b1805", "SWR12", at.Add(-time.Minute))
+	sight(t, s, "home", "400001", "EZY45", at.Add(-30*time.Minute))
+	sight(t, s, "office", "400001", "EZY45", at)
+	sight(t, s, "home", "400002", "UNKNOWN", at)
+	all, lastSeens, err = s.GetAllFlights(0, "home")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SWR12", "EZY45"}, idents(all))
+	assert.True(t, at.Add(-time.Minute).Equal(lastSeens[0]))
+	last10, _, err = s.GetLast10Flights("office")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EZY45"}, idents(last10))
+	latest, lastSeen, err = s.GetLatestFlight("office")
+	require.NoError(t, err)
+	assert.Equal(t, "EZY45", latest.Ident)
+	assert.True(t, at.Equal(lastSeen))
+
+	require.NoError(t, s.ClearFlightLog())
+	count, err = s.GetFlightCount()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	sightings, err := s.GetSightingCount()
+	require.NoError(t, err)
+	assert.Zero(t, sightings)
+}
+
+func testSightings(t *testing.T, s storage.Store) {
+	at := now()
+	obs := model.Observation{Icao24: "4b1805", Callsign: "SWR12", Time: at, Distance: 5000, Altitude: 3000, Bearing: 90, NoiseLevel: 60, NoiseExposure: 70}
+	first, err := s.RecordSighting(obs, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultSite, first.Site)
+	assert.NotZero(t, first.ID)
+
+	// Observations within the gap extend the sighting, the loudest keeps its noise
+	obs.Time, obs.Distance, obs.Altitude, obs.Bearing, obs.NoiseLevel, obs.NoiseExposure = at.Add(time.Minute), 2000, 2500, 100, 65, 75
+	extended, err := s.RecordSighting(obs, 5*time.Minute)
+	require.NoError(t, err)
+	// An unknown altitude does not lower the pass
+	obs.Time, obs.Distance, obs.Altitude, obs.Bearing, obs.NoiseLevel, obs.NoiseExposure = at.Add(2*time.Minute), 4000, 0, 120, 55, 66
+	extended, err = s.RecordSighting(obs, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, extended.ID)
+	assert.True(t, at.Equal(extended.FirstSeen))
+	assert.True(t, at.Add(2*time.Minute).Equal(extended.LastSeen))
+	assert.Equal(t, 2000.0, extended.MinDistance)
+	assert.Equal(t, 2500.0, extended.MinAltitude)
+	assert.Equal(t, 90.0, extended.EntryBearing)
+	assert.Equal(t, 120.0, extended.ExitBearing)
+	assert.Equal(t, 3, extended.SampleCount)
+	assert.Equal(t, 65.0, extended.PeakNoise)
+	assert.Equal(t, 75.0, extended.NoiseExposure)
+
+	// After the gap a new one starts
+	obs.Time = at.Add(time.Hour)
+	later, err := s.RecordSighting(obs, 5*time.Minute)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, later.ID)
+	assert.Zero(t, later.MinAltitude)
+	obs.Time, obs.Altitude = at.Add(time.Hour+time.Minute), 1800
+	later, err = s.RecordSighting(obs, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1800.0, later.MinAltitude)
+	quiet := sight(t, s, "office", "400001", "EZY45", at.Add(30*time.Minute))
+
+	got, err := s.GetSighting(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.SampleCount)
+	got, err = s.GetSighting(later.ID + 100)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	recent, err := s.GetRecentSightings(2, "")
+	require.NoError(t, err)
+	require.Len(t, recent, 2)
+	assert.Equal(t, []int64{later.ID, quiet.ID}, []int64{recent[0].ID, recent[1].ID})
+	recent, err = s.GetRecentSightings(10, "office")
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, quiet.ID, recent[0].ID)
+
+	noisy, err := s.GetNoisySightingsSince(at, "")
+	require.NoError(t, err)
+	require.Len(t, noisy, 2)
+	assert.Equal(t, first.ID, noisy[0].ID) // 65 dB, louder than the 55 dB of the later one
+	noisy, err = s.GetNoisySightingsSince(at.Add(time.Minute), "")
+	require.NoError(t, err)
+	require.Len(t, noisy, 1)
+
+	between, err := s.GetSightingsBetween(at, at.Add(time.Hour), "")
+	require.NoError(t, err)
+	require.Len(t, between, 2)
+	assert.Equal(t, []int64{first.ID, quiet.ID}, []int64{between[0].ID, between[1].ID})
+	between, err = s.GetSightingsBetween(at, at.Add(time.Hour), config.DefaultSite)
+	require.NoError(t, err)
+	require.Len(t, between, 1)
+
+	count, err := s.GetSightingCount()
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	count, err = s.GetSightingCountSince(at.Add(time.Minute), "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = s.GetSightingCountSince(at, "office")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func testExportSightings(t *testing.T, s storage.Store) {
+	logged := flight("SWR12", "ZRH", "JFK")
+	logged.SetState(&model.Flight{Icao24: "4b1805", BaroAltitude: 3000, Velocity: 180.5, VerticalRate: -4, Squawk: "1000"})
+	require.NoError(t, s.LogFlight("SWR12", logged))
+	// Sighted after the leg was logged, and before the return leg
+	at := time.Now()
+	obs := model.Observation{Icao24: "4b1805", Callsign: "SWR12", Time: at, Distance: 5000, Altitude: 3000, Bearing: 90, NoiseLevel: 60}
+	identified, err := s.RecordSighting(obs, 5*time.Minute)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	back := flight("SWR12", "JFK", "ZRH")
+	back.FaFlightID = "SWR12-1719000000-schedule-0001"
+	require.NoError(t, s.LogFlight("SWR12", back))
+
+	early := sight(t, s, "office", "4b1805", "SWR12", at.Add(-time.Hour))
+	unknown := sight(t, s, "office", "400001", "EZY45", at.Add(time.Minute))
+	returned := sight(t, s, config.DefaultSite, "4b1805", "SWR12", at.Add(time.Hour))
+	sight(t, s, "office", "400002", "EZY46", at.Add(2*time.Hour))
+
+	var rows []model.ExportRow
+	collect := func(row *model.ExportRow) error {
+		rows = append(rows, *row)
+		return nil
+	}
+	require.NoError(t, s.ExportSightings(at.Add(-time.Second), at.Add(2*time.Hour), "", collect))
+	require.Len(t, rows, 3)
+
+	row := rows[0]
+	assert.Equal(t, identified.ID, row.SightingID)
+	assert.Equal(t, config.DefaultSite, row.Site)
+	assert.WithinDuration(t, at, row.FirstSeen, time.Millisecond)
+	assert.Equal(t, 5000.0, row.MinDistance)
+	assert.Equal(t, 60.0, row.PeakNoise)
+	assert.Equal(t, "SWR12", row.Ident)
+	assert.Equal(t, "LX", row.OperatorIata)
+	assert.Equal(t, []string{"LSZH", "ZRH", "ZRH city"}, []string{row.Origin, row.OriginIata, row.OriginCity})
+	assert.Equal(t, []string{"KJFK", "JFK", "JFK city"}, []string{row.Destination, row.DestinationIata, row.DestinationCity})
+	assert.Equal(t, "GERSA UN871 BADEP", row.Route)
+	assert.Equal(t, 3930, row.RouteDistance)
+	assert.Equal(t, "HB-JNA", row.Registration)
+	assert.Equal(t, "B77W", row.AircraftType)
+	assert.Equal(t, 98000.0, row.CO2KG)
+	assert.Equal(t, 180.5, row.Velocity)
+	assert.Equal(t, -4.0, row.VerticalRate)
+	assert.Equal(t, "1000", row.Squawk)
+
+	// The sightings of unidentified callsigns have no flight columns
+	assert.Equal(t, model.ExportRow{
+		SightingID: unknown.ID, Site: "office", Icao24: "400001", Callsign: "EZY45",
+		FirstSeen: rows[1].FirstSeen, LastSeen: rows[1].LastSeen, SampleCount: 1,
+	}, rows[1])
+
+	// Each sighting is exported with the leg logged last by its end
+	assert.Equal(t, returned.ID, rows[2].SightingID)
+	assert.Equal(t, "SWR12", rows[2].Ident)
+	assert.Equal(t, []string{"JFK", "ZRH"}, []string{rows[2].OriginIata, rows[2].DestinationIata})
+
+	// The sightings before any leg was logged have no flight columns either
+	rows = nil
+	require.NoError(t, s.ExportSightings(time.Time{}, at.Add(3*time.Hour), "office", collect))
+	require.Len(t, rows, 3)
+	assert.Equal(t, early.ID, rows[0].SightingID)
+	assert.Empty(t, rows[0].Ident)
+	assert.Empty(t, rows[0].OriginIata)
+
+	// An error of fn stops the export
+	calls := 0
+	err = s.ExportSightings(time.Time{}, at.Add(3*time.Hour), "", func(*model.ExportRow) error {
+		calls++
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
+
+func testStats(t *testing.T, s storage.Store) {
+	at := now()
+	require.NoError(t, s.LogFlight("SWR12", flight("SWR12", "ZRH", "JFK")))
+	require.NoError(t, s.LogFlight("DLH4", flight("DLH4", "FRA", "JFK")))
+	require.NoError(t, s.LogFlight("EZY45", flight("EZY45", "GVA", "LGW")))
+	for i := range 3 {
+		sight(t, s, "home", "4b1805", "SWR12", at.Add(time.Duration(i)*time.Hour))
+	}
+	sight(t, s, "home", "3c0001", "DLH4", at)
+	sight(t, s, "office", "400001", "EZY45", at)
+	sight(t, s, "office", "400001", "EZY45", at.Add(time.Hour))
+
+	common, err := s.GetMostCommonFlights("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SWR12", "EZY45", "DLH4"}, idents(common))
+	assert.Equal(t, 3, common[0].IdentificationCount)
+	common, err = s.GetMostCommonFlights("office")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EZY45"}, idents(common))
+
+	destinations, err := s.GetTopDestinations("")
+	require.NoError(t, err)
+	assert.Equal(t, []model.AirportStat{{Iata: "JFK", City: "JFK city", Count: 4}, {Iata: "LGW", City: "LGW city", Count: 2}}, destinations)
+	sources, err := s.GetTopSources("home")
+	require.NoError(t, err)
+	assert.Equal(t, []model.AirportStat{{Iata: "ZRH", City: "ZRH city", Count: 3}, {Iata: "FRA", City: "FRA city", Count: 1}}, sources)
+
+	// Rejections count each aircraft once per filter and day
+	yesterday := at.AddDate(0, 0, -1)
+	require.NoError(t, s.RecordFilterRejection("", "altitude", "4b1805", at))
+	require.NoError(t, s.RecordFilterRejection("", "altitude", "4b1805", at))
+	require.NoError(t, s.RecordFilterRejection("", "altitude", "4b1805", yesterday))
+	require.NoError(t, s.RecordFilterRejection("", "altitude", "400001", yesterday))
+	require.NoError(t, s.RecordFilterRejection("office", "ground", "400001", at))
+	filterStats, err := s.GetFilterStats(at, "")
+	require.NoError(t, err)
+	assert.Equal(t, []model.FilterStat{{Name: "altitude", Today: 1, Total: 3}, {Name: "ground", Today: 1, Total: 1}}, filterStats)
+	filterStats, err = s.GetFilterStats(at, "office")
+	require.NoError(t, err)
+	assert.Equal(t, []model.FilterStat{{Name: "ground", Today: 1, Total: 1}}, filterStats)
+
+	prediction := model.Prediction{Icao24: "4b1805", PredictedAt: at, EntryTime: at.Add(time.Minute), ClosestDistance: 1000}
+	for _, o := range []model.PredictionOutcome{
+		{Prediction: prediction, Outcome: model.PredictionEntered, ActualEntry: at.Add(70 * time.Second), ActualDistance: 1200, ResolvedAt: at},
+		{Prediction: prediction, Outcome: model.PredictionEntered, ActualEntry: at.Add(40 * time.Second), ActualDistance: 900, ResolvedAt: at},
+		{Prediction: prediction, Outcome: model.PredictionMissed, ResolvedAt: at},
+		{Prediction: model.Prediction{Site: "office"}, Outcome: model.PredictionUnpredicted, ActualEntry: at, ResolvedAt: at},
+		{Prediction: prediction, Outcome: model.PredictionMissed, ResolvedAt: at.AddDate(0, 0, -2)},
+	} {
+		require.NoError(t, s.RecordPredictionOutcome(&o))
+	}
+	accuracy, err := s.GetPredictionAccuracy(at.AddDate(0, 0, -1), "")
+	require.NoError(t, err)
+	assert.Equal(t, &model.PredictionAccuracy{Entered: 2, Missed: 1, Unpredicted: 1, MeanEntryError: 15, MeanDistanceError: 150, MeanLead: 55}, accuracy)
+	accuracy, err = s.GetPredictionAccuracy(at.AddDate(0, 0, -1), "office")
+	require.NoError(t, err)
+	assert.Equal(t, &model.PredictionAccuracy{Unpredicted: 1}, accuracy)
+}
+
+func testFirstSeen(t *testing.T, s storage.Store) {
+	at := now()
+	firsts, err := s.RecordFirstSeen(map[string]string{model.KindOperator: "SWR", model.KindAircraftType: "B77W"}, "SWR12", "", at)
+	require.NoError(t, err)
+	assert.Equal(t, []string{model.KindOperator, model.KindAircraftType}, firsts)
+	firsts, err = s.RecordFirstSeen(map[string]string{model.KindOperator: "SWR", model.KindAircraftType: "A320"}, "SWR14", "office", at.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{model.KindAircraftType}, firsts)
+
+	all, err := s.GetFirstSeen()
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	for _, f := range all {
+		if f.Value == "SWR" {
+			assert.Equal(t, 2, f.Count)
+			assert.Equal(t, config.DefaultSite, f.Site)
+			assert.Equal(t, "SWR12", f.Callsign)
+			assert.True(t, at.Equal(f.Time))
+		}
+	}
+
+	since, err := s.GetFirstSeenSince(at, "")
+	require.NoError(t, err)
+	require.Len(t, since, 3)
+	assert.Equal(t, "A320", since[0].Value)
+	assert.Equal(t, []string{model.KindAircraftType, model.KindOperator}, []string{since[1].Kind, since[2].Kind})
+	since, err = s.GetFirstSeenSince(at, config.DefaultSite)
+	require.NoError(t, err)
+	assert.Len(t, since, 2)
+}
+
+func testSquawkAlerts(t *testing.T, s storage.Store) {
+	at := now()
+	state := &model.Flight{Icao24: "4b1805", Callsign: "SWR12", Squawk: "7700"}
+	alert, opened, err := s.RecordSquawkAlert("", "emergency", "critical", state, at, 10*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, opened)
+	assert.Equal(t, config.DefaultSite, alert.Site)
+
+	state.Squawk = "7600"
+	again, opened, err := s.RecordSquawkAlert("", "emergency", "warning", state, at.Add(time.Minute), 10*time.Minute)
+	require.NoError(t, err)
+	assert.False(t, opened)
+	assert.Equal(t, alert.ID, again.ID)
+	// The alert keeps what raised it, and the last state
+	assert.Equal(t, "7700", again.Squawk)
+	assert.Equal(t, "critical", again.Severity)
+	assert.Equal(t, "7700", again.State.Squawk)
+	assert.Equal(t, "7600", again.LastState.Squawk)
+	assert.True(t, at.Equal(again.FirstSeen))
+	assert.True(t, at.Add(time.Minute).Equal(again.LastSeen))
+
+	later, opened, err := s.RecordSquawkAlert("office", "emergency", "critical", state, at.Add(2*time.Minute), 10*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, opened)
+
+	alerts, err := s.GetSquawkAlertsSince(at.Add(time.Minute), "")
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, later.ID, alerts[0].ID)
+	assert.Equal(t, alert.ID, alerts[1].ID)
+	assert.Equal(t, "7700", alerts[1].State.Squawk)
+	assert.Equal(t, "7600", alerts[1].LastState.Squawk)
+	alerts, err = s.GetSquawkAlertsSince(at.Add(time.Hour), "")
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+}
+
+func testPositions(t *testing.T, s storage.Store) {
+	at := now()
+	states := []model.Flight{
+		{Icao24: "4b1805", Callsign: "SWR12", TimePosition: int(at.Unix()) - 5, Latitude: 47.4, Longitude: 8.5, BaroAltitude: 3000},
+		{Icao24: "4b1806"}, // no position
+		{Icao24: "400001", Latitude: 47.5, Longitude: 8.6, OnGround: true},
+	}
+	require.NoError(t, s.RecordPositions(states, at))
+	require.NoError(t, s.RecordPositions(states, at.Add(10*time.Second))) // 4b1805 again, a newer 400001
+
+	track, err := s.GetTrack(&model.Sighting{Icao24: "4b1805", FirstSeen: at, LastSeen: at})
+	require.NoError(t, err)
+	require.Len(t, track, 1)
+	assert.Equal(t, at.Add(-5*time.Second).Unix(), track[0].Time.Unix())
+	assert.Equal(t, 3000.0, track[0].BaroAltitude)
+	track, err = s.GetTrack(&model.Sighting{Icao24: "400001", FirstSeen: at, LastSeen: at})
+	require.NoError(t, err)
+	require.Len(t, track, 2)
+	assert.True(t, track[0].OnGround)
+
+	// Within a radius, the 400001 positions about 13 km away
+	within, err := s.GetPositionsWithin(47.4, 8.5, 5, at.Add(-time.Minute), at.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, within, 1)
+	assert.Equal(t, "4b1805", within[0].Icao24)
+	within, err = s.GetPositionsWithin(47.4, 8.5, 20, at.Add(-time.Minute), at.Add(10*time.Second))
+	require.NoError(t, err)
+	require.Len(t, within, 2)
+	assert.Equal(t, "4b1805", within[0].Icao24)
+	assert.Equal(t, "400001", within[1].Icao24)
+	assert.Equal(t, 47.5, within[1].Latitude)
+	assert.Equal(t, 8.6, within[1].Longitude)
+
+	// Two minutes every 10 seconds, downsampled to a position a minute, then deleted
+	old := time.Unix(at.Add(-48*time.Hour).Unix()/60*60, 0)
+	for i := range 12 {
+		state := model.Flight{Icao24: "3c0001", Latitude: 47.4, Longitude: 8.5 + float64(i)/100}
+		require.NoError(t, s.RecordPositions([]model.Flight{state}, old.Add(time.Duration(i)*10*time.Second)))
+	}
+	deleted, err := s.DownsamplePositions(at.Add(-24*time.Hour), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), deleted)
+	pass := &model.Sighting{Icao24: "3c0001", FirstSeen: old, LastSeen: old.Add(2 * time.Minute)}
+	track, err = s.GetTrack(pass)
+	require.NoError(t, err)
+	require.Len(t, track, 2)
+	assert.True(t, old.Equal(track[0].Time))
+	assert.True(t, old.Add(time.Minute).Equal(track[1].Time))
+
+	deleted, err = s.DeletePositionsBefore(at.Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	track, err = s.GetTrack(pass)
+	require.NoError(t, err)
+	assert.Empty(t, track)
+	// A deleted position can be stored again
+	require.NoError(t, s.RecordPositions([]model.Flight{{Icao24: "3c0001", Latitude: 47.4, Longitude: 8.5}}, old))
+	track, err = s.GetTrack(pass)
+	require.NoError(t, err)
+	assert.Len(t, track, 1)
+}
+
+func testRecurringFlights(t *testing.T, s storage.Store) {
+	require.NoError(t, s.ReplaceRecurringFlights([]model.RecurringFlight{{Callsign: "OLD1", Minute: 60}}))
+	flights := []model.RecurringFlight{
+		{Site: "office", Callsign: "SWR12", Minute: 600, Tolerance: 10, Weekdays: []time.Weekday{time.Monday, time.Friday}, Occurrences: 8, Regularity: 0.9},
+		{Callsign: "EZY45", Minute: 480, Tolerance: 15, Weekdays: []time.Weekday{time.Sunday}, Occurrences: 4, Regularity: 0.5},
+	}
+	require.NoError(t, s.ReplaceRecurringFlights(flights))
+
+	got, err := s.GetRecurringFlights("")
+	require.NoError(t, err)
+	flights[1].Site = config.DefaultSite
+	assert.Equal(t, []model.RecurringFlight{flights[1], flights[0]}, got)
+	got, err = s.GetRecurringFlights("office")
+	require.NoError(t, err)
+	assert.Equal(t, []model.RecurringFlight{flights[0]}, got)
+}
+
+func testRules(t *testing.T, s storage.Store) {
+	rule := &model.Rule{Name: "low", Expression: "altitude < 1000", Severity: "info", Cooldown: 60, Actions: []string{"webhook", "mqtt"}, Enabled: true}
+	require.NoError(t, s.CreateRule(rule))
+	assert.NotZero(t, rule.ID)
+	quiet := &model.Rule{Name: "quiet", Expression: "true", Actions: []string{}}
+	require.NoError(t, s.CreateRule(quiet))
+
+	got, err := s.GetRule(rule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, rule, got)
+	got, err = s.GetRule(quiet.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.Actions)
+
+	rule.Enabled = false
+	rule.Actions = []string{"mqtt"}
+	found, err := s.UpdateRule(rule)
+	require.NoError(t, err)
+	assert.True(t, found)
+	rules, err := s.GetRules()
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, rule, rules[0])
+
+	found, err = s.DeleteRule(rule.ID)
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = s.DeleteRule(rule.ID)
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = s.UpdateRule(rule)
+	require.NoError(t, err)
+	assert.False(t, found)
+	got, err = s.GetRule(rule.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func testWebhookDeliveries(t *testing.T, s storage.Store) {
+	at := now()
+	var deliveries []*model.WebhookDelivery
+	for i := range 3 {
+		d := &model.WebhookDelivery{Webhook: "home", EventType: "entered", Body: "{}", NextAttempt: at.Add(time.Duration(2-i) * time.Second), CreatedAt: at}
+		require.NoError(t, s.EnqueueWebhookDelivery(d))
+		assert.Equal(t, model.DeliveryPending, d.Status)
+		deliveries = append(deliveries, d)
+	}
+
+	due, err := s.GetDueWebhookDeliveries(at.Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, []int64{deliveries[2].ID, deliveries[1].ID}, []int64{due[0].ID, due[1].ID})
+	due, err = s.GetDueWebhookDeliveries(at.Add(time.Minute), 1)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	require.NoError(t, s.MarkWebhookDelivered(deliveries[2].ID, 1, at))
+	require.NoError(t, s.MarkWebhookFailed(deliveries[1].ID, 1, at.Add(time.Hour), "timeout", false))
+	require.NoError(t, s.MarkWebhookFailed(deliveries[0].ID, 5, at, "refused", true))
+	due, err = s.GetDueWebhookDeliveries(at.Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	dead, err := s.GetDeadWebhookDeliveries(10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, deliveries[0].ID, dead[0].ID)
+	assert.Equal(t, 5, dead[0].Attempts)
+	assert.Equal(t, "refused", dead[0].LastError)
+	assert.Nil(t, dead[0].DeliveredAt)
+
+	requeued, err := s.RequeueWebhookDelivery(deliveries[1].ID, at) // pending, not dead
+	require.NoError(t, err)
+	assert.False(t, requeued)
+	requeued, err = s.RequeueWebhookDelivery(deliveries[0].ID, at.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, requeued)
+	due, err = s.GetDueWebhookDeliveries(at.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, deliveries[0].ID, due[0].ID)
+	assert.Zero(t, due[0].Attempts)
+}
+
+func testMaintenance(t *testing.T, s storage.Store) {
+	require.NoError(t, s.Optimize())
+	_, err := s.IncrementalVacuum()
+	require.NoError(t, err)
+	_, err = s.Checkpoint()
+	require.NoError(t, err)
+
+	at := now()
+	runs := []*model.MaintenanceRun{
+		{Job: "cache", StartedAt: at.AddDate(0, 0, -40), DurationMs: 3, Affected: 5},
+		{Job: "cache", StartedAt: at.Add(-time.Hour), DurationMs: 2, Affected: 1},
+		{Job: "vacuum", StartedAt: at, DurationMs: 10, Error: "database is locked"},
+	}
+	for _, run := range runs {
+		require.NoError(t, s.RecordMaintenanceRun(run))
+		assert.NotZero(t, run.ID)
+	}
+
+	latest, err := s.GetMaintenanceRuns(2)
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	assert.Equal(t, runs[2].ID, latest[0].ID)
+	assert.Equal(t, "database is locked", latest[0].Error)
+	assert.Equal(t, int64(1), latest[1].Affected)
+
+	last, err := s.GetLastMaintenanceRuns()
+	require.NoError(t, err)
+	require.Len(t, last, 2)
+	assert.True(t, at.Add(-time.Hour).Equal(last["cache"]))
+
+	deleted, err := s.DeleteMaintenanceRunsBefore(at.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,180 @@
+// Package transit predicts aircraft crossing the disk of the sun or the moon, for photographers.
+package transit
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/carlo-colombo/sopra/astro"
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+)
+
+// step is the resolution of the first scan of a path, refined afterwards.
+const step = time.Second
+
+// Observer is where the sky is watched from.
+type Observer struct {
+	Site      string
+	Latitude  float64
+	Longitude float64
+	Altitude  float64 // meters above sea level
+}
+
+// Predictor extrapolates the paths of aircraft to find when they pass in front of the sun or the moon.
+type Predictor struct {
+	horizon       time.Duration
+	maxSeparation float64 // arcminutes
+}
+
+// New creates a Predictor from the transit configuration.
+func New(cfg config.TransitConfig) (*Predictor, error) {
+	if cfg.Horizon <= 0 || cfg.Horizon > 3600 {
+		return nil, fmt.Errorf("the transit horizon must be between 1 and 3600 seconds")
+	}
+	if cfg.MaxSeparation <= 0 {
+		return nil, fmt.Errorf("the transit max separation must be positive")
+	}
+	return &Predictor{horizon: time.Duration(cfg.Horizon) * time.Second, maxSeparation: cfg.MaxSeparation}, nil
+}
+
+// body is the sun or the moon, with its positions in the sky of the observer.
+type body struct {
+	name      string
+	position  func(t time.Time, lat, lon, alt float64) astro.Position
+	positions []astro.Position // at each step of the horizon
+}
+
+// Predict returns the transits and near transits of the aircraft, seen from the observer within the horizon
+// after at. Aircraft keep their last track, speed and vertical rate. There is at most one transit per aircraft
+// and body, at the closest approach to the center of the disk.
+func (p *Predictor) Predict(obs Observer, states []model.Flight, at time.Time) []model.Transit {
+	steps := int(p.horizon / step)
+	var bodies []*body
+	for _, b := range []*body{{name: model.BodySun, position: astro.Sun}, {name: model.BodyMoon, position: astro.Moon}} {
+		visible := false
+		for i := 0; i <= steps; i++ {
+			pos := b.position(at.Add(time.Duration(i)*step), obs.Latitude, obs.Longitude, obs.Altitude)
+			b.positions = append(b.positions, pos)
+			visible = visible || pos.Elevation > 0
+		}
+		if visible {
+			bodies = append(bodies, b)
+		}
+	}
+
+	var transits []model.Transit
+	for i := range states {
+		state := &states[i]
+		if state.OnGround || state.Velocity <= 0 {
+			continue
+		}
+		for _, b := range bodies {
+			if transit, ok := p.closestApproach(obs, state, b, at); ok {
+				transits = append(transits, transit)
+			}
+		}
+	}
+	return transits
+}
+
+// closestApproach finds when an aircraft passes closest to the center of a body, and whether it is close enough.
+func (p *Predictor) closestApproach(obs Observer, state *model.Flight, b *body, at time.Time) (model.Transit, bool) {
+	separation := func(t time.Time, pos astro.Position) float64 {
+		az, el, _ := look(obs, state, t)
+		if el <= 0 || pos.Elevation <= 0 {
+			return math.Inf(1)
+		}
+		return astro.Separation(az, el, pos.Azimuth, pos.Elevation) * 60
+	}
+
+	closest, best := 0, math.Inf(1)
+	for i, pos := range b.positions {
+		if sep := separation(at.Add(time.Duration(i)*step), pos); sep < best {
+			closest, best = i, sep
+		}
+	}
+	if math.IsInf(best, 1) {
+		return model.Transit{}, false
+	}
+
+	// An aircraft a few kilometers away crosses a disk in less than a second: golden section search
+	// the closest approach between the neighbouring steps.
+	lo := at.Add(time.Duration(closest-1) * step)
+	hi := at.Add(time.Duration(closest+1) * step)
+	sepAt := func(t time.Time) float64 {
+		return separation(t, b.position(t, obs.Latitude, obs.Longitude, obs.Altitude))
+	}
+	const ratio = 0.6180339887498949
+	for hi.Sub(lo) > time.Millisecond {
+		m1 := hi.Add(-time.Duration(float64(hi.Sub(lo)) * ratio))
+		m2 := lo.Add(time.Duration(float64(hi.Sub(lo)) * ratio))
+		if sepAt(m1) < sepAt(m2) {
+			hi = m2
+		} else {
+			lo = m1
+		}
+	}
+	t := lo.Add(hi.Sub(lo) / 2)
+	if t.Before(at) {
+		t = at
+	}
+	sep := sepAt(t)
+	if sep > p.maxSeparation {
+		return model.Transit{}, false
+	}
+
+	pos := b.position(t, obs.Latitude, obs.Longitude, obs.Altitude)
+	az, el, slantRange := look(obs, state, t)
+	transit := model.Transit{
+		Site:       obs.Site,
+		Icao24:     state.Icao24,
+		Callsign:   state.Callsign,
+		Body:       b.name,
+		Time:       t,
+		Separation: sep,
+		BodyRadius: pos.Radius,
+		Azimuth:    az,
+		Elevation:  el,
+		SlantRange: slantRange,
+	}
+	if sep < pos.Radius {
+		// The chord across the disk at the apparent angular speed of the aircraft
+		az1, el1, _ := look(obs, state, t.Add(-50*time.Millisecond))
+		az2, el2, _ := look(obs, state, t.Add(50*time.Millisecond))
+		speed := astro.Separation(az1, el1, az2, el2) * 60 / 0.1 // arcminutes per second
+		transit.Duration = 2 * math.Sqrt(pos.Radius*pos.Radius-sep*sep) / speed
+	}
+	transit.ShiftDistance, transit.ShiftBearing = groundShift(az, el, slantRange, pos)
+	return transit, true
+}
+
+// minShiftElevation is the lowest elevation, in degrees, the ground shift foreshortens a move toward an aircraft by.
+// Closer to the horizon the foreshortening grows without bound, while the shift is a rough hint anyway.
+const minShiftElevation = 5
+
+// groundShift returns how far and in which direction an observer has to move to see an aircraft, at a slant
+// range, in front of the center of a body. The body is too far to move in the sky, while the aircraft shifts
+// opposite to the move: sideways by the move, and up or down by the move toward it foreshortened by its elevation,
+// at least minShiftElevation, so that the shift of the aircraft low on the horizon is an underestimate.
+func groundShift(az, el, slantRange float64, pos astro.Position) (distance, bearing float64) {
+	right := haversine.DegToRad(math.Remainder(az-pos.Azimuth, 360)*math.Cos(haversine.DegToRad(pos.Elevation))) * slantRange
+	forward := -haversine.DegToRad(el-pos.Elevation) * slantRange / math.Sin(haversine.DegToRad(math.Max(el, minShiftElevation)))
+	north := forward*math.Cos(haversine.DegToRad(az)) - right*math.Sin(haversine.DegToRad(az))
+	east := forward*math.Sin(haversine.DegToRad(az)) + right*math.Cos(haversine.DegToRad(az))
+	return math.Hypot(north, east), math.Mod(haversine.RadToDeg(math.Atan2(east, north))+360, 360)
+}
+
+// look returns the look angles of the aircraft from the observer at t, extrapolating its last state vector.
+func look(obs Observer, state *model.Flight, t time.Time) (azimuth, elevation, slantRange float64) {
+	seen := t
+	if state.TimePosition > 0 {
+		seen = time.Unix(int64(state.TimePosition), 0)
+	}
+	dt := t.Sub(seen).Seconds()
+	lat, lon := haversine.Destination(state.Latitude, state.Longitude, state.TrueTrack, state.Velocity*dt/1000)
+	alt := state.GeometricAltitude() + state.VerticalRate*dt
+	return haversine.LookAngles(obs.Latitude, obs.Longitude, obs.Altitude, lat, lon, alt)
+}
@@ -0,0 +1,111 @@
+package transit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/astro"
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/haversine"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crossing returns the state, at at, of an aircraft flying east 10 km above the observer
+// that is in front of the sun after a minute, offset north by offset meters.
+func crossing(obs Observer, at time.Time, offset float64) model.Flight {
+	sun := astro.Sun(at.Add(time.Minute), obs.Latitude, obs.Longitude, obs.Altitude)
+	height := 10000.0
+	distance := height / math.Tan(haversine.DegToRad(sun.Elevation))
+	var lat, lon float64
+	for range 3 { // correcting for the curvature of the earth
+		lat, lon = haversine.Destination(obs.Latitude, obs.Longitude, sun.Azimuth, distance/1000)
+		_, el, _ := haversine.LookAngles(obs.Latitude, obs.Longitude, obs.Altitude, lat, lon, obs.Altitude+height)
+		distance *= math.Tan(haversine.DegToRad(el)) / math.Tan(haversine.DegToRad(sun.Elevation))
+	}
+	lat, lon = haversine.Destination(lat, lon, 0, offset/1000)
+	startLat, startLon := haversine.Destination(lat, lon, 270, 200*60/1000.0)
+	return model.Flight{
+		Icao24:       "4b1805",
+		Callsign:     "SWR12",
+		TimePosition: int(at.Unix()),
+		Latitude:     startLat,
+		Longitude:    startLon,
+		GeoAltitude:  obs.Altitude + height,
+		Velocity:     200,
+		TrueTrack:    haversine.Bearing(startLat, startLon, lat, lon),
+	}
+}
+
+func TestPredictor_Predict(t *testing.T) {
+	p, err := New(config.TransitConfig{Horizon: 300, MaxSeparation: 30})
+	require.NoError(t, err)
+	obs := Observer{Site: "default", Latitude: 47.3769, Longitude: 8.5417, Altitude: 400}
+	at := time.Date(2024, 6, 20, 10, 0, 0, 0, time.UTC) // the moon is below the horizon
+
+	transits := p.Predict(obs, []model.Flight{crossing(obs, at, 0)}, at)
+	require.Len(t, transits, 1)
+	transit := transits[0]
+	assert.Equal(t, "default", transit.Site)
+	assert.Equal(t, "SWR12", transit.Callsign)
+	assert.Equal(t, model.BodySun, transit.Body)
+	assert.WithinDuration(t, at.Add(time.Minute), transit.Time, time.Second)
+	assert.Less(t, transit.Separation, 0.5)
+	assert.True(t, transit.Full())
+	assert.InDelta(t, 0.6, transit.Duration, 0.2, "about half a degree at 50 arcminutes per second")
+	assert.InDelta(t, 10000/math.Sin(haversine.DegToRad(transit.Elevation)), transit.SlantRange, 100)
+	assert.Less(t, transit.ShiftDistance, 5.0)
+
+	// 100 m to the north the aircraft passes next to the disk
+	transits = p.Predict(obs, []model.Flight{crossing(obs, at, 100)}, at)
+	require.Len(t, transits, 1)
+	assert.False(t, transits[0].Full())
+	assert.Zero(t, transits[0].Duration)
+	assert.InDelta(t, 28, transits[0].Separation, 1)
+	assert.InDelta(t, 100, transits[0].ShiftDistance, 5, "moving as much as the aircraft is off")
+	assert.Equal(t, "N", model.CompassPoint(transits[0].ShiftBearing))
+
+	// Too far from the disk, on the ground, or crossing after the horizon
+	onGround := crossing(obs, at, 0)
+	onGround.OnGround = true
+	assert.Empty(t, p.Predict(obs, []model.Flight{crossing(obs, at, 3000), onGround}, at))
+	short, err := New(config.TransitConfig{Horizon: 30, MaxSeparation: 30})
+	require.NoError(t, err)
+	assert.Empty(t, short.Predict(obs, []model.Flight{crossing(obs, at, 0)}, at))
+
+	// At night only the moon can be crossed
+	assert.Empty(t, p.Predict(obs, []model.Flight{crossing(obs, at, 0)}, at.Add(12*time.Hour)))
+}
+
+func TestGroundShift(t *testing.T) {
+	sun := astro.Position{Azimuth: 180, Elevation: 45}
+
+	// Above the sun, the aircraft is lowered by stepping back from it
+	distance, bearing := groundShift(180, 45+10.0/60, 10000, sun)
+	assert.InDelta(t, 41.1, distance, 0.1)
+	assert.InDelta(t, 0, bearing, 0.1)
+
+	// Facing south, an aircraft to the right of the sun is reached moving right, west
+	distance, bearing = groundShift(180.2, 45, 10000, sun)
+	assert.InDelta(t, 24.7, distance, 0.1)
+	assert.InDelta(t, 270.2, bearing, 0.1)
+
+	// Down to the horizon, below the sun low in the sky, the shift stays finite
+	low := astro.Position{Azimuth: 270, Elevation: 1}
+	for _, el := range []float64{0, 0.5, -0.1} {
+		distance, bearing = groundShift(270, el, 30000, low)
+		assert.False(t, math.IsNaN(distance) || math.IsInf(distance, 0), "elevation %v", el)
+		assert.InDelta(t, 270, bearing, 0.1, "elevation %v", el)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(config.TransitConfig{Horizon: 0, MaxSeparation: 30})
+	assert.Error(t, err)
+	_, err = New(config.TransitConfig{Horizon: 7200, MaxSeparation: 30})
+	assert.Error(t, err)
+	_, err = New(config.TransitConfig{Horizon: 300, MaxSeparation: 0})
+	assert.Error(t, err)
+}
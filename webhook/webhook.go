@@ -0,0 +1,323 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/carlo-colombo/sopra/storage"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, prefixed by "sha256=".
+	SignatureHeader = "X-Sopra-Signature-256"
+	// EventHeader carries the event type.
+	EventHeader = "X-Sopra-Event"
+	// DeliveryHeader carries the delivery ID, stable across retries.
+	DeliveryHeader = "X-Sopra-Delivery"
+
+	defaultMaxAttempts = 8
+	retryBase          = 30 * time.Second
+	retryMax           = time.Hour
+	pollInterval       = 5 * time.Second
+	batchSize          = 50
+)
+
+// Webhook is a configured endpoint with its parsed body template.
+type Webhook struct {
+	config.WebhookConfig
+	template *template.Template
+}
+
+// TemplateData is what webhook body templates are rendered from.
+type TemplateData struct {
+	Type       events.Type
+	Time       time.Time
+	Site       string
+	Flight     *model.FlightInfo
+	Sighting   *model.Sighting
+	Operator   string
+	Rule       string
+	Severity   string
+	Alert      *model.SquawkAlert
+	Transit    *model.Transit
+	Prediction *model.Prediction
+}
+
+// Dispatcher queues the events matching the webhooks in the database and delivers them,
+// retrying failed deliveries with exponential back off.
+type Dispatcher struct {
+	db     storage.WebhookDeliveries
+	hooks  []*Webhook
+	client *http.Client
+	now    func() time.Time
+	queued chan struct{} // wakes up the delivery loop when deliveries are queued
+}
+
+// New creates a Dispatcher for the configured webhooks.
+func New(cfgs []config.WebhookConfig, db storage.WebhookDeliveries) (*Dispatcher, error) {
+	d := &Dispatcher{
+		db:     db,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+		queued: make(chan struct{}, 1),
+	}
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || cfg.URL == "" {
+			return nil, fmt.Errorf("every webhook needs a name and a url")
+		}
+		if slices.ContainsFunc(d.hooks, func(h *Webhook) bool { return h.Name == cfg.Name }) {
+			return nil, fmt.Errorf("duplicate webhook name %q", cfg.Name)
+		}
+		if cfg.MaxAttempts <= 0 {
+			cfg.MaxAttempts = defaultMaxAttempts
+		}
+		hook := &Webhook{WebhookConfig: cfg}
+		if cfg.Template != "" {
+			tmpl, err := template.New(cfg.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(cfg.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template of webhook %s: %w", cfg.Name, err)
+			}
+			hook.template = tmpl
+		}
+		d.hooks = append(d.hooks, hook)
+	}
+	return d, nil
+}
+
+// Enabled reports whether any webhook is configured.
+func (d *Dispatcher) Enabled() bool {
+	return len(d.hooks) > 0
+}
+
+// Run queues the received events until ctx is canceled, while the due deliveries are attempted in the background,
+// so that a slow endpoint does not hold up the events. Events already received when ctx is canceled are queued,
+// to be delivered after a restart.
+func (d *Dispatcher) Run(ctx context.Context, received <-chan events.Event) error {
+	ctx, cancel := context.WithCancel(ctx)
+	delivering := make(chan struct{})
+	go func() {
+		defer close(delivering)
+		d.deliver(ctx)
+	}()
+	defer func() { <-delivering }()
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e, ok := <-received:
+					if !ok {
+						return nil
+					}
+					d.enqueueOrLog(e)
+				default:
+					return nil
+				}
+			}
+		case e, ok := <-received:
+			if !ok {
+				return nil
+			}
+			d.enqueueOrLog(e)
+		}
+	}
+}
+
+// deliver attempts the due deliveries as soon as deliveries are queued, and every pollInterval for the retries,
+// until ctx is canceled.
+func (d *Dispatcher) deliver(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.queued:
+		case <-ticker.C:
+		}
+		d.DeliverDue(ctx)
+	}
+}
+
+func (d *Dispatcher) enqueueOrLog(e events.Event) {
+	if err := d.Enqueue(e); err != nil {
+		log.Printf("Error queueing webhooks for event %d: %v", e.ID, err)
+	}
+}
+
+// Enqueue renders the event for each webhook subscribed to its type and queues the deliveries. A webhook failing
+// to render or queue the event does not keep it from the others, its error is returned with theirs.
+func (d *Dispatcher) Enqueue(e events.Event) error {
+	var errs []error
+	for _, hook := range d.hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, string(e.Type)) {
+			continue
+		}
+		body, err := hook.render(e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to render webhook %s: %w", hook.Name, err))
+			continue
+		}
+		now := d.now().UTC()
+		delivery := &model.WebhookDelivery{
+			Webhook:     hook.Name,
+			EventType:   string(e.Type),
+			Body:        body,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		if err := d.db.EnqueueWebhookDelivery(delivery); err != nil {
+			errs = append(errs, fmt.Errorf("failed to queue webhook %s: %w", hook.Name, err))
+			continue
+		}
+		select {
+		case d.queued <- struct{}{}:
+		default:
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeliverDue attempts the deliveries that are due. It returns the number of successful deliveries.
+func (d *Dispatcher) DeliverDue(ctx context.Context) int {
+	due, err := d.db.GetDueWebhookDeliveries(d.now().UTC(), batchSize)
+	if err != nil {
+		log.Printf("Error getting due webhook deliveries: %v", err)
+		return 0
+	}
+
+	delivered := 0
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			// Stopping: the rest are attempted after a restart
+			break
+		}
+		hook := d.hook(delivery.Webhook)
+		if hook == nil {
+			// The webhook was removed from the configuration
+			if err := d.db.MarkWebhookFailed(delivery.ID, delivery.Attempts, delivery.NextAttempt, "webhook not configured", true); err != nil {
+				log.Printf("Error updating webhook delivery %d: %v", delivery.ID, err)
+			}
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		start := time.Now()
+		err := d.send(ctx, hook, delivery)
+		now := d.now().UTC()
+		if err == nil {
+			delivered++
+			log.Printf("Delivered webhook %s (delivery %d) in %s", hook.Name, delivery.ID, time.Since(start))
+			err = d.db.MarkWebhookDelivered(delivery.ID, attempts, now)
+		} else {
+			dead := attempts >= hook.MaxAttempts
+			log.Printf("Webhook %s (delivery %d) attempt %d failed: %v. Dead: %t", hook.Name, delivery.ID, attempts, err, dead)
+			err = d.db.MarkWebhookFailed(delivery.ID, attempts, now.Add(backoff(attempts)), err.Error(), dead)
+		}
+		if err != nil {
+			log.Printf("Error updating webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return delivered
+}
+
+func (d *Dispatcher) hook(name string) *Webhook {
+	for _, h := range d.hooks {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// send POSTs a delivery, failing on any status other than 2xx.
+func (d *Dispatcher) send(ctx context.Context, hook *Webhook, delivery *model.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewBufferString(delivery.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, []byte(delivery.Body)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of a body: "sha256=" followed by the hex HMAC-SHA256.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the delay after a failed attempt: 30 seconds, doubling at each attempt up to an hour.
+func backoff(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMax)
+}
+
+// render returns the body of the webhook for an event.
+func (h *Webhook) render(e events.Event) (string, error) {
+	if h.template == nil {
+		return toJSON(e)
+	}
+	var buf bytes.Buffer
+	err := h.template.Execute(&buf, TemplateData{
+		Type:       e.Type,
+		Time:       e.Time,
+		Site:       e.Site,
+		Flight:     e.Flight,
+		Sighting:   e.Sighting,
+		Operator:   e.Operator,
+		Rule:       e.Rule,
+		Severity:   e.Severity,
+		Alert:      e.Alert,
+		Transit:    e.Transit,
+		Prediction: e.Prediction,
+	})
+	return buf.String(), err
+}
+
+// toJSON marshals v, to embed values in JSON templates.
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,234 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlo-colombo/sopra/config"
+	"github.com/carlo-colombo/sopra/events"
+	"github.com/carlo-colombo/sopra/memory"
+	"github.com/carlo-colombo/sopra/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is an httptest server recording the requests and replying with the scripted statuses.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, string(body))
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func newTestDB(t *testing.T) *memory.Store {
+	t.Helper()
+	return memory.New()
+}
+
+func enteredEvent() events.Event {
+	return events.Event{
+		ID:     1,
+		Type:   events.AircraftEntered,
+		Time:   time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC),
+		Site:   "home",
+		Flight: &model.FlightInfo{Ident: "EZY123", Destination: model.AirportDetail{City: "London"}},
+	}
+}
+
+func TestDeliver_TemplateAndSignature(t *testing.T) {
+	rcv := newReceiver(t)
+	db := newTestDB(t)
+	d, err := New([]config.WebhookConfig{{
+		Name:     "notify",
+		URL:      rcv.URL,
+		Headers:  map[string]string{"X-Api-Key": "key"},
+		Events:   []string{string(events.AircraftEntered)},
+		Template: `{"text": {{ printf "%s to %s over %s" .Flight.Ident .Flight.Destination.City .Site | json }}}`,
+		Secret:   "shh",
+	}}, db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.Enqueue(enteredEvent()))
+	left := enteredEvent()
+	left.Type = events.AircraftLeft
+	assert.NoError(t, d.Enqueue(left)) // not subscribed
+
+	assert.Equal(t, 1, d.DeliverDue(context.Background()))
+	assert.Len(t, rcv.requests, 1)
+	body := `{"text": "EZY123 to London over home"}`
+	assert.Equal(t, body, rcv.bodies[0])
+	req := rcv.requests[0]
+	assert.Equal(t, "key", req.Header.Get("X-Api-Key"))
+	assert.Equal(t, "aircraft_entered", req.Header.Get(EventHeader))
+	assert.NotEmpty(t, req.Header.Get(DeliveryHeader))
+	assert.Equal(t, Sign("shh", []byte(body)), req.Header.Get(SignatureHeader))
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", req.Header.Get(SignatureHeader))
+
+	// Delivered deliveries are not sent again
+	assert.Equal(t, 0, d.DeliverDue(context.Background()))
+}
+
+func TestDeliver_DefaultBody(t *testing.T) {
+	rcv := newReceiver(t)
+	d, err := New([]config.WebhookConfig{{Name: "all", URL: rcv.URL}}, newTestDB(t))
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.Enqueue(enteredEvent()))
+	assert.Equal(t, 1, d.DeliverDue(context.Background()))
+	assert.Contains(t, rcv.bodies[0], `"type":"aircraft_entered"`)
+	assert.Contains(t, rcv.bodies[0], `"site":"home"`)
+	assert.Empty(t, rcv.requests[0].Header.Get(SignatureHeader))
+}
+
+func TestDeliver_RetryAndDeadLetter(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK)
+	db := newTestDB(t)
+	d, err := New([]config.WebhookConfig{{Name: "flaky", URL: rcv.URL, MaxAttempts: 3}}, db)
+	assert.NoError(t, err)
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	assert.NoError(t, d.Enqueue(enteredEvent()))
+	assert.Equal(t, 0, d.DeliverDue(context.Background()))
+
+	// Not retried before the back off
+	now = now.Add(29 * time.Second)
+	assert.Equal(t, 0, d.DeliverDue(context.Background()))
+	assert.Len(t, rcv.requests, 1)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, 0, d.DeliverDue(context.Background()))
+	assert.Len(t, rcv.requests, 2)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 0, d.DeliverDue(context.Background()))
+	assert.Len(t, rcv.requests, 3)
+	assert.Equal(t, rcv.requests[0].Header.Get(DeliveryHeader), rcv.requests[2].Header.Get(DeliveryHeader))
+
+	dead, err := db.GetDeadWebhookDeliveries(10)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "unexpected status: 503 Service Unavailable", dead[0].LastError)
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, 0, d.DeliverDue(context.Background()))
+
+	// A requeued dead letter is delivered again
+	requeued, err := db.RequeueWebhookDelivery(dead[0].ID, now)
+	assert.NoError(t, err)
+	assert.True(t, requeued)
+	assert.Equal(t, 1, d.DeliverDue(context.Background()))
+	assert.Len(t, rcv.requests, 4)
+}
+
+func TestRun_DeliversPublishedEvents(t *testing.T) {
+	rcv := newReceiver(t)
+	d, err := New([]config.WebhookConfig{{Name: "all", URL: rcv.URL}}, newTestDB(t))
+	assert.NoError(t, err)
+
+	bus := events.NewBus(0)
+	sub := bus.Subscribe(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx, sub.C) }()
+
+	bus.Publish(enteredEvent())
+	assert.Eventually(t, func() bool {
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		return len(rcv.requests) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestRun_SlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { once.Do(func() { close(release) }) })
+
+	db := newTestDB(t)
+	d, err := New([]config.WebhookConfig{{Name: "slow", URL: slow.URL}}, db)
+	assert.NoError(t, err)
+	bus := events.NewBus(0)
+	sub := bus.Subscribe(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx, sub.C) }()
+
+	// The events are queued while the first delivery waits for the endpoint
+	for range 3 {
+		bus.Publish(enteredEvent())
+	}
+	assert.Eventually(t, func() bool {
+		due, err := db.GetDueWebhookDeliveries(time.Now().Add(time.Minute), 10)
+		return err == nil && len(due) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	once.Do(func() { close(release) })
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestEnqueue_FailingWebhook(t *testing.T) {
+	db := newTestDB(t)
+	d, err := New([]config.WebhookConfig{
+		{Name: "broken", URL: "http://x", Template: `{{ .Flight.Destination.Nope }}`},
+		{Name: "ok", URL: "http://y"},
+	}, db)
+	assert.NoError(t, err)
+
+	// The webhook failing to render does not keep the event from the other
+	err = d.Enqueue(enteredEvent())
+	assert.ErrorContains(t, err, "broken")
+	due, err := db.GetDueWebhookDeliveries(time.Now().Add(time.Minute), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, due, 1) {
+		assert.Equal(t, "ok", due[0].Webhook)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New([]config.WebhookConfig{{Name: "a"}}, nil)
+	assert.Error(t, err)
+	_, err = New([]config.WebhookConfig{{Name: "a", URL: "http://x"}, {Name: "a", URL: "http://y"}}, nil)
+	assert.Error(t, err)
+	_, err = New([]config.WebhookConfig{{Name: "a", URL: "http://x", Template: "{{ .Flight"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, time.Minute, backoff(2))
+	assert.Equal(t, 4*time.Minute, backoff(4))
+	assert.Equal(t, time.Hour, backoff(20))
+}